@@ -1,13 +1,11 @@
 package cmd
 
 import (
-	"fmt"
 	"net/url"
-	"os"
 
 	"github.com/shric/trpc/internal/fileutils"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/config"
 )
 
@@ -30,8 +28,8 @@ func Add(c *Command) {
 	var dummyID int64
 
 	if len(opts.Positional.Files) == 0 {
-		fmt.Fprintln(os.Stderr, "Please supply at least one file or URL")
-		os.Exit(1)
+		c.errorf("Please supply at least one file or URL")
+		return
 	}
 
 	conf := config.ReadConfig()
@@ -40,11 +38,11 @@ func Add(c *Command) {
 	}
 
 	for _, arg := range opts.Positional.Files {
-		var torrent *transmissionrpc.Torrent
+		var torrent *backend.Torrent
 
 		url, err := url.Parse(arg)
 
-		payload := transmissionrpc.TorrentAddPayload{
+		payload := backend.TorrentAddPayload{
 			Paused: &opts.Paused,
 		}
 
@@ -55,9 +53,9 @@ func Add(c *Command) {
 
 		// Assume it's a file.
 		if err != nil || url.Scheme == "" {
-			b64, err := transmissionrpc.File2Base64(arg)
+			b64, err := fileutils.Base64(arg)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "can't encode '%s' content as base64: %v", arg, err)
+				c.errorf("can't encode '%s' content as base64: %v", arg, err)
 				return
 			}
 
@@ -73,14 +71,14 @@ func Add(c *Command) {
 			// Fill it with something for dry-run
 			dummyID = 0
 			argCopy = arg
-			torrent = &transmissionrpc.Torrent{
+			torrent = &backend.Torrent{
 				ID:   &dummyID,
 				Name: &argCopy}
 		}
 
 		if err != nil {
-			fmt.Println("Add: err: ", err)
-			os.Exit(1)
+			c.errorf("Add: err: %v", err)
+			return
 		} else {
 			c.status("Added torrent with ID", torrent)
 		}
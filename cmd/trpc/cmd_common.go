@@ -1,19 +1,31 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 
-	"github.com/hekmon/transmissionrpc"
 	"github.com/jessevdk/go-flags"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/client"
+	"github.com/shric/trpc/internal/config"
+	"github.com/shric/trpc/internal/util"
 )
 
 // CommonOptions declares command line arguments that apply to all or most
 // subcommands. It still needs to be explicitly included.
 type commonOptions struct {
-	DryRun bool `short:"n" long:"dry-run" description:"Dry run -- don't talk to the client, just print what would happen"`
-	Debug  bool `short:"D" long:"debug" description:"Debug -- output the reply from server to stderr"`
+	DryRun      bool   `short:"n" long:"dry-run" description:"Dry run -- don't talk to the client, just print what would happen"`
+	Debug       bool   `short:"D" long:"debug" description:"Debug -- output the reply from server to stderr"`
+	Profile     string `long:"profile" description:"Connection profile(s) from ~/.trpc.conf, comma separated (default: default_profile setting)"`
+	AllProfiles bool   `long:"all-profiles" description:"Run the command against every profile in ~/.trpc.conf"`
+	Host        string `long:"host" description:"Connect to host[:port] or an http(s):// URL, overriding the profile and TR_HOST"`
+	Color       string `long:"color" default:"auto" description:"Colour output: auto (on a terminal unless NO_COLOR is set), always or never" choice:"auto" choice:"always" choice:"never"`
+	Output      string `long:"output" description:"Machine readable output (list, files, info, errors and which)" choice:"json" choice:"ndjson" choice:"csv" choice:"tsv"`
 }
 
 // torrentOptions declares the positional command line argument for specifying 0 or more torrents.
@@ -23,6 +35,21 @@ type torrentOptions struct {
 	} `positional-args:"true"`
 }
 
+// sortOptions declares the command line arguments for sorting torrents.
+type sortOptions struct {
+	Sort    string `long:"sort" description:"sort by comma separated filter variables or expressions, - for descending, e.g. tracker,-ratio,name" unquote:"false"`
+	Reverse bool   `short:"r" long:"reverse" description:"reverse sort order"`
+}
+
+// sortField returns the sort keys for util.ProcessTorrents, nil if none.
+func (o sortOptions) sortField() *string {
+	if o.Sort == "" {
+		return nil
+	}
+
+	return &o.Sort
+}
+
 // fileOptions declares the positional command line argument for specifying 0 or more filenames.
 type fileOptions struct {
 	Pos struct {
@@ -31,36 +58,69 @@ type fileOptions struct {
 }
 
 type options struct {
-	Common  commonOptions `group:"global options"`
-	Add     addOptions    `command:"add" alias:"a" description:"Add torrents"`
-	Errors  errorsOptions `command:"errors" alias:"e" description:"Show torrent error strings"`
-	Files   filesOptions  `command:"files" alias:"f" description:"Show file info for torrents"`
-	Fset    fsetOptions   `command:"fset" alias:"f" description:"Set file priority/get status"`
-	Info    infoOptions   `command:"info" alias:"i" description:"Show torrent or session info"`
-	List    listOptions   `command:"list" alias:"l" description:"List torrents"`
-	Move    moveOptions   `command:"move" alias:"mv" description:"Move torrent to another location"`
-	Rename  renameOptions `command:"rename" description:"Rename torrent file"`
-	Rm      rmOptions     `command:"rm" alias:"r" description:"Remove torrents"`
-	Set     setOptions    `command:"set" description:"Set torrent priorities/speeds or session speeds"`
-	Start   startOptions  `command:"start" description:"Start torrents"`
-	Stop    stopOptions   `command:"stop" description:"Start torrents"`
-	Verify  verifyOptions `command:"verify" alias:"hash" description:"Verify torrents (hash check)"`
-	Watch   watchOptions  `command:"watch" description:"Watch progress for torrents"`
-	Which   whichOptions  `command:"which" description:"Identify which file/path a torrent belongs to"`
-	Version struct{}      `command:"version" description:"Print version"`
+	Common   commonOptions   `group:"global options"`
+	Add      addOptions      `command:"add" alias:"a" description:"Add torrents"`
+	Errors   errorsOptions   `command:"errors" alias:"e" description:"Show torrent error strings"`
+	Files    filesOptions    `command:"files" alias:"f" description:"Show file info for torrents"`
+	Filters  filtersOptions  `command:"filters" description:"List and check the named filters of ~/.trpc.conf"`
+	Fset     fsetOptions     `command:"fset" alias:"f" description:"Set file priority/get status"`
+	Info     infoOptions     `command:"info" alias:"i" description:"Show torrent info"`
+	List     listOptions     `command:"list" alias:"l" description:"List torrents"`
+	Move     moveOptions     `command:"move" alias:"mv" description:"Move torrent to another location"`
+	Peers    peersOptions    `command:"peers" description:"List the peers of torrents, or the top clients, countries or peers"`
+	Rename   renameOptions   `command:"rename" description:"Rename torrent file"`
+	Rm       rmOptions       `command:"rm" alias:"r" description:"Remove torrents"`
+	Session  sessionOptions  `command:"session" subcommands-optional:"true" description:"Show session settings and statistics"`
+	Set      setOptions      `command:"set" description:"Set torrent priorities/speeds or session speeds"`
+	Start    startOptions    `command:"start" description:"Start torrents"`
+	Stop     stopOptions     `command:"stop" description:"Start torrents"`
+	Trackers trackersOptions `command:"trackers" description:"List the trackers of torrents, or add, remove or replace their announce URLs"`
+	Turtle   turtleOptions   `command:"turtle" description:"Turn the alternative speed limits (turtle mode) on or off, or show them"`
+	Verify   verifyOptions   `command:"verify" alias:"hash" description:"Verify torrents (hash check)"`
+	Watch    watchOptions    `command:"watch" description:"Watch progress for torrents"`
+	Which    whichOptions    `command:"which" description:"Identify which file/path a torrent belongs to"`
+	Version  struct{}        `command:"version" description:"Print version"`
 }
 
 // CommandInstance is the data specific to one command.
 type CommandInstance struct {
 	Options interface{}
 	Runner  func(c *Command)
+	// Merge, if set, is called once a command has been run against several
+	// daemons, e.g. to print overall totals to out. Commands that failed to
+	// connect have a nil Client.
+	Merge func(out io.Writer, commands []*Command) error
+	// SingleDaemon marks commands that can't be run against several daemons at once.
+	SingleDaemon bool
+	// Records marks commands that support --output.
+	Records bool
+	// Local marks commands that don't talk to a daemon.
+	Local bool
+	// ChecksConfig marks commands that report the wrong entries of
+	// ~/.trpc.conf themselves.
+	ChecksConfig bool
+	// Prepare, if set, is called once before the command is run against any
+	// daemon, e.g. to read stdin that all of them need.
+	Prepare func(c *Command) error
 }
 
 // Command holds everything needed to run a command.
 type Command struct {
 	PositionalArgs []string
 	CommonOptions  commonOptions
-	Client         *transmissionrpc.Client
+	Client         backend.Backend
+	// Daemon is the profile name of the daemon the command is run against.
+	Daemon string
+	// Out and Err are where the command writes its output and errors.
+	Out io.Writer
+	Err io.Writer
+	// Result is anything a command wants to hand to its Merge function.
+	Result interface{}
+	// records is where the command writes with --output, nil without.
+	records *recordWriter
+	// display describes where Out goes.
+	display display
+	failed  bool
 	CommandInstance
 }
 
@@ -69,48 +129,277 @@ var commonArgs = [...]string{
 	"rateUpload", "eta", "id", "leftUntilDone", "recheckProgress", "error",
 	"rateDownload", "status", "trackers", "bandwidthPriority", "uploadedEver",
 	"downloadDir", "addedDate", "doneDate", "startDate", "isFinished",
-	"errorString", "peersGettingFromUs", "peersSendingToUs",
+	"errorString", "peersGettingFromUs", "peersSendingToUs", "hashString",
 }
 
-// Run parses flags.
+// selectProfiles returns the connection profiles selected on the command line.
+func selectProfiles(opts commonOptions, conf *config.Config) ([]*config.Profile, error) {
+	var names []string
+
+	switch {
+	case opts.AllProfiles:
+		if conf == nil || len(conf.Profiles) == 0 {
+			return nil, fmt.Errorf("--all-profiles given but no profiles are defined in ~/.trpc.conf")
+		}
+
+		for name := range conf.Profiles {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+	case opts.Profile != "":
+		names = strings.Split(opts.Profile, ",")
+	default:
+		names = []string{""}
+	}
+
+	result := make([]*config.Profile, 0, len(names))
+
+	for _, name := range names {
+		profile, err := conf.Profile(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, profile)
+	}
+
+	return result, nil
+}
+
+// Run parses flags and runs the command line of the process.
 func Run() {
-	var args = new(options)
+	os.Exit(Main(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	p := flags.NewParser(args, flags.Default)
-	_, err := p.Parse()
+// Main runs the trpc command line args, writing to stdout and stderr, and
+// returns the exit status.
+func Main(args []string, stdout, stderr io.Writer) int {
+	var opts = new(options)
 
-	if err != nil {
-		os.Exit(1)
+	p := flags.NewParser(opts, flags.HelpFlag|flags.PassDoubleDash)
+	if _, err := p.ParseArgs(args); err != nil {
+		// Like flags.PrintErrors, but to the given writers.
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			fmt.Fprintln(stdout, err)
+		} else {
+			fmt.Fprintln(stderr, err)
+		}
+
+		return 1
 	}
 
 	commandInstances := map[string]CommandInstance{
-		"add":     {Runner: Add, Options: args.Add},
-		"errors":  {Runner: Errors, Options: args.Errors},
-		"files":   {Runner: Files, Options: args.Files},
-		"fset":    {Runner: Fset, Options: args.Fset},
-		"info":    {Runner: Info, Options: args.Info},
-		"list":    {Runner: List, Options: args.List},
-		"move":    {Runner: Move, Options: args.Move},
-		"rename":  {Runner: Rename, Options: args.Rename},
-		"rm":      {Runner: Rm, Options: args.Rm},
-		"set":     {Runner: Set, Options: args.Set},
-		"start":   {Runner: Start, Options: args.Start},
-		"stop":    {Runner: Stop, Options: args.Stop},
-		"verify":  {Runner: Verify, Options: args.Verify},
-		"version": {Runner: Version, Options: args.Version},
-		"watch":   {Runner: Watch, Options: args.Watch},
-		"which":   {Runner: Which, Options: args.Which},
-	}
-
-	c := client.Connect(args.Common.Debug)
-
-	command := &Command{
-		CommonOptions: args.Common,
-		Client:        c,
-	}
-
-	command.CommandInstance = commandInstances[p.Active.Name]
+		"add":            {Runner: Add, Options: opts.Add},
+		"errors":         {Runner: Errors, Options: opts.Errors, Records: true},
+		"files":          {Runner: Files, Options: opts.Files, Records: true},
+		"filters":        {Runner: Filters, Options: opts.Filters, Local: true, ChecksConfig: true},
+		"fset":           {Runner: Fset, Options: opts.Fset},
+		"info":           {Runner: Info, Options: opts.Info, Records: true},
+		"list":           {Runner: List, Options: opts.List, Merge: ListMerge, Records: true},
+		"move":           {Runner: Move, Options: opts.Move},
+		"peers":          {Runner: Peers, Options: opts.Peers, Records: true},
+		"rename":         {Runner: Rename, Options: opts.Rename},
+		"rm":             {Runner: Rm, Options: opts.Rm},
+		"session":        {Runner: Session, Options: opts.Session, Records: true},
+		"session set":    {Runner: SessionSet, Options: opts.Session.Set},
+		"session export": {Runner: SessionExport, Options: opts.Session.Export, SingleDaemon: true},
+		"session import": {Runner: SessionImport, Options: opts.Session.Import, Prepare: SessionImportRead},
+		"set":            {Runner: Set, Options: opts.Set},
+		"start":          {Runner: Start, Options: opts.Start},
+		"stop":           {Runner: Stop, Options: opts.Stop},
+		"trackers":       {Runner: Trackers, Options: opts.Trackers, Records: true},
+		"turtle":         {Runner: Turtle, Options: opts.Turtle},
+		"verify":         {Runner: Verify, Options: opts.Verify},
+		"version":        {Runner: Version, Options: opts.Version},
+		"watch":          {Runner: Watch, Options: opts.Watch, SingleDaemon: true},
+		"which":          {Runner: Which, Options: opts.Which, Records: true},
+	}
+
+	// Subcommands are named after their command, e.g. "session set".
+	name := p.Active.Name
+	if p.Active.Active != nil {
+		name += " " + p.Active.Active.Name
+	}
+
+	instance := commandInstances[name]
+
+	// Commands read the config as they go, its mistakes are only told once.
+	conf := config.ReadConfig()
+	if conf != nil && !instance.ChecksConfig {
+		for _, err := range conf.Errors {
+			fmt.Fprintln(stderr, err)
+		}
+	}
+
+	profiles, err := selectProfiles(opts.Common, conf)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var records *recordWriter
+
+	if opts.Common.Output != "" {
+		if !instance.Records {
+			fmt.Fprintf(stderr, "--output isn't supported by %s\n", name)
+			return 1
+		}
+
+		records = newRecordWriter(opts.Common.Output, stdout, len(profiles) > 1)
+	}
+
+	base := Command{
+		CommonOptions:   opts.Common,
+		Out:             stdout,
+		Err:             stderr,
+		records:         records,
+		display:         newDisplay(stdout, opts.Common.Color),
+		CommandInstance: instance,
+	}
+
+	if instance.Prepare != nil {
+		if err := instance.Prepare(&base); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	var failed bool
+
+	switch {
+	case instance.Local:
+		command := &base
+		command.Run()
+		failed = command.failed
+	case len(profiles) == 1:
+		failed = runSingle(base, profiles[0])
+	default:
+		if instance.SingleDaemon {
+			fmt.Fprintf(stderr, "%s can only be run against one daemon at a time\n", name)
+			return 1
+		}
+
+		failed = runFanOut(base, profiles)
+	}
+
+	if records != nil {
+		if err := records.close(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	if failed {
+		return 1
+	}
+
+	return 0
+}
+
+// runSingle runs the base command against a single daemon and returns true if
+// it failed.
+func runSingle(base Command, profile *config.Profile) bool {
+	c, err := client.Connect(profile, base.CommonOptions.Host, base.CommonOptions.Debug)
+	if err != nil {
+		fmt.Fprintln(base.Err, "Unable to connect:", err)
+		return true
+	}
+
+	command := &base
+	command.Client = c
+	command.Daemon = profile.Name
 	command.Run()
+
+	return command.failed
+}
+
+// runFanOut runs the base command concurrently against several daemons,
+// prefixing each line of output with the daemon name. Records aren't
+// prefixed, they have a daemon field instead. It returns true if any of them
+// failed.
+func runFanOut(base Command, profiles []*config.Profile) bool {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	commands := make([]*Command, len(profiles))
+
+	for i, profile := range profiles {
+		commands[i] = &Command{Daemon: profile.Name}
+	}
+
+	width := daemonWidth(commands)
+
+	for i, profile := range profiles {
+		prefix := daemonPrefix(profile.Name, width)
+		c := base
+		c.Daemon = profile.Name
+		c.Out = newPrefixWriter(&mu, base.Out, prefix)
+		c.Err = newPrefixWriter(&mu, base.Err, prefix)
+
+		if c.display.width > 0 {
+			c.display.width -= len(prefix)
+		}
+
+		commands[i] = &c
+
+		wg.Add(1)
+
+		go func(c *Command, profile *config.Profile) {
+			defer wg.Done()
+			defer c.Out.(*prefixWriter).Flush()
+			defer c.Err.(*prefixWriter).Flush()
+
+			rpcClient, err := client.Connect(profile, c.CommonOptions.Host, c.CommonOptions.Debug)
+			if err != nil {
+				c.errorf("Unable to connect: %v", err)
+				return
+			}
+
+			c.Client = rpcClient
+			c.Run()
+		}(commands[i], profile)
+	}
+
+	wg.Wait()
+
+	if base.Merge != nil {
+		if err := base.Merge(base.Out, commands); err != nil {
+			fmt.Fprintln(base.Err, err)
+			return true
+		}
+	}
+
+	for _, c := range commands {
+		if c.failed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// overallName labels output lines that combine the results of all daemons.
+const overallName = "total"
+
+// daemonWidth returns the length of the longest daemon name.
+func daemonWidth(commands []*Command) int {
+	width := len(overallName)
+
+	for _, c := range commands {
+		if len(c.Daemon) > width {
+			width = len(c.Daemon)
+		}
+	}
+
+	return width
+}
+
+// daemonPrefix returns the prefix used for output lines of the named daemon.
+func daemonPrefix(name string, width int) string {
+	return fmt.Sprintf("%-*s  ", width, name)
 }
 
 // Run is a simple wrapper to call the runner function of a command.
@@ -118,7 +407,36 @@ func (c *Command) Run() {
 	if c.Runner != nil {
 		c.Runner(c)
 	} else {
-		fmt.Fprintln(os.Stderr, "Fatal internal error: command not implemented")
+		fmt.Fprintln(c.Err, "Fatal internal error: command not implemented")
+		c.failed = true
+	}
+}
+
+// errorf reports an error and marks the command as failed.
+func (c *Command) errorf(format string, a ...interface{}) {
+	fmt.Fprintf(c.Err, format+"\n", a...)
+	c.failed = true
+}
+
+// processFailed reports an error of util.ProcessTorrents and tells if the
+// command has to stop. It carries on when only some of the torrents given
+// weren't found, the others having been processed.
+func (c *Command) processFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	c.errorf("%v", err)
+
+	var notFound *util.NotFoundError
+
+	return !errors.As(err, &notFound)
+}
+
+// record writes a record for --output.
+func (c *Command) record(record interface{}) {
+	if err := c.records.write(c.Daemon, record); err != nil {
+		c.errorf("%v", err)
 	}
 }
 
@@ -128,10 +446,10 @@ func (c *Command) statusf(format string, a ...interface{}) {
 		dryRun = "[dry run] "
 	}
 
-	fmt.Printf(dryRun+format+"\n", a...)
+	fmt.Fprintf(c.Out, dryRun+format+"\n", a...)
 }
 
-func (c *Command) status(msg string, torrent *transmissionrpc.Torrent) {
+func (c *Command) status(msg string, torrent *backend.Torrent) {
 	c.statusf("%s %d: %s", msg, *torrent.ID, *torrent.Name)
 }
 
@@ -0,0 +1,533 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shric/trpc/internal/backend/transmission/transmissiontest"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// dirVar stands for the temporary directory of a test, in arguments and
+// golden files.
+const dirVar = "$DIR"
+
+// fixture describes the state every golden test starts from. Files of the
+// "ubuntu.iso" and "Album" torrents exist on disk, under $DIR/downloads.
+func fixture(s *transmissiontest.Server, dir string) {
+	downloads := filepath.Join(dir, "downloads")
+
+	ubuntu := transmissiontest.NewTorrent(1, "ubuntu.iso").
+		AddFile("ubuntu.iso", 3*GiB, 3*GiB).
+		AddTracker("https://torrent.ubuntu.com/announce")
+	ubuntu["status"] = 6
+	ubuntu["uploadedEver"] = 6 * GiB
+	ubuntu["rateUpload"] = 50 * KiB
+	ubuntu["peersGettingFromUs"] = 2
+	ubuntu["isFinished"] = true
+
+	album := transmissiontest.NewTorrent(2, "Album").
+		AddFile("Album/01 Intro.flac", 10*MiB, 10*MiB).
+		AddFile("Album/02 Song.flac", 20*MiB, 5*MiB).
+		AddTracker("http://tracker.example.org:6969/announce")
+	album["status"] = 4
+	album["rateDownload"] = 100 * KiB
+	album["peersSendingToUs"] = 3
+	album["eta"] = 150
+	album["bandwidthPriority"] = 1
+	album["uploadedEver"] = 3 * MiB
+
+	debian := transmissiontest.NewTorrent(3, "debian.iso").
+		AddFile("debian.iso", 600*MiB, 0).
+		AddTracker("http://bttracker.debian.org:6969/announce")
+	debian["error"] = 2
+	debian["errorString"] = "Tracker gave HTTP response code 404 (Not Found)"
+
+	for _, t := range []transmissiontest.Torrent{ubuntu, album, debian} {
+		t["downloadDir"] = downloads
+	}
+
+	s.Torrents = []transmissiontest.Torrent{ubuntu, album, debian}
+	s.Session["download-dir"] = downloads
+	s.Session["peer-port"] = 51413
+	s.Session["encryption"] = "preferred"
+	s.Session["dht-enabled"] = true
+	s.Session["alt-speed-down"] = 50
+	s.Session["alt-speed-up"] = 20
+	s.Session["alt-speed-enabled"] = false
+	s.Session["alt-speed-time-begin"] = 9 * 60
+	s.Session["alt-speed-time-end"] = 17*60 + 30
+	s.Session["alt-speed-time-day"] = 62
+	s.Session["alt-speed-time-enabled"] = true
+	s.Session["seedRatioLimit"] = 2
+	s.Session["seedRatioLimited"] = true
+	s.Session["download-queue-size"] = 5
+	s.Session["download-queue-enabled"] = true
+	s.Stats["current-stats"] = map[string]interface{}{
+		"uploadedBytes": 1 * GiB, "downloadedBytes": 512 * MiB, "filesAdded": 2, "sessionCount": 1, "secondsActive": 7200,
+	}
+	s.Stats["cumulative-stats"] = map[string]interface{}{
+		"uploadedBytes": 40 * GiB, "downloadedBytes": 10 * GiB, "filesAdded": 31, "sessionCount": 12, "secondsActive": 90 * 86400,
+	}
+	s.FreeSpace = 120 * GiB
+}
+
+// sorted moves the torrents to download dirs whose names don't depend on
+// where the test runs.
+func sorted(s *transmissiontest.Server, _ transmissiontest.Request) {
+	s.Torrent(1)["downloadDir"] = "/data/linux"
+	s.Torrent(2)["downloadDir"] = "/data/music"
+	s.Torrent(3)["downloadDir"] = "/data/linux"
+}
+
+// labelled labels ubuntu.iso and debian.iso "linux", and ubuntu.iso "lts" too.
+func labelled(s *transmissiontest.Server, _ transmissiontest.Request) {
+	s.Torrent(1)["labels"] = []string{"linux", "lts"}
+	s.Torrent(3)["labels"] = []string{"linux"}
+}
+
+// swarm has ubuntu.iso announced and scraped, and connected to two peers.
+func swarm(s *transmissiontest.Server, _ transmissiontest.Request) {
+	ubuntu := s.Torrent(1)
+	ubuntu["comment"] = "Ubuntu CD releases.ubuntu.com"
+	ubuntu["creator"] = "mktorrent 1.1"
+	ubuntu["dateCreated"] = 1599000000
+	ubuntu["activityDate"] = 1600100000
+	ubuntu["secondsSeeding"] = 3 * 86400
+	ubuntu["peersConnected"] = 2
+
+	tracker := ubuntu["trackerStats"].([]interface{})[0].(map[string]interface{})
+	tracker["hasAnnounced"] = true
+	tracker["lastAnnounceTime"] = 1600100000
+	tracker["lastAnnouncePeerCount"] = 50
+	tracker["nextAnnounceTime"] = 1600101800
+	tracker["hasScraped"] = true
+	tracker["lastScrapeTime"] = 1600100000
+	tracker["lastScrapeSucceeded"] = true
+	tracker["seederCount"] = 120
+	tracker["leecherCount"] = 4
+	tracker["downloadCount"] = 3000
+
+	ubuntu["peers"] = []interface{}{
+		map[string]interface{}{
+			"address": "203.0.113.5", "port": 51413, "clientName": "Transmission 4.0.5", "flagStr": "TUEI",
+			"progress": 1, "rateToClient": 0, "rateToPeer": 30 * KiB, "isEncrypted": true, "isUTP": true,
+			"isIncoming": true, "isUploadingTo": true, "clientIsChoked": true,
+		},
+		map[string]interface{}{
+			"address": "198.51.100.7", "port": 6881, "clientName": "qBittorrent 4.6.2", "flagStr": "UE",
+			"progress": 0.25, "rateToClient": 0, "rateToPeer": 20 * KiB, "isEncrypted": true,
+			"isUploadingTo": true, "clientIsChoked": true,
+		},
+	}
+}
+
+// peered adds to swarm two peers of Album, one of which is also a peer of
+// ubuntu.iso.
+func peered(s *transmissiontest.Server, r transmissiontest.Request) {
+	swarm(s, r)
+
+	album := s.Torrent(2)
+	album["peersConnected"] = 2
+	album["peers"] = []interface{}{
+		map[string]interface{}{
+			"address": "203.0.113.5", "port": 51413, "clientName": "Transmission 4.0.5", "flagStr": "DE",
+			"progress": 1, "rateToClient": 60 * KiB, "rateToPeer": 0, "isEncrypted": true,
+			"isDownloadingFrom": true, "clientIsInterested": true,
+		},
+		map[string]interface{}{
+			"address": "192.0.2.44", "port": 6889, "clientName": "Deluge 2.1.1.0", "flagStr": "duT",
+			"progress": 0.6, "rateToClient": 0, "rateToPeer": 0, "isUTP": true, "clientIsInterested": true,
+			"clientIsChoked": true, "peerIsInterested": true, "peerIsChoked": true,
+		},
+	}
+}
+
+// geoipConf points to a GeoIP database of the addresses of the peers of
+// swarm and peered.
+const geoipConf = `
+[settings]
+geoip_database = "$DIR/countries.csv"
+`
+
+// sessionExport is a file for session import, only some settings of which
+// differ from the fixture.
+const sessionExport = `# transmission session settings, for trpc session import
+peer-port = 6881
+dht-enabled = true
+encryption = "required"
+speed-limit-down = 500
+speed-limit-down-enabled = true
+`
+
+const listFormats = `
+[settings]
+default_list_format = "dirs"
+
+[formats]
+short = "{ID:3} {Pct:>3}% {Name}"
+dirs = "{ID:3} {downloadDir} {name}"
+`
+
+const namedFilters = `
+[filters]
+big = "size > 500 MB"
+big-debian = 'any(trackers, "debian") && @big'
+broken = "sise > 1"
+loop = "@loop"
+`
+
+// wrongConf has entries that are skipped, which are only told once.
+const wrongConf = `
+[filters]
+big = "size > 500 MB"
+huge = 5
+
+[formats]
+short = ["{ID}"]
+
+[profiles]
+seedbox = "localhost"
+`
+
+var goldenTests = []struct {
+	name string
+	args []string
+	// conf, if set, is written to ~/.trpc.conf, with $DIR expanded.
+	conf string
+	// script, if set, is run by the fake daemon before each request.
+	script func(s *transmissiontest.Server, r transmissiontest.Request)
+	// terminal, if set, is the width of the terminal stdout pretends to be.
+	terminal int
+}{
+	{name: "add", args: []string{"add", "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=new"}},
+	{name: "add_dry_run", args: []string{"add", "-n", "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=new"}},
+	{name: "add_file", args: []string{"add", "--paused", "-d", "$DIR/elsewhere", "$DIR/new.torrent"}},
+	{name: "add_nothing", args: []string{"add"}},
+	{name: "errors", args: []string{"errors"}},
+	{name: "errors_output", args: []string{"errors", "--output", "ndjson"}},
+	{name: "errors_dry_run", args: []string{"errors", "--dry-run"}},
+	{name: "errors_sort", args: []string{"errors", "--sort=-id"}},
+	{name: "errors_terminal", args: []string{"errors", "--color", "never"}, terminal: 60},
+	{name: "files", args: []string{"files", "2"}},
+	{name: "files_output", args: []string{"files", "--output", "csv", "2"}},
+	{name: "files_terminal", args: []string{"files", "2"}, terminal: 80},
+	{name: "files_filter", args: []string{"files", "-f", "name == \"ubuntu.iso\""}},
+	{name: "files_file_filter", args: []string{"files", "--file-filter", `ext == "flac" && progress < 100`}},
+	{name: "files_file_filter_output", args: []string{"files", "--output", "csv", "--file-filter", "length > 500 MiB"}},
+	{name: "files_sort", args: []string{"files", "--sort=-size", "--file-sort=-length,name"}},
+	{name: "files_file_sort_invalid", args: []string{"files", "--file-sort", "length,ratio"}},
+	{name: "files_file_filter_invalid", args: []string{"files", "--file-filter", "size > 1"}},
+	{name: "fset", args: []string{"fset", "--noget", "$DIR/downloads/Album/02 Song.flac"}},
+	{name: "fset_file_filter", args: []string{"fset", "--noget", "--file-filter", `matches(name, "(?i)song")`}},
+	{name: "fset_file_filter_torrents", args: []string{"fset", "-p", "low", "-c", "--file-filter", "length > 5 MiB"}},
+	{name: "fset_file_filter_path", args: []string{"fset", "-n", "-p", "high", "--file-filter", `startsWith(name, "01")`, "$DIR/downloads/Album"}},
+	{name: "fset_file_filter_none", args: []string{"fset", "--get", "--file-filter", "!wanted"}},
+	{name: "fset_dry_run", args: []string{"fset", "-n", "-p", "high", "$DIR/downloads/Album/01 Intro.flac"}},
+	{name: "info", args: []string{"info", "1"}},
+	{name: "info_output", args: []string{"info", "--output", "json", "2"}},
+	{name: "info_all", args: []string{"info", "--all", "1"}, script: swarm},
+	{name: "info_pieces", args: []string{"info", "--pieces", "2", "3"}},
+	{name: "info_trackers_peers", args: []string{"info", "--trackers", "--peers", "1", "2"}, script: swarm},
+	{name: "info_output_peers", args: []string{"info", "--output", "json", "--peers", "--trackers", "1"}, script: swarm},
+	{name: "list", args: []string{"list"}},
+	{name: "list_dry_run", args: []string{"list", "-n"}},
+	{name: "list_filters", args: []string{"list", "-i", "--no-totals"}},
+	{name: "list_filter_fields", args: []string{"list", "-f", "left > 0 && progress > 10 && !isPrivate && id != 3",
+		"--columns", "id,left,progress,have,hash,name"}},
+	{name: "list_filter_literals", args: []string{"list", "-n", "-f", "size > 100 MiB && addedDate < 2026-01-01 && up < 1 MiB/s"}},
+	{name: "list_filter_invalid", args: []string{"list", "-f", "size > > 1"}},
+	{name: "list_filter_type", args: []string{"list", "-f", `name > 1`}},
+	{name: "list_filter_functions", args: []string{"list", "-n", "-f", `!exists(path) && any(files, "(?i)[.]iso$")`}},
+	{name: "list_filter_arity", args: []string{"list", "-f", `startsWith(name)`}},
+	{name: "list_named", conf: namedFilters, args: []string{"list", "-n", "-F", "big-debian"}},
+	{name: "list_named_ref", conf: namedFilters, args: []string{"list", "-n", "-i", "-f", "@big || id == 1"}},
+	{name: "list_named_broken", conf: namedFilters, args: []string{"list", "-F", "broken"}},
+	{name: "list_named_unknown", conf: namedFilters, args: []string{"list", "-f", "id > 1 && @nope"}},
+	{name: "filters", conf: namedFilters, args: []string{"filters"}},
+	{name: "filters_names", conf: namedFilters, args: []string{"filters", "big", "big-debian"}},
+	{name: "filters_none", args: []string{"filters"}},
+	{name: "filters_invalid", conf: wrongConf, args: []string{"filters"}},
+	{name: "list_wrong_conf", conf: wrongConf, args: []string{"list", "--output", "csv"}},
+	{name: "list_sort", args: []string{"list", "--sort", "name", "-r"}},
+	{name: "list_sort_keys", args: []string{"list", "-n", "--sort", "complete,-size"}},
+	{name: "list_sort_expression", args: []string{"list", "-n", `--sort=-any(trackers, "debian|ubuntu"),name`}},
+	{name: "list_sort_invalid", args: []string{"list", "--sort", "name,-rato"}},
+	{name: "list_group_tracker", args: []string{"list", "--group-by", "tracker"}},
+	{name: "list_group_status", args: []string{"list", "--summary", "--group-by", "status"}},
+	{name: "list_group_dir", args: []string{"list", "--summary", "--group-by", "downloadDir"}, script: sorted},
+	{name: "list_group_label", args: []string{"list", "--summary", "--group-by", "label"}, script: labelled},
+	{name: "list_group_output", args: []string{"list", "--output", "json", "--group-by", "label"}, script: labelled},
+	{name: "list_summary", args: []string{"list", "--summary", "-f", "complete"}},
+	{name: "list_unknown_file", args: []string{"list", "$DIR/nothing"}},
+	{name: "list_some_unknown", args: []string{"list", "1", "$DIR/nothing", "99"}},
+	{name: "start_some_unknown", args: []string{"start", "99", "3"}},
+	{name: "list_columns", args: []string{"list", "--columns", "id,pct,size,status,down,complete,name"}},
+	{name: "list_columns_unknown", args: []string{"list", "--columns", "id,nope"}},
+	{name: "list_format", args: []string{"list", "--format", "{ID:>3} {Name:<12} {size:>10} {tracker}"}},
+	{name: "list_format_both", args: []string{"list", "--format", "{ID}", "--columns", "id"}},
+	{name: "list_format_default", conf: listFormats, args: []string{"list", "-n"}},
+	{name: "list_format_invalid", args: []string{"list", "--format", "{Nope}"}},
+	{name: "list_format_named", conf: listFormats, args: []string{"list", "--format", "short"}},
+	{name: "list_format_unknown", args: []string{"list", "--format", "short"}},
+	{name: "list_terminal", args: []string{"list"}, terminal: 100},
+	{name: "list_terminal_narrow", args: []string{"list", "--color", "never"}, terminal: 72},
+	{name: "list_color_always", args: []string{"list", "--color", "always", "-n"}},
+	{name: "list_output_csv", args: []string{"list", "--output", "csv"}},
+	{name: "list_output_json", args: []string{"list", "--output", "json", "2"}},
+	{name: "list_output_ndjson", args: []string{"list", "--output", "ndjson", "1", "3"}},
+	{name: "list_output_tsv", args: []string{"list", "--output", "tsv", "-f", "name == \"none\""}},
+	{name: "output_unsupported", args: []string{"stop", "--output", "json", "1"}},
+	{name: "move", args: []string{"move", "1", "$DIR/elsewhere"}},
+	{name: "move_dry_run", args: []string{"move", "--dry-run", "--force-all", "$DIR/elsewhere"}},
+	{name: "move_all", args: []string{"move", "$DIR/elsewhere"}},
+	{name: "peers", args: []string{"peers"}, script: peered},
+	{name: "peers_terminal", args: []string{"peers", "--name", "Album"}, script: peered, terminal: 100},
+	{name: "peers_geoip", args: []string{"peers", "1"}, conf: geoipConf, script: peered},
+	{name: "peers_geoip_missing", args: []string{"peers"}, conf: "[settings]\ngeoip_database = \"$DIR/missing.mmdb\"\n"},
+	{name: "peers_output", args: []string{"peers", "--output", "json", "2"}, conf: geoipConf, script: peered},
+	{name: "peers_top_clients", args: []string{"peers", "--top", "clients"}, script: peered},
+	{name: "peers_top_countries", args: []string{"peers", "--top", "countries"}, conf: geoipConf, script: peered},
+	{name: "peers_top_countries_no_database", args: []string{"peers", "--top", "countries"}, script: peered},
+	{name: "peers_top_upload", args: []string{"peers", "--top", "upload"}, conf: geoipConf, script: peered},
+	{name: "peers_top_download", args: []string{"peers", "--top", "download", "--limit", "1"}, script: peered},
+	{name: "peers_top_output", args: []string{"peers", "--top", "clients", "--output", "csv"}, script: peered},
+	{name: "trackers", args: []string{"trackers"}, script: swarm},
+	{name: "trackers_terminal", args: []string{"trackers", "1"}, script: swarm, terminal: 120},
+	{name: "trackers_output", args: []string{"trackers", "--output", "json", "1"}, script: swarm},
+	{name: "trackers_add", args: []string{"trackers", "--add", "https://torrent.ubuntu.com/announce", "--force-all"}},
+	{name: "trackers_add_all", args: []string{"trackers", "--add", "udp://tracker.example.net:1337/announce"}},
+	{name: "trackers_remove", args: []string{"trackers", "--remove", "debian", "--remove", "ubuntu", "2", "3"}},
+	{name: "trackers_replace", args: []string{"trackers", "--replace", `tracker\.example\.org:6969/(.*)`, "--with", "tracker.example.net/$1"}},
+	{name: "trackers_replace_ids", args: []string{"trackers", "1", "2", "--replace", "example", "--with", "new.example"}},
+	{name: "trackers_replace_unknown", args: []string{"trackers", "2", "9", "--replace", "example", "--with", "new.example"}},
+	{name: "trackers_with_alone", args: []string{"trackers", "--with", "new.example", "1"}},
+	{name: "trackers_replace_add", args: []string{"trackers", "--add", "https://tracker.example.net/announce",
+		"--replace", "http://(bt)?tracker.([a-z]+).org:6969", "--with", "https://tracker.example.net", "--force-all"}},
+	{name: "trackers_replace_missing", args: []string{"trackers", "--replace", "example"}},
+	{name: "trackers_dry_run", args: []string{"trackers", "-n", "--replace", "^http:", "--with", "https:", "--name", "debian"}},
+	{name: "trackers_edit_output", args: []string{"trackers", "--output", "csv", "--remove", "example"}},
+	{name: "rename", args: []string{"rename", "$DIR/downloads/Album/01 Intro.flac", "01 Overture.flac"}},
+	{name: "rename_dry_run", args: []string{"rename", "-n", "-t", "1", "$DIR/downloads/ubuntu.iso", "ubuntu-24.04.iso"}},
+	{name: "rm", args: []string{"rm", "3"}},
+	{name: "rm_all", args: []string{"rm"}},
+	{name: "rm_dry_run", args: []string{"rm", "-n", "--nuke", "--force-all", "-c"}},
+	{name: "rm_nuke", args: []string{"rm", "--nuke", "1", "2"}},
+	{name: "session", args: []string{"session"}},
+	{name: "session_output", args: []string{"session", "--output", "json"}},
+	{name: "session_set", args: []string{"session", "set", "peer-port=6881", "download-dir=/data", "dht-enabled=off",
+		"alt-speed-time-begin=08:30", "alt-speed-time-day=Sat,Sun", "encryption=preferred"}},
+	{name: "session_set_dry_run", args: []string{"session", "set", "-n", "speed-limit-up=200", "seedRatioLimit=1.5"}},
+	{name: "session_set_invalid", args: []string{"session", "set", "peer-port=70000"}},
+	{name: "session_set_unknown", args: []string{"session", "set", "peer-prot=1"}},
+	{name: "session_set_read_only", args: []string{"session", "set", "version=5"}},
+	{name: "session_set_no_value", args: []string{"session", "set", "dht-enabled"}},
+	{name: "session_export", args: []string{"session", "export"}},
+	{name: "session_import", args: []string{"session", "import", "$DIR/session.toml"}},
+	{name: "session_import_dry_run", args: []string{"session", "import", "-n", "$DIR/session.toml"}},
+	{name: "session_import_invalid", args: []string{"session", "import", "$DIR/bad-session.toml"}},
+	{name: "session_import_missing", args: []string{"session", "import", "$DIR/missing.toml"}},
+	{name: "turtle", args: []string{"turtle"}},
+	{name: "turtle_on", args: []string{"turtle", "on"}},
+	{name: "turtle_toggle", args: []string{"turtle", "toggle"}},
+	{name: "turtle_limits", args: []string{"turtle", "off", "--up", "30", "--down", "60"}},
+	{name: "turtle_schedule", args: []string{"turtle", "status", "--schedule", "Sat,Sun 22:00-06:30"}},
+	{name: "turtle_schedule_off", args: []string{"turtle", "--schedule", "off"}},
+	{name: "turtle_dry_run", args: []string{"turtle", "-n", "on", "--schedule", "Mon-Fri 09:00-18:00"}},
+	{name: "turtle_schedule_invalid", args: []string{"turtle", "--schedule", "Mon-Fri 9-18"}},
+	{name: "turtle_negative", args: []string{"turtle", "--up", "-5"}},
+	{name: "turtle_invalid", args: []string{"turtle", "sideways"}},
+	{name: "set", args: []string{"set", "--down", "100", "--up", "0", "2"}},
+	{name: "set_dry_run", args: []string{"set", "-n", "--priority", "low", "--force-all"}},
+	{name: "set_nothing", args: []string{"set", "1"}},
+	{name: "set_session", args: []string{"set", "-s", "--up", "50", "--down", "0"}},
+	{name: "set_session_dry_run", args: []string{"set", "--dry-run", "-s", "--up", "50"}},
+	{name: "start", args: []string{"start"}},
+	{name: "start_dry_run", args: []string{"start", "-n", "3"}},
+	{name: "start_now", args: []string{"start", "--now", "3"}},
+	{name: "stop", args: []string{"stop", "1", "2", "3"}},
+	{name: "stop_dry_run", args: []string{"stop", "-n", "-a"}},
+	{name: "unknown_command", args: []string{"frobnicate"}},
+	{name: "verify", args: []string{"verify", "1"}},
+	{name: "verify_all", args: []string{"verify"}},
+	{name: "verify_dry_run", args: []string{"verify", "-n", "--force-all"}},
+	{name: "version", args: []string{"version"}},
+	{
+		name: "watch",
+		args: []string{"watch"},
+		// The album completes once watch has looked at it twice.
+		script: func(s *transmissiontest.Server, r transmissiontest.Request) {
+			if r.Method != "torrent-get" {
+				return
+			}
+
+			album := s.Torrent(2)
+			if album["watched"] == true {
+				album["leftUntilDone"] = 0
+				album["status"] = 6
+			}
+
+			if len(r.Arguments["fields"].([]interface{})) == 6 {
+				album["watched"] = true
+			}
+		},
+	},
+	{name: "watch_sort_invalid", args: []string{"watch", "--sort", "size >"}},
+	{name: "watch_dry_run", args: []string{"watch", "-n", "-c"}},
+	{name: "which", args: []string{"which", "$DIR/downloads/Album/02 Song.flac", "$DIR/downloads/Album", "$DIR/nothing"}},
+	{name: "which_output", args: []string{"which", "--output", "tsv", "$DIR/downloads/Album/02 Song.flac", "$DIR/downloads/Album", "$DIR/nothing"}},
+	{name: "which_missing", args: []string{"which", "--missing", "$DIR/downloads/ubuntu.iso"}},
+}
+
+// testDir creates the directory tree of a golden test. $HOME is set to it so
+// that no ~/.trpc.conf gets in the way.
+func testDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "trpc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"downloads/ubuntu.iso":          "ubuntu",
+		"downloads/Album/01 Intro.flac": "intro",
+		"downloads/Album/02 Song.flac":  "song",
+		"new.torrent":                   "d4:infod4:name3:newee",
+		"session.toml":                  sessionExport,
+		"bad-session.toml":              "encryption = \"sometimes\"\n",
+		"countries.csv":                 "198.51.100.0,198.51.100.255,US\n203.0.113.0,203.0.113.255,NZ\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	home := os.Getenv("HOME")
+
+	os.Setenv("HOME", dir)
+	t.Cleanup(func() { os.Setenv("HOME", home) })
+
+	return dir
+}
+
+// run runs trpc with args against the fake daemon and returns what a golden
+// file holds: the command line, exit status, output and the requests that
+// could have changed something.
+func run(t *testing.T, s *transmissiontest.Server, dir string, args []string) string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = strings.ReplaceAll(arg, dirVar, dir)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	status := Main(append(expanded, "--host", s.RPCURL()), &stdout, &stderr)
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "$ trpc %s\n", strings.Join(quote(args), " "))
+	fmt.Fprintf(&b, "exit status %d\n", status)
+	fmt.Fprintf(&b, "-- stdout --\n%s", stdout.String())
+	fmt.Fprintf(&b, "-- stderr --\n%s", stderr.String())
+	fmt.Fprintf(&b, "-- requests --\n")
+
+	for _, r := range s.Mutations() {
+		fmt.Fprintln(&b, r)
+	}
+
+	return strings.ReplaceAll(b.String(), dir, dirVar)
+}
+
+func quote(args []string) []string {
+	result := make([]string, len(args))
+
+	for i, arg := range args {
+		result[i] = arg
+		if strings.ContainsAny(arg, " \"&?") {
+			result[i] = fmt.Sprintf("'%s'", arg)
+		}
+	}
+
+	return result
+}
+
+// notTerminal is what stdout is in golden tests unless they say otherwise.
+func notTerminal(io.Writer) (int, bool) {
+	return 0, false
+}
+
+func TestGolden(t *testing.T) {
+	os.Unsetenv("TR_HOST")
+	os.Unsetenv("TR_AUTH")
+	os.Unsetenv("NO_COLOR")
+
+	// Dates are shown in local time.
+	time.Local = time.UTC
+	terminalWidth = notTerminal
+
+	for _, tt := range goldenTests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDir(t)
+			s := transmissiontest.NewServer()
+			defer s.Close()
+
+			fixture(s, dir)
+
+			if tt.conf != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, ".trpc.conf"), []byte(strings.ReplaceAll(tt.conf, dirVar, dir)), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s.Script = tt.script
+
+			if tt.terminal != 0 {
+				terminalWidth = func(io.Writer) (int, bool) { return tt.terminal, true }
+				t.Cleanup(func() { terminalWidth = notTerminal })
+			}
+
+			got := run(t, s, dir, tt.args)
+			golden := filepath.Join("testdata", tt.name+".golden")
+
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+
+			if got != string(want) {
+				t.Errorf("output differs from %s:\n--- got\n%s--- want\n%s", golden, got, want)
+			}
+		})
+	}
+}
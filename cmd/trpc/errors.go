@@ -2,9 +2,9 @@ package cmd
 
 import (
 	"fmt"
-	"os"
+	"strconv"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/util"
 )
@@ -12,6 +12,7 @@ import (
 type errorsOptions struct {
 	torrentOptions
 	filter.Options `group:"filters"`
+	sortOptions
 }
 
 // Errors provides a list of all or selected torrents.
@@ -20,13 +21,39 @@ func Errors(c *Command) {
 	optionsCheck(ok)
 
 	if c.CommonOptions.DryRun {
-		fmt.Fprintln(os.Stderr, "--dry-run has no effect on errors as errors doesn't change state")
+		fmt.Fprintln(c.Err, "--dry-run has no effect on errors as errors doesn't change state")
 	}
 
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
-		func(torrent *transmissionrpc.Torrent) {
-			if *torrent.Error != 0 {
-				fmt.Printf("ID: %5d %s:\n\t%s\n", *torrent.ID, *torrent.Name, *torrent.ErrorString)
+	if c.records != nil {
+		c.records.declare(errorRecord{})
+	}
+
+	table := newListTable(c.display, "ID", "Name", "Error")
+
+	err := util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
+		func(torrent *backend.Torrent) {
+			if *torrent.Error == 0 {
+				return
+			}
+
+			if c.records != nil {
+				c.record(errorRecord{
+					ID: *torrent.ID, Name: *torrent.Name, Error: *torrent.Error, ErrorString: *torrent.ErrorString,
+				})
+
+				return
 			}
-		}, nil, false)
+
+			table.add(
+				cell{text: strconv.FormatInt(*torrent.ID, 10), right: true},
+				cell{text: *torrent.Name},
+				cell{text: *torrent.ErrorString, color: colorRed})
+		}, opts.sortField(), opts.Reverse)
+	if c.processFailed(err) {
+		return
+	}
+
+	if err := table.render(c.Out, c.display); err != nil {
+		c.errorf("%v", err)
+	}
 }
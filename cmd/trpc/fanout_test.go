@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shric/trpc/internal/backend/transmission/transmissiontest"
+)
+
+// fanOutConf has two daemons, a and b, and one, down, that can't be reached.
+// $A, $B and $DOWN stand for their host:port.
+const fanOutConf = `
+[settings]
+default_profile = "a"
+
+[profiles.a]
+url = "http://$A/transmission/rpc"
+
+[profiles.b]
+url = "http://$B/transmission/rpc"
+
+[profiles.down]
+url = "http://$DOWN/transmission/rpc"
+`
+
+var fanOutTests = []struct {
+	name string
+	args []string
+}{
+	{name: "fanout_list", args: []string{"list", "--profile", "a,b"}},
+	{name: "fanout_list_all_profiles", args: []string{"list", "--all-profiles"}},
+	{name: "fanout_list_one", args: []string{"list", "--profile", "b,down"}},
+	{name: "fanout_list_summary", args: []string{"list", "--profile", "a,b", "--summary"}},
+	{name: "fanout_list_group_by", args: []string{"list", "--profile", "a,b", "--group-by", "tracker"}},
+	{name: "fanout_list_output", args: []string{"list", "--profile", "a,b", "--output", "csv", "--summary"}},
+	{name: "fanout_errors", args: []string{"errors", "--all-profiles"}},
+	{name: "fanout_stop", args: []string{"stop", "--all-profiles", "2", "3"}},
+	{name: "fanout_single_daemon", args: []string{"session", "export", "--all-profiles"}},
+}
+
+// byDaemon sorts lines of output by the daemon they are prefixed with, or
+// that their record starts with, keeping the order of the lines of each
+// daemon: daemons run concurrently, so their lines interleave at random.
+// Other lines, such as the header of CSV records, come first.
+func byDaemon(output string) string {
+	lines := strings.SplitAfter(output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	daemon := func(line string) string {
+		for _, name := range []string{"a", "b", "down", overallName} {
+			if strings.HasPrefix(line, name+" ") || strings.HasPrefix(line, name+",") {
+				return name
+			}
+		}
+
+		return ""
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return daemon(lines[i]) < daemon(lines[j])
+	})
+
+	return strings.Join(lines, "")
+}
+
+func TestGoldenFanOut(t *testing.T) {
+	time.Local = time.UTC
+	terminalWidth = notTerminal
+
+	for _, tt := range fanOutTests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDir(t)
+
+			a := transmissiontest.NewServer()
+			defer a.Close()
+
+			fixture(a, dir)
+
+			// b only has Album and debian.iso.
+			b := transmissiontest.NewServer()
+			defer b.Close()
+
+			fixture(b, dir)
+			b.Torrents = b.Torrents[1:]
+
+			down := transmissiontest.NewServer()
+			down.Close()
+
+			var hosts []string
+
+			for _, s := range []*transmissiontest.Server{a, b, down} {
+				u, err := url.Parse(s.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				hosts = append(hosts, u.Host)
+			}
+
+			conf := strings.NewReplacer("$A", hosts[0], "$B", hosts[1], "$DOWN", hosts[2]).Replace(fanOutConf)
+
+			if err := ioutil.WriteFile(filepath.Join(dir, ".trpc.conf"), []byte(conf), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+
+			status := Main(tt.args, &stdout, &stderr)
+
+			var sb strings.Builder
+
+			fmt.Fprintf(&sb, "$ trpc %s\n", strings.Join(quote(tt.args), " "))
+			fmt.Fprintf(&sb, "exit status %d\n", status)
+			fmt.Fprintf(&sb, "-- stdout --\n%s", byDaemon(stdout.String()))
+			fmt.Fprintf(&sb, "-- stderr --\n%s", byDaemon(stderr.String()))
+
+			for _, s := range []struct {
+				name   string
+				server *transmissiontest.Server
+			}{{"a", a}, {"b", b}} {
+				fmt.Fprintf(&sb, "-- requests %s --\n", s.name)
+
+				for _, r := range s.server.Mutations() {
+					fmt.Fprintln(&sb, r)
+				}
+			}
+
+			// A port may start with another: longer hosts are replaced first.
+			vars := [][2]string{{hosts[0], "$A"}, {hosts[1], "$B"}, {hosts[2], "$DOWN"}}
+			sort.Slice(vars, func(i, j int) bool { return len(vars[i][0]) > len(vars[j][0]) })
+
+			var pairs []string
+
+			for _, v := range vars {
+				pairs = append(pairs, v[0], v[1])
+			}
+
+			got := strings.NewReplacer(pairs...).Replace(strings.ReplaceAll(sb.String(), dir, dirVar))
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+
+			if got != string(want) {
+				t.Errorf("output differs from %s:\n--- got\n%s--- want\n%s", golden, got, want)
+			}
+		})
+	}
+}
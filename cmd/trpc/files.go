@@ -2,8 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"strconv"
-	"strings"
 
 	"github.com/hekmon/cunits/v2"
 
@@ -14,50 +14,133 @@ import (
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/util"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 )
 
-func fileInfo(t *transmissionrpc.Torrent) string {
-	var s string
+// allFiles returns the indexes of all files of a torrent.
+func allFiles(t *backend.Torrent) []int {
+	files := make([]int, len(t.Files))
+	for i := range files {
+		files[i] = i
+	}
+
+	return files
+}
 
+// fileInfo writes the given files of a torrent as a table under a line naming
+// the torrent.
+func fileInfo(out io.Writer, d display, t *backend.Torrent, files []int) error {
 	result := torrent.NewFrom(t, nil)
 
-	s = pyfmt.Must("{ID}: {Name}:\n", result)
-	formatString := "%3s: %4s %-8s %3s %10s  %s"
-	s += fmt.Sprintf(formatString+"\n",
-		"#", "Done", "Priority", "Get", "Size", "Name")
-
-	for i, f := range t.Files {
-		var get string
-		if t.Wanted[i] {
-			get = "Yes"
-		} else {
-			get = "No "
+	if _, err := io.WriteString(out, pyfmt.Must("{ID}: {Name}:\n", result)); err != nil {
+		return err
+	}
+
+	table := newTable("#", "Done", "Priority", "Get", "Size", "Name")
+	table.seps[0] = "  "
+	table.seps[1] = ": "
+	table.seps[2] = " "
+	table.seps[3] = " "
+	table.seps[4] = " "
+
+	for _, i := range files {
+		f := t.Files[i]
+		get, color := "Yes", ""
+		if !t.Wanted[i] {
+			get, color = "No", colorGrey
 		}
 
-		s += fmt.Sprintf(formatString+"\n",
-			strconv.Itoa(i),
-			strconv.FormatInt(int64(100.0*torrent.FileProgress(t, int64(i))), 10)+"%",
-			torrent.FilePriority(t, int64(i)),
-			get,
-			cunits.ImportInByte(float64(f.Length)).GetHumanSizeRepresentation(),
-			strings.Replace(f.Name, *t.Name+"/", "", 1))
+		progress := torrent.FileProgress(t, int64(i))
+
+		table.add(
+			cell{text: strconv.Itoa(i), right: true},
+			cell{text: strconv.FormatInt(int64(100.0*progress), 10) + "%", right: true, color: progressColor(progress)},
+			cell{text: torrent.FilePriority(t, int64(i))},
+			cell{text: get},
+			cell{text: cunits.ImportInByte(float64(f.Length)).GetHumanSizeRepresentation(), right: true},
+			cell{text: torrent.FileName(t, i), color: color})
 	}
 
-	return s
+	if err := table.render(out, d); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintln(out)
+
+	return err
 }
 
 type filesOptions struct {
 	torrentOptions
 	filter.Options `group:"filters"`
+	sortOptions
+	FileFilter []string `long:"file-filter" description:"only files matching a file filter expression, e.g. 'ext == \"nfo\"'" unquote:"false"`
+	FileSort   string   `long:"file-sort" description:"sort the files of each torrent by comma separated file variables or expressions, - for descending, e.g. -length,name" unquote:"false"`
 }
 
 // Files provides a list of files for all or selected torrents.
 func Files(c *Command) {
 	opts, ok := c.Options.(filesOptions)
 	optionsCheck(ok)
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, append(commonArgs[:], "files", "priorities", "wanted"),
-		func(transmissionrpcTorrent *transmissionrpc.Torrent) {
-			fmt.Println(fileInfo(transmissionrpcTorrent))
-		}, nil, false)
+
+	fileFilter, err := filter.NewFileFilter(opts.FileFilter)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	var fileOrder *filter.FileOrder
+
+	if opts.FileSort != "" {
+		if fileOrder, err = filter.NewFileOrder(opts.FileSort); err != nil {
+			c.errorf("%v", err)
+			return
+		}
+	}
+
+	if c.records != nil {
+		c.records.declare(fileRecord{})
+	}
+
+	err = util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, append(commonArgs[:], "files", "priorities", "wanted"),
+		func(backendTorrent *backend.Torrent) {
+			if c.failed {
+				return
+			}
+
+			files, err := fileFilter.Files(backendTorrent)
+			if err != nil {
+				c.errorf("%v", err)
+				return
+			}
+
+			if fileOrder != nil {
+				if err := fileOrder.Sort(backendTorrent, files, false); err != nil {
+					c.errorf("%v", err)
+					return
+				}
+			}
+
+			// Torrents without matching files aren't shown at all.
+			if len(files) == 0 && len(opts.FileFilter) != 0 {
+				return
+			}
+
+			if c.records == nil {
+				if err := fileInfo(c.Out, c.display, backendTorrent, files); err != nil {
+					c.errorf("%v", err)
+				}
+
+				return
+			}
+
+			entries := newFileEntries(backendTorrent)
+
+			for _, i := range files {
+				c.record(fileRecord{TorrentID: *backendTorrent.ID, TorrentName: *backendTorrent.Name, fileEntry: entries[i]})
+			}
+		}, opts.sortField(), opts.Reverse)
+	if err != nil {
+		c.errorf("%v", err)
+	}
 }
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shric/trpc/internal/config"
+	"github.com/shric/trpc/internal/filter"
+)
+
+type filtersOptions struct {
+	Pos struct {
+		Names []string `positional-arg-name:"name" description:"named filter to check (default: all)"`
+	} `positional-args:"true"`
+}
+
+// Filters lists the named filters of ~/.trpc.conf, checking each of them.
+func Filters(c *Command) {
+	opts, ok := c.Options.(filtersOptions)
+	optionsCheck(ok)
+
+	conf := config.ReadConfig()
+
+	// Filters that aren't even strings are checked along with the others.
+	invalid := make(map[string]*config.EntryError)
+
+	if conf != nil {
+		for _, err := range conf.Errors {
+			if err.Section == "filters" {
+				invalid[err.Name] = err
+			}
+		}
+	}
+
+	names := opts.Pos.Names
+	if len(names) == 0 {
+		names = filter.Names(conf)
+		for name := range invalid {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+	}
+
+	if len(names) == 0 {
+		fmt.Fprintln(c.Err, "No filters defined in [filters] of ~/.trpc.conf")
+		return
+	}
+
+	width := 0
+
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	for _, name := range names {
+		if err, ok := invalid[name]; ok {
+			c.errorf("%s: %s", name, err.Problem)
+			continue
+		}
+
+		if err := filter.CheckNamed(name, conf); err != nil {
+			c.errorf("%s: %v", name, err)
+			continue
+		}
+
+		fmt.Fprintf(c.Out, "%-*s  %s\n", width, name, conf.Filters[name])
+	}
+}
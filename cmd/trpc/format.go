@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/slongfield/pyfmt"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+// defaultListFormat is the layout of list unless --format, --columns or the
+// default_list_format setting says otherwise.
+const defaultListFormat = "{ID:4}{Error:1} {Pct:5}%  {Size:6.1f} {SizeSuffix:<3} {Eta:<8} {Up:>7} {Down:>7}" +
+	" {Ratio:>6.1f}  {Priority:6} {Trackershortname:4}   {Name}"
+
+// listColumns are the --columns that are parts of the default format. Any
+// torrent field is a column as well.
+var listColumns = []struct {
+	name, format string
+}{
+	{"id", "{ID:4}"},
+	{"err", "{Error:1}"},
+	{"pct", "{Pct:5}%"},
+	{"size", "{Size:6.1f} {SizeSuffix:<3}"},
+	{"eta", "{Eta:<8}"},
+	{"up", "{Up:>7}"},
+	{"down", "{Down:>7}"},
+	{"ratio", "{Ratio:>6.1f}"},
+	{"priority", "{Priority:6}"},
+	{"tracker", "{Trackershortname:4}"},
+	{"name", "{Name}"},
+}
+
+// fieldColumnFormat returns the --columns format of a torrent field.
+func fieldColumnFormat(f *torrent.Field) string {
+	widths := map[torrent.Kind]string{
+		torrent.KindBool:     ":<5",
+		torrent.KindInt:      ":>6",
+		torrent.KindFloat:    ":>8",
+		torrent.KindBytes:    ":>10",
+		torrent.KindRate:     ":>12",
+		torrent.KindDuration: ":<8",
+		torrent.KindDate:     ":<16",
+	}
+
+	if f.Name == "status" {
+		return "{status:<11}"
+	}
+
+	return "{" + f.Name + widths[f.Kind] + "}"
+}
+
+// columnsFormat builds a format from a comma separated list of columns.
+func columnsFormat(columns string) (string, error) {
+	var parts []string
+
+next:
+	for _, name := range strings.Split(columns, ",") {
+		name = strings.TrimSpace(name)
+
+		for _, c := range listColumns {
+			if strings.EqualFold(c.name, name) {
+				parts = append(parts, c.format)
+				continue next
+			}
+		}
+
+		if f := torrent.FieldByName(name); f != nil {
+			parts = append(parts, fieldColumnFormat(f))
+			continue
+		}
+
+		return "", fmt.Errorf("unknown column %q, columns are: %s", name, strings.Join(columnNames(), ", "))
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// columnNames returns the names of all columns.
+func columnNames() []string {
+	var names []string
+
+	seen := make(map[string]bool)
+
+	for _, c := range listColumns {
+		names = append(names, c.name)
+		seen[c.name] = true
+	}
+
+	for _, f := range torrent.Fields {
+		if !seen[f.Name] {
+			names = append(names, f.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// namedFormat returns the [formats] entry called name, or name itself if it
+// is a format string.
+func namedFormat(name string, conf *config.Config) (string, error) {
+	if conf != nil {
+		if format, ok := conf.Formats[name]; ok {
+			return format, nil
+		}
+	}
+
+	if !strings.Contains(name, "{") {
+		return "", fmt.Errorf("unknown format %q (check [formats] in ~/.trpc.conf)", name)
+	}
+
+	return name, nil
+}
+
+// listFormat returns the format list uses.
+func listFormat(opts listOptions, conf *config.Config) (string, error) {
+	switch {
+	case opts.Format != "" && opts.Columns != "":
+		return "", fmt.Errorf("--format and --columns can't be used together")
+	case opts.Columns != "":
+		return columnsFormat(opts.Columns)
+	case opts.Format != "":
+		return namedFormat(opts.Format, conf)
+	case conf != nil && conf.Settings.Has("default_list_format"):
+		name, _ := conf.Settings.Get("default_list_format").(string)
+		return namedFormat(name, conf)
+	}
+
+	return defaultListFormat, nil
+}
+
+var formatName = regexp.MustCompile(`{([A-Za-z]+)`)
+
+// formatFields returns the torrent fields used in a format.
+func formatFields(format string) []*torrent.Field {
+	var fields []*torrent.Field
+
+	for _, match := range formatName.FindAllStringSubmatch(format, -1) {
+		if f := torrent.FieldByName(match[1]); f != nil {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// formatValues returns what a format can refer to: the fields of
+// torrent.Torrent (ID, Pct, Size...) and, as text shown like in columns, the
+// torrent fields of filters (size, status, downloadDir...).
+func formatValues(t *torrent.Torrent, fields map[string]string) map[string]interface{} {
+	values := make(map[string]interface{})
+
+	v := reflect.ValueOf(*t)
+	for i := 0; i < v.NumField(); i++ {
+		if sf := v.Type().Field(i); sf.PkgPath == "" {
+			values[sf.Name] = v.Field(i).Interface()
+		}
+	}
+
+	for _, f := range torrent.Fields {
+		values[f.Name] = fields[f.Name]
+	}
+
+	return values
+}
+
+// torrentFields returns the text of the fields of a torrent, and adds the
+// values of those that sum up to sums.
+func torrentFields(t *backend.Torrent, conf *config.Config, used []*torrent.Field,
+	sums map[string]int64,
+) map[string]string {
+	fields := make(map[string]string, len(used))
+
+	for _, f := range used {
+		value := f.ValueOf(t, conf)
+		fields[f.Name] = f.Display(value)
+
+		if n, ok := value.(int64); ok && f.Sum {
+			sums[f.Name] += n
+		}
+	}
+
+	return fields
+}
+
+// totalFields returns the text of the fields of a totals row: the sums, and
+// nothing for fields that don't add up.
+func totalFields(sums map[string]int64) map[string]string {
+	fields := make(map[string]string, len(sums))
+
+	for name, sum := range sums {
+		fields[name] = torrent.FieldByName(name).Display(sum)
+	}
+
+	return fields
+}
+
+// listHeaders are the column headers of the fields of torrent.Torrent. Torrent
+// fields are headed by their name.
+var listHeaders = map[string]string{
+	"ID":               "ID",
+	"Error":            "",
+	"Pct":              "Done",
+	"Size":             "Size",
+	"SizeSuffix":       "",
+	"Eta":              "ETA",
+	"Up":               "Up",
+	"Down":             "Down",
+	"Ratio":            "Ratio",
+	"Priority":         "Priority",
+	"Trackershortname": "Tracker",
+	"Name":             "Name",
+}
+
+// listLayout is a format split into the placeholders of its columns and the
+// text around them.
+type listLayout struct {
+	format string
+	specs  []string
+	keys   []string
+	seps   []string
+}
+
+// newListLayout splits a format. Doubled braces stand for braces.
+func newListLayout(format string) (*listLayout, error) {
+	l := &listLayout{format: format}
+
+	var text strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		switch {
+		case strings.HasPrefix(format[i:], "{{"), strings.HasPrefix(format[i:], "}}"):
+			text.WriteByte(format[i])
+			i++
+		case format[i] == '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid format %q: unmatched {", format)
+			}
+
+			spec := format[i+1 : i+end]
+			key := spec
+
+			if j := strings.IndexAny(spec, ":!.["); j >= 0 {
+				key = spec[:j]
+			}
+
+			l.specs = append(l.specs, spec)
+			l.keys = append(l.keys, key)
+			l.seps = append(l.seps, text.String())
+			text.Reset()
+
+			i += end
+		default:
+			text.WriteByte(format[i])
+		}
+	}
+
+	l.seps = append(l.seps, text.String())
+
+	for _, key := range l.keys {
+		if key == "" {
+			return nil, fmt.Errorf("invalid format %q: placeholders need a name", format)
+		}
+	}
+
+	return l, nil
+}
+
+// table returns an empty table for the layout, with headers if header is set.
+// The name is the flex column.
+func (l *listLayout) table(header bool) *table {
+	t := &table{seps: l.seps, flex: -1}
+
+	for i, key := range l.keys {
+		if key == "Name" || key == "name" {
+			t.flex = i
+		}
+	}
+
+	if header {
+		for _, key := range l.keys {
+			name, ok := listHeaders[key]
+			if !ok {
+				name = key
+			}
+
+			t.header = append(t.header, name)
+		}
+	}
+
+	return t
+}
+
+// cells renders a torrent, or totals if original is nil.
+func (l *listLayout) cells(t *torrent.Torrent, fields map[string]string,
+	original *backend.Torrent,
+) ([]cell, error) {
+	values := formatValues(t, fields)
+	cells := make([]cell, len(l.specs))
+
+	for i, spec := range l.specs {
+		text, err := pyfmt.Fmt("{"+spec+"}", values)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format %q: %v", l.format, err)
+		}
+
+		cells[i] = cell{text: text, right: rightAligned(spec, values[l.keys[i]])}
+
+		if original == nil {
+			continue
+		}
+
+		switch l.keys[i] {
+		case "Name", "name", "status":
+			cells[i].color = statusColor(original)
+		case "Pct":
+			cells[i].color = progressColor(float64(t.Pct) / 100)
+		}
+	}
+
+	return cells, nil
+}
+
+// rightAligned tells if the text of a placeholder is aligned to the right:
+// if asked to, if pyfmt pads it which it does on the left, or for numbers.
+func rightAligned(spec string, value interface{}) bool {
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		options := spec[i+1:]
+		if strings.ContainsAny(options, "<^") {
+			return false
+		}
+
+		if strings.ContainsAny(options, ">123456789") {
+			return true
+		}
+	}
+
+	switch value.(type) {
+	case int, int64, float64:
+		return true
+	}
+
+	return false
+}
@@ -2,28 +2,42 @@ package cmd
 
 import (
 	"fmt"
-	"os"
+	"sort"
+	"strconv"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/filter"
 
 	"github.com/shric/trpc/internal/util"
 )
 
 type fsetOptions struct {
 	fileOptions
-	Get      bool   `long:"get" short:"g" description:"Mark file for downloading"`
-	NoGet    bool   `long:"noget" short:"G" description:"Mark file for not downloading"`
-	Priority string `long:"priority" short:"p" description:"Set file priority" choice:"low" choice:"normal" choice:"high"`
+	filter.Options `group:"filters"`
+	FileFilter     []string `long:"file-filter" description:"files matching a file filter expression, of the torrents of the files given or else of those the filters select" unquote:"false"`
+	Get            bool     `long:"get" short:"g" description:"Mark file for downloading"`
+	NoGet          bool     `long:"noget" short:"G" description:"Mark file for not downloading"`
+	Priority       string   `long:"priority" short:"p" description:"Set file priority" choice:"low" choice:"normal" choice:"high"`
 }
 
-func torrentFset(c *Command, files map[int64][]int64) {
+// torrentFset sets the files of each torrent, by torrent ID, and shows them:
+// all files of the torrent, or only the ones set if they were filtered.
+func torrentFset(c *Command, files map[int64][]int64, filtered bool) {
 	opts, ok := c.Options.(fsetOptions)
 	optionsCheck(ok)
 
-	for ID, fileIDs := range files {
+	torrentIDs := make([]int64, 0, len(files))
+	for ID := range files {
+		torrentIDs = append(torrentIDs, ID)
+	}
+
+	sort.Slice(torrentIDs, func(i, j int) bool { return torrentIDs[i] < torrentIDs[j] })
+
+	for _, ID := range torrentIDs {
+		fileIDs := files[ID]
 		IDs := make([]int64, 1)
 		IDs[0] = ID
-		payload := &transmissionrpc.TorrentSetPayload{IDs: IDs}
+		payload := &backend.TorrentSetPayload{IDs: IDs}
 
 		for _, fileID := range fileIDs {
 			if opts.Get {
@@ -47,39 +61,126 @@ func torrentFset(c *Command, files map[int64][]int64) {
 		if !c.CommonOptions.DryRun {
 			err := c.Client.TorrentSet(payload)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
+				c.errorf("%v", err)
 				return
 			}
 		}
 
 		torrents, err := c.Client.TorrentGet(append(commonArgs[:], "files", "priorities", "wanted"), IDs)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			c.errorf("%v", err)
 			return
 		}
 
-		fmt.Println(fileInfo(torrents[0]))
+		shown := allFiles(torrents[0])
+
+		if filtered {
+			shown = shown[:0]
+			for _, fileID := range fileIDs {
+				shown = append(shown, int(fileID))
+			}
+		}
+
+		if err := fileInfo(c.Out, c.display, torrents[0], shown); err != nil {
+			c.errorf("%v", err)
+		}
 	}
 }
 
-// Fset implements the which command (find which torrent a file/path is associated with.
+// Fset implements the fset command (set or show the files of torrents).
 func Fset(c *Command) {
 	opts, ok := c.Options.(fsetOptions)
 	optionsCheck(ok)
 
-	finder := util.NewFinder(c.Client)
+	fileFilter, err := filter.NewFileFilter(opts.FileFilter)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	finder, err := util.NewFinder(c.Client)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
 
 	// files maps torrent ID
 	files := map[int64][]int64{}
 
 	for _, f := range opts.Pos.Files {
-		torrent, fileID := finder.Find(f)
-		if torrent != nil {
+		torrent, fileID, err := finder.Find(f)
+
+		switch {
+		case err != nil:
+			c.errorf("%v", err)
+			return
+		case torrent != nil:
 			files[*torrent.ID] = append(files[*torrent.ID], fileID)
-		} else {
-			fmt.Fprintln(os.Stderr, "Couldn't find a torrent for", f)
+		default:
+			fmt.Fprintln(c.Err, "Couldn't find a torrent for", f)
+		}
+	}
+
+	if len(opts.FileFilter) == 0 {
+		torrentFset(c, files, false)
+		return
+	}
+
+	// Nothing given was found.
+	if len(opts.Pos.Files) != 0 && len(files) == 0 {
+		return
+	}
+
+	torrents := make([]string, 0, len(files))
+	for ID := range files {
+		torrents = append(torrents, strconv.FormatInt(ID, 10))
+	}
+
+	matched := map[int64][]int64{}
+
+	err = util.ProcessTorrents(c.Client, opts.Options, torrents, []string{"id", "name", "files", "priorities", "wanted"},
+		func(t *backend.Torrent) {
+			if c.failed {
+				return
+			}
+
+			candidates, err := fileFilter.Files(t)
+			if err != nil {
+				c.errorf("%v", err)
+				return
+			}
+
+			for _, i := range candidates {
+				if given(files[*t.ID], int64(i)) {
+					matched[*t.ID] = append(matched[*t.ID], int64(i))
+				}
+			}
+		}, nil, false)
+	if c.processFailed(err) {
+		return
+	}
+
+	switch {
+	case c.failed:
+	case len(matched) == 0:
+		fmt.Fprintln(c.Err, "No files match")
+	default:
+		torrentFset(c, matched, true)
+	}
+}
+
+// given tells if a file is one of fileIDs found for the paths given, or if
+// there were none. A directory stands for all the files of its torrent.
+func given(fileIDs []int64, fileID int64) bool {
+	if len(fileIDs) == 0 {
+		return true
+	}
+
+	for _, ID := range fileIDs {
+		if ID == fileID || ID < 0 {
+			return true
 		}
 	}
 
-	torrentFset(c, files)
+	return false
 }
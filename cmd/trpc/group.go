@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+// groupBys are the --group-by choices, with the header of their column and
+// the torrent field they group by.
+var groupBys = map[string]struct{ header, field string }{
+	"tracker":     {"Tracker", "tracker"},
+	"downloadDir": {"Download dir", "downloadDir"},
+	"status":      {"Status", "status"},
+	"label":       {"Label", "labels"},
+}
+
+// noGroup stands for a missing label.
+const noGroup = "(none)"
+
+// groupKeys returns the groups a torrent belongs to: one, or one per label
+// for labels.
+func groupKeys(by string, t *backend.Torrent, conf *config.Config) []string {
+	switch by {
+	case "tracker":
+		return []string{torrent.TrackerName(t, conf)}
+	case "label":
+		if len(t.Labels) > 0 {
+			return t.Labels
+		}
+
+		return []string{noGroup}
+	default:
+		return []string{torrent.FieldByName(by).Display(torrent.FieldByName(by).ValueOf(t, conf))}
+	}
+}
+
+// aggregate sums up torrents.
+type aggregate struct {
+	torrents                 int
+	size, have, uploaded     int64
+	rateUpload, rateDownload int64
+}
+
+func (a *aggregate) add(t *backend.Torrent) {
+	a.torrents++
+	a.size += int64(t.SizeWhenDone.Byte())
+	a.have += torrent.Have(t)
+	a.uploaded += *t.UploadedEver
+	a.rateUpload += *t.RateUpload
+	a.rateDownload += *t.RateDownload
+}
+
+// merge adds the torrents summed up by b.
+func (a *aggregate) merge(b *aggregate) {
+	a.torrents += b.torrents
+	a.size += b.size
+	a.have += b.have
+	a.uploaded += b.uploaded
+	a.rateUpload += b.rateUpload
+	a.rateDownload += b.rateDownload
+}
+
+// ratio is the upload/size ratio of all the torrents.
+func (a *aggregate) ratio() float64 {
+	return finite(float64(a.uploaded) / float64(a.size))
+}
+
+// groups are the aggregates of torrents grouped by a torrent property, along
+// with those of all torrents.
+type groups struct {
+	by     string
+	conf   *config.Config
+	total  aggregate
+	groups map[string]*aggregate
+}
+
+// groupArgs returns the torrent-get fields grouping by one of the
+// --group-by choices needs.
+func groupArgs(by string) []string {
+	if by == "" {
+		return nil
+	}
+
+	return torrent.FieldByName(groupBys[by].field).RPC
+}
+
+// newGroups groups by one of the --group-by choices, or not at all if by is
+// empty.
+func newGroups(by string, conf *config.Config) *groups {
+	return &groups{by: by, conf: conf, groups: make(map[string]*aggregate)}
+}
+
+func (g *groups) add(t *backend.Torrent) {
+	g.total.add(t)
+
+	if g.by == "" {
+		return
+	}
+
+	for _, key := range groupKeys(g.by, t, g.conf) {
+		if g.groups[key] == nil {
+			g.groups[key] = &aggregate{}
+		}
+
+		g.groups[key].add(t)
+	}
+}
+
+// merge adds the groups of other, grouped the same way, to g.
+func (g *groups) merge(other *groups) {
+	g.total.merge(&other.total)
+
+	for key, a := range other.groups {
+		if g.groups[key] == nil {
+			g.groups[key] = &aggregate{}
+		}
+
+		g.groups[key].merge(a)
+	}
+}
+
+// names returns the names of the groups, sorted ignoring case.
+func (g *groups) names() []string {
+	names := make([]string, 0, len(g.groups))
+	for name := range g.groups {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		a, b := strings.ToLower(names[i]), strings.ToLower(names[j])
+		if a != b {
+			return a < b
+		}
+
+		return names[i] < names[j]
+	})
+
+	return names
+}
+
+// render writes a table of the groups and their total.
+func (g *groups) render(out io.Writer, d display) error {
+	header := "Group"
+	if g.by != "" {
+		header = groupBys[g.by].header
+	}
+
+	// Unlike those of list, the figures mean nothing without the header.
+	t := newTable(header, "Torrents", "Size", "Have", "Uploaded", "Ratio", "Up", "Down")
+	t.flex = 0
+
+	// Sizes and rates are shown like in the list.
+	row := func(name string, a *aggregate) {
+		t.add(
+			cell{text: name},
+			cell{text: strconv.Itoa(a.torrents), right: true},
+			cell{text: torrent.HumanSize(a.size), right: true},
+			cell{text: torrent.HumanSize(a.have), right: true},
+			cell{text: torrent.HumanSize(a.uploaded), right: true},
+			cell{text: strconv.FormatFloat(a.ratio(), 'f', 1, 64), right: true},
+			cell{text: torrent.HumanRate(a.rateUpload), right: true},
+			cell{text: torrent.HumanRate(a.rateDownload), right: true})
+	}
+
+	for _, name := range g.names() {
+		row(name, g.groups[name])
+	}
+
+	row(overallName, &g.total)
+
+	return t.render(out, d)
+}
+
+// records writes a record per group, and one for all torrents.
+func (g *groups) records(c *Command) {
+	record := func(name *string, a *aggregate) {
+		c.record(groupRecord{
+			GroupBy: g.by, Group: name, Torrents: a.torrents,
+			SizeWhenDone: a.size, Have: a.have, UploadedEver: a.uploaded, UploadRatio: a.ratio(),
+			RateUpload: a.rateUpload, RateDownload: a.rateDownload,
+		})
+	}
+
+	for _, name := range g.names() {
+		name := name
+		record(&name, g.groups[name])
+	}
+
+	record(nil, &g.total)
+}
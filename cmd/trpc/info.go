@@ -1,44 +1,413 @@
 package cmd
 
 import (
+	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/shric/trpc/internal/torrent"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/util"
 )
 
+// infoSections selects the sections of info after NAME, which is always
+// shown. Without any, those of transmission-remote -i are shown.
+type infoSections struct {
+	Transfer bool `long:"transfer" description:"show the state, location, sizes, rates and ratio"`
+	History  bool `long:"history" description:"show when the torrent was added, finished and active"`
+	Origins  bool `long:"origins" description:"show who created the torrent, when, and its pieces"`
+	Limits   bool `long:"limits" description:"show the speed, seed ratio and peer limits"`
+	Pieces   bool `long:"pieces" description:"show which pieces have been downloaded"`
+	Trackers bool `long:"trackers" description:"show the announce and scrape results of the trackers"`
+	Peers    bool `long:"peers" description:"show the connected peers"`
+	All      bool `long:"all" description:"show every section"`
+}
+
+// selected returns the sections to show.
+func (s infoSections) selected() infoSections {
+	switch {
+	case s.All:
+		return infoSections{true, true, true, true, true, true, true, true}
+	case s == infoSections{}:
+		return infoSections{Transfer: true, History: true, Origins: true, Limits: true}
+	}
+
+	return s
+}
+
+// fields returns the torrent-get fields of the sections, besides those every
+// section needs.
+func (s infoSections) fields() []string {
+	var fields []string
+
+	if s.Pieces {
+		fields = append(fields, "pieces")
+	}
+
+	if s.Trackers {
+		fields = append(fields, "trackerStats")
+	}
+
+	if s.Peers {
+		fields = append(fields, "peers")
+	}
+
+	return fields
+}
+
 type infoOptions struct {
 	torrentOptions
+	Sections       infoSections `group:"sections"`
 	filter.Options `group:"filters"`
 }
 
-// Info provides a list of files for all or selected torrents.
+// Info shows everything about all or selected torrents, in sections.
 func Info(c *Command) {
 	opts, ok := c.Options.(infoOptions)
 	optionsCheck(ok)
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, append(commonArgs[:], "files", "priorities", "wanted", "hashString", "magnetLink", "activityDate", "addedDate", "bandwidthPriority", "comment", "corruptEver", "creator", "dateCreated", "desiredAvailable", "doneDate", "downloadDir", "downloadedEver", "downloadLimit", "downloadLimited", "error", "errorString", "eta", "hashString", "haveUnchecked", "haveValid", "honorsSessionLimits", "id", "isFinished", "isPrivate", "leftUntilDone", "magnetLink", "name", "peersConnected", "peersGettingFromUs", "peersSendingToUs", "peer-limit", "pieceCount", "pieceSize", "rateDownload", "rateUpload", "recheckProgress", "secondsDownloading", "secondsSeeding", "seedRatioMode", "seedRatioLimit", "sizeWhenDone", "startDate", "status", "totalSize", "uploadedEver", "uploadLimit", "uploadLimited", "webseeds", "webseedsSendingToUs"),
-		func(transmissionrpcTorrent *transmissionrpc.Torrent) {
-			fmt.Println(info(transmissionrpcTorrent))
+
+	conf := config.ReadConfig()
+	sections := opts.Sections.selected()
+
+	if c.records != nil {
+		c.records.declare(infoRecord{})
+	}
+
+	fields := append(commonArgs[:], "files", "priorities", "wanted", "hashString", "magnetLink", "activityDate", "addedDate", "bandwidthPriority", "comment", "corruptEver", "creator", "dateCreated", "desiredAvailable", "doneDate", "downloadDir", "downloadedEver", "downloadLimit", "downloadLimited", "error", "errorString", "eta", "hashString", "haveUnchecked", "haveValid", "honorsSessionLimits", "id", "isFinished", "isPrivate", "leftUntilDone", "magnetLink", "name", "peersConnected", "peersGettingFromUs", "peersSendingToUs", "peer-limit", "pieceCount", "pieceSize", "rateDownload", "rateUpload", "recheckProgress", "secondsDownloading", "secondsSeeding", "seedRatioMode", "seedRatioLimit", "sizeWhenDone", "startDate", "status", "totalSize", "uploadedEver", "uploadLimit", "uploadLimited", "webseeds", "webseedsSendingToUs", "labels")
+
+	err := util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, append(fields, sections.fields()...),
+		func(backendTorrent *backend.Torrent) {
+			record := newInfoRecord(backendTorrent, conf, sections)
+
+			if c.records != nil {
+				c.record(record)
+				return
+			}
+
+			fmt.Fprintln(c.Out, info(record, sections, c.display))
 		}, nil, false)
+	if err != nil {
+		c.errorf("%v", err)
+	}
+}
+
+// info returns the selected sections of a torrent, like transmission-remote
+// -i does.
+func info(r infoRecord, sections infoSections, d display) string {
+	var b strings.Builder
+
+	section := func(title string) {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+
+		b.WriteString(title + "\n")
+	}
+
+	line := func(key, value string) {
+		fmt.Fprintf(&b, "  %s:", key)
+
+		if value != "" {
+			b.WriteString(" " + value)
+		}
+
+		b.WriteString("\n")
+	}
+
+	section("NAME")
+	line("Id", fmt.Sprint(r.ID))
+	line("Name", r.Name)
+	line("Hash", optString(r.HashString))
+	line("Magnet", optString(r.MagnetLink))
+	line("Labels", infoLabels(r.Labels))
+
+	if sections.Transfer {
+		section("TRANSFER")
+		line("State", r.Status)
+		line("Location", optString(r.DownloadDir))
+		line("Percent done", fmt.Sprintf("%.1f%%", 100*r.PercentDone))
+		line("ETA", infoETA(r))
+		line("Download speed", optValue(torrent.KindRate, r.RateDownload))
+		line("Upload speed", optValue(torrent.KindRate, r.RateUpload))
+		line("Have", infoHave(r))
+		line("Availability", infoAvailability(r))
+		line("Total size", optValue(torrent.KindBytes, r.TotalSize)+
+			" ("+optValue(torrent.KindBytes, &r.SizeWhenDone)+" wanted)")
+		line("Downloaded", optValue(torrent.KindBytes, r.DownloadedEver))
+		line("Uploaded", optValue(torrent.KindBytes, &r.UploadedEver))
+		line("Ratio", fmt.Sprintf("%.2f", r.UploadRatio))
+		line("Corrupt DL", optValue(torrent.KindBytes, r.CorruptEver))
+		line("Peers", fmt.Sprintf("connected to %s, uploading to %s, downloading from %s",
+			optInt(r.PeersConnected), optInt(r.PeersGettingFromUs), optInt(r.PeersSendingToUs)))
+
+		if r.Error != 0 {
+			line("Error", r.ErrorString)
+		}
+	}
+
+	if sections.History {
+		section("HISTORY")
+		line("Date added", optValue(torrent.KindDate, r.AddedDate))
+		line("Date finished", optValue(torrent.KindDate, r.DoneDate))
+		line("Date started", optValue(torrent.KindDate, r.StartDate))
+		line("Latest activity", optValue(torrent.KindDate, r.ActivityDate))
+		line("Downloading time", optValue(torrent.KindDuration, r.SecondsDownloading))
+		line("Seeding time", optValue(torrent.KindDuration, r.SecondsSeeding))
+	}
+
+	if sections.Origins {
+		section("ORIGINS")
+		line("Date created", optValue(torrent.KindDate, r.DateCreated))
+		line("Private", optBool(r.IsPrivate))
+		line("Comment", optString(r.Comment))
+		line("Creator", optString(r.Creator))
+		line("Piece count", optInt(r.PieceCount))
+		line("Piece size", optValue(torrent.KindBytes, r.PieceSize))
+
+		if len(r.WebSeeds) > 0 {
+			line("Web seeds", strings.Join(r.WebSeeds, ", "))
+		}
+	}
+
+	if sections.Limits {
+		section("LIMITS")
+		line("Download limit", speedLimit(r.DownloadLimit, r.DownloadLimited))
+		line("Upload limit", speedLimit(r.UploadLimit, r.UploadLimited))
+		line("Seed ratio", torrentSeedRatio(r))
+		line("Honors session limits", optBool(r.HonorsSessionLimits))
+		line("Peer limit", optInt(r.PeerLimit))
+		line("Bandwidth priority", r.Priority)
+	}
+
+	if sections.Pieces {
+		section("PIECES")
+		infoPieces(&b, r)
+	}
+
+	if sections.Trackers {
+		section("TRACKERS")
+		infoTrackers(&b, r)
+	}
+
+	if sections.Peers {
+		section("PEERS")
+		infoPeers(&b, r, d)
+	}
+
+	return b.String()
+}
+
+func infoLabels(labels []string) string {
+	switch {
+	case labels == nil:
+		return backend.Unsupported
+	case len(labels) == 0:
+		return "none"
+	}
+
+	return strings.Join(labels, ", ")
+}
+
+func infoETA(r infoRecord) string {
+	if r.LeftUntilDone == 0 {
+		return "Done"
+	}
+
+	return optValue(torrent.KindDuration, r.Eta)
 }
 
-func info(t *transmissionrpc.Torrent) string {
-	return infoGeneral(t) + "\n" + infoTransfer(t)
+// infoHave shows the bytes downloaded, and how much of it is verified.
+func infoHave(r infoRecord) string {
+	if r.HaveValid == nil {
+		return optValue(torrent.KindBytes, &r.Have)
+	}
+
+	return optValue(torrent.KindBytes, &r.Have) + " (" + optValue(torrent.KindBytes, r.HaveValid) + " verified)"
+}
+
+// infoAvailability is the part of what's wanted that's downloaded or that
+// connected peers have.
+func infoAvailability(r infoRecord) string {
+	if r.DesiredAvailable == nil {
+		return backend.Unsupported
+	}
+
+	return fmt.Sprintf("%.1f%%", 100*finite(float64(r.Have+*r.DesiredAvailable)/float64(r.SizeWhenDone)))
 }
 
-func infoGeneral(t *transmissionrpc.Torrent) string {
-	return "NAME\n" +
-		fmt.Sprintf("  Id: %d\n", *t.ID) +
-		fmt.Sprintf("  Name: %s\n", *t.Name) +
-		fmt.Sprintf("  Hash: %s\n", *t.HashString) +
-		fmt.Sprintf("  Magnet: %s\n", *t.MagnetLink)
+func torrentSeedRatio(r infoRecord) string {
+	if r.SeedRatioMode == nil || r.SeedRatioLimit == nil {
+		return backend.Unsupported
+	}
+
+	switch *r.SeedRatioMode {
+	case backend.SeedRatioModeGlobal.String():
+		return "session limit"
+	case backend.SeedRatioModeNoRatio.String():
+		return "unlimited"
+	}
+
+	return fmt.Sprintf("%.2f", *r.SeedRatioLimit)
 }
 
-func infoTransfer(t *transmissionrpc.Torrent) string {
-	status, _ := torrent.Status(t)
-	return "TRANSFER\n" +
-		fmt.Sprintf("  State: %v\n", status)
+// piecesWidth is the number of characters of the pieces bar.
+const piecesWidth = 64
+
+// infoPieces shows how many pieces have been downloaded and a bar of where they
+// are, each character of which is # if all its pieces have been, + if some
+// have and . if none.
+func infoPieces(b *strings.Builder, r infoRecord) {
+	if r.Pieces == nil || r.PieceCount == nil {
+		fmt.Fprintf(b, "  Have: %s\n", backend.Unsupported)
+		return
+	}
+
+	bits, err := base64.StdEncoding.DecodeString(*r.Pieces)
+	if err != nil {
+		fmt.Fprintf(b, "  Have: %v\n", err)
+		return
+	}
+
+	count := *r.PieceCount
+	has := func(i int64) bool {
+		return i/8 < int64(len(bits)) && bits[i/8]&(0x80>>uint(i%8)) != 0
+	}
+
+	var total int64
+
+	for i := int64(0); i < count; i++ {
+		if has(i) {
+			total++
+		}
+	}
+
+	fmt.Fprintf(b, "  Have: %d of %d pieces (%.1f%%)\n", total, count, 100*finite(float64(total)/float64(count)))
+
+	width := int64(piecesWidth)
+	if count < width {
+		width = count
+	}
+
+	if width == 0 {
+		return
+	}
+
+	bar := make([]byte, width)
+
+	for c := int64(0); c < width; c++ {
+		from, to := count*c/width, count*(c+1)/width
+
+		var n int64
+
+		for i := from; i < to; i++ {
+			if has(i) {
+				n++
+			}
+		}
+
+		switch n {
+		case to - from:
+			bar[c] = '#'
+		case 0:
+			bar[c] = '.'
+		default:
+			bar[c] = '+'
+		}
+	}
+
+	fmt.Fprintf(b, "  [%s]\n", bar)
+}
+
+// infoTrackers shows the trackers of a torrent with their last announce and
+// scrape.
+func infoTrackers(b *strings.Builder, r infoRecord) {
+	if r.TrackerStats == nil {
+		fmt.Fprintf(b, "  %s\n", backend.Unsupported)
+		return
+	}
+
+	for i, ts := range r.TrackerStats {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		tier := fmt.Sprintf("tier %d", ts.Tier)
+		if ts.IsBackup {
+			tier += ", backup"
+		}
+
+		fmt.Fprintf(b, "  Tracker %d: %s (%s)\n", ts.ID, ts.Announce, tier)
+		fmt.Fprintf(b, "    Last announce: %s\n",
+			trackerResult(ts.LastAnnounceResult, ts.LastAnnounceSucceeded, ts.LastAnnounceTime))
+
+		if ts.LastAnnounceSucceeded && ts.LastAnnounceTime != 0 {
+			fmt.Fprintf(b, "    Peers received: %d\n", ts.LastAnnouncePeerCount)
+		}
+
+		if ts.NextAnnounceTime != 0 {
+			fmt.Fprintf(b, "    Next announce: %s\n", optValue(torrent.KindDate, &ts.NextAnnounceTime))
+		}
+
+		fmt.Fprintf(b, "    Last scrape: %s\n",
+			trackerResult(ts.LastScrapeResult, ts.LastScrapeSucceeded, ts.LastScrapeTime))
+		fmt.Fprintf(b, "    Swarm: %s seeders, %s leechers, %s downloads\n",
+			swarmCount(ts.SeederCount), swarmCount(ts.LeecherCount), swarmCount(ts.DownloadCount))
+	}
+}
+
+// trackerResult shows the result of an announce or scrape and when it was.
+func trackerResult(result string, succeeded bool, at int64) string {
+	if result == "" {
+		result = "none"
+		if succeeded {
+			result = "Success"
+		}
+	}
+
+	if at == 0 {
+		return result
+	}
+
+	return result + " at " + optValue(torrent.KindDate, &at)
+}
+
+// swarmCount shows a count of a scrape, which trackers answer -1 for when
+// they don't know.
+func swarmCount(n int64) string {
+	if n < 0 {
+		return "unknown"
+	}
+
+	return fmt.Sprint(n)
+}
+
+// infoPeers shows the connected peers as a table.
+func infoPeers(b *strings.Builder, r infoRecord, d display) {
+	if r.Peers == nil {
+		fmt.Fprintf(b, "  %s\n", backend.Unsupported)
+		return
+	}
+
+	if len(r.Peers) == 0 {
+		b.WriteString("  none\n")
+		return
+	}
+
+	table := newTable("Address", "Flags", "Done", "Down", "Up", "Client")
+	table.seps[0] = "  "
+
+	for _, p := range r.Peers {
+		table.add(
+			cell{text: p.Address},
+			cell{text: p.FlagStr},
+			cell{text: fmt.Sprintf("%.1f%%", 100*p.Progress), right: true, color: progressColor(p.Progress)},
+			cell{text: optValue(torrent.KindRate, &p.RateToClient), right: true},
+			cell{text: optValue(torrent.KindRate, &p.RateToPeer), right: true},
+			cell{text: p.ClientName})
+	}
+
+	_ = table.render(b, d)
 }
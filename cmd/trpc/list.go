@@ -2,29 +2,35 @@ package cmd
 
 import (
 	"fmt"
-	"os"
+	"io"
+	"sync"
 
 	"github.com/shric/trpc/internal/config"
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/torrent"
 	"github.com/shric/trpc/internal/util"
 
-	"github.com/hekmon/transmissionrpc"
-	"github.com/slongfield/pyfmt"
+	"github.com/shric/trpc/internal/backend"
 )
 
-func format(torrent *torrent.Torrent, _ *config.Config) string {
-	format := "{ID:4}{Error:1} {Pct:5}%  {Size:6.1f} {SizeSuffix:<3} {Eta:<8} {Up:>7} {Down:>7}" +
-		" {Ratio:>6.1f}  {Priority:6} {Trackershortname:4}   {Name}"
-	return pyfmt.Must(format, torrent)
-}
-
 type listOptions struct {
 	torrentOptions
 	filter.Options `group:"filters"`
-	NoTotals       bool   `short:"n" long:"no-totals" description:"suppress output of totals"`
-	Sort           string `long:"sort" description:"sort" choice:"size" choice:"name" choice:"id" choice:"ratio" choice:"have" choice:"progress" choice:"uploaded" choice:"age"`
-	Reverse        bool   `short:"r" long:"reverse" description:"reverse sort order"`
+	sortOptions
+	NoTotals bool   `short:"n" long:"no-totals" description:"suppress output of totals"`
+	Format   string `long:"format" description:"format name from [formats] in ~/.trpc.conf, or a format string such as '{ID:4} {Name}'"`
+	Columns  string `long:"columns" description:"comma separated columns, e.g. id,pct,size,ratio,name"`
+	GroupBy  string `long:"group-by" choice:"tracker" choice:"downloadDir" choice:"status" choice:"label" description:"print the totals of each group of torrents"`
+	Summary  bool   `long:"summary" description:"only print the totals, of each group with --group-by"`
+}
+
+// listResult is what a list hands to ListMerge: its total, if it printed one,
+// and its groups, if it printed those.
+type listResult struct {
+	total  *torrent.Torrent
+	sums   map[string]int64
+	layout *listLayout
+	groups *groups
 }
 
 // List provides a list of all or selected torrents.
@@ -39,28 +45,205 @@ func List(c *Command) {
 	conf := config.ReadConfig()
 
 	if c.CommonOptions.DryRun {
-		fmt.Fprintln(os.Stderr, "--dry-run has no effect on list as list doesn't change state")
+		fmt.Fprintln(c.Err, "--dry-run has no effect on list as list doesn't change state")
+	}
+
+	format, err := listFormat(opts, conf)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	layout, err := newListLayout(format)
+	if err != nil {
+		c.errorf("%v", err)
+		return
 	}
 
-	linePrinted := false
+	fields := append(commonArgs[:], "labels")
+	used := formatFields(format)
+	sums := make(map[string]int64)
 
-	var sortField *string
-	if opts.Sort != "" {
-		sortField = &opts.Sort
+	for _, f := range used {
+		fields = append(fields, f.RPC...)
 	}
 
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
-		func(transmissionrpcTorrent *transmissionrpc.Torrent) {
-			result := torrent.NewFrom(transmissionrpcTorrent, conf)
+	grouped := opts.GroupBy != "" || opts.Summary
+	groups := newGroups(opts.GroupBy, conf)
+
+	fields = append(fields, groupArgs(opts.GroupBy)...)
+
+	if c.records != nil {
+		if grouped {
+			c.records.declare(groupRecord{})
+		} else {
+			c.records.declare(torrentRecord{})
+		}
+	}
+
+	// The header is only shown on a terminal, as with newListTable.
+	table := layout.table(c.display.terminal())
+
+	var formatErr error
+
+	err = util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, fields,
+		func(backendTorrent *backend.Torrent) {
+			if grouped {
+				groups.add(backendTorrent)
+			}
+
+			if c.records != nil && grouped {
+				return
+			}
+
+			if c.records != nil {
+				c.record(newTorrentRecord(backendTorrent, conf))
+				return
+			}
+
+			if formatErr != nil || opts.Summary {
+				return
+			}
+
+			result := torrent.NewFrom(backendTorrent, conf)
 			total.UpdateTotal(result)
 
-			formattedTorrent := format(result, conf)
-			fmt.Println(formattedTorrent)
-			linePrinted = true
-		}, sortField, opts.Reverse)
+			cells, err := layout.cells(result, torrentFields(backendTorrent, conf, used, sums), backendTorrent)
+			if err != nil {
+				formatErr = err
+				return
+			}
+
+			table.add(cells...)
+		}, opts.sortField(), opts.Reverse)
+	if c.processFailed(err) {
+		return
+	}
+
+	if formatErr != nil {
+		c.errorf("%v", formatErr)
+		return
+	}
+
+	result := &listResult{}
+	if c.records == nil {
+		c.Result = result
+	}
+
+	if !opts.Summary && listTable(c, opts, table, layout, total, sums) {
+		result.total, result.sums, result.layout = total, sums, layout
+	}
+
+	if !grouped || groups.total.torrents == 0 {
+		return
+	}
+
+	if c.records != nil {
+		groups.records(c)
+		return
+	}
+
+	result.groups = groups
 
-	if !opts.NoTotals && linePrinted {
-		formattedTotal := format(total, conf)
-		fmt.Println(formattedTotal)
+	if !opts.Summary {
+		fmt.Fprintln(c.Out)
 	}
+
+	if err := groups.render(c.Out, c.display); err != nil {
+		c.errorf("%v", err)
+	}
+}
+
+// listTable prints the table of torrents, along with their total, and tells
+// if it printed the total.
+func listTable(c *Command, opts listOptions, table *table, layout *listLayout, total *torrent.Torrent,
+	sums map[string]int64,
+) bool {
+	if len(table.rows) == 0 {
+		return false
+	}
+
+	if !opts.NoTotals {
+		cells, err := layout.cells(total, totalFields(sums), nil)
+		if err != nil {
+			c.errorf("%v", err)
+			return false
+		}
+
+		table.add(cells...)
+	}
+
+	if err := table.render(c.Out, c.display); err != nil {
+		c.errorf("%v", err)
+		return false
+	}
+
+	return !opts.NoTotals
+}
+
+// ListMerge prints the overall total, and groups, of a list run against
+// several daemons.
+func ListMerge(out io.Writer, commands []*Command) error {
+	overall := torrent.NewForTotal()
+	sums := make(map[string]int64)
+	totals, grouped := 0, 0
+
+	var (
+		layout *listLayout
+		all    *groups
+	)
+
+	for _, c := range commands {
+		result, ok := c.Result.(*listResult)
+		if !ok {
+			continue
+		}
+
+		if result.total != nil {
+			overall.UpdateTotal(result.total)
+
+			for name, sum := range result.sums {
+				sums[name] += sum
+			}
+
+			layout = result.layout
+			totals++
+		}
+
+		if result.groups != nil {
+			if all == nil {
+				all = newGroups(result.groups.by, result.groups.conf)
+			}
+
+			all.merge(result.groups)
+			grouped++
+		}
+	}
+
+	out = newPrefixWriter(&sync.Mutex{}, out, daemonPrefix(overallName, daemonWidth(commands)))
+
+	// The figures of a single daemon already say it all.
+	if totals > 1 {
+		cells, err := layout.cells(overall, totalFields(sums), nil)
+		if err != nil {
+			return err
+		}
+
+		table := layout.table(false)
+		table.add(cells...)
+
+		if err := table.render(out, display{}); err != nil {
+			return err
+		}
+	}
+
+	if grouped < 2 {
+		return nil
+	}
+
+	if totals > 1 {
+		fmt.Fprintln(out)
+	}
+
+	return all.render(out, display{})
 }
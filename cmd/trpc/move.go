@@ -2,11 +2,10 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/shric/trpc/internal/fileutils"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/util"
 )
@@ -32,24 +31,27 @@ func Move(c *Command) {
 	optionsCheck(ok)
 
 	if len(opts.Positional.Files) == 0 {
-		fmt.Fprintln(os.Stderr, "move: Destination required")
+		fmt.Fprintln(c.Err, "move: Destination required")
 		return
 	}
 
 	if len(opts.Positional.Files) == 1 && !opts.ForceAll {
-		fmt.Fprintln(os.Stderr, "Use --force-all if you really want to move all torrents")
+		fmt.Fprintln(c.Err, "Use --force-all if you really want to move all torrents")
 		return
 	}
 
 	fnames, destination := getFnamesAndDest(opts.Positional.Files)
-	util.ProcessTorrents(c.Client, opts.Options, fnames, commonArgs[:], func(torrent *transmissionrpc.Torrent) {
+	err := util.ProcessTorrents(c.Client, opts.Options, fnames, commonArgs[:], func(torrent *backend.Torrent) {
 		if !c.CommonOptions.DryRun {
 			err := c.Client.TorrentSetLocation(*torrent.ID, destination, true)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
+				c.errorf("%v", err)
 				return
 			}
 		}
 		c.status("Moving torrent", torrent)
 	}, nil, false)
+	if err != nil {
+		c.errorf("%v", err)
+	}
 }
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// The machine readable formats of --output.
+const (
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+	outputCSV    = "csv"
+	outputTSV    = "tsv"
+)
+
+// recordWriter serializes the records of --output. Records are structs whose
+// exported fields have json tags, the tag names are the CSV/TSV columns.
+// It's shared by the commands run against several daemons, in which case
+// every record starts with a "daemon" field.
+type recordWriter struct {
+	mu      sync.Mutex
+	format  string
+	out     io.Writer
+	daemons bool
+	columns []string
+	rows    int
+}
+
+func newRecordWriter(format string, out io.Writer, daemons bool) *recordWriter {
+	return &recordWriter{format: format, out: out, daemons: daemons}
+}
+
+// declare sets the columns from the type of the records to come, so that
+// CSV and TSV output has a header even without any record.
+func (w *recordWriter) declare(record interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.columns == nil {
+		w.columns = w.names(record)
+	}
+}
+
+func (w *recordWriter) names(record interface{}) []string {
+	var names []string
+	if w.daemons {
+		names = append(names, "daemon")
+	}
+
+	for _, f := range recordFields(reflect.ValueOf(record)) {
+		names = append(names, f.name)
+	}
+
+	return names
+}
+
+// write serializes the record of a daemon.
+func (w *recordWriter) write(daemon string, record interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.columns == nil {
+		w.columns = w.names(record)
+	}
+
+	var err error
+
+	switch w.format {
+	case outputJSON, outputNDJSON:
+		err = w.writeJSON(daemon, record)
+	default:
+		err = w.writeRow(daemon, record)
+	}
+
+	w.rows++
+
+	return err
+}
+
+// marshal is json.Marshal without the escaping of <, > and & for HTML, as
+// found in magnet links.
+func marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+func (w *recordWriter) writeJSON(daemon string, record interface{}) error {
+	b, err := marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if w.daemons {
+		name, _ := marshal(daemon)
+		b = append([]byte(`{"daemon":`+string(name)+","), b[1:]...)
+	}
+
+	if w.format == outputNDJSON {
+		_, err = fmt.Fprintf(w.out, "%s\n", b)
+		return err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, b, "  ", "  "); err != nil {
+		return err
+	}
+
+	separator := ",\n  "
+	if w.rows == 0 {
+		separator = "[\n  "
+	}
+
+	_, err = fmt.Fprintf(w.out, "%s%s", separator, indented.Bytes())
+
+	return err
+}
+
+func (w *recordWriter) writeRow(daemon string, record interface{}) error {
+	if w.rows == 0 {
+		if err := w.writeLine(w.columns); err != nil {
+			return err
+		}
+	}
+
+	var cells []string
+	if w.daemons {
+		cells = append(cells, daemon)
+	}
+
+	for _, f := range recordFields(reflect.ValueOf(record)) {
+		cell, err := cellValue(f.value)
+		if err != nil {
+			return err
+		}
+
+		cells = append(cells, cell)
+	}
+
+	return w.writeLine(cells)
+}
+
+// tsvEscaper escapes what would break a TSV line, like PostgreSQL's text format.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func (w *recordWriter) writeLine(cells []string) error {
+	if w.format == outputTSV {
+		escaped := make([]string, len(cells))
+		for i, cell := range cells {
+			escaped[i] = tsvEscaper.Replace(cell)
+		}
+
+		_, err := fmt.Fprintln(w.out, strings.Join(escaped, "\t"))
+
+		return err
+	}
+
+	cw := csv.NewWriter(w.out)
+	if err := cw.Write(cells); err != nil {
+		return err
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// close terminates the output: the closing bracket of a JSON array, or the
+// header of an empty CSV/TSV table.
+func (w *recordWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case w.format == outputJSON && w.rows == 0:
+		_, err := fmt.Fprintln(w.out, "[]")
+		return err
+	case w.format == outputJSON:
+		_, err := fmt.Fprintln(w.out, "\n]")
+		return err
+	case (w.format == outputCSV || w.format == outputTSV) && w.rows == 0 && w.columns != nil:
+		return w.writeLine(w.columns)
+	}
+
+	return nil
+}
+
+type recordField struct {
+	name  string
+	value interface{}
+}
+
+// recordFields returns the json tagged fields of a struct in order, those of
+// embedded structs included.
+func recordFields(v reflect.Value) []recordField {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	var fields []recordField
+
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, recordFields(v.Field(i))...)
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fields = append(fields, recordField{name, v.Field(i).Interface()})
+	}
+
+	return fields
+}
+
+// cellValue returns the CSV/TSV cell of a value: strings as is, null as an
+// empty cell and anything else as JSON.
+func cellValue(value interface{}) (string, error) {
+	b, err := marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case string(b) == "null":
+		return "", nil
+	case b[0] == '"':
+		var s string
+		err := json.Unmarshal(b, &s)
+
+		return s, err
+	}
+
+	return string(b), nil
+}
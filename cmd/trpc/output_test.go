@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRecordWriter(t *testing.T) {
+	records := []errorRecord{
+		{ID: 1, Name: "a\tb", Error: 2, ErrorString: "x, \"y\""},
+		{ID: 2, Name: "c", Error: 3, ErrorString: "line\nbreak"},
+	}
+
+	tests := []struct {
+		format  string
+		daemons bool
+		want    string
+	}{
+		{outputJSON, false, "[\n  {\n    \"id\": 1,\n    \"name\": \"a\\tb\",\n    \"error\": 2,\n" +
+			"    \"errorString\": \"x, \\\"y\\\"\"\n  },\n  {\n    \"id\": 2,\n    \"name\": \"c\",\n" +
+			"    \"error\": 3,\n    \"errorString\": \"line\\nbreak\"\n  }\n]\n"},
+		{outputNDJSON, true, `{"daemon":"home","id":1,"name":"a\tb","error":2,"errorString":"x, \"y\""}` + "\n" +
+			`{"daemon":"home","id":2,"name":"c","error":3,"errorString":"line\nbreak"}` + "\n"},
+		{outputCSV, true, "daemon,id,name,error,errorString\nhome,1,a\tb,2,\"x, \"\"y\"\"\"\n" +
+			"home,2,c,3,\"line\nbreak\"\n"},
+		{outputTSV, false, "id\tname\terror\terrorString\n1\ta\\tb\t2\tx, \"y\"\n2\tc\t3\tline\\nbreak\n"},
+	}
+
+	for _, tt := range tests {
+		var b bytes.Buffer
+
+		w := newRecordWriter(tt.format, &b, tt.daemons)
+		w.declare(errorRecord{})
+
+		for _, r := range records {
+			if err := w.write("home", r); err != nil {
+				t.Fatalf("%s: write() error = %v", tt.format, err)
+			}
+		}
+
+		if err := w.close(); err != nil {
+			t.Fatalf("%s: close() error = %v", tt.format, err)
+		}
+
+		if b.String() != tt.want {
+			t.Errorf("%s:\n%s\nwant\n%s", tt.format, b.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
+	"github.com/shric/trpc/internal/filter"
+	"github.com/shric/trpc/internal/geoip"
+	"github.com/shric/trpc/internal/torrent"
+	"github.com/shric/trpc/internal/util"
+)
+
+type peersOptions struct {
+	torrentOptions
+	Top            string `long:"top" choice:"clients" choice:"countries" choice:"upload" choice:"download" description:"show the clients or countries with the most peers, or the peers uploaded or downloaded to fastest, across the torrents"`
+	Limit          int    `long:"limit" default:"10" description:"rows of --top to show, 0 for all"`
+	filter.Options `group:"filters"`
+}
+
+// The groups of peers of --top, by what they're ranked on.
+var peerTops = map[string]struct {
+	header string
+	key    func(p peerRecord) string
+	rate   func(g *peerGroup) int64
+}{
+	"clients":   {"Client", func(p peerRecord) string { return clientSoftware(p.ClientName) }, nil},
+	"countries": {"Country", func(p peerRecord) string { return country(p.Country) }, nil},
+	"upload": {"Address", func(p peerRecord) string { return p.Address },
+		func(g *peerGroup) int64 { return g.rateToPeer }},
+	"download": {"Address", func(p peerRecord) string { return p.Address },
+		func(g *peerGroup) int64 { return g.rateToClient }},
+}
+
+// openGeoIP opens the database of geoip_database in the [settings] of
+// ~/.trpc.conf, nil if there's none.
+func openGeoIP(conf *config.Config) (geoip.DB, error) {
+	if conf == nil || !conf.Settings.Has("geoip_database") {
+		return nil, nil
+	}
+
+	path, ok := conf.Settings.Get("geoip_database").(string)
+	if !ok {
+		return nil, fmt.Errorf("geoip_database must be the path of a GeoIP database")
+	}
+
+	return geoip.Open(path)
+}
+
+// Peers lists the peers of all or selected torrents, or the top clients,
+// countries or peers among them.
+func Peers(c *Command) {
+	opts, ok := c.Options.(peersOptions)
+	optionsCheck(ok)
+
+	if opts.Limit < 0 {
+		c.errorf("--limit can't be negative")
+		return
+	}
+
+	conf := config.ReadConfig()
+
+	geo, err := openGeoIP(conf)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	if opts.Top == "countries" && geo == nil {
+		c.errorf("--top countries needs a GeoIP database, set geoip_database in ~/.trpc.conf")
+		return
+	}
+
+	if c.records != nil {
+		if opts.Top != "" {
+			c.records.declare(peerGroupRecord{})
+		} else {
+			c.records.declare(peerRecord{})
+		}
+	}
+
+	var peers []peerRecord
+
+	err = util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, append(commonArgs[:], "peers"),
+		func(t *backend.Torrent) {
+			for _, entry := range newPeerEntries(t) {
+				record := peerRecord{TorrentID: *t.ID, TorrentName: *t.Name, peerEntry: entry}
+
+				if geo != nil {
+					country := geo.Country(net.ParseIP(entry.Address))
+					record.Country = &country
+				}
+
+				peers = append(peers, record)
+			}
+		}, nil, false)
+	if c.processFailed(err) {
+		return
+	}
+
+	if opts.Top != "" {
+		topPeers(c, opts, peers)
+		return
+	}
+
+	if c.records != nil {
+		for _, p := range peers {
+			c.record(p)
+		}
+
+		return
+	}
+
+	peerTable(c, peers, geo != nil)
+}
+
+// peerTable lists peers, and the torrents they're peers of.
+func peerTable(c *Command, peers []peerRecord, countries bool) {
+	header := []string{"ID", "Address", "Port", "Flags", "Done", "Down", "Up"}
+	if countries {
+		header = append(header, "Country")
+	}
+
+	table := newListTable(c.display, append(header, "Client", "Name")...)
+
+	rate := torrent.FieldByName("up")
+
+	for _, p := range peers {
+		cells := []cell{
+			{text: strconv.FormatInt(p.TorrentID, 10), right: true},
+			{text: p.Address},
+			{text: strconv.FormatInt(p.Port, 10), right: true},
+			{text: peerFlags(p.peerEntry)},
+			{text: fmt.Sprintf("%.1f%%", 100*p.Progress), right: true, color: progressColor(p.Progress)},
+			{text: rate.Display(p.RateToClient), right: true},
+			{text: rate.Display(p.RateToPeer), right: true},
+		}
+
+		if countries {
+			cells = append(cells, cell{text: country(p.Country)})
+		}
+
+		table.add(append(cells, cell{text: p.ClientName}, cell{text: p.TorrentName})...)
+	}
+
+	if err := table.render(c.Out, c.display); err != nil {
+		c.errorf("%v", err)
+	}
+}
+
+// peerFlags shows the state of a peer with the letters of transmission:
+// D downloading from it, d we'd like to but it's choking us, U uploading to
+// it, u it'd like us to but we're choking it, E encrypted, I incoming and T
+// uTP.
+func peerFlags(p peerEntry) string {
+	var b strings.Builder
+
+	switch {
+	case p.IsDownloadingFrom:
+		b.WriteString("D")
+	case p.ClientIsInterested:
+		b.WriteString("d")
+	}
+
+	switch {
+	case p.IsUploadingTo:
+		b.WriteString("U")
+	case p.PeerIsInterested:
+		b.WriteString("u")
+	}
+
+	for _, flag := range []struct {
+		on     bool
+		letter string
+	}{{p.IsEncrypted, "E"}, {p.IsIncoming, "I"}, {p.IsUTP, "T"}} {
+		if flag.on {
+			b.WriteString(flag.letter)
+		}
+	}
+
+	return b.String()
+}
+
+// country shows the country of a peer, which the database may not know.
+func country(code *string) string {
+	if code == nil || *code == "" {
+		return "?"
+	}
+
+	return *code
+}
+
+// clientSoftware returns the name of a client without its version, e.g.
+// qBittorrent for qBittorrent 4.6.2.
+func clientSoftware(name string) string {
+	words := strings.Fields(name)
+	if len(words) > 1 && strings.IndexAny(words[len(words)-1][:1], "0123456789") == 0 {
+		words = words[:len(words)-1]
+	}
+
+	if len(words) == 0 {
+		return "unknown"
+	}
+
+	return strings.Join(words, " ")
+}
+
+// peerGroup is the aggregate of the peers of a client, country or address.
+type peerGroup struct {
+	name         string
+	peers        int
+	torrents     map[int64]bool
+	rateToClient int64
+	rateToPeer   int64
+	// clientName and country are those of the first peer, for groups of
+	// addresses.
+	clientName string
+	country    *string
+}
+
+// topPeers shows the groups of peers of --top, the most peers or the fastest
+// first.
+func topPeers(c *Command, opts peersOptions, peers []peerRecord) {
+	top := peerTops[opts.Top]
+	groups := make(map[string]*peerGroup)
+
+	var order []*peerGroup
+
+	for _, p := range peers {
+		key := top.key(p)
+
+		g := groups[key]
+		if g == nil {
+			g = &peerGroup{name: key, torrents: make(map[int64]bool), clientName: p.ClientName, country: p.Country}
+			groups[key] = g
+			order = append(order, g)
+		}
+
+		g.peers++
+		g.torrents[p.TorrentID] = true
+		g.rateToClient += p.RateToClient
+		g.rateToPeer += p.RateToPeer
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if top.rate != nil && top.rate(a) != top.rate(b) {
+			return top.rate(a) > top.rate(b)
+		}
+
+		if a.peers != b.peers {
+			return a.peers > b.peers
+		}
+
+		return a.name < b.name
+	})
+
+	if opts.Limit > 0 && len(order) > opts.Limit {
+		order = order[:opts.Limit]
+	}
+
+	if c.records != nil {
+		for _, g := range order {
+			c.record(peerGroupRecord{
+				Top: opts.Top, Group: g.name, Peers: g.peers, Torrents: len(g.torrents),
+				RateToClient: g.rateToClient, RateToPeer: g.rateToPeer,
+			})
+		}
+
+		return
+	}
+
+	byAddress := top.rate != nil
+	countries := byAddress && len(peers) > 0 && peers[0].Country != nil
+
+	header := []string{top.header}
+	if countries {
+		header = append(header, "Country")
+	}
+
+	if byAddress {
+		header = append(header, "Client")
+	}
+
+	if !byAddress {
+		header = append(header, "Peers")
+	}
+
+	// Unlike those of the list of peers, the figures mean nothing without
+	// the header.
+	table := newTable(append(header, "Torrents", "Down", "Up")...)
+
+	rate := torrent.FieldByName("up")
+
+	for _, g := range order {
+		cells := []cell{{text: g.name}}
+
+		if countries {
+			cells = append(cells, cell{text: country(g.country)})
+		}
+
+		if byAddress {
+			cells = append(cells, cell{text: g.clientName})
+		} else {
+			cells = append(cells, cell{text: strconv.Itoa(g.peers), right: true})
+		}
+
+		table.add(append(cells,
+			cell{text: strconv.Itoa(len(g.torrents)), right: true},
+			cell{text: rate.Display(g.rateToClient), right: true},
+			cell{text: rate.Display(g.rateToPeer), right: true})...)
+	}
+
+	if err := table.render(c.Out, c.display); err != nil {
+		c.errorf("%v", err)
+	}
+}
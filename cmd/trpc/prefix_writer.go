@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// prefixWriter prefixes every line written to it. Only whole lines are
+// written to the underlying writer, under a mutex shared between all
+// prefixWriters so that output from concurrent commands doesn't interleave
+// within a line.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(mu *sync.Mutex, w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{mu: mu, w: w, prefix: []byte(prefix)}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+
+	i := bytes.LastIndexByte(p.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+
+	lines := p.buf[:i+1]
+
+	var out bytes.Buffer
+
+	for len(lines) > 0 {
+		j := bytes.IndexByte(lines, '\n')
+		out.Write(p.prefix)
+		out.Write(lines[:j+1])
+		lines = lines[j+1:]
+	}
+
+	p.buf = append(p.buf[:0], p.buf[i+1:]...)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Flush writes out any incomplete final line.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		_, _ = p.Write([]byte{'\n'})
+	}
+}
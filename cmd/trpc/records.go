@@ -0,0 +1,472 @@
+package cmd
+
+import (
+	"math"
+	"time"
+
+	"github.com/hekmon/cunits/v2"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+// The records of --output. Field names are those of the transmission RPC
+// where there's one, sizes are in bytes, rates in bytes per second, dates in
+// seconds since the epoch (0 for never) and fractions between 0 and 1.
+// Fields the daemon doesn't have are null.
+
+// torrentRecord is a torrent as listed by list.
+type torrentRecord struct {
+	ID                 int64    `json:"id"`
+	Name               string   `json:"name"`
+	HashString         *string  `json:"hashString"`
+	Status             string   `json:"status"`
+	Error              int64    `json:"error"`
+	ErrorString        string   `json:"errorString"`
+	SizeWhenDone       int64    `json:"sizeWhenDone"`
+	LeftUntilDone      int64    `json:"leftUntilDone"`
+	Have               int64    `json:"have"`
+	PercentDone        float64  `json:"percentDone"`
+	RecheckProgress    float64  `json:"recheckProgress"`
+	Eta                *int64   `json:"eta"`
+	RateDownload       *int64   `json:"rateDownload"`
+	RateUpload         *int64   `json:"rateUpload"`
+	UploadedEver       int64    `json:"uploadedEver"`
+	UploadRatio        float64  `json:"uploadRatio"`
+	Priority           string   `json:"priority"`
+	Tracker            string   `json:"tracker"`
+	DownloadDir        *string  `json:"downloadDir"`
+	AddedDate          *int64   `json:"addedDate"`
+	DoneDate           *int64   `json:"doneDate"`
+	StartDate          *int64   `json:"startDate"`
+	IsFinished         *bool    `json:"isFinished"`
+	PeersGettingFromUs *int64   `json:"peersGettingFromUs"`
+	PeersSendingToUs   *int64   `json:"peersSendingToUs"`
+	Labels             []string `json:"labels"`
+}
+
+// fileEntry is a file of a torrent.
+type fileEntry struct {
+	Index          int64   `json:"index"`
+	Name           string  `json:"name"`
+	Length         int64   `json:"length"`
+	BytesCompleted int64   `json:"bytesCompleted"`
+	PercentDone    float64 `json:"percentDone"`
+	Priority       string  `json:"priority"`
+	Wanted         bool    `json:"wanted"`
+}
+
+// fileRecord is a file as listed by files.
+type fileRecord struct {
+	TorrentID   int64  `json:"torrentId"`
+	TorrentName string `json:"torrentName"`
+	fileEntry
+}
+
+// trackerEntry is a tracker of a torrent.
+type trackerEntry struct {
+	ID       int64  `json:"id"`
+	Tier     int64  `json:"tier"`
+	Announce string `json:"announce"`
+}
+
+// trackerStatsEntry is a tracker of a torrent with its announce and scrape
+// results.
+type trackerStatsEntry struct {
+	trackerEntry
+	Host                  string `json:"host"`
+	IsBackup              bool   `json:"isBackup"`
+	LastAnnounceTime      int64  `json:"lastAnnounceTime"`
+	LastAnnounceSucceeded bool   `json:"lastAnnounceSucceeded"`
+	LastAnnounceResult    string `json:"lastAnnounceResult"`
+	LastAnnouncePeerCount int64  `json:"lastAnnouncePeerCount"`
+	NextAnnounceTime      int64  `json:"nextAnnounceTime"`
+	LastScrapeTime        int64  `json:"lastScrapeTime"`
+	LastScrapeSucceeded   bool   `json:"lastScrapeSucceeded"`
+	LastScrapeResult      string `json:"lastScrapeResult"`
+	SeederCount           int64  `json:"seederCount"`
+	LeecherCount          int64  `json:"leecherCount"`
+	DownloadCount         int64  `json:"downloadCount"`
+}
+
+// peerEntry is a peer of a torrent.
+type peerEntry struct {
+	Address            string  `json:"address"`
+	Port               int64   `json:"port"`
+	ClientName         string  `json:"clientName"`
+	Progress           float64 `json:"progress"`
+	RateToClient       int64   `json:"rateToClient"`
+	RateToPeer         int64   `json:"rateToPeer"`
+	FlagStr            string  `json:"flagStr"`
+	IsEncrypted        bool    `json:"isEncrypted"`
+	IsUTP              bool    `json:"isUTP"`
+	IsIncoming         bool    `json:"isIncoming"`
+	IsDownloadingFrom  bool    `json:"isDownloadingFrom"`
+	IsUploadingTo      bool    `json:"isUploadingTo"`
+	ClientIsChoked     bool    `json:"clientIsChoked"`
+	ClientIsInterested bool    `json:"clientIsInterested"`
+	PeerIsChoked       bool    `json:"peerIsChoked"`
+	PeerIsInterested   bool    `json:"peerIsInterested"`
+}
+
+// trackerRecord is a tracker as listed by trackers.
+type trackerRecord struct {
+	TorrentID   int64  `json:"torrentId"`
+	TorrentName string `json:"torrentName"`
+	trackerStatsEntry
+}
+
+// peerRecord is a peer as listed by peers. Country is null without a GeoIP
+// database, empty if the database doesn't know the address.
+type peerRecord struct {
+	TorrentID   int64  `json:"torrentId"`
+	TorrentName string `json:"torrentName"`
+	peerEntry
+	Country *string `json:"country"`
+}
+
+// peerGroupRecord is the aggregate of the peers of a client, a country or an
+// address, as listed by peers --top.
+type peerGroupRecord struct {
+	Top          string `json:"top"`
+	Group        string `json:"group"`
+	Peers        int    `json:"peers"`
+	Torrents     int    `json:"torrents"`
+	RateToClient int64  `json:"rateToClient"`
+	RateToPeer   int64  `json:"rateToPeer"`
+}
+
+// infoRecord is everything info knows about a torrent. Pieces, TrackerStats
+// and Peers are null unless their section is asked for.
+type infoRecord struct {
+	torrentRecord
+	MagnetLink          *string             `json:"magnetLink"`
+	Comment             *string             `json:"comment"`
+	Creator             *string             `json:"creator"`
+	DateCreated         *int64              `json:"dateCreated"`
+	ActivityDate        *int64              `json:"activityDate"`
+	TotalSize           *int64              `json:"totalSize"`
+	HaveValid           *int64              `json:"haveValid"`
+	HaveUnchecked       *int64              `json:"haveUnchecked"`
+	CorruptEver         *int64              `json:"corruptEver"`
+	DesiredAvailable    *int64              `json:"desiredAvailable"`
+	DownloadedEver      *int64              `json:"downloadedEver"`
+	PieceCount          *int64              `json:"pieceCount"`
+	PieceSize           *int64              `json:"pieceSize"`
+	IsPrivate           *bool               `json:"isPrivate"`
+	HonorsSessionLimits *bool               `json:"honorsSessionLimits"`
+	DownloadLimit       *int64              `json:"downloadLimit"`
+	DownloadLimited     *bool               `json:"downloadLimited"`
+	UploadLimit         *int64              `json:"uploadLimit"`
+	UploadLimited       *bool               `json:"uploadLimited"`
+	SeedRatioMode       *string             `json:"seedRatioMode"`
+	SeedRatioLimit      *float64            `json:"seedRatioLimit"`
+	PeersConnected      *int64              `json:"peersConnected"`
+	PeerLimit           *int64              `json:"peerLimit"`
+	SecondsDownloading  *int64              `json:"secondsDownloading"`
+	SecondsSeeding      *int64              `json:"secondsSeeding"`
+	WebSeeds            []string            `json:"webseeds"`
+	Trackers            []trackerEntry      `json:"trackers"`
+	Files               []fileEntry         `json:"files"`
+	Pieces              *string             `json:"pieces"`
+	TrackerStats        []trackerStatsEntry `json:"trackerStats"`
+	Peers               []peerEntry         `json:"peers"`
+}
+
+// errorRecord is a torrent error as listed by errors.
+type errorRecord struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Error       int64  `json:"error"`
+	ErrorString string `json:"errorString"`
+}
+
+// whichRecord is what which found out about a path. FileID is null for a
+// directory and everything but the path is null if no torrent has it.
+type whichRecord struct {
+	Path        string  `json:"path"`
+	TorrentID   *int64  `json:"torrentId"`
+	TorrentName *string `json:"torrentName"`
+	FileID      *int64  `json:"fileId"`
+}
+
+// groupRecord is the aggregate of a group of torrents as listed by
+// list --group-by. Group is null for the aggregate of all torrents.
+type groupRecord struct {
+	GroupBy      string  `json:"groupBy"`
+	Group        *string `json:"group"`
+	Torrents     int     `json:"torrents"`
+	SizeWhenDone int64   `json:"sizeWhenDone"`
+	Have         int64   `json:"have"`
+	UploadedEver int64   `json:"uploadedEver"`
+	UploadRatio  float64 `json:"uploadRatio"`
+	RateUpload   int64   `json:"rateUpload"`
+	RateDownload int64   `json:"rateDownload"`
+}
+
+// sessionRecord is what session shows: the session-get arguments the daemon
+// has, its session-stats and the free space of the download dir.
+type sessionRecord struct {
+	Session   *backend.Session      `json:"session"`
+	Stats     *backend.SessionStats `json:"stats"`
+	FreeSpace *int64                `json:"freeSpace"`
+}
+
+// finite replaces the NaN and infinities of divisions by zero, which JSON
+// can't represent.
+func finite(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+
+	return f
+}
+
+// The following return nil for a field the torrent doesn't have.
+
+func supported(t *backend.Torrent, field string, isNil bool) bool {
+	return !isNil && t.Supports(field)
+}
+
+func intField(t *backend.Torrent, field string, v *int64) *int64 {
+	if !supported(t, field, v == nil) {
+		return nil
+	}
+
+	return v
+}
+
+func stringField(t *backend.Torrent, field string, v *string) *string {
+	if !supported(t, field, v == nil) {
+		return nil
+	}
+
+	return v
+}
+
+func boolField(t *backend.Torrent, field string, v *bool) *bool {
+	if !supported(t, field, v == nil) {
+		return nil
+	}
+
+	return v
+}
+
+func floatField(t *backend.Torrent, field string, v *float64) *float64 {
+	if !supported(t, field, v == nil) {
+		return nil
+	}
+
+	f := finite(*v)
+
+	return &f
+}
+
+func bytesField(t *backend.Torrent, field string, v *cunits.Bits) *int64 {
+	if !supported(t, field, v == nil) {
+		return nil
+	}
+
+	n := int64(v.Byte())
+
+	return &n
+}
+
+func dateField(t *backend.Torrent, field string, v *time.Time) *int64 {
+	if !supported(t, field, v == nil) {
+		return nil
+	}
+
+	var seconds int64
+	if v.Unix() > 0 {
+		seconds = v.Unix()
+	}
+
+	return &seconds
+}
+
+func newTorrentRecord(t *backend.Torrent, conf *config.Config) torrentRecord {
+	status, _ := torrent.Status(t)
+	size := int64(t.SizeWhenDone.Byte())
+
+	return torrentRecord{
+		ID:                 *t.ID,
+		Name:               *t.Name,
+		HashString:         stringField(t, "hashString", t.HashString),
+		Status:             status,
+		Error:              *t.Error,
+		ErrorString:        *t.ErrorString,
+		SizeWhenDone:       size,
+		LeftUntilDone:      *t.LeftUntilDone,
+		Have:               torrent.Have(t),
+		PercentDone:        finite(float64(torrent.Have(t)) / float64(size)),
+		RecheckProgress:    *t.RecheckProgress,
+		Eta:                intField(t, "eta", t.Eta),
+		RateDownload:       intField(t, "rateDownload", t.RateDownload),
+		RateUpload:         intField(t, "rateUpload", t.RateUpload),
+		UploadedEver:       *t.UploadedEver,
+		UploadRatio:        finite(torrent.Ratio(t)),
+		Priority:           torrent.Priority(t),
+		Tracker:            torrent.NewFrom(t, conf).Trackershortname,
+		DownloadDir:        stringField(t, "downloadDir", t.DownloadDir),
+		AddedDate:          dateField(t, "addedDate", t.AddedDate),
+		DoneDate:           dateField(t, "doneDate", t.DoneDate),
+		StartDate:          dateField(t, "startDate", t.StartDate),
+		IsFinished:         boolField(t, "isFinished", t.IsFinished),
+		PeersGettingFromUs: intField(t, "peersGettingFromUs", t.PeersGettingFromUs),
+		PeersSendingToUs:   intField(t, "peersSendingToUs", t.PeersSendingToUs),
+		Labels:             labelsField(t),
+	}
+}
+
+func labelsField(t *backend.Torrent) []string {
+	if !t.Supports("labels") {
+		return nil
+	}
+
+	if t.Labels == nil {
+		return []string{}
+	}
+
+	return t.Labels
+}
+
+func newFileEntries(t *backend.Torrent) []fileEntry {
+	entries := make([]fileEntry, len(t.Files))
+
+	for i, f := range t.Files {
+		entries[i] = fileEntry{
+			Index:          int64(i),
+			Name:           f.Name,
+			Length:         f.Length,
+			BytesCompleted: f.BytesCompleted,
+			PercentDone:    torrent.FileProgress(t, int64(i)),
+			Priority:       torrent.FilePriority(t, int64(i)),
+			Wanted:         t.Wanted[i],
+		}
+	}
+
+	return entries
+}
+
+func newInfoRecord(t *backend.Torrent, conf *config.Config, sections infoSections) infoRecord {
+	record := infoRecord{
+		torrentRecord:       newTorrentRecord(t, conf),
+		MagnetLink:          stringField(t, "magnetLink", t.MagnetLink),
+		Comment:             stringField(t, "comment", t.Comment),
+		Creator:             stringField(t, "creator", t.Creator),
+		DateCreated:         dateField(t, "dateCreated", t.DateCreated),
+		ActivityDate:        dateField(t, "activityDate", t.ActivityDate),
+		TotalSize:           bytesField(t, "totalSize", t.TotalSize),
+		HaveValid:           intField(t, "haveValid", t.HaveValid),
+		HaveUnchecked:       intField(t, "haveUnchecked", t.HaveUnchecked),
+		CorruptEver:         intField(t, "corruptEver", t.CorruptEver),
+		DesiredAvailable:    intField(t, "desiredAvailable", t.DesiredAvailable),
+		DownloadedEver:      intField(t, "downloadedEver", t.DownloadedEver),
+		PieceCount:          intField(t, "pieceCount", t.PieceCount),
+		PieceSize:           bytesField(t, "pieceSize", t.PieceSize),
+		IsPrivate:           boolField(t, "isPrivate", t.IsPrivate),
+		HonorsSessionLimits: boolField(t, "honorsSessionLimits", t.HonorsSessionLimits),
+		DownloadLimit:       intField(t, "downloadLimit", t.DownloadLimit),
+		DownloadLimited:     boolField(t, "downloadLimited", t.DownloadLimited),
+		UploadLimit:         intField(t, "uploadLimit", t.UploadLimit),
+		UploadLimited:       boolField(t, "uploadLimited", t.UploadLimited),
+		SeedRatioLimit:      floatField(t, "seedRatioLimit", t.SeedRatioLimit),
+		PeersConnected:      intField(t, "peersConnected", t.PeersConnected),
+		PeerLimit:           intField(t, "peer-limit", t.PeerLimit),
+		SecondsDownloading:  intField(t, "secondsDownloading", t.SecondsDownloading),
+		WebSeeds:            t.WebSeeds,
+		Trackers:            make([]trackerEntry, len(t.Trackers)),
+		Files:               newFileEntries(t),
+	}
+
+	if supported(t, "seedRatioMode", t.SeedRatioMode == nil) {
+		mode := t.SeedRatioMode.String()
+		record.SeedRatioMode = &mode
+	}
+
+	if supported(t, "secondsSeeding", t.SecondsSeeding == nil) {
+		seconds := int64(t.SecondsSeeding.Seconds())
+		record.SecondsSeeding = &seconds
+	}
+
+	for i, tr := range t.Trackers {
+		record.Trackers[i] = trackerEntry{ID: tr.ID, Tier: tr.Tier, Announce: tr.Announce}
+	}
+
+	if sections.Pieces {
+		record.Pieces = stringField(t, "pieces", t.Pieces)
+	}
+
+	if sections.Trackers && t.Supports("trackerStats") {
+		record.TrackerStats = newTrackerStatsEntries(t)
+	}
+
+	if sections.Peers && t.Supports("peers") {
+		record.Peers = newPeerEntries(t)
+	}
+
+	return record
+}
+
+// unixSeconds returns a time as seconds since the epoch, 0 for never.
+func unixSeconds(t time.Time) int64 {
+	if t.Unix() < 0 {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+func newTrackerStatsEntries(t *backend.Torrent) []trackerStatsEntry {
+	entries := make([]trackerStatsEntry, len(t.TrackerStats))
+
+	for i, ts := range t.TrackerStats {
+		entries[i] = trackerStatsEntry{
+			trackerEntry:          trackerEntry{ID: ts.ID, Tier: ts.Tier, Announce: ts.Announce},
+			Host:                  ts.Host,
+			IsBackup:              ts.IsBackup,
+			LastAnnounceTime:      unixSeconds(ts.LastAnnounceTime),
+			LastAnnounceSucceeded: ts.LastAnnounceSucceeded,
+			LastAnnounceResult:    ts.LastAnnounceResult,
+			LastAnnouncePeerCount: ts.LastAnnouncePeerCount,
+			NextAnnounceTime:      unixSeconds(ts.NextAnnounceTime),
+			LastScrapeTime:        unixSeconds(ts.LastScrapeTime),
+			LastScrapeSucceeded:   ts.LastScrapeSucceeded,
+			LastScrapeResult:      ts.LastScrapeResult,
+			SeederCount:           ts.SeederCount,
+			LeecherCount:          ts.LeecherCount,
+			DownloadCount:         ts.DownloadCount,
+		}
+	}
+
+	return entries
+}
+
+func newPeerEntries(t *backend.Torrent) []peerEntry {
+	entries := make([]peerEntry, len(t.Peers))
+
+	for i, p := range t.Peers {
+		entries[i] = peerEntry{
+			Address:            p.Address,
+			Port:               p.Port,
+			ClientName:         p.ClientName,
+			Progress:           p.Progress,
+			RateToClient:       p.RateToClient,
+			RateToPeer:         p.RateToPeer,
+			FlagStr:            p.FlagStr,
+			IsEncrypted:        p.IsEncrypted,
+			IsUTP:              p.IsUTP,
+			IsIncoming:         p.IsIncoming,
+			IsDownloadingFrom:  p.IsDownloadingFrom,
+			IsUploadingTo:      p.IsUploadingTo,
+			ClientIsChoked:     p.ClientIsChoked,
+			ClientIsInterested: p.ClientIsInterested,
+			PeerIsChoked:       p.PeerIsChoked,
+			PeerIsInterested:   p.PeerIsInterested,
+		}
+	}
+
+	return entries
+}
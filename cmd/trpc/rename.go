@@ -1,14 +1,12 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
 	"path"
 	"strings"
 
 	"github.com/shric/trpc/internal/fileutils"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/util"
 )
 
@@ -25,28 +23,35 @@ func Rename(c *Command) {
 	opts, ok := c.Options.(renameOptions)
 	optionsCheck(ok)
 
-	finder := util.NewFinder(c.Client)
-
 	oldname := fileutils.RealPath(opts.Positional.Oldname)
 	newname := fileutils.RealPath(opts.Positional.Newname)
 
-	var torrent *transmissionrpc.Torrent
+	var torrent *backend.Torrent
 
 	if opts.ID != 0 {
 		torrents, err := c.Client.TorrentGet([]string{"id", "downloadDir", "name"}, []int64{opts.ID})
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Torrent ID %d not found.", opts.ID)
-			os.Exit(1)
+		if err != nil || len(torrents) == 0 {
+			c.errorf("Torrent ID %d not found.", opts.ID)
+			return
 		}
 
 		torrent = torrents[0]
 	} else {
-		torrent, _ = finder.Find(oldname)
+		finder, err := util.NewFinder(c.Client)
+		if err != nil {
+			c.errorf("%v", err)
+			return
+		}
+
+		if torrent, _, err = finder.Find(oldname); err != nil {
+			c.errorf("%v", err)
+			return
+		}
 	}
 
 	if torrent == nil {
-		fmt.Fprintln(os.Stderr, "Couldn't determine associated torrent from ", oldname)
-		os.Exit(1)
+		c.errorf("Couldn't determine associated torrent from %s", oldname)
+		return
 	}
 
 	realDownloadDir := fileutils.RealPath(*torrent.DownloadDir) + "/"
@@ -61,8 +66,7 @@ func Rename(c *Command) {
 	}
 
 	if err != nil {
-		fmt.Println("Rename: err: ", err)
-		os.Exit(1)
+		c.errorf("Rename: err: %v", err)
 	} else {
 		c.statusf("Renamed %s to %s", oldname, newname)
 	}
@@ -2,9 +2,8 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/util"
 )
@@ -22,23 +21,22 @@ func Rm(c *Command) {
 	optionsCheck(ok)
 
 	if len(opts.Pos.Torrents) == 0 && !opts.ForceAll {
-		fmt.Fprintln(os.Stderr, "Use --force-all if you really want to delete all torrents!")
+		fmt.Fprintln(c.Err, "Use --force-all if you really want to delete all torrents!")
 		return
 	}
 
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
-		func(torrent *transmissionrpc.Torrent) {
+	err := util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
+		func(torrent *backend.Torrent) {
 			if !c.CommonOptions.DryRun {
-				err := c.Client.TorrentRemove(&transmissionrpc.TorrentRemovePayload{
-					IDs:             []int64{*torrent.ID},
-					DeleteLocalData: opts.Nuke,
-				})
+				err := c.Client.TorrentRemove([]int64{*torrent.ID}, opts.Nuke)
 				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
-					os.Exit(1)
+					c.errorf("%v", err)
 					return
 				}
 			}
 			c.status("Removed torrent", torrent)
 		}, nil, false)
+	if err != nil {
+		c.errorf("%v", err)
+	}
 }
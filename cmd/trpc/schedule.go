@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// weekdays are the days of the alt-speed-time-day bitmask, from bit 0.
+var weekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// weekOrder is the order of weekdays people write weeks in, Monday first.
+var weekOrder = []int{1, 2, 3, 4, 5, 6, 0}
+
+// weekday returns the position in weekOrder of a day name, -1 if it isn't
+// one.
+func weekday(name string) int {
+	for pos, day := range weekOrder {
+		if strings.EqualFold(weekdays[day], strings.TrimSpace(name)) {
+			return pos
+		}
+	}
+
+	return -1
+}
+
+// formatDays shows an alt-speed-time-day bitmask as ranges of days, e.g.
+// Mon-Fri or Mon,Wed,Sat-Sun.
+func formatDays(mask int64) string {
+	var runs []string
+
+	for pos := 0; pos < len(weekOrder); pos++ {
+		if mask&(1<<uint(weekOrder[pos])) == 0 {
+			continue
+		}
+
+		end := pos
+		for end+1 < len(weekOrder) && mask&(1<<uint(weekOrder[end+1])) != 0 {
+			end++
+		}
+
+		run := weekdays[weekOrder[pos]]
+		if end > pos {
+			run += "-" + weekdays[weekOrder[end]]
+		}
+
+		runs = append(runs, run)
+		pos = end
+	}
+
+	if len(runs) == 0 {
+		return "never"
+	}
+
+	return strings.Join(runs, ",")
+}
+
+// parseDays takes days as formatDays shows them, a bitmask, or every day,
+// weekdays or weekends. Ranges may wrap around the end of the week, e.g.
+// Fri-Mon. A bitmask has one bit per day, so it's at most 127.
+func parseDays(s string) (int64, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "every day", "daily":
+		return 127, nil
+	case "weekdays":
+		return 62, nil
+	case "weekends":
+		return 65, nil
+	case "never":
+		return 0, nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, inRange(n, 0, 127)
+	}
+
+	bad := fmt.Errorf("must be a bitmask, every day, weekdays, weekends, never or days such as Mon-Fri or Sat,Sun")
+
+	var mask int64
+
+	for _, run := range strings.Split(s, ",") {
+		names := strings.SplitN(run, "-", 2)
+
+		first := weekday(names[0])
+		last := first
+
+		if len(names) == 2 {
+			last = weekday(names[1])
+		}
+
+		if first < 0 || last < 0 {
+			return 0, bad
+		}
+
+		for pos := first; ; pos = (pos + 1) % len(weekOrder) {
+			mask |= 1 << uint(weekOrder[pos])
+
+			if pos == last {
+				break
+			}
+		}
+	}
+
+	return mask, nil
+}
+
+var clockTime = regexp.MustCompile(`^(\d{1,2}):([0-5]\d)$`)
+
+// parseClock takes a time of day as HH:MM and returns the minutes after
+// midnight.
+func parseClock(s string) (int64, bool) {
+	m := clockTime.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+
+	hours, _ := strconv.ParseInt(m[1], 10, 64)
+	minutes, _ := strconv.ParseInt(m[2], 10, 64)
+
+	return hours*60 + minutes, hours < 24
+}
+
+// formatMinutes shows minutes after midnight as HH:MM.
+func formatMinutes(minutes int64) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// formatSchedule shows an alt speed schedule, e.g. "Mon-Fri 09:00-18:00".
+func formatSchedule(begin, end, days int64) string {
+	return formatDays(days) + " " + formatMinutes(begin) + "-" + formatMinutes(end)
+}
+
+// parseSchedule takes an alt speed schedule as formatSchedule shows it. The
+// days may be left out for every day.
+func parseSchedule(s string) (begin, end, days int64, err error) {
+	s = strings.TrimSpace(s)
+	times, daysPart := s, "every day"
+
+	if i := strings.LastIndex(s, " "); i >= 0 {
+		daysPart, times = s[:i], s[i+1:]
+	}
+
+	bad := fmt.Errorf("invalid schedule %q: expected days and times such as \"Mon-Fri 09:00-18:00\"", s)
+
+	hours := strings.Split(times, "-")
+	if len(hours) != 2 {
+		return 0, 0, 0, bad
+	}
+
+	var ok1, ok2 bool
+
+	begin, ok1 = parseClock(hours[0])
+	end, ok2 = parseClock(hours[1])
+
+	if !ok1 || !ok2 {
+		return 0, 0, 0, bad
+	}
+
+	if days, err = parseDays(daysPart); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid schedule %q: days %v", s, err)
+	}
+
+	return begin, end, days, nil
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import "testing"
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+		err  string
+	}{
+		{"Mon-Fri 09:00-18:00", "Mon-Fri 09:00-18:00", ""},
+		{"mon,tue,wed,thu,fri 9:00-18:00", "Mon-Fri 09:00-18:00", ""},
+		{"Sat,Sun 22:00-06:30", "Sat-Sun 22:00-06:30", ""},
+		{"Fri-Mon 00:00-23:59", "Mon,Fri-Sun 00:00-23:59", ""},
+		{"Mon,Wed,Fri 01:00-07:00", "Mon,Wed,Fri 01:00-07:00", ""},
+		{"weekends 12:00-13:00", "Sat-Sun 12:00-13:00", ""},
+		{"every day 12:00-13:00", "Mon-Sun 12:00-13:00", ""},
+		{"12:00-13:00", "Mon-Sun 12:00-13:00", ""},
+		{"never 12:00-13:00", "never 12:00-13:00", ""},
+		{"Mon-Fri 24:00-18:00", "", `invalid schedule "Mon-Fri 24:00-18:00": expected days and times such as "Mon-Fri 09:00-18:00"`},
+		{"Mon-Fri 09:00", "", `invalid schedule "Mon-Fri 09:00": expected days and times such as "Mon-Fri 09:00-18:00"`},
+		{"Mon-Fry 09:00-18:00", "", `invalid schedule "Mon-Fry 09:00-18:00": days must be a bitmask, every day, weekdays, weekends, never or days such as Mon-Fri or Sat,Sun`},
+		{"62 09:00-18:00", "Mon-Fri 09:00-18:00", ""},
+		{"200 09:00-18:00", "", `invalid schedule "200 09:00-18:00": days must be between 0 and 127`},
+		{"-1 09:00-18:00", "", `invalid schedule "-1 09:00-18:00": days must be between 0 and 127`},
+	}
+
+	for _, tt := range tests {
+		var got, msg string
+
+		begin, end, days, err := parseSchedule(tt.arg)
+		if err != nil {
+			msg = err.Error()
+		} else {
+			got = formatSchedule(begin, end, days)
+		}
+
+		if got != tt.want || msg != tt.err {
+			t.Errorf("parseSchedule(%q) = %q, %q, want %q, %q", tt.arg, got, msg, tt.want, tt.err)
+		}
+	}
+}
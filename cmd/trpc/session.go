@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+type sessionOptions struct {
+	Set    sessionSetOptions    `command:"set" description:"Change session settings, e.g. peer-port=51413"`
+	Export struct{}             `command:"export" description:"Print the session settings as TOML, for session import"`
+	Import sessionImportOptions `command:"import" description:"Change the session settings to those of a session export"`
+}
+
+// Session shows the settings and statistics of the session.
+func Session(c *Command) {
+	session, err := c.Client.SessionGet()
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	stats, err := c.Client.SessionStats()
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	// Not every daemon can tell, which is no reason not to show the rest.
+	var free *int64
+
+	if session.DownloadDir != nil {
+		if space, err := c.Client.FreeSpace(*session.DownloadDir); err == nil {
+			free = &space
+		}
+	}
+
+	if c.records != nil {
+		c.record(sessionRecord{Session: session, Stats: stats, FreeSpace: free})
+		return
+	}
+
+	fmt.Fprint(c.Out, sessionInfo(c.Client.Name(), session, stats, free))
+}
+
+// sessionInfo returns the session settings and statistics in sections, like
+// info does for torrents.
+func sessionInfo(client string, s *backend.Session, stats *backend.SessionStats, free *int64) string {
+	var b strings.Builder
+
+	section := func(title string) {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+
+		b.WriteString(title + "\n")
+	}
+
+	line := func(key, value string) {
+		fmt.Fprintf(&b, "  %s: %s\n", key, value)
+	}
+
+	version := client
+	if s.Version != nil {
+		version += " " + *s.Version
+	}
+
+	section("SESSION")
+	line("Version", version)
+	line("RPC version", rpcVersion(s))
+	line("Config dir", optString(s.ConfigDir))
+
+	section("DIRECTORIES")
+	line("Download dir", optString(s.DownloadDir))
+	line("Free space", optValue(torrent.KindBytes, free))
+	line("Incomplete dir", enabled(optString(s.IncompleteDir), s.IncompleteDirEnabled))
+	line("Rename partial files", optBool(s.RenamePartialFiles))
+	line("Start added torrents", optBool(s.StartAddedTorrents))
+	line("Done script", enabled(optString(s.ScriptTorrentDoneFilename), s.ScriptTorrentDoneEnabled))
+
+	section("NETWORK")
+	line("Peer port", optInt(s.PeerPort))
+	line("Random port on start", optBool(s.PeerPortRandomOnStart))
+	line("Port forwarding", optBool(s.PortForwardingEnabled))
+	line("Peer limit", optInt(s.PeerLimitGlobal))
+	line("Peer limit per torrent", optInt(s.PeerLimitPerTorrent))
+	line("Encryption", optString(s.Encryption))
+	line("DHT", optBool(s.DHTEnabled))
+	line("PEX", optBool(s.PEXEnabled))
+	line("LPD", optBool(s.LPDEnabled))
+	line("uTP", optBool(s.UTPEnabled))
+	line("Blocklist", enabled(optString(s.BlocklistURL), s.BlocklistEnabled))
+
+	section("LIMITS")
+	line("Download", speedLimit(s.SpeedLimitDown, s.SpeedLimitDownEnabled))
+	line("Upload", speedLimit(s.SpeedLimitUp, s.SpeedLimitUpEnabled))
+	line("Alt speeds", optOn(s.AltSpeedEnabled))
+	line("Alt download", speedLimit(s.AltSpeedDown, nil))
+	line("Alt upload", speedLimit(s.AltSpeedUp, nil))
+	line("Alt speed schedule", altSpeedSchedule(s))
+	line("Seed ratio", seedRatio(s))
+	line("Idle seeding limit", enabled(minutes(s.IdleSeedingLimit), s.IdleSeedingLimitEnabled))
+
+	section("QUEUES")
+	line("Download queue", enabled(optInt(s.DownloadQueueSize), s.DownloadQueueEnabled))
+	line("Seed queue", enabled(optInt(s.SeedQueueSize), s.SeedQueueEnabled))
+	line("Stalled after", enabled(minutes(s.QueueStalledMinutes), s.QueueStalledEnabled))
+
+	section("STATISTICS")
+	line("Torrents", fmt.Sprintf("%s (%s active, %s paused)",
+		optInt(stats.TorrentCount), optInt(stats.ActiveTorrentCount), optInt(stats.PausedTorrentCount)))
+	line("Upload rate", optValue(torrent.KindRate, stats.UploadSpeed))
+	line("Download rate", optValue(torrent.KindRate, stats.DownloadSpeed))
+
+	for _, period := range []struct {
+		title string
+		stats backend.Stats
+	}{
+		{"CURRENT SESSION", stats.Current},
+		{"ALL SESSIONS", stats.Cumulative},
+	} {
+		st := period.stats
+
+		section(period.title)
+		line("Uploaded", optValue(torrent.KindBytes, st.UploadedBytes))
+		line("Downloaded", optValue(torrent.KindBytes, st.DownloadedBytes))
+		line("Ratio", transferRatio(st))
+		line("Files added", optInt(st.FilesAdded))
+		line("Sessions", optInt(st.SessionCount))
+		line("Active", optValue(torrent.KindDuration, st.SecondsActive))
+	}
+
+	return b.String()
+}
+
+func optString(s *string) string {
+	if s == nil {
+		return backend.Unsupported
+	}
+
+	return *s
+}
+
+func optInt(n *int64) string {
+	if n == nil {
+		return backend.Unsupported
+	}
+
+	return fmt.Sprint(*n)
+}
+
+func optBool(v *bool) string {
+	switch {
+	case v == nil:
+		return backend.Unsupported
+	case *v:
+		return "yes"
+	}
+
+	return "no"
+}
+
+func optOn(v *bool) string {
+	switch {
+	case v == nil:
+		return backend.Unsupported
+	case *v:
+		return "on"
+	}
+
+	return "off"
+}
+
+// optValue shows a number as list shows a field of kind.
+func optValue(kind torrent.Kind, n *int64) string {
+	if n == nil {
+		return backend.Unsupported
+	}
+
+	return (&torrent.Field{Kind: kind}).Display(*n)
+}
+
+// enabled marks a setting as disabled when it's switched off.
+func enabled(value string, on *bool) string {
+	if on != nil && !*on {
+		return value + " (disabled)"
+	}
+
+	return value
+}
+
+func minutes(n *int64) string {
+	if n == nil {
+		return backend.Unsupported
+	}
+
+	return fmt.Sprintf("%d mins", *n)
+}
+
+// speedLimit shows a limit in KB/sec, as set takes it.
+func speedLimit(limit *int64, on *bool) string {
+	switch {
+	case on != nil && !*on:
+		return "unlimited"
+	case limit == nil:
+		return backend.Unsupported
+	}
+
+	return fmt.Sprintf("%d KB/sec", *limit)
+}
+
+func rpcVersion(s *backend.Session) string {
+	version := optInt(s.RPCVersion)
+	if s.RPCVersionMinimum != nil {
+		version += fmt.Sprintf(" (minimum %d)", *s.RPCVersionMinimum)
+	}
+
+	return version
+}
+
+func seedRatio(s *backend.Session) string {
+	switch {
+	case s.SeedRatioLimited != nil && !*s.SeedRatioLimited:
+		return "unlimited"
+	case s.SeedRatioLimit == nil:
+		return backend.Unsupported
+	}
+
+	return fmt.Sprintf("%.2f", *s.SeedRatioLimit)
+}
+
+// altSpeedSchedule shows when the alternative speed limits are on, e.g.
+// "Mon-Fri 09:00-18:00".
+func altSpeedSchedule(s *backend.Session) string {
+	if s.AltSpeedTimeBegin == nil || s.AltSpeedTimeEnd == nil || s.AltSpeedTimeDay == nil {
+		return backend.Unsupported
+	}
+
+	return enabled(formatSchedule(*s.AltSpeedTimeBegin, *s.AltSpeedTimeEnd, *s.AltSpeedTimeDay), s.AltSpeedTimeEnabled)
+}
+
+func transferRatio(st backend.Stats) string {
+	if st.UploadedBytes == nil || st.DownloadedBytes == nil {
+		return backend.Unsupported
+	}
+
+	return fmt.Sprintf("%.2f", finite(float64(*st.UploadedBytes)/float64(*st.DownloadedBytes)))
+}
@@ -0,0 +1,439 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+type sessionSetOptions struct {
+	Pos struct {
+		Settings []string `positional-arg-name:"key=value" required:"1" description:"session-set argument, e.g. peer-port=51413"`
+	} `positional-args:"true"`
+}
+
+type sessionImportOptions struct {
+	Pos struct {
+		File string `positional-arg-name:"file" required:"true" description:"file written by session export, - for stdin"`
+	} `positional-args:"true"`
+	// data is what SessionImportRead read from the file.
+	data []byte
+}
+
+// readOnlySettings are the session-get arguments session-set doesn't take.
+var readOnlySettings = map[string]bool{
+	"blocklist-size":      true,
+	"config-dir":          true,
+	"rpc-version":         true,
+	"rpc-version-minimum": true,
+	"session-id":          true,
+	"version":             true,
+}
+
+// sessionField returns the index of the backend.Session field of a
+// session-set argument, -1 if there's none.
+func sessionField(key string) int {
+	t := reflect.TypeOf(backend.Session{})
+
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// settingKeys returns the session-set arguments in the order of
+// backend.Session.
+func settingKeys() []string {
+	var keys []string
+
+	t := reflect.TypeOf(backend.Session{})
+
+	for i := 0; i < t.NumField(); i++ {
+		if key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; !readOnlySettings[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// settingChecks validate the values of settings beyond their type. Numbers
+// without a check can't be negative.
+var settingChecks = map[string]func(value interface{}) error{
+	"peer-port": func(v interface{}) error {
+		return inRange(v.(int64), 1, 65535)
+	},
+	"alt-speed-time-begin": checkMinutes,
+	"alt-speed-time-end":   checkMinutes,
+	"encryption": func(v interface{}) error {
+		switch v.(string) {
+		case "required", "preferred", "tolerated":
+			return nil
+		}
+
+		return fmt.Errorf("must be required, preferred or tolerated")
+	},
+	"download-dir":                 checkAbsolute,
+	"incomplete-dir":               optional(checkAbsolute),
+	"script-torrent-done-filename": optional(checkAbsolute),
+	"blocklist-url": optional(func(v interface{}) error {
+		if u, err := url.Parse(v.(string)); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("must be an http or https URL")
+		}
+
+		return nil
+	}),
+}
+
+// optional lets a string setting of a check be empty, as daemons have them
+// by default.
+func optional(check func(v interface{}) error) func(v interface{}) error {
+	return func(v interface{}) error {
+		if v.(string) == "" {
+			return nil
+		}
+
+		return check(v)
+	}
+}
+
+func inRange(n, min, max int64) error {
+	if n < min || n > max {
+		return fmt.Errorf("must be between %d and %d", min, max)
+	}
+
+	return nil
+}
+
+// checkMinutes checks minutes after midnight.
+func checkMinutes(v interface{}) error {
+	return inRange(v.(int64), 0, 24*60-1)
+}
+
+// checkAbsolute checks a path of the daemon's machine, which may run
+// Windows.
+func checkAbsolute(v interface{}) error {
+	p := v.(string)
+	if path.IsAbs(p) || len(p) > 2 && p[1] == ':' {
+		return nil
+	}
+
+	return fmt.Errorf("must be an absolute path")
+}
+
+// parseBool takes the usual ways of saying yes or no.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("must be true or false")
+}
+
+// parseMinutes takes minutes after midnight as a number or as HH:MM.
+func parseMinutes(s string) (int64, error) {
+	if minutes, ok := parseClock(s); ok {
+		return minutes, nil
+	}
+
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseSetting converts the value of a session-set argument to the type of
+// its backend.Session field and validates it.
+func parseSetting(key, s string) (interface{}, error) {
+	i := sessionField(key)
+
+	switch {
+	case i < 0:
+		return nil, fmt.Errorf("unknown session setting %s", key)
+	case readOnlySettings[key]:
+		return nil, fmt.Errorf("%s can't be changed", key)
+	}
+
+	var (
+		value interface{}
+		err   error
+	)
+
+	switch reflect.TypeOf(backend.Session{}).Field(i).Type.Elem().Kind() {
+	case reflect.Bool:
+		value, err = parseBool(s)
+	case reflect.Int64:
+		var n int64
+
+		switch key {
+		case "alt-speed-time-begin", "alt-speed-time-end":
+			n, err = parseMinutes(s)
+		case "alt-speed-time-day":
+			n, err = parseDays(s)
+		default:
+			n, err = strconv.ParseInt(s, 10, 64)
+		}
+
+		if err == nil && n < 0 && settingChecks[key] == nil {
+			err = fmt.Errorf("can't be negative")
+		}
+
+		if _, ok := err.(*strconv.NumError); ok {
+			err = fmt.Errorf("must be a whole number")
+		}
+
+		value = n
+	case reflect.Float64:
+		var f float64
+
+		if f, err = strconv.ParseFloat(s, 64); err != nil {
+			err = fmt.Errorf("must be a number")
+		} else if f < 0 {
+			err = fmt.Errorf("can't be negative")
+		}
+
+		value = f
+	default:
+		value = s
+	}
+
+	if err == nil && settingChecks[key] != nil {
+		err = settingChecks[key](value)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", key, s, err)
+	}
+
+	return value, nil
+}
+
+// sessionValue returns the value of a setting, nil if the session hasn't got
+// it.
+func sessionValue(s *backend.Session, key string) interface{} {
+	field := reflect.ValueOf(s).Elem().Field(sessionField(key))
+	if field.IsNil() {
+		return nil
+	}
+
+	return field.Elem().Interface()
+}
+
+// setSessionValue sets a setting of the session.
+func setSessionValue(s *backend.Session, key string, value interface{}) {
+	field := reflect.ValueOf(s).Elem().Field(sessionField(key))
+	v := reflect.New(field.Type().Elem())
+	v.Elem().Set(reflect.ValueOf(value))
+	field.Set(v)
+}
+
+// showSetting shows the value of a setting in the diff of session set.
+func showSetting(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return backend.Unsupported
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// setting is a session-set argument and its value.
+type setting struct {
+	key   string
+	value interface{}
+}
+
+// applySettings shows how settings change the session, then changes it
+// unless it's a dry run. Settings that don't change are only shown if asked
+// to.
+func applySettings(c *Command, settings []setting, showUnchanged bool) {
+	current, err := c.Client.SessionGet()
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	payload := &backend.Session{}
+	changed := false
+
+	for _, s := range settings {
+		old := sessionValue(current, s.key)
+		if reflect.DeepEqual(old, s.value) {
+			if showUnchanged {
+				c.statusf("%s: %s (unchanged)", s.key, showSetting(old))
+			}
+
+			continue
+		}
+
+		c.statusf("%s: %s -> %s", s.key, showSetting(old), showSetting(s.value))
+		setSessionValue(payload, s.key, s.value)
+
+		changed = true
+	}
+
+	if !changed && !showUnchanged {
+		c.statusf("No session settings to change")
+	}
+
+	if !changed || c.CommonOptions.DryRun {
+		return
+	}
+
+	if err := c.Client.SessionSet(payload); err != nil {
+		c.errorf("%v", err)
+	}
+}
+
+// SessionSet changes session settings given as key=value.
+func SessionSet(c *Command) {
+	opts, ok := c.Options.(sessionSetOptions)
+	optionsCheck(ok)
+
+	settings := make([]setting, 0, len(opts.Pos.Settings))
+	seen := make(map[string]bool)
+
+	for _, arg := range opts.Pos.Settings {
+		eq := strings.Index(arg, "=")
+		if eq < 0 {
+			c.errorf("expected key=value, got %q", arg)
+			return
+		}
+
+		key := arg[:eq]
+		if seen[key] {
+			c.errorf("%s is given more than once", key)
+			return
+		}
+
+		seen[key] = true
+
+		value, err := parseSetting(key, arg[eq+1:])
+		if err != nil {
+			c.errorf("%v", err)
+			return
+		}
+
+		settings = append(settings, setting{key, value})
+	}
+
+	applySettings(c, settings, true)
+}
+
+// SessionExport prints the session settings as TOML, for SessionImport.
+func SessionExport(c *Command) {
+	session, err := c.Client.SessionGet()
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	tree, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	for _, key := range settingKeys() {
+		if value := sessionValue(session, key); value != nil {
+			tree.Set(key, value)
+		}
+	}
+
+	text, err := tree.ToTomlString()
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	fmt.Fprintf(c.Out, "# %s session settings, for trpc session import\n%s", c.Client.Name(), text)
+}
+
+// SessionImportRead reads the file of SessionImport once, as stdin can't be
+// read again for each daemon.
+func SessionImportRead(c *Command) error {
+	opts, ok := c.Options.(sessionImportOptions)
+	optionsCheck(ok)
+
+	var err error
+
+	if opts.Pos.File == "-" {
+		opts.data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		opts.data, err = ioutil.ReadFile(opts.Pos.File)
+	}
+
+	c.Options = opts
+
+	return err
+}
+
+// SessionImport changes session settings to those of a file written by
+// SessionExport.
+func SessionImport(c *Command) {
+	opts, ok := c.Options.(sessionImportOptions)
+	optionsCheck(ok)
+
+	tree, err := toml.LoadBytes(opts.data)
+	if err != nil {
+		c.errorf("%s: %v", opts.Pos.File, err)
+		return
+	}
+
+	keys := settingKeys()
+	known := make(map[string]bool)
+
+	for _, key := range keys {
+		known[key] = true
+	}
+
+	for _, key := range tree.Keys() {
+		if !known[key] {
+			_, err := parseSetting(key, "")
+			c.errorf("%s: %v", opts.Pos.File, err)
+
+			return
+		}
+	}
+
+	var settings []setting
+
+	// In the order of session export, whatever the order of the file.
+	for _, key := range keys {
+		raw := tree.Get(key)
+
+		switch raw.(type) {
+		case nil:
+			continue
+		case *toml.Tree:
+			c.errorf("%s: unexpected table [%s]", opts.Pos.File, key)
+			return
+		}
+
+		value, err := parseSetting(key, fmt.Sprint(raw))
+		if err != nil {
+			c.errorf("%s: %v", opts.Pos.File, err)
+			return
+		}
+
+		settings = append(settings, setting{key, value})
+	}
+
+	applySettings(c, settings, false)
+}
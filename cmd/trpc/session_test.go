@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shric/trpc/internal/backend/transmission/transmissiontest"
+)
+
+func TestParseSetting(t *testing.T) {
+	tests := []struct {
+		arg   string
+		value interface{}
+		err   string
+	}{
+		{"peer-port=51413", int64(51413), ""},
+		{"peer-port=0", nil, `invalid peer-port "0": must be between 1 and 65535`},
+		{"dht-enabled=yes", true, ""},
+		{"dht-enabled=maybe", nil, `invalid dht-enabled "maybe": must be true or false`},
+		{"speed-limit-down=-1", nil, `invalid speed-limit-down "-1": can't be negative`},
+		{"speed-limit-down=fast", nil, `invalid speed-limit-down "fast": must be a whole number`},
+		{"seedRatioLimit=1.5", 1.5, ""},
+		{"alt-speed-time-end=17:30", int64(1050), ""},
+		{"alt-speed-time-end=1440", nil, `invalid alt-speed-time-end "1440": must be between 0 and 1439`},
+		{"alt-speed-time-day=weekends", int64(65), ""},
+		{"alt-speed-time-day=mon,Wed", int64(10), ""},
+		{"alt-speed-time-day=128", nil, `invalid alt-speed-time-day "128": must be between 0 and 127`},
+		{"alt-speed-time-day=someday", nil, `invalid alt-speed-time-day "someday": must be a bitmask, every day, weekdays, weekends, never or days such as Mon-Fri or Sat,Sun`},
+		{"download-dir=C:\\Downloads", "C:\\Downloads", ""},
+		{"download-dir=downloads", nil, `invalid download-dir "downloads": must be an absolute path`},
+		{"script-torrent-done-filename=", "", ""},
+		{"blocklist-url=ftp://example.com/list", nil, `invalid blocklist-url "ftp://example.com/list": must be an http or https URL`},
+		{"rpc-version=1", nil, "rpc-version can't be changed"},
+	}
+
+	for _, tt := range tests {
+		key, value := tt.arg, ""
+		if i := strings.Index(tt.arg, "="); i >= 0 {
+			key, value = tt.arg[:i], tt.arg[i+1:]
+		}
+
+		got, err := parseSetting(key, value)
+
+		var msg string
+		if err != nil {
+			msg = err.Error()
+		}
+
+		if msg != tt.err || !reflect.DeepEqual(got, tt.value) {
+			t.Errorf("parseSetting(%q) = %v, %q, want %v, %q", tt.arg, got, msg, tt.value, tt.err)
+		}
+	}
+}
+
+func TestSessionExportImport(t *testing.T) {
+	dir := testDir(t)
+
+	from := transmissiontest.NewServer()
+	defer from.Close()
+
+	fixture(from, dir)
+
+	var export, stderr bytes.Buffer
+	if status := Main([]string{"session", "export", "--host", from.RPCURL()}, &export, &stderr); status != 0 {
+		t.Fatalf("session export: exit status %d: %s", status, stderr.String())
+	}
+
+	file := filepath.Join(dir, "exported.toml")
+	if err := ioutil.WriteFile(file, export.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	to := transmissiontest.NewServer()
+	defer to.Close()
+
+	if status := Main([]string{"session", "import", file, "--host", to.RPCURL()}, ioutil.Discard, &stderr); status != 0 {
+		t.Fatalf("session import: exit status %d: %s", status, stderr.String())
+	}
+
+	for _, key := range settingKeys() {
+		want, ok := from.Session[key]
+		if !ok {
+			continue
+		}
+
+		// The fake daemon keeps what it's sent as JSON decoded it.
+		if got := to.Session[key]; !reflect.DeepEqual(normalize(got), normalize(want)) {
+			t.Errorf("%s = %v after import, want %v", key, got, want)
+		}
+	}
+}
+
+// normalize makes numbers comparable whatever their Go type.
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	}
+
+	return v
+}
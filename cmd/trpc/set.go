@@ -3,9 +3,8 @@ package cmd
 import (
 	"fmt"
 	"math"
-	"os"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/util"
 
 	"github.com/shric/trpc/internal/filter"
@@ -26,7 +25,7 @@ func SessionLimit(c *Command) {
 	opts, ok := c.Options.(setOptions)
 	optionsCheck(ok)
 
-	payload := &transmissionrpc.SessionArguments{}
+	payload := &backend.Session{}
 	speedLimitDownEnabled := false
 	speedLimitUpEnabled := false
 
@@ -61,15 +60,15 @@ func SessionLimit(c *Command) {
 	}
 
 	if !c.CommonOptions.DryRun {
-		err := c.Client.SessionArgumentsSet(payload)
+		err := c.Client.SessionSet(payload)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			c.errorf("%v", err)
 			return
 		}
 	}
 }
 
-func setUploadLimit(payload *transmissionrpc.TorrentSetPayload, opts setOptions) string {
+func setUploadLimit(payload *backend.TorrentSetPayload, opts setOptions) string {
 	uploadLimited := false
 
 	switch {
@@ -90,7 +89,7 @@ func setUploadLimit(payload *transmissionrpc.TorrentSetPayload, opts setOptions)
 	return ""
 }
 
-func setDownloadLimit(payload *transmissionrpc.TorrentSetPayload, opts setOptions) string {
+func setDownloadLimit(payload *backend.TorrentSetPayload, opts setOptions) string {
 	downloadLimited := false
 
 	switch {
@@ -117,7 +116,7 @@ const (
 	trPriHigh   = 1
 )
 
-func setPriority(payload *transmissionrpc.TorrentSetPayload, opts setOptions) string {
+func setPriority(payload *backend.TorrentSetPayload, opts setOptions) string {
 	var priority int64
 	payload.BandwidthPriority = &priority
 
@@ -143,11 +142,11 @@ func TorrentLimit(c *Command) {
 
 	firstTorrent := true
 
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:], func(torrent *transmissionrpc.Torrent) {
+	err := util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:], func(torrent *backend.Torrent) {
 		IDs := make([]int64, 1)
 		IDs[0] = *torrent.ID
 
-		payload := &transmissionrpc.TorrentSetPayload{IDs: IDs}
+		payload := &backend.TorrentSetPayload{IDs: IDs}
 
 		if message := setDownloadLimit(payload, opts); message != "" && firstTorrent {
 			c.statusf(message)
@@ -162,7 +161,7 @@ func TorrentLimit(c *Command) {
 		}
 
 		if firstTorrent {
-			fmt.Println()
+			fmt.Fprintln(c.Out)
 		}
 
 		firstTorrent = false
@@ -171,11 +170,14 @@ func TorrentLimit(c *Command) {
 		if !c.CommonOptions.DryRun {
 			err := c.Client.TorrentSet(payload)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
+				c.errorf("%v", err)
 				return
 			}
 		}
 	}, nil, false)
+	if err != nil {
+		c.errorf("%v", err)
+	}
 }
 
 // Set implements the limit command.
@@ -184,24 +186,24 @@ func Set(c *Command) {
 	optionsCheck(ok)
 
 	if opts.UpLimit == math.MaxInt64 && opts.DownLimit == math.MaxInt64 && opts.Priority == "" {
-		fmt.Fprint(os.Stderr, "Must specify either --down, --up, or --priority\n")
+		fmt.Fprint(c.Err, "Must specify either --down, --up, or --priority\n")
 		return
 	}
 
 	if len(opts.Pos.Torrents) == 0 && !opts.ForceAll && !opts.Session {
-		fmt.Fprintln(os.Stderr,
+		fmt.Fprintln(c.Err,
 			"Use --force-all if you really want to set all torrents, use --session if you want to apply a session limit")
 		return
 	}
 
 	if opts.Session && opts.Priority != "" {
-		fmt.Fprintf(os.Stderr,
+		fmt.Fprintf(c.Err,
 			"--session isn't compatible with --priority. Priorities can only be set on torrents or files (with fset command)")
 		return
 	}
 
 	if opts.Session && len(opts.Pos.Torrents) != 0 {
-		fmt.Fprintln(os.Stderr,
+		fmt.Fprintln(c.Err,
 			"Do not specify any torrents if using --session")
 		return
 	}
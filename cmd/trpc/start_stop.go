@@ -1,10 +1,7 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
-
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/util"
 )
@@ -20,25 +17,22 @@ func Start(c *Command) {
 	opts, ok := c.Options.(startOptions)
 	optionsCheck(ok)
 
-	startFunc := c.Client.TorrentStartIDs
-
-	if opts.Now {
-		startFunc = c.Client.TorrentStartNowIDs
-	}
-
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
-		func(torrent *transmissionrpc.Torrent) {
-			if *torrent.Status != transmissionrpc.TorrentStatusStopped {
+	err := util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
+		func(torrent *backend.Torrent) {
+			if *torrent.Status != backend.StatusStopped {
 				return
 			}
 			if !c.CommonOptions.DryRun {
-				err := startFunc([]int64{*torrent.ID})
+				err := c.Client.TorrentStart([]int64{*torrent.ID}, opts.Now)
 				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
+					c.errorf("%v", err)
 				}
 			}
 			c.status("Started torrent", torrent)
 		}, nil, false)
+	if err != nil {
+		c.errorf("%v", err)
+	}
 }
 
 type stopOptions struct {
@@ -50,17 +44,20 @@ type stopOptions struct {
 func Stop(c *Command) {
 	opts, ok := c.Options.(stopOptions)
 	optionsCheck(ok)
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
-		func(torrent *transmissionrpc.Torrent) {
-			if *torrent.Status == transmissionrpc.TorrentStatusStopped {
+	err := util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
+		func(torrent *backend.Torrent) {
+			if *torrent.Status == backend.StatusStopped {
 				return
 			}
 			if !c.CommonOptions.DryRun {
-				err := c.Client.TorrentStopIDs([]int64{*torrent.ID})
+				err := c.Client.TorrentStop([]int64{*torrent.ID})
 				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
+					c.errorf("%v", err)
 				}
 			}
 			c.status("Stopped torrent", torrent)
 		}, nil, false)
+	if err != nil {
+		c.errorf("%v", err)
+	}
 }
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/terminal"
+)
+
+// The --color choices.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ANSI SGR parameters of the colours used.
+const (
+	colorBold   = "1"
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+	colorGrey   = "90"
+)
+
+// display describes where the output of a command goes.
+type display struct {
+	// width is the number of columns of the terminal, or 0 for output to
+	// something else, which is never truncated.
+	width int
+	color bool
+}
+
+// terminalWidth returns the width of the terminal w is, and false if it isn't
+// one. Tests replace it.
+var terminalWidth = func(w io.Writer) (int, bool) {
+	if f, ok := w.(*os.File); ok {
+		return terminal.Width(f)
+	}
+
+	return 0, false
+}
+
+// newDisplay describes stdout for the --color choice. Colours are used on a
+// terminal unless $NO_COLOR is set, or always or never as asked.
+func newDisplay(stdout io.Writer, color string) display {
+	width, isTerminal := terminalWidth(stdout)
+	d := display{width: width}
+
+	switch color {
+	case colorAlways:
+		d.color = true
+	case colorNever:
+	default:
+		_, noColor := os.LookupEnv("NO_COLOR")
+		d.color = isTerminal && !noColor
+	}
+
+	return d
+}
+
+// terminal returns true if output goes to a terminal.
+func (d display) terminal() bool {
+	return d.width > 0
+}
+
+// paint wraps text in the SGR sequence of a colour, if colours are on. The
+// spaces around text are left out.
+func (d display) paint(text, color string) string {
+	core := strings.TrimSpace(text)
+	if !d.color || color == "" || core == "" {
+		return text
+	}
+
+	start := strings.Index(text, core)
+
+	return text[:start] + "\033[" + color + "m" + core + "\033[0m" + text[start+len(core):]
+}
+
+// statusColor returns the colour of a torrent's state: red for errors, grey
+// when stopped and green when seeding.
+func statusColor(t *backend.Torrent) string {
+	switch {
+	case t.Error != nil && *t.Error != 0:
+		return colorRed
+	case t.Status == nil:
+		return ""
+	case *t.Status == backend.StatusStopped:
+		return colorGrey
+	case *t.Status == backend.StatusSeed || *t.Status == backend.StatusSeedWait:
+		return colorGreen
+	}
+
+	return ""
+}
+
+// progressColor returns the colour of a progress between 0 and 1.
+func progressColor(progress float64) string {
+	switch {
+	case progress >= 1:
+		return colorGreen
+	case progress > 0:
+		return colorYellow
+	}
+
+	return ""
+}
+
+// cell is a table cell.
+type cell struct {
+	text  string
+	right bool
+	color string
+}
+
+// table lays out cells in columns as wide as their widest cell. On a
+// terminal the flex column is shortened, with an ellipsis, so that lines fit.
+type table struct {
+	// header is shown above the rows if not nil.
+	header []string
+	rows   [][]cell
+	// seps are what comes before each column, and after the last one.
+	seps []string
+	flex int
+}
+
+// newTable returns a table of columns separated by two spaces, where the
+// column named "Name" is the flex column.
+func newTable(header ...string) *table {
+	t := &table{header: header, flex: -1}
+
+	for i, name := range header {
+		sep := "  "
+		if i == 0 {
+			sep = ""
+		}
+
+		t.seps = append(t.seps, sep)
+
+		if name == "Name" {
+			t.flex = i
+		}
+	}
+
+	t.seps = append(t.seps, "")
+
+	return t
+}
+
+// newListTable returns a table of what a command lists, whose header is only
+// shown on a terminal: headers are for people, they'd get in the way of
+// scripts.
+func newListTable(d display, header ...string) *table {
+	t := newTable(header...)
+	if !d.terminal() {
+		t.header = nil
+	}
+
+	return t
+}
+
+func (t *table) add(cells ...cell) {
+	t.rows = append(t.rows, cells)
+}
+
+func textWidth(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// ellipsize shortens s to width runes, the last one being an ellipsis.
+func ellipsize(s string, width int) string {
+	if textWidth(s) <= width {
+		return s
+	}
+
+	if width <= 0 {
+		return ""
+	}
+
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+// widths returns the width of each column.
+func (t *table) widths(width int) []int {
+	columns := len(t.seps) - 1
+	widths := make([]int, columns)
+
+	for i := 0; i < columns; i++ {
+		if t.header != nil {
+			widths[i] = textWidth(t.header[i])
+		}
+
+		for _, row := range t.rows {
+			if w := textWidth(row[i].text); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	if width <= 0 || t.flex < 0 {
+		return widths
+	}
+
+	total := 0
+	for i, w := range widths {
+		total += w + textWidth(t.seps[i])
+	}
+
+	total += textWidth(t.seps[columns])
+
+	// Keep at least a few characters of the name.
+	const minFlex = 8
+
+	if excess := total - width; excess > 0 && widths[t.flex] > minFlex {
+		widths[t.flex] -= excess
+		if widths[t.flex] < minFlex {
+			widths[t.flex] = minFlex
+		}
+	}
+
+	return widths
+}
+
+// line renders the cells of a row in columns of the given widths. Lines
+// don't end in spaces.
+func (t *table) line(d display, cells []cell, widths []int) string {
+	var b strings.Builder
+
+	for i, c := range cells {
+		b.WriteString(t.seps[i])
+
+		text := ellipsize(c.text, widths[i])
+		pad := strings.Repeat(" ", widths[i]-textWidth(text))
+
+		if c.right {
+			b.WriteString(pad + d.paint(text, c.color))
+		} else {
+			b.WriteString(d.paint(text, c.color) + pad)
+		}
+	}
+
+	b.WriteString(t.seps[len(cells)])
+
+	return strings.TrimRight(b.String(), " ")
+}
+
+// render writes the table to out.
+func (t *table) render(out io.Writer, d display) error {
+	widths := t.widths(d.width)
+
+	var b strings.Builder
+
+	if t.header != nil {
+		cells := make([]cell, len(t.header))
+
+		for i, name := range t.header {
+			cells[i] = cell{text: name, color: colorBold}
+			if len(t.rows) > 0 {
+				cells[i].right = t.rows[0][i].right
+			}
+		}
+
+		b.WriteString(t.line(d, cells, widths) + "\n")
+	}
+
+	for _, row := range t.rows {
+		b.WriteString(t.line(d, row, widths) + "\n")
+	}
+
+	_, err := io.WriteString(out, b.String())
+
+	return err
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestNewDisplay(t *testing.T) {
+	defer func() { terminalWidth = notTerminal }()
+
+	tests := []struct {
+		color    string
+		terminal bool
+		noColor  bool
+		want     display
+	}{
+		{colorAuto, true, false, display{width: 80, color: true}},
+		{colorAuto, true, true, display{width: 80}},
+		{colorAuto, false, false, display{}},
+		{colorAlways, false, true, display{color: true}},
+		{colorNever, true, false, display{width: 80}},
+	}
+
+	for _, tt := range tests {
+		isTerminal := tt.terminal
+		terminalWidth = func(io.Writer) (int, bool) {
+			if isTerminal {
+				return 80, true
+			}
+
+			return 0, false
+		}
+
+		os.Unsetenv("NO_COLOR")
+
+		if tt.noColor {
+			os.Setenv("NO_COLOR", "")
+		}
+
+		if got := newDisplay(os.Stdout, tt.color); got != tt.want {
+			t.Errorf("newDisplay(%q) terminal %v NO_COLOR %v = %+v, want %+v",
+				tt.color, tt.terminal, tt.noColor, got, tt.want)
+		}
+	}
+
+	os.Unsetenv("NO_COLOR")
+}
+
+func TestTableRender(t *testing.T) {
+	tests := []struct {
+		d    display
+		want string
+	}{
+		{display{}, "ID  Name                 Size\n" +
+			" 1  a rather long name   3 GB\n" +
+			"12  short               10 MB\n"},
+		{display{width: 22}, "ID  Name          Size\n" +
+			" 1  a rather l…   3 GB\n" +
+			"12  short        10 MB\n"},
+		{display{width: 5}, "ID  Name       Size\n" +
+			" 1  a rathe…   3 GB\n" +
+			"12  short     10 MB\n"},
+		{display{width: 40, color: true}, "\033[1mID\033[0m  \033[1mName\033[0m                 \033[1mSize\033[0m\n" +
+			" 1  \033[31ma rather long name\033[0m   3 GB\n" +
+			"12  short               10 MB\n"},
+	}
+
+	for _, tt := range tests {
+		table := newTable("ID", "Name", "Size")
+		table.add(cell{text: "1", right: true}, cell{text: "a rather long name", color: colorRed},
+			cell{text: "3 GB", right: true})
+		table.add(cell{text: "12", right: true}, cell{text: "short"}, cell{text: "10 MB", right: true})
+
+		var b bytes.Buffer
+		if err := table.render(&b, tt.d); err != nil {
+			t.Fatal(err)
+		}
+
+		if b.String() != tt.want {
+			t.Errorf("render(%+v) =\n%q\nwant\n%q", tt.d, b.String(), tt.want)
+		}
+	}
+}
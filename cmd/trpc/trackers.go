@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/filter"
+	"github.com/shric/trpc/internal/util"
+)
+
+type trackersOptions struct {
+	torrentOptions
+	Add            []string `long:"add" value-name:"URL" description:"add an announce URL, may be given more than once"`
+	Remove         []string `long:"remove" value-name:"REGEX" description:"remove the trackers whose announce URL matches a regex, may be given more than once"`
+	Replace        string   `long:"replace" value-name:"REGEX" description:"replace what a regex matches in announce URLs with --with, e.g. --replace 'old.example/(.*)' --with 'new.example/$1'"`
+	With           string   `long:"with" value-name:"URL" description:"what --replace replaces with, $1 being the first group of its regex"`
+	ForceAll       bool     `long:"force-all" description:"Really add trackers to all torrents"`
+	filter.Options `group:"filters"`
+}
+
+// trackerEdit is what the options of trackers change.
+type trackerEdit struct {
+	add         []string
+	remove      []*regexp.Regexp
+	replace     *regexp.Regexp
+	replacement string
+}
+
+// Trackers lists the trackers of all or selected torrents, or adds, removes
+// or replaces them.
+func Trackers(c *Command) {
+	opts, ok := c.Options.(trackersOptions)
+	optionsCheck(ok)
+
+	edit := trackerEdit{add: opts.Add}
+	torrents := opts.Pos.Torrents
+
+	for _, expr := range opts.Remove {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			c.errorf("--remove: %v", err)
+			return
+		}
+
+		edit.remove = append(edit.remove, re)
+	}
+
+	if opts.Replace != "" {
+		re, err := regexp.Compile(opts.Replace)
+		if err != nil {
+			c.errorf("--replace: %v", err)
+			return
+		}
+
+		if opts.With == "" {
+			c.errorf("--replace needs what to replace with, e.g. --replace 'old.example/(.*)' --with 'new.example/$1'")
+			return
+		}
+
+		edit.replace, edit.replacement = re, opts.With
+	} else if opts.With != "" {
+		c.errorf("--with only goes with --replace")
+		return
+	}
+
+	if len(edit.add) == 0 && len(edit.remove) == 0 && edit.replace == nil {
+		listTrackers(c, opts, torrents)
+		return
+	}
+
+	if c.records != nil {
+		c.errorf("--output only lists trackers, it doesn't go with --add, --remove or --replace")
+		return
+	}
+
+	if len(edit.add) > 0 && len(torrents) == 0 && !opts.ForceAll {
+		fmt.Fprintln(c.Err, "Use --force-all if you really want to add trackers to all torrents")
+		return
+	}
+
+	var changed, failed int
+
+	err := util.ProcessTorrents(c.Client, opts.Options, torrents, commonArgs[:], func(t *backend.Torrent) {
+		payload, messages := edit.payload(t)
+		if payload == nil {
+			return
+		}
+
+		if !c.CommonOptions.DryRun {
+			if err := c.Client.TorrentSet(payload); err != nil {
+				c.errorf("Failed to change the trackers of %d: %s: %v", *t.ID, *t.Name, err)
+				failed++
+
+				return
+			}
+		}
+
+		c.status("Changing the trackers of", t)
+
+		for _, m := range messages {
+			fmt.Fprintf(c.Out, "  %s\n", m)
+		}
+
+		changed++
+	}, nil, false)
+	if c.processFailed(err) {
+		return
+	}
+
+	c.statusf("Torrents changed: %d, failed: %d", changed, failed)
+}
+
+// payload returns the torrent-set that edits the trackers of a torrent and
+// what it does, or nil if they stay as they are. Announce URLs the torrent
+// already has aren't added again, and trackers that would be replaced with
+// one of them are removed instead.
+func (e trackerEdit) payload(t *backend.Torrent) (*backend.TorrentSetPayload, []string) {
+	payload := &backend.TorrentSetPayload{IDs: []int64{*t.ID}}
+
+	var messages []string
+
+	has := make(map[string]bool, len(t.Trackers))
+	for _, tr := range t.Trackers {
+		has[tr.Announce] = true
+	}
+
+	for _, tr := range t.Trackers {
+		if e.removes(tr.Announce) {
+			payload.TrackerRemove = append(payload.TrackerRemove, tr.ID)
+			messages = append(messages, fmt.Sprintf("Removing tracker %d: %s", tr.ID, tr.Announce))
+
+			continue
+		}
+
+		if e.replace == nil || !e.replace.MatchString(tr.Announce) {
+			continue
+		}
+
+		announce := e.replace.ReplaceAllString(tr.Announce, e.replacement)
+
+		switch {
+		case announce == tr.Announce:
+		case has[announce]:
+			payload.TrackerRemove = append(payload.TrackerRemove, tr.ID)
+			messages = append(messages, fmt.Sprintf("Removing tracker %d: %s, it already has %s", tr.ID, tr.Announce, announce))
+		default:
+			has[announce] = true
+			payload.TrackerReplace = append(payload.TrackerReplace, backend.TrackerReplace{ID: tr.ID, Announce: announce})
+			messages = append(messages, fmt.Sprintf("Replacing tracker %d: %s with %s", tr.ID, tr.Announce, announce))
+		}
+	}
+
+	for _, announce := range e.add {
+		if !has[announce] {
+			has[announce] = true
+			payload.TrackerAdd = append(payload.TrackerAdd, announce)
+			messages = append(messages, fmt.Sprintf("Adding tracker: %s", announce))
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	return payload, messages
+}
+
+// removes tells whether --remove removes a tracker.
+func (e trackerEdit) removes(announce string) bool {
+	for _, re := range e.remove {
+		if re.MatchString(announce) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listTrackers lists the trackers of torrents with how their last announce
+// went and the swarm they last scraped.
+func listTrackers(c *Command, opts trackersOptions, torrents []string) {
+	if c.CommonOptions.DryRun {
+		fmt.Fprintln(c.Err, "--dry-run has no effect on trackers without --add, --remove or --replace")
+	}
+
+	if c.records != nil {
+		c.records.declare(trackerRecord{})
+	}
+
+	table := newListTable(c.display, "ID", "Tier", "Announce", "Last announce", "Seeders", "Leechers", "Downloads", "Name")
+
+	err := util.ProcessTorrents(c.Client, opts.Options, torrents, append(commonArgs[:], "trackerStats"),
+		func(t *backend.Torrent) {
+			for _, ts := range newTrackerStatsEntries(t) {
+				if c.records != nil {
+					c.record(trackerRecord{TorrentID: *t.ID, TorrentName: *t.Name, trackerStatsEntry: ts})
+					continue
+				}
+
+				tier := strconv.FormatInt(ts.Tier, 10)
+				if ts.IsBackup {
+					tier += " backup"
+				}
+
+				table.add(
+					cell{text: strconv.FormatInt(*t.ID, 10), right: true},
+					cell{text: tier, right: true},
+					cell{text: ts.Announce},
+					cell{text: trackerResult(ts.LastAnnounceResult, ts.LastAnnounceSucceeded, ts.LastAnnounceTime)},
+					cell{text: swarmCount(ts.SeederCount), right: true},
+					cell{text: swarmCount(ts.LeecherCount), right: true},
+					cell{text: swarmCount(ts.DownloadCount), right: true},
+					cell{text: *t.Name},
+				)
+			}
+		}, nil, false)
+	if c.processFailed(err) {
+		return
+	}
+
+	if c.records != nil {
+		return
+	}
+
+	if err := table.render(c.Out, c.display); err != nil {
+		c.errorf("%v", err)
+	}
+}
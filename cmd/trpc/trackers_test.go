@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+func TestTrackerEditPayload(t *testing.T) {
+	id, name := int64(7), "linux.iso"
+	torrent := &backend.Torrent{ID: &id, Name: &name, Trackers: []*backend.Tracker{
+		{ID: 0, Announce: "http://old.example/announce?passkey=abc"},
+		{ID: 3, Announce: "https://new.example/announce?passkey=abc"},
+		{ID: 4, Announce: "udp://old.example:1337/announce"},
+	}}
+
+	tests := []struct {
+		name     string
+		edit     trackerEdit
+		want     *backend.TorrentSetPayload
+		messages []string
+	}{
+		{
+			name: "replace",
+			edit: trackerEdit{replace: regexp.MustCompile(`^udp://old\.example:1337/(.*)`), replacement: "udp://new.example:1337/$1"},
+			want: &backend.TorrentSetPayload{IDs: []int64{7}, TrackerReplace: []backend.TrackerReplace{{ID: 4, Announce: "udp://new.example:1337/announce"}}},
+			messages: []string{
+				"Replacing tracker 4: udp://old.example:1337/announce with udp://new.example:1337/announce",
+			},
+		},
+		{
+			name: "replace with a tracker it has",
+			edit: trackerEdit{replace: regexp.MustCompile(`http://old\.example/(.*)`), replacement: "https://new.example/$1"},
+			want: &backend.TorrentSetPayload{IDs: []int64{7}, TrackerRemove: []int64{0}},
+			messages: []string{
+				"Removing tracker 0: http://old.example/announce?passkey=abc, it already has https://new.example/announce?passkey=abc",
+			},
+		},
+		{
+			name: "remove and add",
+			edit: trackerEdit{
+				remove: []*regexp.Regexp{regexp.MustCompile(`old\.example`)},
+				add:    []string{"https://new.example/announce?passkey=abc", "udp://new.example:1337/announce"},
+			},
+			want: &backend.TorrentSetPayload{
+				IDs: []int64{7}, TrackerRemove: []int64{0, 4}, TrackerAdd: []string{"udp://new.example:1337/announce"},
+			},
+			messages: []string{
+				"Removing tracker 0: http://old.example/announce?passkey=abc",
+				"Removing tracker 4: udp://old.example:1337/announce",
+				"Adding tracker: udp://new.example:1337/announce",
+			},
+		},
+		{
+			name: "nothing to change",
+			edit: trackerEdit{replace: regexp.MustCompile(`passkey=(abc)`), replacement: "passkey=$1"},
+		},
+	}
+
+	for _, tt := range tests {
+		got, messages := tt.edit.payload(torrent)
+		if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(messages, tt.messages) {
+			t.Errorf("%s: payload() = %+v, %q, want %+v, %q", tt.name, got, messages, tt.want, tt.messages)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+type turtleOptions struct {
+	Up       int64  `long:"up" description:"Set the alternative upload limit (KB/sec)" default:"9223372036854775807" default-mask:"-"`
+	Down     int64  `long:"down" description:"Set the alternative download limit (KB/sec)" default:"9223372036854775807" default-mask:"-"`
+	Schedule string `long:"schedule" description:"When turtle mode turns itself on, e.g. 'Mon-Fri 09:00-18:00', or off"`
+	Pos      struct {
+		Action string `positional-arg-name:"on|off|toggle|status" description:"turn turtle mode on or off, toggle it or show it (the default)"`
+	} `positional-args:"true"`
+}
+
+// Turtle controls the alternative speed limits, "turtle mode" in the
+// transmission clients.
+func Turtle(c *Command) {
+	opts, ok := c.Options.(turtleOptions)
+	optionsCheck(ok)
+
+	payload := &backend.Session{}
+
+	var messages []string
+
+	switch opts.Pos.Action {
+	case "", "status":
+	case "on", "off":
+		on := opts.Pos.Action == "on"
+		payload.AltSpeedEnabled = &on
+	case "toggle":
+		session, err := c.Client.SessionGet()
+		if err != nil {
+			c.errorf("%v", err)
+			return
+		}
+
+		if session.AltSpeedEnabled == nil {
+			c.errorf("%s has no alternative speed limits", c.Client.Name())
+			return
+		}
+
+		on := !*session.AltSpeedEnabled
+		payload.AltSpeedEnabled = &on
+	default:
+		c.errorf("expected on, off, toggle or status, got %q", opts.Pos.Action)
+		return
+	}
+
+	if payload.AltSpeedEnabled != nil {
+		messages = append(messages, "Turtle mode "+optOn(payload.AltSpeedEnabled))
+	}
+
+	if opts.Up != math.MaxInt64 {
+		if opts.Up < 0 {
+			c.errorf("--up can't be negative")
+			return
+		}
+
+		payload.AltSpeedUp = &opts.Up
+		messages = append(messages, fmt.Sprintf("Alternative upload limit set to %d KB/sec", opts.Up))
+	}
+
+	if opts.Down != math.MaxInt64 {
+		if opts.Down < 0 {
+			c.errorf("--down can't be negative")
+			return
+		}
+
+		payload.AltSpeedDown = &opts.Down
+		messages = append(messages, fmt.Sprintf("Alternative download limit set to %d KB/sec", opts.Down))
+	}
+
+	switch opts.Schedule {
+	case "":
+	case "off":
+		off := false
+		payload.AltSpeedTimeEnabled = &off
+		messages = append(messages, "Turtle mode schedule off")
+	default:
+		begin, end, days, err := parseSchedule(opts.Schedule)
+		if err != nil {
+			c.errorf("%v", err)
+			return
+		}
+
+		on := true
+		payload.AltSpeedTimeEnabled = &on
+		payload.AltSpeedTimeBegin, payload.AltSpeedTimeEnd, payload.AltSpeedTimeDay = &begin, &end, &days
+		messages = append(messages, "Turtle mode schedule set to "+formatSchedule(begin, end, days))
+	}
+
+	if len(messages) == 0 {
+		turtleStatus(c)
+		return
+	}
+
+	if !c.CommonOptions.DryRun {
+		if err := c.Client.SessionSet(payload); err != nil {
+			c.errorf("%v", err)
+			return
+		}
+	}
+
+	for _, message := range messages {
+		c.statusf("%s", message)
+	}
+
+	if opts.Pos.Action == "status" {
+		turtleStatus(c)
+	}
+}
+
+// turtleStatus shows whether turtle mode is on, its limits and schedule.
+func turtleStatus(c *Command) {
+	s, err := c.Client.SessionGet()
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	schedule := "off"
+
+	switch {
+	case s.AltSpeedTimeEnabled == nil:
+		schedule = backend.Unsupported
+	case *s.AltSpeedTimeEnabled:
+		schedule = altSpeedSchedule(s)
+	case s.AltSpeedTimeBegin != nil && s.AltSpeedTimeEnd != nil && s.AltSpeedTimeDay != nil:
+		schedule = "off (" + formatSchedule(*s.AltSpeedTimeBegin, *s.AltSpeedTimeEnd, *s.AltSpeedTimeDay) + ")"
+	}
+
+	fmt.Fprintf(c.Out, "Turtle mode: %s\n", optOn(s.AltSpeedEnabled))
+	fmt.Fprintf(c.Out, "Upload limit: %s\n", speedLimit(s.AltSpeedUp, nil))
+	fmt.Fprintf(c.Out, "Download limit: %s\n", speedLimit(s.AltSpeedDown, nil))
+	fmt.Fprintf(c.Out, "Schedule: %s\n", schedule)
+}
@@ -2,9 +2,8 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/util"
 )
@@ -22,19 +21,22 @@ func Verify(c *Command) {
 	optionsCheck(ok)
 
 	if len(opts.Pos.Torrents) == 0 && !opts.ForceAll {
-		fmt.Fprintln(os.Stderr, "Use --force-all if you really want to verify all torrents!")
+		fmt.Fprintln(c.Err, "Use --force-all if you really want to verify all torrents!")
 		return
 	}
 
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
-		func(torrent *transmissionrpc.Torrent) {
+	err := util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
+		func(torrent *backend.Torrent) {
 			if !c.CommonOptions.DryRun {
-				err := c.Client.TorrentVerifyIDs([]int64{*torrent.ID})
+				err := c.Client.TorrentVerify([]int64{*torrent.ID})
 				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
+					c.errorf("%v", err)
 					return
 				}
 			}
 			c.status("Verifying torrent", torrent)
 		}, nil, false)
+	if err != nil {
+		c.errorf("%v", err)
+	}
 }
@@ -2,8 +2,6 @@ package cmd
 
 import (
 	"fmt"
-
-	"github.com/hekmon/transmissionrpc"
 )
 
 var (
@@ -14,19 +12,13 @@ var (
 
 // Version prints the version number and build info.
 func Version(c *Command) {
-	fmt.Printf("trpc version %s (%s) built at %s\n", version, sha1ver, buildTime)
+	fmt.Fprintf(c.Out, "trpc version %s (%s) built at %s\n", version, sha1ver, buildTime)
 
-	ok, serverVersion, serverMinimumVersion, err := c.Client.RPCVersion()
+	remote, err := c.Client.Version()
 	if err != nil {
-		panic(err)
-	}
-
-	if !ok {
-		panic(fmt.Sprintf(
-			"Remote transmission RPC version (v%d) is incompatible with the transmission library (v%d): min v%d",
-			serverVersion, transmissionrpc.RPCVersion, serverMinimumVersion))
+		c.errorf("%v", err)
+		return
 	}
 
-	fmt.Printf("Client library is built against RPC version v%d\n", transmissionrpc.RPCVersion)
-	fmt.Printf("Remote transmission RPC version v%d\n", serverVersion)
+	fmt.Fprintf(c.Out, "Remote %s\n", remote)
 }
@@ -2,12 +2,14 @@ package cmd
 
 import (
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/shric/trpc/internal/torrent"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
 	"github.com/shric/trpc/internal/filter"
 	"github.com/shric/trpc/internal/util"
 )
@@ -17,6 +19,7 @@ const delayMillis = 200
 type watchOptions struct {
 	torrentOptions
 	filter.Options `group:"filters"`
+	sortOptions
 }
 
 // Watch watches the torrents until they're downloaded, giving progress.
@@ -25,14 +28,29 @@ func Watch(c *Command) {
 	optionsCheck(ok)
 
 	if c.CommonOptions.DryRun {
-		fmt.Fprintln(os.Stderr, "--dry-run has no effect on watch as watch doesn't change state")
+		fmt.Fprintln(c.Err, "--dry-run has no effect on watch as watch doesn't change state")
+	}
+
+	fields := []string{"leftUntilDone", "sizeWhenDone", "id", "name", "rateDownload", "recheckProgress"}
+
+	// Torrents are sorted as they're redrawn, the order can change.
+	var order *filter.Order
+
+	if opts.Sort != "" {
+		var err error
+		if order, err = filter.NewOrder(opts.Sort, config.ReadConfig()); err != nil {
+			c.errorf("%v", err)
+			return
+		}
+
+		fields = append(fields, order.Args...)
 	}
 
 	IDs := make([]int64, 0)
 
-	util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
-		func(torrent *transmissionrpc.Torrent) {
-			if *torrent.Status == transmissionrpc.TorrentStatusStopped {
+	err := util.ProcessTorrents(c.Client, opts.Options, opts.Pos.Torrents, commonArgs[:],
+		func(torrent *backend.Torrent) {
+			if *torrent.Status == backend.StatusStopped {
 				return
 			}
 			if *torrent.LeftUntilDone == 0 {
@@ -40,6 +58,9 @@ func Watch(c *Command) {
 			}
 			IDs = append(IDs, *torrent.ID)
 		}, nil, false)
+	if c.processFailed(err) {
+		return
+	}
 
 	if len(IDs) == 0 {
 		return
@@ -48,32 +69,42 @@ func Watch(c *Command) {
 	var done bool
 
 	for {
-		torrents, err := c.Client.TorrentGet([]string{"leftUntilDone", "sizeWhenDone", "id", "name", "rateDownload", "recheckProgress"}, IDs)
+		torrents, err := c.Client.TorrentGet(fields, IDs)
 
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Torrent get error: ", err)
-			os.Exit(1)
+			c.errorf("Torrent get error: %v", err)
+			return
+		}
+
+		if order != nil {
+			if err := order.Sort(torrents, opts.Reverse); err != nil {
+				c.errorf("%v", err)
+				return
+			}
 		}
 
 		done = true
 
+		table := newListTable(c.display, "ID", "Done", "Rate", "Name")
+
 		for _, t := range torrents {
 			percent := torrent.Progress(t)
 
-			var percentStr string
-
-			var rateStr string
+			progress := cell{text: "Done", right: true, color: colorGreen}
+			rate := cell{right: true}
 
 			if *t.LeftUntilDone != 0 {
 				done = false
-				percentStr = fmt.Sprintf("%5.2f%%", percent)
-				rateStr = fmt.Sprintf("%9.2f KiB/s", float64(*t.RateDownload)/KiB)
-			} else {
-				percentStr = "Done"
-				rateStr = ""
+				progress = cell{text: fmt.Sprintf("%.2f%%", percent), right: true, color: colorYellow}
+				rate.text = fmt.Sprintf("%.2f KiB/s", float64(*t.RateDownload)/KiB)
 			}
 
-			fmt.Printf("%5d: %6s %15s %s\n", *t.ID, percentStr, rateStr, *t.Name)
+			table.add(cell{text: strconv.FormatInt(*t.ID, 10), right: true}, progress, rate, cell{text: *t.Name})
+		}
+
+		if err := table.render(c.Out, c.display); err != nil {
+			c.errorf("%v", err)
+			return
 		}
 
 		if done {
@@ -82,8 +113,12 @@ func Watch(c *Command) {
 
 		time.Sleep(delayMillis * time.Millisecond)
 
-		for range torrents {
-			fmt.Print("\033[F")
+		// Go back up to redraw the table, clearing what was there.
+		lines := len(table.rows)
+		if table.header != nil {
+			lines++
 		}
+
+		fmt.Fprint(c.Out, strings.Repeat("\033[F", lines)+"\033[J")
 	}
 }
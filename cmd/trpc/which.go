@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/shric/trpc/internal/util"
 )
@@ -17,15 +16,39 @@ func Which(c *Command) {
 	opts, ok := c.Options.(whichOptions)
 	optionsCheck(ok)
 
-	finder := util.NewFinder(c.Client)
+	finder, err := util.NewFinder(c.Client)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+
+	if c.records != nil {
+		c.records.declare(whichRecord{})
+	}
 
 	for _, f := range opts.Pos.Files {
-		torrent, fileID := finder.Find(f)
-		if torrent != nil {
-			fmt.Printf("%s belongs to torrent %d: %s (File ID %d)\n",
+		torrent, fileID, err := finder.Find(f)
+
+		switch {
+		case err != nil:
+			c.errorf("%v", err)
+			return
+		case c.records != nil:
+			record := whichRecord{Path: f}
+
+			if torrent != nil {
+				record.TorrentID, record.TorrentName = torrent.ID, torrent.Name
+				if fileID >= 0 {
+					record.FileID = &fileID
+				}
+			}
+
+			c.record(record)
+		case torrent != nil:
+			fmt.Fprintf(c.Out, "%s belongs to torrent %d: %s (File ID %d)\n",
 				f, *torrent.ID, *torrent.Name, fileID)
-		} else {
-			fmt.Fprintln(os.Stderr, "Couldn't find a torrent for", f)
+		default:
+			fmt.Fprintln(c.Err, "Couldn't find a torrent for", f)
 		}
 	}
 }
@@ -0,0 +1,90 @@
+// Package backend defines the interface trpc uses to talk to a bittorrent
+// client, together with a client neutral model of torrents and sessions.
+//
+// The model follows the transmission RPC spec as it's the most complete of
+// the supported clients: field names passed to TorrentGet are transmission
+// torrent-get field names, and backends for other clients map them as best
+// they can. Fields are pointers so that nil means "not requested" (or not
+// supported by the client).
+package backend
+
+import (
+	"time"
+)
+
+// Backend is implemented by every supported bittorrent client.
+type Backend interface {
+	// Name returns the name of the bittorrent client, e.g. "transmission".
+	Name() string
+	// Version returns a human readable description of the remote version.
+	Version() (string, error)
+
+	TorrentGet(fields []string, ids []int64) ([]*Torrent, error)
+	TorrentSet(payload *TorrentSetPayload) error
+	TorrentAdd(payload *TorrentAddPayload) (*Torrent, error)
+	TorrentRemove(ids []int64, deleteData bool) error
+	TorrentStart(ids []int64, now bool) error
+	TorrentStop(ids []int64) error
+	TorrentVerify(ids []int64) error
+	TorrentSetLocation(id int64, location string, move bool) error
+	TorrentRenamePath(id int64, path, name string) error
+
+	SessionGet() (*Session, error)
+	SessionSet(session *Session) error
+	SessionStats() (*SessionStats, error)
+	// FreeSpace returns the free space, in bytes, of the disk a directory
+	// of the daemon's machine is on.
+	FreeSpace(path string) (int64, error)
+}
+
+// TorrentSetPayload holds the torrent properties to change. Only non-nil
+// fields are changed.
+type TorrentSetPayload struct {
+	IDs                 []int64
+	BandwidthPriority   *int64
+	DownloadLimit       *int64 // KB/s
+	DownloadLimited     *bool
+	FilesWanted         []int64
+	FilesUnwanted       []int64
+	HonorsSessionLimits *bool
+	Labels              []string
+	Location            *string
+	PeerLimit           *int64
+	PriorityHigh        []int64
+	PriorityLow         []int64
+	PriorityNormal      []int64
+	QueuePosition       *int64
+	SeedIdleLimit       *time.Duration
+	SeedIdleMode        *int64
+	SeedRatioLimit      *float64
+	SeedRatioMode       *SeedRatioMode
+	TrackerAdd          []string
+	TrackerRemove       []int64
+	TrackerReplace      []TrackerReplace
+	UploadLimit         *int64 // KB/s
+	UploadLimited       *bool
+}
+
+// TrackerReplace replaces the announce URL of the tracker with an ID, which
+// keeps its tier.
+type TrackerReplace struct {
+	ID       int64
+	Announce string
+}
+
+// TorrentAddPayload describes a torrent to add. One of Filename (a URL or
+// magnet link) or MetaInfo (base64 encoded .torrent content) must be set.
+type TorrentAddPayload struct {
+	Cookies           *string
+	DownloadDir       *string
+	Filename          *string
+	MetaInfo          *string
+	Paused            *bool
+	PeerLimit         *int64
+	BandwidthPriority *int64
+	FilesWanted       []int64
+	FilesUnwanted     []int64
+	PriorityHigh      []int64
+	PriorityLow       []int64
+	PriorityNormal    []int64
+}
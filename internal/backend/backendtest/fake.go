@@ -0,0 +1,225 @@
+// Package backendtest provides an in-memory backend.Backend for tests.
+package backendtest
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+// Fake is an in-memory backend.Backend. TorrentGet ignores the requested
+// fields and returns the stored torrents as is, so tests must fill in every
+// field the code under test dereferences.
+type Fake struct {
+	Torrents []*backend.Torrent
+	Session  backend.Session
+	Stats    backend.SessionStats
+	// Free is the FreeSpace of every path.
+	Free int64
+	// Calls records every mutating call, e.g. "TorrentStop [1 2]".
+	Calls []string
+	// Err, when set, is returned by every method.
+	Err error
+	// Fields are those asked for by the last TorrentGet.
+	Fields []string
+}
+
+var _ backend.Backend = (*Fake)(nil)
+
+func (f *Fake) record(format string, a ...interface{}) error {
+	f.Calls = append(f.Calls, fmt.Sprintf(format, a...))
+	return f.Err
+}
+
+func (f *Fake) find(id int64) (*backend.Torrent, error) {
+	for _, t := range f.Torrents {
+		if t.ID != nil && *t.ID == id {
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no torrent with ID %d", id)
+}
+
+func (f *Fake) setStatus(ids []int64, status backend.Status) error {
+	for _, id := range ids {
+		t, err := f.find(id)
+		if err != nil {
+			return err
+		}
+
+		s := status
+		t.Status = &s
+	}
+
+	return nil
+}
+
+// Name implements backend.Backend.
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Version implements backend.Backend.
+func (f *Fake) Version() (string, error) {
+	return "fake", f.Err
+}
+
+// TorrentGet implements backend.Backend.
+func (f *Fake) TorrentGet(fields []string, ids []int64) ([]*backend.Torrent, error) {
+	f.Fields = fields
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	if len(ids) == 0 {
+		return append([]*backend.Torrent(nil), f.Torrents...), nil
+	}
+
+	var torrents []*backend.Torrent
+
+	for _, id := range ids {
+		if t, err := f.find(id); err == nil {
+			torrents = append(torrents, t)
+		}
+	}
+
+	return torrents, nil
+}
+
+// TorrentSet implements backend.Backend.
+func (f *Fake) TorrentSet(payload *backend.TorrentSetPayload) error {
+	return f.record("TorrentSet %v", payload.IDs)
+}
+
+// TorrentAdd implements backend.Backend.
+func (f *Fake) TorrentAdd(payload *backend.TorrentAddPayload) (*backend.Torrent, error) {
+	if err := f.record("TorrentAdd"); err != nil {
+		return nil, err
+	}
+
+	id := int64(len(f.Torrents) + 1)
+	name := "metainfo"
+
+	if payload.Filename != nil {
+		name = path.Base(*payload.Filename)
+	}
+
+	t := &backend.Torrent{ID: &id, Name: &name}
+	f.Torrents = append(f.Torrents, t)
+
+	return t, nil
+}
+
+// TorrentRemove implements backend.Backend.
+func (f *Fake) TorrentRemove(ids []int64, deleteData bool) error {
+	if err := f.record("TorrentRemove %v %v", ids, deleteData); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		for i, t := range f.Torrents {
+			if *t.ID == id {
+				f.Torrents = append(f.Torrents[:i], f.Torrents[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// TorrentStart implements backend.Backend.
+func (f *Fake) TorrentStart(ids []int64, now bool) error {
+	if err := f.record("TorrentStart %v %v", ids, now); err != nil {
+		return err
+	}
+
+	return f.setStatus(ids, backend.StatusDownload)
+}
+
+// TorrentStop implements backend.Backend.
+func (f *Fake) TorrentStop(ids []int64) error {
+	if err := f.record("TorrentStop %v", ids); err != nil {
+		return err
+	}
+
+	return f.setStatus(ids, backend.StatusStopped)
+}
+
+// TorrentVerify implements backend.Backend.
+func (f *Fake) TorrentVerify(ids []int64) error {
+	if err := f.record("TorrentVerify %v", ids); err != nil {
+		return err
+	}
+
+	return f.setStatus(ids, backend.StatusCheckWait)
+}
+
+// TorrentSetLocation implements backend.Backend.
+func (f *Fake) TorrentSetLocation(id int64, location string, move bool) error {
+	if err := f.record("TorrentSetLocation %d %s %v", id, location, move); err != nil {
+		return err
+	}
+
+	t, err := f.find(id)
+	if err != nil {
+		return err
+	}
+
+	t.DownloadDir = &location
+
+	return nil
+}
+
+// TorrentRenamePath implements backend.Backend.
+func (f *Fake) TorrentRenamePath(id int64, oldPath, name string) error {
+	if err := f.record("TorrentRenamePath %d %s %s", id, oldPath, name); err != nil {
+		return err
+	}
+
+	t, err := f.find(id)
+	if err != nil {
+		return err
+	}
+
+	if t.Name != nil && *t.Name == oldPath {
+		t.Name = &name
+	}
+
+	return nil
+}
+
+// SessionGet implements backend.Backend.
+func (f *Fake) SessionGet() (*backend.Session, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	session := f.Session
+
+	return &session, nil
+}
+
+// SessionSet implements backend.Backend.
+func (f *Fake) SessionSet(session *backend.Session) error {
+	return f.record("SessionSet")
+}
+
+// SessionStats implements backend.Backend.
+func (f *Fake) SessionStats() (*backend.SessionStats, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	stats := f.Stats
+
+	return &stats, nil
+}
+
+// FreeSpace implements backend.Backend.
+func (f *Fake) FreeSpace(path string) (int64, error) {
+	return f.Free, f.Err
+}
@@ -0,0 +1,335 @@
+// Package deluge implements backend.Backend on top of the JSON-RPC API of the
+// Deluge Web UI (deluge-web), which forwards core.* methods to a daemon.
+//
+// Like qBittorrent, Deluge identifies torrents by info hash, so torrent IDs
+// are derived from the hashes (see backend.IDMap). Fields Deluge doesn't have
+// are listed in backend.Torrent.Unsupported, and settings it doesn't have are
+// rejected with an error rather than silently ignored.
+package deluge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+// Config describes how to reach a Deluge Web UI.
+type Config struct {
+	// URL is the JSON-RPC endpoint, e.g. "http://localhost:8112/json".
+	URL      string
+	Password string
+	// HTTPClient is used for all requests. It is given a cookie jar if it
+	// doesn't already have one, as the API authenticates with a cookie.
+	HTTPClient *http.Client
+	Debug      bool
+}
+
+// Backend talks to a Deluge daemon through deluge-web.
+type Backend struct {
+	config Config
+	ids    backend.IDMap
+	nextID int
+}
+
+// rpcError is an error answered by the JSON-RPC API.
+type rpcError struct {
+	method  string
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("deluge: %s: %s", e.method, e.Message)
+}
+
+// New returns a Backend after logging in to the Web UI and, if the Web UI
+// isn't connected to a daemon yet, connecting it to the first one it knows.
+func New(config Config) (*Backend, error) {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+	}
+
+	if config.HTTPClient.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		client := *config.HTTPClient
+		client.Jar = jar
+		config.HTTPClient = &client
+	}
+
+	b := &Backend{config: config}
+
+	var ok bool
+	if err := b.call("auth.login", []interface{}{config.Password}, &ok); err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, errors.New("deluge: login failed: wrong password")
+	}
+
+	if err := b.connectDaemon(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *Backend) connectDaemon() error {
+	var connected bool
+	if err := b.call("web.connected", []interface{}{}, &connected); err != nil {
+		return err
+	}
+
+	if connected {
+		return nil
+	}
+
+	// Each host is [id, host, port, user or status].
+	var hosts [][]interface{}
+	if err := b.call("web.get_hosts", []interface{}{}, &hosts); err != nil {
+		return err
+	}
+
+	if len(hosts) == 0 || len(hosts[0]) == 0 {
+		return errors.New("deluge: the Web UI isn't connected to a daemon and knows no hosts")
+	}
+
+	if err := b.call("web.connect", []interface{}{hosts[0][0]}, nil); err != nil {
+		return err
+	}
+
+	return b.call("web.connected", []interface{}{}, &connected)
+}
+
+// call calls a JSON-RPC method and decodes its result, unless result is nil.
+func (b *Backend) call(method string, params []interface{}, result interface{}) error {
+	b.nextID++
+
+	data, err := json.Marshal(map[string]interface{}{"method": method, "params": params, "id": b.nextID})
+	if err != nil {
+		return err
+	}
+
+	if b.config.Debug {
+		fmt.Fprintf(os.Stderr, "deluge: %s\n", data)
+	}
+
+	req, err := http.NewRequest("POST", b.config.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "trpc")
+
+	resp, err := b.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deluge: %s: %d %s", method, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	var answer struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+
+	if err := json.Unmarshal(data, &answer); err != nil {
+		return fmt.Errorf("deluge: %s: %v", method, err)
+	}
+
+	if answer.Error != nil {
+		answer.Error.method = method
+		return answer.Error
+	}
+
+	if result == nil || len(answer.Result) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(answer.Result, result); err != nil {
+		return fmt.Errorf("deluge: %s: %v", method, err)
+	}
+
+	return nil
+}
+
+// callFirst calls the first of the methods the daemon knows. Deluge 2
+// replaced some methods taking lists (pause_torrent) by plural ones.
+func (b *Backend) callFirst(params []interface{}, methods ...string) error {
+	var err error
+
+	for _, method := range methods {
+		var rpcErr *rpcError
+		if err = b.call(method, params, nil); !errors.As(err, &rpcErr) || !strings.Contains(rpcErr.Message, "Unknown method") {
+			return err
+		}
+	}
+
+	return err
+}
+
+// hashes returns the hashes of the torrents with the given IDs.
+func (b *Backend) hashes(ids []int64) ([]string, error) {
+	result := make([]string, len(ids))
+
+	for i, id := range ids {
+		hash, ok := b.ids.Hash(id)
+		if !ok {
+			// Maybe it's a torrent we haven't seen yet.
+			if _, err := b.torrentsStatus([]string{"hash"}); err != nil {
+				return nil, err
+			}
+
+			if hash, ok = b.ids.Hash(id); !ok {
+				return nil, fmt.Errorf("deluge: no torrent with ID %d", id)
+			}
+		}
+
+		result[i] = hash
+	}
+
+	return result, nil
+}
+
+func (b *Backend) hash(id int64) (string, error) {
+	hashes, err := b.hashes([]int64{id})
+	if err != nil {
+		return "", err
+	}
+
+	return hashes[0], nil
+}
+
+// Name implements backend.Backend.
+func (b *Backend) Name() string {
+	return "deluge"
+}
+
+// Version implements backend.Backend.
+func (b *Backend) Version() (string, error) {
+	var version string
+	if err := b.call("daemon.info", []interface{}{}, &version); err != nil {
+		return "", err
+	}
+
+	return "Deluge " + version, nil
+}
+
+// TorrentRemove implements backend.Backend.
+func (b *Backend) TorrentRemove(ids []int64, deleteData bool) error {
+	hashes, err := b.hashes(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if err := b.call("core.remove_torrent", []interface{}{hash, deleteData}, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TorrentStart implements backend.Backend. Deluge has no way to bypass the
+// queue, so starting now moves the torrents to the top of the queue.
+func (b *Backend) TorrentStart(ids []int64, now bool) error {
+	hashes, err := b.hashes(ids)
+	if err != nil {
+		return err
+	}
+
+	if err := b.callFirst([]interface{}{hashes}, "core.resume_torrents", "core.resume_torrent"); err != nil {
+		return err
+	}
+
+	if now {
+		return b.call("core.queue_top", []interface{}{hashes}, nil)
+	}
+
+	return nil
+}
+
+// TorrentStop implements backend.Backend.
+func (b *Backend) TorrentStop(ids []int64) error {
+	hashes, err := b.hashes(ids)
+	if err != nil {
+		return err
+	}
+
+	return b.callFirst([]interface{}{hashes}, "core.pause_torrents", "core.pause_torrent")
+}
+
+// TorrentVerify implements backend.Backend.
+func (b *Backend) TorrentVerify(ids []int64) error {
+	hashes, err := b.hashes(ids)
+	if err != nil {
+		return err
+	}
+
+	return b.call("core.force_recheck", []interface{}{hashes}, nil)
+}
+
+// TorrentSetLocation implements backend.Backend. Deluge always moves the
+// data, so move=false isn't supported.
+func (b *Backend) TorrentSetLocation(id int64, location string, move bool) error {
+	if !move {
+		return errors.New("deluge: changing the location without moving the data isn't supported")
+	}
+
+	hash, err := b.hash(id)
+	if err != nil {
+		return err
+	}
+
+	return b.call("core.move_storage", []interface{}{[]string{hash}, location}, nil)
+}
+
+// TorrentRenamePath implements backend.Backend. A path that is a file is
+// renamed with core.rename_files, anything else with core.rename_folder.
+func (b *Backend) TorrentRenamePath(id int64, oldPath, name string) error {
+	hash, err := b.hash(id)
+	if err != nil {
+		return err
+	}
+
+	newPath := name
+	if i := strings.LastIndex(oldPath, "/"); i >= 0 {
+		newPath = oldPath[:i+1] + name
+	}
+
+	status, err := b.torrentStatus(hash, []string{"files"})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range status.Files {
+		if f.Path == oldPath {
+			return b.call("core.rename_files", []interface{}{hash, [][]interface{}{{f.Index, newPath}}}, nil)
+		}
+	}
+
+	return b.call("core.rename_folder", []interface{}{hash, oldPath + "/", newPath + "/"}, nil)
+}
@@ -0,0 +1,346 @@
+package deluge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+const (
+	seedingHash = "aabbccddeeff00112233445566778899aabbccdd"
+	pausedHash  = "0123456789abcdef0123456789abcdef01234567"
+)
+
+var torrentsStatus = `{
+	"` + seedingHash + `": {"name": "seeding", "state": "Seeding", "total_wanted": 2048, "total_done": 2048,
+	 "total_size": 2048, "progress": 100, "upload_payload_rate": 512, "total_uploaded": 4096, "time_added": 200.5,
+	 "completed_time": 300, "magnet_uri": "magnet:?xt=urn:btih:` + seedingHash + `", "label": "linux",
+	 "eta": 0, "save_path": "/data/", "stop_at_ratio": true, "stop_ratio": 2, "max_download_speed": -1,
+	 "tracker_host": "example", "tracker_status": "Announce OK",
+	 "trackers": [{"url": "http://tracker.example/announce", "tier": 0}]},
+	"` + pausedHash + `": {"name": "paused", "state": "Error", "message": "disk full", "total_wanted": 1024,
+	 "total_done": 512, "total_size": 4096, "progress": 50, "time_added": 100, "eta": 60, "save_path": "/data",
+	 "max_download_speed": 100.0, "trackers": [],
+	 "files": [{"index": 0, "path": "paused/a", "size": 512}, {"index": 1, "path": "paused/b", "size": 512}],
+	 "file_priorities": [7, 0], "file_progress": [1, 0]}
+}`
+
+// standIn is a minimal deluge-web JSON-RPC API recording the calls it gets.
+type standIn struct {
+	*httptest.Server
+	calls     []string
+	connected bool
+	// v1 only has the singular pause/resume methods of Deluge 1.3.
+	v1 bool
+}
+
+func newStandIn(t *testing.T) *standIn {
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+			ID     int               `json:"id"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		answer := func(result string) {
+			fmt.Fprintf(w, `{"id": %d, "result": %s, "error": null}`, req.ID, result)
+		}
+
+		fail := func(message string) {
+			fmt.Fprintf(w, `{"id": %d, "result": null, "error": {"message": %q, "code": 2}}`, req.ID, message)
+		}
+
+		if req.Method == "auth.login" {
+			if string(req.Params[0]) != `"secret"` {
+				answer("false")
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: "sid", Path: "/"})
+			answer("true")
+
+			return
+		}
+
+		if cookie, err := r.Cookie("_session_id"); err != nil || cookie.Value != "sid" {
+			fmt.Fprintf(w, `{"id": %d, "result": null, "error": {"message": "Not authenticated", "code": 1}}`, req.ID)
+			return
+		}
+
+		params, _ := json.Marshal(req.Params)
+
+		switch req.Method {
+		case "web.connected":
+			answer(fmt.Sprint(s.connected))
+		case "web.get_hosts":
+			answer(`[["host1", "127.0.0.1", 58846, "localclient"]]`)
+		case "web.connect":
+			s.connected = string(req.Params[0]) == `"host1"`
+			answer("null")
+		case "daemon.info":
+			answer(`"2.1.1"`)
+		case "core.get_torrents_status":
+			answer(torrentsStatus)
+		case "core.get_session_status":
+			answer(`{"payload_download_rate": 10.5, "payload_upload_rate": 20, "total_payload_download": 100,
+				"total_payload_upload": 200}`)
+		case "core.get_free_space":
+			answer("1000000")
+		case "core.get_torrent_status":
+			answer(`{"name": "seeding", "file_priorities": [7, 0],
+				"trackers": [{"url": "http://a/announce", "tier": 0}, {"url": "http://b/announce", "tier": 1}]}`)
+		case "core.pause_torrents", "core.resume_torrents":
+			if s.v1 {
+				fail("Unknown method")
+				return
+			}
+
+			fallthrough
+		default:
+			s.calls = append(s.calls, req.Method+" "+string(params))
+			answer(`"` + seedingHash + `"`)
+		}
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func connect(t *testing.T, s *standIn) *Backend {
+	b, err := New(Config{URL: s.URL + "/json", Password: "secret"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return b
+}
+
+func TestLogin(t *testing.T) {
+	s := newStandIn(t)
+
+	if _, err := New(Config{URL: s.URL + "/json", Password: "wrong"}); err == nil {
+		t.Fatal("New() with a wrong password: expected an error")
+	}
+
+	b := connect(t, s)
+
+	if !s.connected {
+		t.Error("New() didn't connect the Web UI to a daemon")
+	}
+
+	if version, err := b.Version(); err != nil || version != "Deluge 2.1.1" {
+		t.Errorf("Version() = %q, %v", version, err)
+	}
+}
+
+func TestTorrentGet(t *testing.T) {
+	b := connect(t, newStandIn(t))
+
+	torrents, err := b.TorrentGet([]string{"id", "name", "files"}, nil)
+	if err != nil {
+		t.Fatalf("TorrentGet() error = %v", err)
+	}
+
+	if len(torrents) != 2 {
+		t.Fatalf("TorrentGet() returned %d torrents, want 2", len(torrents))
+	}
+
+	paused, seeding := torrents[0], torrents[1]
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"order", *paused.Name + "," + *seeding.Name, "paused,seeding"},
+		{"id", *seeding.ID, backend.HashID(seedingHash)},
+		{"seeding status", statusName(seeding), "Seeding"},
+		{"paused status", statusName(paused), "Stopped"},
+		{"error", *paused.ErrorString, "disk full"},
+		{"have", torrent.Have(paused), int64(512)},
+		{"percent done", *paused.PercentDone, 0.5},
+		{"download dir", *seeding.DownloadDir, "/data"},
+		{"unknown eta", *seeding.Eta, int64(-1)},
+		{"download limit", *paused.DownloadLimit, int64(100)},
+		{"unlimited", *seeding.DownloadLimited, false},
+		{"labels", seeding.Labels, []string{"linux"}},
+		{"tracker result", seeding.TrackerStats[0].LastAnnounceResult, "Announce OK"},
+		{"ratio mode", *seeding.SeedRatioMode, backend.SeedRatioModeCustom},
+		{"files", len(paused.Files), 2},
+		{"priorities", paused.Priorities, []int64{1, 0}},
+		{"wanted", paused.Wanted, []bool{true, false}},
+		{"priority", torrent.Priority(seeding), backend.Unsupported},
+		{"magnet", seeding.Supports("magnetLink"), true},
+		{"missing magnet", paused.Supports("magnetLink"), false},
+		{"missing label", paused.Supports("labels"), false},
+	}
+
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	selected, err := b.TorrentGet([]string{"id"}, []int64{*paused.ID})
+	if err != nil || len(selected) != 1 || *selected[0].Name != "paused" {
+		t.Errorf("TorrentGet() by ID = %v, %v", selected, err)
+	}
+}
+
+func statusName(t *backend.Torrent) string {
+	status, _ := torrent.Status(t)
+	return status
+}
+
+func TestActions(t *testing.T) {
+	s := newStandIn(t)
+	s.v1 = true
+	b := connect(t, s)
+	id := backend.HashID(seedingHash)
+	limit := int64(100)
+	location := "/elsewhere"
+
+	if err := b.TorrentStop([]int64{id}); err != nil {
+		t.Fatalf("TorrentStop() error = %v", err)
+	}
+
+	if err := b.TorrentRemove([]int64{id}, true); err != nil {
+		t.Fatalf("TorrentRemove() error = %v", err)
+	}
+
+	err := b.TorrentSet(&backend.TorrentSetPayload{
+		IDs:           []int64{id},
+		DownloadLimit: &limit,
+		Location:      &location,
+		FilesWanted:   []int64{1},
+		PriorityLow:   []int64{0},
+		TrackerRemove: []int64{0},
+		TrackerAdd:    []string{"http://c/announce"},
+	})
+	if err != nil {
+		t.Fatalf("TorrentSet() error = %v", err)
+	}
+
+	want := []string{
+		`core.pause_torrent [["` + seedingHash + `"]]`,
+		`core.remove_torrent ["` + seedingHash + `",true]`,
+		`core.set_torrent_options [["` + seedingHash + `"],{"max_download_speed":100}]`,
+		`core.move_storage [["` + seedingHash + `"],"/elsewhere"]`,
+		`core.set_torrent_options [["` + seedingHash + `"],{"file_priorities":[1,4]}]`,
+		`core.set_torrent_trackers ["` + seedingHash + `",[{"tier":1,"url":"http://b/announce"},{"tier":2,"url":"http://c/announce"}]]`,
+	}
+
+	if !reflect.DeepEqual(s.calls, want) {
+		t.Errorf("calls =\n%s\nwant\n%s", s.calls, want)
+	}
+
+	if err := b.TorrentStop([]int64{42}); err == nil {
+		t.Error("TorrentStop() of an unknown ID: expected an error")
+	}
+
+	s.calls = nil
+
+	priority := int64(1)
+
+	err = b.TorrentSet(&backend.TorrentSetPayload{IDs: []int64{id}, BandwidthPriority: &priority})
+	if err == nil || len(s.calls) != 0 {
+		t.Errorf("TorrentSet() with a bandwidth priority: error = %v, calls = %q", err, s.calls)
+	}
+}
+
+func TestTorrentAdd(t *testing.T) {
+	s := newStandIn(t)
+	b := connect(t, s)
+	magnet := "magnet:?xt=urn:btih:" + seedingHash
+	paused := true
+
+	added, err := b.TorrentAdd(&backend.TorrentAddPayload{Filename: &magnet, Paused: &paused})
+	if err != nil {
+		t.Fatalf("TorrentAdd() error = %v", err)
+	}
+
+	if *added.ID != backend.HashID(seedingHash) || *added.Name != "seeding" {
+		t.Errorf("TorrentAdd() = %d %s, want %d seeding", *added.ID, *added.Name, backend.HashID(seedingHash))
+	}
+
+	want := []string{`core.add_torrent_magnet ["` + magnet + `",{"add_paused":true}]`}
+	if !reflect.DeepEqual(s.calls, want) {
+		t.Errorf("calls = %q, want %q", s.calls, want)
+	}
+}
+
+func TestSessionStats(t *testing.T) {
+	b := connect(t, newStandIn(t))
+
+	stats, err := b.SessionStats()
+	if err != nil {
+		t.Fatalf("SessionStats() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  *int64
+		want int64
+	}{
+		{"active", stats.ActiveTorrentCount, 1},
+		{"paused", stats.PausedTorrentCount, 1},
+		{"torrents", stats.TorrentCount, 2},
+		{"download speed", stats.DownloadSpeed, 10},
+		{"uploaded", stats.Current.UploadedBytes, 200},
+	}
+
+	for _, tt := range tests {
+		if tt.got == nil || *tt.got != tt.want {
+			t.Errorf("%s: got %v, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if stats.Cumulative.UploadedBytes != nil {
+		t.Errorf("uploaded ever = %d, want nil", *stats.Cumulative.UploadedBytes)
+	}
+
+	if free, err := b.FreeSpace("/data"); err != nil || free != 1000000 {
+		t.Errorf("FreeSpace(/data) = %d, %v, want 1000000", free, err)
+	}
+}
+
+func TestSessionConfig(t *testing.T) {
+	limit, enabled, port := int64(50), false, int64(51413)
+
+	config, err := sessionConfig(&backend.Session{
+		SpeedLimitDown:       &limit,
+		SpeedLimitUpEnabled:  &enabled,
+		PeerPort:             &port,
+		DownloadQueueEnabled: &enabled,
+	})
+	if err != nil {
+		t.Fatalf("sessionConfig() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"max_download_speed":     int64(50),
+		"max_upload_speed":       int64(-1),
+		"listen_ports":           []int64{51413, 51413},
+		"max_active_downloading": -1,
+	}
+
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("sessionConfig() = %v, want %v", config, want)
+	}
+
+	if _, err := sessionConfig(&backend.Session{AltSpeedEnabled: &enabled}); err == nil {
+		t.Error("sessionConfig() with alt speeds: expected an error")
+	}
+}
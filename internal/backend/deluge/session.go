@@ -0,0 +1,279 @@
+package deluge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+// coreConfig holds the parts of core.get_config trpc knows about.
+type coreConfig struct {
+	AddPaused                bool    `json:"add_paused"`
+	CacheSize                int64   `json:"cache_size"`
+	DHT                      bool    `json:"dht"`
+	DownloadLocation         string  `json:"download_location"`
+	EncInPolicy              int64   `json:"enc_in_policy"`
+	EncOutPolicy             int64   `json:"enc_out_policy"`
+	ListenPorts              []int64 `json:"listen_ports"`
+	LSD                      bool    `json:"lsd"`
+	MaxActiveDownloading     int64   `json:"max_active_downloading"`
+	MaxActiveSeeding         int64   `json:"max_active_seeding"`
+	MaxConnectionsGlobal     int64   `json:"max_connections_global"`
+	MaxConnectionsPerTorrent int64   `json:"max_connections_per_torrent"`
+	MaxDownloadSpeed         float64 `json:"max_download_speed"`
+	MaxUploadSpeed           float64 `json:"max_upload_speed"`
+	RandomPort               bool    `json:"random_port"`
+	StopSeedAtRatio          bool    `json:"stop_seed_at_ratio"`
+	StopSeedRatio            float64 `json:"stop_seed_ratio"`
+	UPnP                     bool    `json:"upnp"`
+	UTPEx                    bool    `json:"utpex"`
+}
+
+// Transmission's encryption modes, indexed by Deluge's policies (forced,
+// enabled, disabled).
+var encryptionModes = []string{"required", "preferred", "tolerated"}
+
+// Deluge's cache_size is in blocks of 16 KiB.
+const cacheBlocksPerMB = 64
+
+// SessionGet implements backend.Backend.
+func (b *Backend) SessionGet() (*backend.Session, error) {
+	var config coreConfig
+	if err := b.call("core.get_config", []interface{}{}, &config); err != nil {
+		return nil, err
+	}
+
+	var version string
+	if err := b.call("daemon.info", []interface{}{}, &version); err != nil {
+		return nil, err
+	}
+
+	encryption := ""
+	if config.EncOutPolicy >= 0 && int(config.EncOutPolicy) < len(encryptionModes) {
+		encryption = encryptionModes[config.EncOutPolicy]
+	}
+
+	var port int64
+	if len(config.ListenPorts) > 0 {
+		port = config.ListenPorts[0]
+	}
+
+	return &backend.Session{
+		CacheSizeMB:           int64p(config.CacheSize / cacheBlocksPerMB),
+		DHTEnabled:            boolp(config.DHT),
+		DownloadDir:           stringp(strings.TrimRight(config.DownloadLocation, "/")),
+		DownloadQueueEnabled:  boolp(config.MaxActiveDownloading >= 0),
+		DownloadQueueSize:     int64p(config.MaxActiveDownloading),
+		Encryption:            stringp(encryption),
+		LPDEnabled:            boolp(config.LSD),
+		PeerLimitGlobal:       int64p(config.MaxConnectionsGlobal),
+		PeerLimitPerTorrent:   int64p(config.MaxConnectionsPerTorrent),
+		PeerPort:              int64p(port),
+		PeerPortRandomOnStart: boolp(config.RandomPort),
+		PEXEnabled:            boolp(config.UTPEx),
+		PortForwardingEnabled: boolp(config.UPnP),
+		SeedQueueEnabled:      boolp(config.MaxActiveSeeding >= 0),
+		SeedQueueSize:         int64p(config.MaxActiveSeeding),
+		SeedRatioLimit:        float64p(config.StopSeedRatio),
+		SeedRatioLimited:      boolp(config.StopSeedAtRatio),
+		SpeedLimitDown:        int64p(int64(config.MaxDownloadSpeed)),
+		SpeedLimitDownEnabled: boolp(config.MaxDownloadSpeed > 0),
+		SpeedLimitUp:          int64p(int64(config.MaxUploadSpeed)),
+		SpeedLimitUpEnabled:   boolp(config.MaxUploadSpeed > 0),
+		StartAddedTorrents:    boolp(!config.AddPaused),
+		Version:               stringp(version),
+	}, nil
+}
+
+// sessionConfig converts the non-nil fields of a session to core.set_config
+// values. It fails on settings Deluge doesn't have.
+func sessionConfig(s *backend.Session) (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+
+	var unsupported []string
+
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			config[name] = *value
+		}
+	}
+
+	setInt := func(name string, value *int64) {
+		if value != nil {
+			config[name] = *value
+		}
+	}
+
+	setBool("dht", s.DHTEnabled)
+	setBool("lsd", s.LPDEnabled)
+	setInt("max_connections_global", s.PeerLimitGlobal)
+	setInt("max_connections_per_torrent", s.PeerLimitPerTorrent)
+	setBool("random_port", s.PeerPortRandomOnStart)
+	setBool("utpex", s.PEXEnabled)
+	setBool("upnp", s.PortForwardingEnabled)
+	setBool("stop_seed_at_ratio", s.SeedRatioLimited)
+
+	if s.CacheSizeMB != nil {
+		config["cache_size"] = *s.CacheSizeMB * cacheBlocksPerMB
+	}
+
+	if s.DownloadDir != nil {
+		config["download_location"] = *s.DownloadDir
+	}
+
+	if s.SeedRatioLimit != nil {
+		config["stop_seed_ratio"] = *s.SeedRatioLimit
+	}
+
+	if s.PeerPort != nil {
+		config["listen_ports"] = []int64{*s.PeerPort, *s.PeerPort}
+	}
+
+	if s.StartAddedTorrents != nil {
+		config["add_paused"] = !*s.StartAddedTorrents
+	}
+
+	// A queue is disabled with an unlimited (-1) number of active torrents.
+	queue := func(name string, enabled *bool, size *int64) {
+		switch {
+		case enabled != nil && !*enabled:
+			config[name] = -1
+		case size != nil:
+			config[name] = *size
+		}
+	}
+
+	queue("max_active_downloading", s.DownloadQueueEnabled, s.DownloadQueueSize)
+	queue("max_active_seeding", s.SeedQueueEnabled, s.SeedQueueSize)
+
+	if limit, ok := speedLimit(s.SpeedLimitDown, s.SpeedLimitDownEnabled); ok {
+		config["max_download_speed"] = limit
+	}
+
+	if limit, ok := speedLimit(s.SpeedLimitUp, s.SpeedLimitUpEnabled); ok {
+		config["max_upload_speed"] = limit
+	}
+
+	if s.Encryption != nil {
+		mode := -1
+
+		for i, m := range encryptionModes {
+			if m == *s.Encryption {
+				mode = i
+			}
+		}
+
+		if mode < 0 {
+			unsupported = append(unsupported, "encryption="+*s.Encryption)
+		} else {
+			config["enc_in_policy"] = mode
+			config["enc_out_policy"] = mode
+		}
+	}
+
+	check := func(set bool, name string) {
+		if set {
+			unsupported = append(unsupported, name)
+		}
+	}
+
+	check(s.AltSpeedDown != nil, "alt-speed-down")
+	check(s.AltSpeedEnabled != nil, "alt-speed-enabled")
+	check(s.AltSpeedTimeBegin != nil, "alt-speed-time-begin")
+	check(s.AltSpeedTimeDay != nil, "alt-speed-time-day")
+	check(s.AltSpeedTimeEnabled != nil, "alt-speed-time-enabled")
+	check(s.AltSpeedTimeEnd != nil, "alt-speed-time-end")
+	check(s.AltSpeedUp != nil, "alt-speed-up")
+	check(s.BlocklistEnabled != nil, "blocklist-enabled")
+	check(s.BlocklistURL != nil, "blocklist-url")
+	check(s.IdleSeedingLimit != nil, "idle-seeding-limit")
+	check(s.IdleSeedingLimitEnabled != nil, "idle-seeding-limit-enabled")
+	check(s.IncompleteDir != nil, "incomplete-dir")
+	check(s.IncompleteDirEnabled != nil, "incomplete-dir-enabled")
+	check(s.QueueStalledEnabled != nil, "queue-stalled-enabled")
+	check(s.QueueStalledMinutes != nil, "queue-stalled-minutes")
+	check(s.RenamePartialFiles != nil, "rename-partial-files")
+	check(s.ScriptTorrentDoneEnabled != nil, "script-torrent-done-enabled")
+	check(s.ScriptTorrentDoneFilename != nil, "script-torrent-done-filename")
+	check(s.TrashOriginalTorrentFiles != nil, "trash-original-torrent-files")
+	check(s.UTPEnabled != nil, "utp-enabled")
+
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("deluge: unsupported session settings: %s", strings.Join(unsupported, ", "))
+	}
+
+	return config, nil
+}
+
+// SessionSet implements backend.Backend.
+func (b *Backend) SessionSet(s *backend.Session) error {
+	config, err := sessionConfig(s)
+	if err != nil {
+		return err
+	}
+
+	if len(config) == 0 {
+		return nil
+	}
+
+	return b.call("core.set_config", []interface{}{config}, nil)
+}
+
+// sessionStatus holds the core.get_session_status keys trpc asks for.
+type sessionStatus struct {
+	PayloadDownloadRate  float64 `json:"payload_download_rate"`
+	PayloadUploadRate    float64 `json:"payload_upload_rate"`
+	TotalPayloadDownload int64   `json:"total_payload_download"`
+	TotalPayloadUpload   int64   `json:"total_payload_upload"`
+}
+
+var sessionStatusKeys = []string{
+	"payload_download_rate", "payload_upload_rate", "total_payload_download", "total_payload_upload",
+}
+
+// SessionStats implements backend.Backend. Deluge only keeps the amounts of
+// data transferred since the daemon started.
+func (b *Backend) SessionStats() (*backend.SessionStats, error) {
+	var session sessionStatus
+	if err := b.call("core.get_session_status", []interface{}{sessionStatusKeys}, &session); err != nil {
+		return nil, err
+	}
+
+	torrents, err := b.torrentsStatus([]string{"state", "total_done", "total_wanted"})
+	if err != nil {
+		return nil, err
+	}
+
+	var paused int64
+
+	for _, s := range torrents {
+		if status(s) == backend.StatusStopped {
+			paused++
+		}
+	}
+
+	return &backend.SessionStats{
+		ActiveTorrentCount: int64p(int64(len(torrents)) - paused),
+		PausedTorrentCount: int64p(paused),
+		TorrentCount:       int64p(int64(len(torrents))),
+		DownloadSpeed:      int64p(int64(session.PayloadDownloadRate)),
+		UploadSpeed:        int64p(int64(session.PayloadUploadRate)),
+		Current: backend.Stats{
+			UploadedBytes:   int64p(session.TotalPayloadUpload),
+			DownloadedBytes: int64p(session.TotalPayloadDownload),
+		},
+	}, nil
+}
+
+// FreeSpace implements backend.Backend.
+func (b *Backend) FreeSpace(path string) (int64, error) {
+	var free int64
+	if err := b.call("core.get_free_space", []interface{}{path}, &free); err != nil {
+		return 0, err
+	}
+
+	return free, nil
+}
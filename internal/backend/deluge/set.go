@@ -0,0 +1,312 @@
+package deluge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+// unsupportedSet lists the fields of a payload Deluge has no equivalent for.
+func unsupportedSet(p *backend.TorrentSetPayload) []string {
+	var fields []string
+
+	check := func(set bool, name string) {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+
+	check(p.BandwidthPriority != nil, "bandwidthPriority")
+	check(p.HonorsSessionLimits != nil, "honorsSessionLimits")
+	check(len(p.Labels) > 1, "labels (Deluge has a single label)")
+	check(p.QueuePosition != nil, "queuePosition")
+	check(p.SeedIdleLimit != nil, "seedIdleLimit")
+	check(p.SeedIdleMode != nil, "seedIdleMode")
+	check(p.SeedRatioMode != nil && *p.SeedRatioMode == backend.SeedRatioModeGlobal, "seedRatioMode=global")
+
+	return fields
+}
+
+// speedLimit converts a transmission limit (KB/s and a flag) to Deluge's
+// KiB/s, where -1 means unlimited. ok is false if nothing is to be changed.
+func speedLimit(limit *int64, limited *bool) (value int64, ok bool) {
+	switch {
+	case limited != nil && !*limited:
+		return -1, true
+	case limit != nil:
+		return *limit, true
+	}
+
+	return 0, false
+}
+
+// torrentOptions converts a payload to core.set_torrent_options options.
+func torrentOptions(p *backend.TorrentSetPayload) map[string]interface{} {
+	options := make(map[string]interface{})
+
+	if limit, ok := speedLimit(p.DownloadLimit, p.DownloadLimited); ok {
+		options["max_download_speed"] = limit
+	}
+
+	if limit, ok := speedLimit(p.UploadLimit, p.UploadLimited); ok {
+		options["max_upload_speed"] = limit
+	}
+
+	if p.PeerLimit != nil {
+		options["max_connections"] = *p.PeerLimit
+	}
+
+	if p.SeedRatioLimit != nil {
+		options["stop_ratio"] = *p.SeedRatioLimit
+		options["stop_at_ratio"] = true
+	}
+
+	if p.SeedRatioMode != nil {
+		options["stop_at_ratio"] = *p.SeedRatioMode == backend.SeedRatioModeCustom
+	}
+
+	return options
+}
+
+// TorrentSet implements backend.Backend. Nothing is changed if the payload
+// holds a setting Deluge doesn't support.
+func (b *Backend) TorrentSet(p *backend.TorrentSetPayload) error {
+	if fields := unsupportedSet(p); len(fields) > 0 {
+		return fmt.Errorf("deluge: unsupported torrent settings: %s", strings.Join(fields, ", "))
+	}
+
+	hashes, err := b.hashes(p.IDs)
+	if err != nil {
+		return err
+	}
+
+	if options := torrentOptions(p); len(options) > 0 {
+		if err := b.call("core.set_torrent_options", []interface{}{hashes, options}, nil); err != nil {
+			return err
+		}
+	}
+
+	if p.Location != nil {
+		if err := b.call("core.move_storage", []interface{}{hashes, *p.Location}, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, hash := range hashes {
+		if err := b.setFiles(hash, p); err != nil {
+			return err
+		}
+
+		if err := b.setTrackers(hash, p); err != nil {
+			return err
+		}
+
+		if p.Labels != nil {
+			label := ""
+			if len(p.Labels) == 1 {
+				label = strings.ToLower(p.Labels[0])
+			}
+
+			if err := b.call("label.set_torrent", []interface{}{hash, label}, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// setFiles changes the file priorities, which Deluge only sets all at once.
+// Skipping a file is its lowest priority, so priorities are only given to
+// wanted files.
+func (b *Backend) setFiles(hash string, p *backend.TorrentSetPayload) error {
+	if len(p.FilesWanted)+len(p.FilesUnwanted)+len(p.PriorityLow)+len(p.PriorityNormal)+len(p.PriorityHigh) == 0 {
+		return nil
+	}
+
+	s, err := b.torrentStatus(hash, []string{"file_priorities"})
+	if err != nil {
+		return err
+	}
+
+	priorities := s.FilePriorities
+
+	set := func(ids []int64, priority func(current int64) int64) error {
+		for _, id := range ids {
+			if id < 0 || id >= int64(len(priorities)) {
+				return fmt.Errorf("deluge: torrent %s has no file %d", hash, id)
+			}
+
+			priorities[id] = priority(priorities[id])
+		}
+
+		return nil
+	}
+
+	wanted := func(current int64) int64 {
+		if current == filePrioritySkip {
+			return filePriorityNormal
+		}
+
+		return current
+	}
+
+	unwanted := func(int64) int64 { return filePrioritySkip }
+
+	prioritize := func(priority int64) func(int64) int64 {
+		return func(current int64) int64 {
+			if current == filePrioritySkip {
+				return current
+			}
+
+			return priority
+		}
+	}
+
+	changes := []struct {
+		ids      []int64
+		priority func(int64) int64
+	}{
+		{p.FilesWanted, wanted},
+		{p.FilesUnwanted, unwanted},
+		{p.PriorityLow, prioritize(filePriorityLow)},
+		{p.PriorityNormal, prioritize(filePriorityNormal)},
+		{p.PriorityHigh, prioritize(filePriorityHigh)},
+	}
+
+	for _, change := range changes {
+		if err := set(change.ids, change.priority); err != nil {
+			return err
+		}
+	}
+
+	options := map[string]interface{}{"file_priorities": priorities}
+
+	return b.call("core.set_torrent_options", []interface{}{[]string{hash}, options}, nil)
+}
+
+// setTrackers adds, removes and replaces trackers. Deluge only sets the
+// whole list, tracker IDs are indexes in it.
+func (b *Backend) setTrackers(hash string, p *backend.TorrentSetPayload) error {
+	if len(p.TrackerAdd)+len(p.TrackerRemove)+len(p.TrackerReplace) == 0 {
+		return nil
+	}
+
+	s, err := b.torrentStatus(hash, []string{"trackers"})
+	if err != nil {
+		return err
+	}
+
+	trackers := s.Trackers
+
+	index := func(id int64) (int, error) {
+		if id < 0 || id >= int64(len(trackers)) {
+			return 0, fmt.Errorf("deluge: no tracker with ID %d", id)
+		}
+
+		return int(id), nil
+	}
+
+	for _, r := range p.TrackerReplace {
+		j, err := index(r.ID)
+		if err != nil {
+			return err
+		}
+
+		trackers[j].URL = r.Announce
+	}
+
+	removed := make(map[int]bool, len(p.TrackerRemove))
+
+	for _, id := range p.TrackerRemove {
+		j, err := index(id)
+		if err != nil {
+			return err
+		}
+
+		removed[j] = true
+	}
+
+	tier := int64(-1)
+	list := make([]map[string]interface{}, 0, len(trackers)+len(p.TrackerAdd))
+
+	for i, tr := range trackers {
+		if tr.Tier > tier {
+			tier = tr.Tier
+		}
+
+		if !removed[i] {
+			list = append(list, map[string]interface{}{"url": tr.URL, "tier": tr.Tier})
+		}
+	}
+
+	// Like transmission, each added tracker gets a tier of its own.
+	for _, announce := range p.TrackerAdd {
+		tier++
+		list = append(list, map[string]interface{}{"url": announce, "tier": tier})
+	}
+
+	return b.call("core.set_torrent_trackers", []interface{}{hash, list}, nil)
+}
+
+// TorrentAdd implements backend.Backend.
+func (b *Backend) TorrentAdd(p *backend.TorrentAddPayload) (*backend.Torrent, error) {
+	if p.BandwidthPriority != nil || len(p.FilesWanted)+len(p.FilesUnwanted) > 0 ||
+		len(p.PriorityHigh)+len(p.PriorityLow)+len(p.PriorityNormal) > 0 {
+		return nil, errors.New("deluge: only the download directory, paused and the peer limit can be set when adding torrents")
+	}
+
+	options := make(map[string]interface{})
+
+	if p.DownloadDir != nil {
+		options["download_location"] = *p.DownloadDir
+	}
+
+	if p.Paused != nil {
+		options["add_paused"] = *p.Paused
+	}
+
+	if p.PeerLimit != nil {
+		options["max_connections"] = *p.PeerLimit
+	}
+
+	var (
+		hash *string
+		err  error
+	)
+
+	switch {
+	case p.MetaInfo != nil:
+		err = b.call("core.add_torrent_file", []interface{}{"trpc.torrent", *p.MetaInfo, options}, &hash)
+	case p.Filename != nil && strings.HasPrefix(*p.Filename, "magnet:"):
+		err = b.call("core.add_torrent_magnet", []interface{}{*p.Filename, options}, &hash)
+	case p.Filename != nil:
+		headers := map[string]interface{}{}
+		if p.Cookies != nil {
+			headers["Cookie"] = *p.Cookies
+		}
+
+		err = b.call("core.add_torrent_url", []interface{}{*p.Filename, options, headers}, &hash)
+	default:
+		return nil, errors.New("deluge: nothing to add")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hash == nil || *hash == "" {
+		return nil, errors.New("deluge: the torrent wasn't added (invalid or already added?)")
+	}
+
+	s, err := b.torrentStatus(*hash, []string{"name"})
+	if err != nil {
+		return nil, err
+	}
+
+	id := b.ids.ID(*hash)
+
+	return &backend.Torrent{ID: &id, Name: &s.Name, HashString: hash}, nil
+}
@@ -0,0 +1,530 @@
+package deluge
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hekmon/cunits/v2"
+	"github.com/shric/trpc/internal/backend"
+)
+
+// Transmission's error codes.
+const (
+	errorTrackerError = 2
+	errorLocal        = 3
+)
+
+// File priorities (Deluge 2).
+const (
+	filePrioritySkip   = 0
+	filePriorityLow    = 1
+	filePriorityNormal = 4
+	filePriorityHigh   = 7
+)
+
+// torrentStatus is the answer of core.get_torrent_status for the keys below.
+type torrentStatus struct {
+	ActiveTime          int64            `json:"active_time"`
+	AllTimeDownload     int64            `json:"all_time_download"`
+	Comment             string           `json:"comment"`
+	CompletedTime       float64          `json:"completed_time"`
+	DownloadPayloadRate int64            `json:"download_payload_rate"`
+	Eta                 int64            `json:"eta"`
+	FilePriorities      []int64          `json:"file_priorities"`
+	FileProgress        []float64        `json:"file_progress"`
+	Files               []torrentFile    `json:"files"`
+	Hash                string           `json:"hash"`
+	IsFinished          bool             `json:"is_finished"`
+	Label               string           `json:"label"`
+	MagnetURI           string           `json:"magnet_uri"`
+	MaxConnections      int64            `json:"max_connections"`
+	MaxDownloadSpeed    float64          `json:"max_download_speed"`
+	MaxUploadSpeed      float64          `json:"max_upload_speed"`
+	Message             string           `json:"message"`
+	Name                string           `json:"name"`
+	NumPeers            int64            `json:"num_peers"`
+	NumPieces           int64            `json:"num_pieces"`
+	NumSeeds            int64            `json:"num_seeds"`
+	Peers               []torrentPeer    `json:"peers"`
+	PieceLength         int64            `json:"piece_length"`
+	Private             bool             `json:"private"`
+	Progress            float64          `json:"progress"`
+	Queue               int64            `json:"queue"`
+	Ratio               float64          `json:"ratio"`
+	SavePath            string           `json:"save_path"`
+	SeedingTime         int64            `json:"seeding_time"`
+	State               string           `json:"state"`
+	StopAtRatio         bool             `json:"stop_at_ratio"`
+	StopRatio           float64          `json:"stop_ratio"`
+	TimeAdded           float64          `json:"time_added"`
+	TimeSinceTransfer   int64            `json:"time_since_transfer"`
+	TotalDone           int64            `json:"total_done"`
+	TotalPeers          int64            `json:"total_peers"`
+	TotalSeeds          int64            `json:"total_seeds"`
+	TotalSize           int64            `json:"total_size"`
+	TotalUploaded       int64            `json:"total_uploaded"`
+	TotalWanted         int64            `json:"total_wanted"`
+	TrackerHost         string           `json:"tracker_host"`
+	TrackerStatus       string           `json:"tracker_status"`
+	Trackers            []torrentTracker `json:"trackers"`
+	UploadPayloadRate   int64            `json:"upload_payload_rate"`
+
+	// present holds the keys the daemon answered, as some only exist in
+	// recent versions or with a plugin enabled.
+	present map[string]bool
+}
+
+// torrentFile is an element of the files key.
+type torrentFile struct {
+	Index int64  `json:"index"`
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+}
+
+// torrentTracker is an element of the trackers key.
+type torrentTracker struct {
+	URL  string `json:"url"`
+	Tier int64  `json:"tier"`
+}
+
+// torrentPeer is an element of the peers key.
+type torrentPeer struct {
+	Client    string  `json:"client"`
+	DownSpeed int64   `json:"down_speed"`
+	IP        string  `json:"ip"`
+	Progress  float64 `json:"progress"`
+	UpSpeed   int64   `json:"up_speed"`
+}
+
+// statusKeys are always requested.
+var statusKeys = []string{
+	"active_time", "all_time_download", "comment", "completed_time", "download_payload_rate", "eta", "hash",
+	"is_finished", "label", "magnet_uri", "max_connections", "max_download_speed", "max_upload_speed", "message",
+	"name", "num_peers", "num_pieces", "num_seeds", "piece_length", "private", "progress", "queue", "ratio",
+	"save_path", "seeding_time", "state", "stop_at_ratio", "stop_ratio", "time_added", "time_since_transfer",
+	"total_done", "total_peers", "total_seeds", "total_size", "total_uploaded", "total_wanted", "tracker_host",
+	"tracker_status", "trackers", "upload_payload_rate",
+}
+
+// Fields whose keys are only requested when needed.
+var (
+	fileFields = []string{"files", "fileStats", "priorities", "wanted"}
+	fileKeys   = []string{"files", "file_priorities", "file_progress"}
+)
+
+// optionalKeys maps the keys that not every daemon has to the fields they fill.
+var optionalKeys = map[string]string{
+	"comment":             "comment",
+	"completed_time":      "doneDate",
+	"label":               "labels",
+	"magnet_uri":          "magnetLink",
+	"time_since_transfer": "activityDate",
+}
+
+// unsupportedFields are the fields Deluge has no equivalent for.
+var unsupportedFields = []string{
+	"bandwidthPriority", "corruptEver", "creator", "dateCreated", "haveUnchecked", "honorsSessionLimits",
+	"pieces", "seedIdleLimit", "seedIdleMode", "startDate",
+}
+
+func wants(fields []string, names ...string) bool {
+	for _, field := range fields {
+		for _, name := range names {
+			if field == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func keysFor(fields []string) []string {
+	keys := append([]string{}, statusKeys...)
+
+	if wants(fields, fileFields...) {
+		keys = append(keys, fileKeys...)
+	}
+
+	if wants(fields, "peers") {
+		keys = append(keys, "peers")
+	}
+
+	return keys
+}
+
+func decodeStatus(hash string, data json.RawMessage) (*torrentStatus, error) {
+	s := &torrentStatus{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+
+	s.present = make(map[string]bool, len(keys))
+	for key := range keys {
+		s.present[key] = true
+	}
+
+	if hash != "" {
+		s.Hash = hash
+	}
+
+	return s, nil
+}
+
+// torrentsStatus lists all the torrents and refreshes the ID map.
+func (b *Backend) torrentsStatus(keys []string) ([]*torrentStatus, error) {
+	var answer map[string]json.RawMessage
+	if err := b.call("core.get_torrents_status", []interface{}{map[string]interface{}{}, keys}, &answer); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*torrentStatus, 0, len(answer))
+	hashes := make([]string, 0, len(answer))
+
+	for hash, data := range answer {
+		s, err := decodeStatus(hash, data)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, s)
+		hashes = append(hashes, hash)
+	}
+
+	b.ids.Assign(hashes)
+
+	return statuses, nil
+}
+
+// torrentStatus returns some keys of a single torrent.
+func (b *Backend) torrentStatus(hash string, keys []string) (*torrentStatus, error) {
+	var answer json.RawMessage
+	if err := b.call("core.get_torrent_status", []interface{}{hash, keys}, &answer); err != nil {
+		return nil, err
+	}
+
+	return decodeStatus(hash, answer)
+}
+
+// status maps a Deluge state onto a transmission status.
+func status(s *torrentStatus) backend.Status {
+	done := s.TotalDone >= s.TotalWanted
+
+	switch s.State {
+	case "Downloading":
+		return backend.StatusDownload
+	case "Seeding":
+		return backend.StatusSeed
+	case "Checking":
+		return backend.StatusCheck
+	case "Queued":
+		if done {
+			return backend.StatusSeedWait
+		}
+
+		return backend.StatusDownloadWait
+	case "Moving", "Allocating":
+		if done {
+			return backend.StatusSeed
+		}
+
+		return backend.StatusDownload
+	default: // Paused, Error
+		return backend.StatusStopped
+	}
+}
+
+// activePeers returns at least one peer while data is flowing, so that the
+// status shown by trpc (Seeding, Downloading, Idle...) follows the rates.
+func activePeers(rate, peers int64) int64 {
+	if rate == 0 {
+		return 0
+	}
+
+	if peers == 0 {
+		return 1
+	}
+
+	return peers
+}
+
+func unixTime(seconds float64) *time.Time {
+	if seconds < 0 {
+		seconds = 0
+	}
+
+	t := time.Unix(int64(seconds), 0)
+
+	return &t
+}
+
+func byteSize(n int64) *cunits.Bits {
+	bits := cunits.ImportInByte(float64(n))
+	return &bits
+}
+
+func int64p(n int64) *int64 {
+	return &n
+}
+
+func boolp(b bool) *bool {
+	return &b
+}
+
+func stringp(s string) *string {
+	return &s
+}
+
+func float64p(f float64) *float64 {
+	return &f
+}
+
+func (b *Backend) fromStatus(s *torrentStatus) *backend.Torrent {
+	st := status(s)
+	t := &backend.Torrent{
+		ID:                  int64p(b.ids.ID(s.Hash)),
+		HashString:          stringp(s.Hash),
+		Name:                stringp(s.Name),
+		Status:              &st,
+		SizeWhenDone:        byteSize(s.TotalWanted),
+		TotalSize:           byteSize(s.TotalSize),
+		LeftUntilDone:       int64p(s.TotalWanted - s.TotalDone),
+		PercentDone:         float64p(s.Progress / 100),
+		RecheckProgress:     float64p(0),
+		RateDownload:        int64p(s.DownloadPayloadRate),
+		RateUpload:          int64p(s.UploadPayloadRate),
+		DownloadedEver:      int64p(s.AllTimeDownload),
+		UploadedEver:        int64p(s.TotalUploaded),
+		UploadRatio:         float64p(s.Ratio),
+		Eta:                 int64p(s.Eta),
+		DownloadDir:         stringp(strings.TrimRight(s.SavePath, "/")),
+		AddedDate:           unixTime(s.TimeAdded),
+		DoneDate:            unixTime(s.CompletedTime),
+		ActivityDate:        unixTime(0),
+		StartDate:           unixTime(0),
+		DateCreated:         unixTime(0),
+		IsFinished:          boolp(s.IsFinished),
+		IsPrivate:           boolp(s.Private),
+		Error:               int64p(0),
+		ErrorString:         stringp(""),
+		BandwidthPriority:   int64p(0),
+		QueuePosition:       int64p(0),
+		MagnetLink:          stringp(s.MagnetURI),
+		Comment:             stringp(s.Comment),
+		Creator:             stringp(""),
+		CorruptEver:         int64p(0),
+		HaveUnchecked:       int64p(0),
+		PieceCount:          int64p(s.NumPieces),
+		PieceSize:           byteSize(s.PieceLength),
+		PeerLimit:           int64p(s.MaxConnections),
+		PeersConnected:      int64p(s.NumSeeds + s.NumPeers),
+		PeersGettingFromUs:  int64p(activePeers(s.UploadPayloadRate, s.NumPeers)),
+		PeersSendingToUs:    int64p(activePeers(s.DownloadPayloadRate, s.NumSeeds)),
+		SecondsDownloading:  int64p(s.ActiveTime - s.SeedingTime),
+		DownloadLimited:     boolp(s.MaxDownloadSpeed > 0),
+		DownloadLimit:       int64p(int64(s.MaxDownloadSpeed)),
+		UploadLimited:       boolp(s.MaxUploadSpeed > 0),
+		UploadLimit:         int64p(int64(s.MaxUploadSpeed)),
+		SeedRatioLimit:      float64p(s.StopRatio),
+		HonorsSessionLimits: boolp(true),
+		Labels:              []string{},
+		Unsupported:         make(map[string]bool),
+	}
+
+	for _, field := range unsupportedFields {
+		t.Unsupported[field] = true
+	}
+
+	for key, field := range optionalKeys {
+		if !s.present[key] {
+			t.Unsupported[field] = true
+		}
+	}
+
+	seeding := time.Duration(s.SeedingTime) * time.Second
+	t.SecondsSeeding = &seeding
+
+	if s.Eta <= 0 {
+		*t.Eta = -1
+	}
+
+	if st == backend.StatusCheck {
+		*t.RecheckProgress = s.Progress / 100
+	}
+
+	if s.Queue > 0 {
+		*t.QueuePosition = s.Queue
+	}
+
+	if s.present["time_since_transfer"] && s.TimeSinceTransfer >= 0 {
+		*t.ActivityDate = time.Now().Add(-time.Duration(s.TimeSinceTransfer) * time.Second).Truncate(time.Second)
+	}
+
+	switch {
+	case s.State == "Error":
+		*t.Error = errorLocal
+		*t.ErrorString = s.Message
+	case strings.HasPrefix(s.TrackerStatus, "Error"):
+		*t.Error = errorTrackerError
+		*t.ErrorString = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(s.TrackerStatus, "Error"), ":"))
+	}
+
+	// Per torrent options are copied from the session when a torrent is
+	// added, there's no "use the global ratio" mode.
+	mode := backend.SeedRatioModeNoRatio
+	if s.StopAtRatio {
+		mode = backend.SeedRatioModeCustom
+	}
+
+	t.SeedRatioMode = &mode
+
+	if s.Label != "" {
+		t.Labels = append(t.Labels, s.Label)
+	}
+
+	b.addTrackers(t, s)
+	addFiles(t, s)
+
+	for _, p := range s.Peers {
+		t.Peers = append(t.Peers, fromPeer(p))
+	}
+
+	return t
+}
+
+// addTrackers fills in trackers and trackerStats. Deluge only reports the
+// status of the tracker currently in use (by host name).
+func (b *Backend) addTrackers(t *backend.Torrent, s *torrentStatus) {
+	current := false
+
+	for i, tr := range s.Trackers {
+		host := tr.URL
+		stats := &backend.TrackerStats{Announce: tr.URL, ID: int64(i), Tier: tr.Tier}
+
+		if u, err := url.Parse(tr.URL); err == nil {
+			host = u.Scheme + "://" + u.Host
+
+			if !current && s.TrackerHost != "" && strings.HasSuffix(u.Hostname(), s.TrackerHost) {
+				current = true
+				stats.LastAnnounceResult = s.TrackerStatus
+				stats.LastAnnounceSucceeded = strings.HasSuffix(s.TrackerStatus, "OK")
+				stats.SeederCount = s.TotalSeeds
+				stats.LeecherCount = s.TotalPeers
+			}
+		}
+
+		stats.Host = host
+		t.Trackers = append(t.Trackers, &backend.Tracker{Announce: tr.URL, ID: int64(i), Tier: tr.Tier})
+		t.TrackerStats = append(t.TrackerStats, stats)
+	}
+}
+
+// filePriority maps Deluge's file priorities (1 to 7) onto transmission's
+// (-1, 0 or 1).
+func filePriority(priority int64) int64 {
+	switch {
+	case priority < filePriorityNormal:
+		return -1
+	case priority > filePriorityNormal:
+		return 1
+	}
+
+	return 0
+}
+
+func addFiles(t *backend.Torrent, s *torrentStatus) {
+	for i, f := range s.Files {
+		var (
+			completed int64
+			priority  int64 = filePriorityNormal
+		)
+
+		if i < len(s.FileProgress) {
+			completed = int64(s.FileProgress[i] * float64(f.Size))
+		}
+
+		if i < len(s.FilePriorities) {
+			priority = s.FilePriorities[i]
+		}
+
+		wanted := priority != filePrioritySkip
+		if !wanted {
+			priority = filePriorityNormal
+		}
+
+		t.Files = append(t.Files, &backend.File{BytesCompleted: completed, Length: f.Size, Name: f.Path})
+		t.FileStats = append(t.FileStats, &backend.FileStat{
+			BytesCompleted: completed,
+			Wanted:         wanted,
+			Priority:       filePriority(priority),
+		})
+		t.Priorities = append(t.Priorities, filePriority(priority))
+		t.Wanted = append(t.Wanted, wanted)
+	}
+}
+
+// fromPeer converts a peer, whose ip holds both the address and the port.
+func fromPeer(p torrentPeer) *backend.Peer {
+	address, port := p.IP, int64(0)
+
+	if host, portStr, err := net.SplitHostPort(p.IP); err == nil {
+		address = host
+		port, _ = strconv.ParseInt(portStr, 10, 64)
+	}
+
+	return &backend.Peer{
+		Address:           address,
+		ClientName:        p.Client,
+		IsDownloadingFrom: p.DownSpeed > 0,
+		IsUploadingTo:     p.UpSpeed > 0,
+		Port:              port,
+		Progress:          p.Progress,
+		RateToClient:      p.DownSpeed,
+		RateToPeer:        p.UpSpeed,
+	}
+}
+
+// TorrentGet implements backend.Backend. Torrents are returned in the order
+// they were added, like transmission does.
+func (b *Backend) TorrentGet(fields []string, ids []int64) ([]*backend.Torrent, error) {
+	statuses, err := b.torrentsStatus(keysFor(fields))
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	var torrents []*backend.Torrent
+
+	for _, s := range statuses {
+		t := b.fromStatus(s)
+		if len(ids) > 0 && !selected[*t.ID] {
+			continue
+		}
+
+		torrents = append(torrents, t)
+	}
+
+	sort.SliceStable(torrents, func(i, j int) bool {
+		if !torrents[i].AddedDate.Equal(*torrents[j].AddedDate) {
+			return torrents[i].AddedDate.Before(*torrents[j].AddedDate)
+		}
+
+		return *torrents[i].HashString < *torrents[j].HashString
+	})
+
+	return torrents, nil
+}
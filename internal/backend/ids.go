@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hashIDDigits is the number of leading hex digits of an info hash used to
+// derive a torrent ID.
+const hashIDDigits = 7
+
+// IDMap assigns torrent IDs to info hashes for clients that identify torrents
+// by hash only. An ID is derived from the start of the hash so that a torrent
+// keeps its ID across invocations (and daemon restarts). The rare clashes are
+// resolved by probing upwards, in hash order.
+type IDMap struct {
+	ids    map[string]int64
+	hashes map[int64]string
+}
+
+// HashID returns the ID derived from hash, ignoring clashes.
+func HashID(hash string) int64 {
+	hash = strings.ToLower(hash)
+	if len(hash) > hashIDDigits {
+		hash = hash[:hashIDDigits]
+	}
+
+	id, err := strconv.ParseInt(hash, 16, 64)
+	if err != nil {
+		return 0
+	}
+
+	// Keep 0 free: trpc uses it for torrents that don't exist yet.
+	return id + 1
+}
+
+// Assign replaces the map with IDs for the given hashes.
+func (m *IDMap) Assign(hashes []string) {
+	sorted := make([]string, len(hashes))
+	for i, hash := range hashes {
+		sorted[i] = strings.ToLower(hash)
+	}
+
+	sort.Strings(sorted)
+
+	m.ids = make(map[string]int64, len(sorted))
+	m.hashes = make(map[int64]string, len(sorted))
+
+	for _, hash := range sorted {
+		id := HashID(hash)
+		for _, taken := m.hashes[id]; taken; _, taken = m.hashes[id] {
+			id++
+		}
+
+		m.ids[hash] = id
+		m.hashes[id] = hash
+	}
+}
+
+// ID returns the ID of hash.
+func (m *IDMap) ID(hash string) int64 {
+	if id, ok := m.ids[strings.ToLower(hash)]; ok {
+		return id
+	}
+
+	return HashID(hash)
+}
+
+// Hash returns the hash of the torrent with the given ID.
+func (m *IDMap) Hash(id int64) (string, bool) {
+	hash, ok := m.hashes[id]
+	return hash, ok
+}
@@ -0,0 +1,144 @@
+package qbittorrent
+
+import (
+	"crypto/sha1" // nolint:gosec // BitTorrent v1 info hashes are SHA-1
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var errBencode = errors.New("invalid torrent file")
+
+// bencodeEnd returns the index just after the bencoded value starting at i.
+func bencodeEnd(data []byte, i int) (int, error) {
+	if i >= len(data) {
+		return 0, errBencode
+	}
+
+	switch c := data[i]; {
+	case c == 'i':
+		end := strings.IndexByte(string(data[i:]), 'e')
+		if end < 0 {
+			return 0, errBencode
+		}
+
+		return i + end + 1, nil
+	case c == 'l' || c == 'd':
+		i++
+		for i < len(data) && data[i] != 'e' {
+			var err error
+			if i, err = bencodeEnd(data, i); err != nil {
+				return 0, err
+			}
+		}
+
+		if i >= len(data) {
+			return 0, errBencode
+		}
+
+		return i + 1, nil
+	case c >= '0' && c <= '9':
+		_, end, err := bencodeString(data, i)
+		return end, err
+	}
+
+	return 0, errBencode
+}
+
+// bencodeString decodes the string starting at i.
+func bencodeString(data []byte, i int) (string, int, error) {
+	colon := strings.IndexByte(string(data[i:]), ':')
+	if colon < 0 {
+		return "", 0, errBencode
+	}
+
+	length, err := strconv.Atoi(string(data[i : i+colon]))
+	start := i + colon + 1
+
+	if err != nil || length < 0 || start+length > len(data) {
+		return "", 0, errBencode
+	}
+
+	return string(data[start : start+length]), start + length, nil
+}
+
+// dictValues calls fn with the key and the start and end of each value of
+// the bencoded dictionary starting at i.
+func dictValues(data []byte, i int, fn func(key string, start, end int)) error {
+	if i >= len(data) || data[i] != 'd' {
+		return errBencode
+	}
+
+	i++
+
+	for i < len(data) && data[i] != 'e' {
+		key, start, err := bencodeString(data, i)
+		if err != nil {
+			return err
+		}
+
+		end, err := bencodeEnd(data, start)
+		if err != nil {
+			return err
+		}
+
+		fn(key, start, end)
+		i = end
+	}
+
+	return nil
+}
+
+// infoHash returns the hex info hash and the name of a .torrent file.
+func infoHash(metainfo []byte) (hash, name string, err error) {
+	err = dictValues(metainfo, 0, func(key string, start, end int) {
+		if key != "info" {
+			return
+		}
+
+		sum := sha1.Sum(metainfo[start:end]) // nolint:gosec
+		hash = hex.EncodeToString(sum[:])
+
+		_ = dictValues(metainfo, start, func(key string, start, end int) {
+			if key == "name" {
+				name, _, _ = bencodeString(metainfo, start)
+			}
+		})
+	})
+
+	if err == nil && hash == "" {
+		err = errors.New("invalid torrent file: no info dictionary")
+	}
+
+	return hash, name, err
+}
+
+// magnetHash returns the hex info hash and display name of a magnet link,
+// or empty strings if it isn't one.
+func magnetHash(link string) (hash, name string) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "magnet" {
+		return "", ""
+	}
+
+	query := u.Query()
+
+	for _, xt := range query["xt"] {
+		if !strings.HasPrefix(xt, "urn:btih:") {
+			continue
+		}
+
+		hash = strings.TrimPrefix(xt, "urn:btih:")
+
+		if len(hash) == 32 {
+			if raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash)); err == nil {
+				hash = hex.EncodeToString(raw)
+			}
+		}
+	}
+
+	return strings.ToLower(hash), query.Get("dn")
+}
@@ -0,0 +1,347 @@
+// Package qbittorrent implements backend.Backend on top of the qBittorrent
+// v2 Web API.
+//
+// qBittorrent identifies torrents by info hash, so torrent IDs are derived
+// from the hashes (see backend.IDMap). Settings that qBittorrent doesn't
+// have, such as per torrent bandwidth priority or a low file priority, are
+// rejected with an error rather than silently ignored.
+package qbittorrent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+// Config describes how to reach a qBittorrent Web UI.
+type Config struct {
+	// URL is the base URL of the Web UI, e.g. "http://localhost:8080".
+	URL      string
+	User     string
+	Password string
+	// HTTPClient is used for all requests. It is given a cookie jar if it
+	// doesn't already have one, as the API authenticates with a cookie.
+	HTTPClient *http.Client
+	Debug      bool
+}
+
+// Backend talks to a qBittorrent daemon.
+type Backend struct {
+	config Config
+	ids    backend.IDMap
+}
+
+// apiError is returned when the Web API answers with a non-200 status.
+type apiError struct {
+	path   string
+	status int
+	body   string
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("qbittorrent: %s: %d %s", e.path, e.status, http.StatusText(e.status))
+	if e.body != "" {
+		msg += ": " + e.body
+	}
+
+	return msg
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.status == status
+}
+
+// New returns a Backend after logging in to the Web UI. Without a user, for
+// Web UIs that bypass authentication for trusted clients, it only checks
+// that the Web UI can be reached.
+func New(config Config) (*Backend, error) {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+	}
+
+	if config.HTTPClient.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		client := *config.HTTPClient
+		client.Jar = jar
+		config.HTTPClient = &client
+	}
+
+	config.URL = strings.TrimRight(config.URL, "/")
+
+	b := &Backend{config: config}
+
+	if err := b.login(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *Backend) login() error {
+	if b.config.User == "" {
+		return b.do("GET", "app/version", nil, nil)
+	}
+
+	var answer string
+
+	err := b.do("POST", "auth/login", url.Values{
+		"username": {b.config.User},
+		"password": {b.config.Password},
+	}, &answer)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(answer) != "Ok." {
+		return errors.New("qbittorrent: login failed: wrong user or password")
+	}
+
+	return nil
+}
+
+// do calls an API method. GET requests carry params in the query string and
+// POST requests as a form. A *string result receives the raw answer, any
+// other non-nil result is decoded from JSON.
+func (b *Backend) do(method, path string, params url.Values, result interface{}) error {
+	var body io.Reader
+
+	endpoint := b.config.URL + "/api/v2/" + path
+
+	if method == "GET" && len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	} else if method == "POST" {
+		body = strings.NewReader(params.Encode())
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+
+	if method == "POST" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	return b.send(req, path, result)
+}
+
+func (b *Backend) send(req *http.Request, path string, result interface{}) error {
+	// The Web UI's CSRF protection wants a Referer from the same origin.
+	req.Header.Set("Referer", b.config.URL)
+	req.Header.Set("User-Agent", "trpc")
+
+	if b.config.Debug {
+		fmt.Fprintf(os.Stderr, "qbittorrent: %s %s\n", req.Method, req.URL)
+	}
+
+	resp, err := b.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &apiError{path: path, status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+
+	switch r := result.(type) {
+	case nil:
+		return nil
+	case *string:
+		*r = string(data)
+		return nil
+	default:
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("qbittorrent: %s: %v", path, err)
+		}
+
+		return nil
+	}
+}
+
+// post calls a method that changes something. qBittorrent 5 renamed some
+// methods (pause became stop, resume became start), so alternatives are
+// tried in order while the previous one doesn't exist.
+func (b *Backend) post(params url.Values, paths ...string) error {
+	var err error
+
+	for _, path := range paths {
+		if err = b.do("POST", path, params, nil); !isStatus(err, http.StatusNotFound) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// hashes returns the "|" separated hashes of the torrents with the given IDs.
+func (b *Backend) hashes(ids []int64) (string, error) {
+	result := make([]string, len(ids))
+
+	for i, id := range ids {
+		hash, ok := b.ids.Hash(id)
+		if !ok {
+			// Maybe it's a torrent we haven't seen yet.
+			if _, err := b.torrentInfo(); err != nil {
+				return "", err
+			}
+
+			if hash, ok = b.ids.Hash(id); !ok {
+				return "", fmt.Errorf("qbittorrent: no torrent with ID %d", id)
+			}
+		}
+
+		result[i] = hash
+	}
+
+	return strings.Join(result, "|"), nil
+}
+
+func (b *Backend) hashParams(ids []int64) (url.Values, error) {
+	hashes, err := b.hashes(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return url.Values{"hashes": {hashes}}, nil
+}
+
+// Name implements backend.Backend.
+func (b *Backend) Name() string {
+	return "qbittorrent"
+}
+
+// Version implements backend.Backend.
+func (b *Backend) Version() (string, error) {
+	var version, apiVersion string
+
+	if err := b.do("GET", "app/version", nil, &version); err != nil {
+		return "", err
+	}
+
+	if err := b.do("GET", "app/webapiVersion", nil, &apiVersion); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("qBittorrent %s, Web API %s", strings.TrimSpace(version), strings.TrimSpace(apiVersion)), nil
+}
+
+// TorrentRemove implements backend.Backend.
+func (b *Backend) TorrentRemove(ids []int64, deleteData bool) error {
+	params, err := b.hashParams(ids)
+	if err != nil {
+		return err
+	}
+
+	params.Set("deleteFiles", fmt.Sprint(deleteData))
+
+	return b.post(params, "torrents/delete")
+}
+
+// TorrentStart implements backend.Backend. Starting now maps to force start.
+func (b *Backend) TorrentStart(ids []int64, now bool) error {
+	params, err := b.hashParams(ids)
+	if err != nil {
+		return err
+	}
+
+	if err := b.post(params, "torrents/resume", "torrents/start"); err != nil {
+		return err
+	}
+
+	if now {
+		params.Set("value", "true")
+		return b.post(params, "torrents/setForceStart")
+	}
+
+	return nil
+}
+
+// TorrentStop implements backend.Backend.
+func (b *Backend) TorrentStop(ids []int64) error {
+	params, err := b.hashParams(ids)
+	if err != nil {
+		return err
+	}
+
+	return b.post(params, "torrents/pause", "torrents/stop")
+}
+
+// TorrentVerify implements backend.Backend.
+func (b *Backend) TorrentVerify(ids []int64) error {
+	params, err := b.hashParams(ids)
+	if err != nil {
+		return err
+	}
+
+	return b.post(params, "torrents/recheck")
+}
+
+// TorrentSetLocation implements backend.Backend. qBittorrent always moves
+// the data, so move=false isn't supported.
+func (b *Backend) TorrentSetLocation(id int64, location string, move bool) error {
+	if !move {
+		return errors.New("qbittorrent: changing the location without moving the data isn't supported")
+	}
+
+	params, err := b.hashParams([]int64{id})
+	if err != nil {
+		return err
+	}
+
+	params.Set("location", location)
+
+	return b.post(params, "torrents/setLocation")
+}
+
+// TorrentRenamePath implements backend.Backend. Like transmission, renaming
+// the top level path also renames the torrent.
+func (b *Backend) TorrentRenamePath(id int64, oldPath, name string) error {
+	hash, err := b.hashes([]int64{id})
+	if err != nil {
+		return err
+	}
+
+	newPath := name
+	if i := strings.LastIndex(oldPath, "/"); i >= 0 {
+		newPath = oldPath[:i+1] + name
+	}
+
+	params := url.Values{"hash": {hash}, "oldPath": {oldPath}, "newPath": {newPath}}
+
+	// There's no telling files and folders apart from here: try both.
+	if err := b.post(params, "torrents/renameFile"); err != nil {
+		if !isStatus(err, http.StatusConflict) && !isStatus(err, http.StatusBadRequest) {
+			return err
+		}
+
+		if err := b.post(params, "torrents/renameFolder"); err != nil {
+			return err
+		}
+	}
+
+	if strings.Contains(oldPath, "/") {
+		return nil
+	}
+
+	return b.post(url.Values{"hash": {hash}, "name": {name}}, "torrents/rename")
+}
@@ -0,0 +1,293 @@
+package qbittorrent
+
+import (
+	"crypto/sha1" // nolint:gosec
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+const (
+	seedingHash = "aabbccddeeff00112233445566778899aabbccdd"
+	pausedHash  = "0123456789abcdef0123456789abcdef01234567"
+)
+
+var torrentsInfo = `[
+	{"hash": "` + seedingHash + `", "name": "seeding", "state": "uploading", "size": 2048, "total_size": 2048,
+	 "amount_left": 0, "progress": 1, "upspeed": 512, "num_leechs": 0, "uploaded": 4096, "added_on": 200,
+	 "ratio_limit": -2, "eta": 8640000, "tracker": "http://tracker.example/announce", "save_path": "/data/",
+	 "tags": "linux, iso"},
+	{"hash": "` + pausedHash + `", "name": "paused", "state": "pausedDL", "size": 1024, "total_size": 4096,
+	 "amount_left": 512, "progress": 0.5, "added_on": 100, "ratio_limit": 1.5, "eta": 60, "save_path": "/data"}
+]`
+
+var mainData = `{
+	"server_state": {"alltime_dl": 8192, "alltime_ul": 16384, "dl_info_data": 100, "dl_info_speed": 10,
+	 "free_space_on_disk": 1000000, "up_info_data": 200, "up_info_speed": 20},
+	"torrents": {"` + seedingHash + `": {"state": "uploading"}, "` + pausedHash + `": {"state": "pausedDL"}}
+}`
+
+// standIn is a minimal qBittorrent Web API recording the calls it gets.
+type standIn struct {
+	*httptest.Server
+	calls []string
+	// v5 makes the old pause/resume methods answer 404.
+	v5 bool
+}
+
+func newStandIn(t *testing.T) *standIn {
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/v2/")
+
+		if path == "auth/login" {
+			if r.FormValue("username") != "admin" || r.FormValue("password") != "secret" {
+				fmt.Fprint(w, "Fails.")
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: "sid", Path: "/"})
+			fmt.Fprint(w, "Ok.")
+
+			return
+		}
+
+		if cookie, err := r.Cookie("SID"); err != nil || cookie.Value != "sid" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch path {
+		case "app/version":
+			fmt.Fprint(w, "v4.6.2")
+		case "torrents/info":
+			fmt.Fprint(w, torrentsInfo)
+		case "sync/maindata":
+			fmt.Fprint(w, mainData)
+		case "app/preferences":
+			fmt.Fprint(w, `{"save_path": "/data/"}`)
+		case "torrents/files":
+			fmt.Fprint(w, `[{"name": "paused/a", "size": 512, "progress": 1, "priority": 6},
+				{"name": "paused/b", "size": 512, "progress": 0, "priority": 0}]`)
+		case "torrents/pieceStates":
+			fmt.Fprint(w, `[2, 2, 1, 0, 2, 0, 0, 0, 2]`)
+		case "torrents/pause", "torrents/resume":
+			if s.v5 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			fallthrough
+		default:
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				_ = r.ParseForm()
+			}
+
+			s.calls = append(s.calls, path+" "+r.Form.Encode())
+			fmt.Fprint(w, "Ok.")
+		}
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func connect(t *testing.T, s *standIn) *Backend {
+	b, err := New(Config{URL: s.URL + "/", User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return b
+}
+
+func TestLogin(t *testing.T) {
+	s := newStandIn(t)
+
+	if _, err := New(Config{URL: s.URL, User: "admin", Password: "wrong"}); err == nil {
+		t.Fatal("New() with a wrong password: expected an error")
+	}
+
+	if _, err := New(Config{URL: s.URL}); err == nil {
+		t.Fatal("New() without a user on a Web UI requiring one: expected an error")
+	}
+}
+
+func TestTorrentGet(t *testing.T) {
+	b := connect(t, newStandIn(t))
+
+	torrents, err := b.TorrentGet([]string{"id", "name", "files", "pieces"}, nil)
+	if err != nil {
+		t.Fatalf("TorrentGet() error = %v", err)
+	}
+
+	if len(torrents) != 2 {
+		t.Fatalf("TorrentGet() returned %d torrents, want 2", len(torrents))
+	}
+
+	paused, seeding := torrents[0], torrents[1]
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"order", *paused.Name + "," + *seeding.Name, "paused,seeding"},
+		{"id", *seeding.ID, backend.HashID(seedingHash)},
+		{"seeding status", torrentStatus(seeding), "Seeding"},
+		{"paused status", torrentStatus(paused), "Stopped"},
+		{"have", torrent.Have(paused), int64(512)},
+		{"download dir", *seeding.DownloadDir, "/data"},
+		{"unknown eta", *seeding.Eta, int64(-1)},
+		{"labels", seeding.Labels, []string{"linux", "iso"}},
+		{"tracker", seeding.Trackers[0].Announce, "http://tracker.example/announce"},
+		{"ratio mode", *paused.SeedRatioMode, backend.SeedRatioModeCustom},
+		{"files", len(paused.Files), 2},
+		{"priorities", paused.Priorities, []int64{1, 0}},
+		{"wanted", paused.Wanted, []bool{true, false}},
+		{"pieces", *paused.Pieces, "yIA="},
+	}
+
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	selected, err := b.TorrentGet([]string{"id"}, []int64{*paused.ID})
+	if err != nil || len(selected) != 1 || *selected[0].Name != "paused" {
+		t.Errorf("TorrentGet() by ID = %v, %v", selected, err)
+	}
+}
+
+func TestSessionStats(t *testing.T) {
+	b := connect(t, newStandIn(t))
+
+	stats, err := b.SessionStats()
+	if err != nil {
+		t.Fatalf("SessionStats() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  *int64
+		want int64
+	}{
+		{"active", stats.ActiveTorrentCount, 1},
+		{"paused", stats.PausedTorrentCount, 1},
+		{"torrents", stats.TorrentCount, 2},
+		{"download speed", stats.DownloadSpeed, 10},
+		{"uploaded", stats.Current.UploadedBytes, 200},
+		{"uploaded ever", stats.Cumulative.UploadedBytes, 16384},
+	}
+
+	for _, tt := range tests {
+		if tt.got == nil || *tt.got != tt.want {
+			t.Errorf("%s: got %v, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if stats.Cumulative.SecondsActive != nil {
+		t.Errorf("seconds active = %d, want nil", *stats.Cumulative.SecondsActive)
+	}
+
+	if free, err := b.FreeSpace("/data"); err != nil || free != 1000000 {
+		t.Errorf("FreeSpace(/data) = %d, %v, want 1000000", free, err)
+	}
+
+	if _, err := b.FreeSpace("/elsewhere"); err == nil {
+		t.Error("FreeSpace(/elsewhere): expected an error")
+	}
+}
+
+func torrentStatus(t *backend.Torrent) string {
+	status, _ := torrent.Status(t)
+	return status
+}
+
+func TestActions(t *testing.T) {
+	s := newStandIn(t)
+	s.v5 = true
+	b := connect(t, s)
+	id := backend.HashID(pausedHash)
+
+	if err := b.TorrentStop([]int64{id}); err != nil {
+		t.Fatalf("TorrentStop() error = %v", err)
+	}
+
+	if err := b.TorrentRemove([]int64{id}, true); err != nil {
+		t.Fatalf("TorrentRemove() error = %v", err)
+	}
+
+	limit := int64(100)
+	if err := b.TorrentSet(&backend.TorrentSetPayload{IDs: []int64{id}, DownloadLimit: &limit}); err != nil {
+		t.Fatalf("TorrentSet() error = %v", err)
+	}
+
+	want := []string{
+		"torrents/stop hashes=" + pausedHash,
+		"torrents/delete deleteFiles=true&hashes=" + pausedHash,
+		"torrents/setDownloadLimit hashes=" + pausedHash + "&limit=102400",
+	}
+
+	if !reflect.DeepEqual(s.calls, want) {
+		t.Errorf("calls = %q, want %q", s.calls, want)
+	}
+
+	if err := b.TorrentStop([]int64{42}); err == nil {
+		t.Error("TorrentStop() of an unknown ID: expected an error")
+	}
+
+	s.calls = nil
+
+	err := b.TorrentSet(&backend.TorrentSetPayload{IDs: []int64{id}, PriorityLow: []int64{0}})
+	if err == nil || len(s.calls) != 0 {
+		t.Errorf("TorrentSet() with a low priority: error = %v, calls = %q", err, s.calls)
+	}
+}
+
+func TestTorrentAdd(t *testing.T) {
+	s := newStandIn(t)
+	b := connect(t, s)
+	magnet := "magnet:?xt=urn:btih:" + strings.ToUpper(seedingHash) + "&dn=seeding"
+
+	added, err := b.TorrentAdd(&backend.TorrentAddPayload{Filename: &magnet})
+	if err != nil {
+		t.Fatalf("TorrentAdd() error = %v", err)
+	}
+
+	if *added.ID != backend.HashID(seedingHash) || *added.Name != "seeding" {
+		t.Errorf("TorrentAdd() = %d %s, want %d seeding", *added.ID, *added.Name, backend.HashID(seedingHash))
+	}
+
+	if len(s.calls) != 1 || !strings.HasPrefix(s.calls[0], "torrents/add urls=magnet") {
+		t.Errorf("calls = %q", s.calls)
+	}
+}
+
+func TestInfoHash(t *testing.T) {
+	info := "d6:lengthi3e4:name5:hello12:piece lengthi16384e6:pieces0:e"
+	metainfo := "d8:announce20:http://tracker/annce4:info" + info + "e"
+	sum := sha1.Sum([]byte(info)) // nolint:gosec
+
+	hash, name, err := infoHash([]byte(metainfo))
+	if err != nil || hash != hex.EncodeToString(sum[:]) || name != "hello" {
+		t.Errorf("infoHash() = %s, %s, %v", hash, name, err)
+	}
+
+	if _, _, err := infoHash([]byte("d4:infod")); err == nil {
+		t.Error("infoHash() of a truncated file: expected an error")
+	}
+
+	hash, name = magnetHash("magnet:?xt=urn:btih:VK54ZXPO74ABCIRTIRKWM54ITGVLXTG5&dn=x")
+	if hash != seedingHash || name != "x" {
+		t.Errorf("magnetHash() of a base32 hash = %s, %s", hash, name)
+	}
+}
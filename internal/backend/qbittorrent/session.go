@@ -0,0 +1,391 @@
+package qbittorrent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+// preferences holds the parts of app/preferences trpc knows about.
+type preferences struct {
+	AltDlLimit          int64   `json:"alt_dl_limit"`
+	AltUpLimit          int64   `json:"alt_up_limit"`
+	AutorunEnabled      bool    `json:"autorun_enabled"`
+	AutorunProgram      string  `json:"autorun_program"`
+	BittorrentProtocol  int64   `json:"bittorrent_protocol"`
+	DHT                 bool    `json:"dht"`
+	DiskCache           int64   `json:"disk_cache"`
+	DlLimit             int64   `json:"dl_limit"`
+	Encryption          int64   `json:"encryption"`
+	IncompleteFilesExt  bool    `json:"incomplete_files_ext"`
+	ListenPort          int64   `json:"listen_port"`
+	LSD                 bool    `json:"lsd"`
+	MaxActiveDownloads  int64   `json:"max_active_downloads"`
+	MaxActiveUploads    int64   `json:"max_active_uploads"`
+	MaxConnec           int64   `json:"max_connec"`
+	MaxConnecPerTorrent int64   `json:"max_connec_per_torrent"`
+	MaxRatio            float64 `json:"max_ratio"`
+	MaxRatioEnabled     bool    `json:"max_ratio_enabled"`
+	PEX                 bool    `json:"pex"`
+	QueueingEnabled     bool    `json:"queueing_enabled"`
+	RandomPort          bool    `json:"random_port"`
+	SavePath            string  `json:"save_path"`
+	ScheduleFromHour    int64   `json:"schedule_from_hour"`
+	ScheduleFromMin     int64   `json:"schedule_from_min"`
+	ScheduleToHour      int64   `json:"schedule_to_hour"`
+	ScheduleToMin       int64   `json:"schedule_to_min"`
+	SchedulerDays       int64   `json:"scheduler_days"`
+	SchedulerEnabled    bool    `json:"scheduler_enabled"`
+	StartPausedEnabled  bool    `json:"start_paused_enabled"`
+	TempPath            string  `json:"temp_path"`
+	TempPathEnabled     bool    `json:"temp_path_enabled"`
+	UpLimit             int64   `json:"up_limit"`
+	UPnP                bool    `json:"upnp"`
+}
+
+// Transmission's encryption modes, indexed by qBittorrent's.
+var encryptionModes = []string{"preferred", "required", "tolerated"}
+
+// Transmission's alt-speed-time-day bitmasks, indexed by qBittorrent's
+// scheduler_days: every day, weekdays, weekends, then Monday to Sunday.
+var schedulerDays = []int64{127, 62, 65, 2, 4, 8, 16, 32, 64, 1}
+
+// Protocols of bittorrent_protocol.
+const (
+	protocolTCPAndUTP = 0
+	protocolTCP       = 1
+)
+
+func indexOf(values []int64, value int64) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// SessionGet implements backend.Backend.
+func (b *Backend) SessionGet() (*backend.Session, error) {
+	var (
+		prefs   preferences
+		version string
+		altMode string
+	)
+
+	if err := b.do("GET", "app/preferences", nil, &prefs); err != nil {
+		return nil, err
+	}
+
+	if err := b.do("GET", "app/version", nil, &version); err != nil {
+		return nil, err
+	}
+
+	if err := b.do("GET", "transfer/speedLimitsMode", nil, &altMode); err != nil {
+		return nil, err
+	}
+
+	encryption := ""
+	if prefs.Encryption >= 0 && int(prefs.Encryption) < len(encryptionModes) {
+		encryption = encryptionModes[prefs.Encryption]
+	}
+
+	var day *int64
+	if prefs.SchedulerDays >= 0 && int(prefs.SchedulerDays) < len(schedulerDays) {
+		day = int64p(schedulerDays[prefs.SchedulerDays])
+	}
+
+	return &backend.Session{
+		AltSpeedDown:              int64p(prefs.AltDlLimit / 1024),
+		AltSpeedEnabled:           boolp(strings.TrimSpace(altMode) == "1"),
+		AltSpeedTimeBegin:         int64p(prefs.ScheduleFromHour*60 + prefs.ScheduleFromMin),
+		AltSpeedTimeDay:           day,
+		AltSpeedTimeEnabled:       boolp(prefs.SchedulerEnabled),
+		AltSpeedTimeEnd:           int64p(prefs.ScheduleToHour*60 + prefs.ScheduleToMin),
+		AltSpeedUp:                int64p(prefs.AltUpLimit / 1024),
+		CacheSizeMB:               int64p(prefs.DiskCache),
+		DHTEnabled:                boolp(prefs.DHT),
+		DownloadDir:               stringp(strings.TrimRight(prefs.SavePath, "/")),
+		DownloadQueueEnabled:      boolp(prefs.QueueingEnabled),
+		DownloadQueueSize:         int64p(prefs.MaxActiveDownloads),
+		Encryption:                stringp(encryption),
+		IncompleteDir:             stringp(strings.TrimRight(prefs.TempPath, "/")),
+		IncompleteDirEnabled:      boolp(prefs.TempPathEnabled),
+		LPDEnabled:                boolp(prefs.LSD),
+		PeerLimitGlobal:           int64p(prefs.MaxConnec),
+		PeerLimitPerTorrent:       int64p(prefs.MaxConnecPerTorrent),
+		PeerPort:                  int64p(prefs.ListenPort),
+		PeerPortRandomOnStart:     boolp(prefs.RandomPort),
+		PEXEnabled:                boolp(prefs.PEX),
+		PortForwardingEnabled:     boolp(prefs.UPnP),
+		RenamePartialFiles:        boolp(prefs.IncompleteFilesExt),
+		ScriptTorrentDoneEnabled:  boolp(prefs.AutorunEnabled),
+		ScriptTorrentDoneFilename: stringp(prefs.AutorunProgram),
+		SeedQueueEnabled:          boolp(prefs.QueueingEnabled),
+		SeedQueueSize:             int64p(prefs.MaxActiveUploads),
+		SeedRatioLimit:            float64p(prefs.MaxRatio),
+		SeedRatioLimited:          boolp(prefs.MaxRatioEnabled),
+		SpeedLimitDown:            int64p(prefs.DlLimit / 1024),
+		SpeedLimitDownEnabled:     boolp(prefs.DlLimit > 0),
+		SpeedLimitUp:              int64p(prefs.UpLimit / 1024),
+		SpeedLimitUpEnabled:       boolp(prefs.UpLimit > 0),
+		StartAddedTorrents:        boolp(!prefs.StartPausedEnabled),
+		UTPEnabled:                boolp(prefs.BittorrentProtocol != protocolTCP),
+		Version:                   stringp(strings.TrimSpace(version)),
+	}, nil
+}
+
+// sessionPreferences converts the non-nil fields of a session to
+// app/setPreferences values. It fails on settings qBittorrent doesn't have.
+func sessionPreferences(s *backend.Session) (map[string]interface{}, error) {
+	prefs := make(map[string]interface{})
+
+	var unsupported []string
+
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			prefs[name] = *value
+		}
+	}
+
+	setInt := func(name string, value *int64, scale int64) {
+		if value != nil {
+			prefs[name] = *value * scale
+		}
+	}
+
+	setString := func(name string, value *string) {
+		if value != nil {
+			prefs[name] = *value
+		}
+	}
+
+	setInt("alt_dl_limit", s.AltSpeedDown, 1024)
+	setInt("alt_up_limit", s.AltSpeedUp, 1024)
+	setBool("scheduler_enabled", s.AltSpeedTimeEnabled)
+	setInt("disk_cache", s.CacheSizeMB, 1)
+	setBool("dht", s.DHTEnabled)
+	setString("save_path", s.DownloadDir)
+	setInt("max_active_downloads", s.DownloadQueueSize, 1)
+	setString("temp_path", s.IncompleteDir)
+	setBool("temp_path_enabled", s.IncompleteDirEnabled)
+	setBool("lsd", s.LPDEnabled)
+	setInt("max_connec", s.PeerLimitGlobal, 1)
+	setInt("max_connec_per_torrent", s.PeerLimitPerTorrent, 1)
+	setInt("listen_port", s.PeerPort, 1)
+	setBool("random_port", s.PeerPortRandomOnStart)
+	setBool("pex", s.PEXEnabled)
+	setBool("upnp", s.PortForwardingEnabled)
+	setBool("incomplete_files_ext", s.RenamePartialFiles)
+	setBool("autorun_enabled", s.ScriptTorrentDoneEnabled)
+	setString("autorun_program", s.ScriptTorrentDoneFilename)
+	setInt("max_active_uploads", s.SeedQueueSize, 1)
+	setBool("max_ratio_enabled", s.SeedRatioLimited)
+
+	if s.SeedRatioLimit != nil {
+		prefs["max_ratio"] = *s.SeedRatioLimit
+	}
+
+	if s.AltSpeedTimeBegin != nil {
+		prefs["schedule_from_hour"] = *s.AltSpeedTimeBegin / 60
+		prefs["schedule_from_min"] = *s.AltSpeedTimeBegin % 60
+	}
+
+	if s.AltSpeedTimeEnd != nil {
+		prefs["schedule_to_hour"] = *s.AltSpeedTimeEnd / 60
+		prefs["schedule_to_min"] = *s.AltSpeedTimeEnd % 60
+	}
+
+	if s.AltSpeedTimeDay != nil {
+		if i := indexOf(schedulerDays, *s.AltSpeedTimeDay); i >= 0 {
+			prefs["scheduler_days"] = i
+		} else {
+			unsupported = append(unsupported, fmt.Sprintf("alt-speed-time-day=%d (only every day, weekdays, weekends or a single day)", *s.AltSpeedTimeDay))
+		}
+	}
+
+	// Both queues are switched together in qBittorrent.
+	switch {
+	case s.DownloadQueueEnabled != nil && s.SeedQueueEnabled != nil && *s.DownloadQueueEnabled != *s.SeedQueueEnabled:
+		unsupported = append(unsupported, "download-queue-enabled and seed-queue-enabled with different values")
+	case s.DownloadQueueEnabled != nil:
+		prefs["queueing_enabled"] = *s.DownloadQueueEnabled
+	case s.SeedQueueEnabled != nil:
+		prefs["queueing_enabled"] = *s.SeedQueueEnabled
+	}
+
+	if s.Encryption != nil {
+		mode := -1
+
+		for i, m := range encryptionModes {
+			if m == *s.Encryption {
+				mode = i
+			}
+		}
+
+		if mode < 0 {
+			unsupported = append(unsupported, "encryption="+*s.Encryption)
+		} else {
+			prefs["encryption"] = mode
+		}
+	}
+
+	if limit, ok := speedLimit(s.SpeedLimitDown, s.SpeedLimitDownEnabled); ok {
+		prefs["dl_limit"] = limit
+	}
+
+	if limit, ok := speedLimit(s.SpeedLimitUp, s.SpeedLimitUpEnabled); ok {
+		prefs["up_limit"] = limit
+	}
+
+	if s.StartAddedTorrents != nil {
+		prefs["start_paused_enabled"] = !*s.StartAddedTorrents
+	}
+
+	if s.UTPEnabled != nil {
+		prefs["bittorrent_protocol"] = protocolTCP
+		if *s.UTPEnabled {
+			prefs["bittorrent_protocol"] = protocolTCPAndUTP
+		}
+	}
+
+	check := func(set bool, name string) {
+		if set {
+			unsupported = append(unsupported, name)
+		}
+	}
+
+	check(s.BlocklistEnabled != nil, "blocklist-enabled")
+	check(s.BlocklistURL != nil, "blocklist-url")
+	check(s.IdleSeedingLimit != nil, "idle-seeding-limit")
+	check(s.IdleSeedingLimitEnabled != nil, "idle-seeding-limit-enabled")
+	check(s.QueueStalledEnabled != nil, "queue-stalled-enabled")
+	check(s.QueueStalledMinutes != nil, "queue-stalled-minutes")
+	check(s.TrashOriginalTorrentFiles != nil, "trash-original-torrent-files")
+
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("qbittorrent: unsupported session settings: %s", strings.Join(unsupported, ", "))
+	}
+
+	return prefs, nil
+}
+
+// SessionSet implements backend.Backend.
+func (b *Backend) SessionSet(s *backend.Session) error {
+	prefs, err := sessionPreferences(s)
+	if err != nil {
+		return err
+	}
+
+	if len(prefs) > 0 {
+		data, err := json.Marshal(prefs)
+		if err != nil {
+			return err
+		}
+
+		if err := b.post(url.Values{"json": {string(data)}}, "app/setPreferences"); err != nil {
+			return err
+		}
+	}
+
+	if s.AltSpeedEnabled == nil {
+		return nil
+	}
+
+	// There's only a toggle for the alternative speed limits.
+	var mode string
+	if err := b.do("GET", "transfer/speedLimitsMode", nil, &mode); err != nil {
+		return err
+	}
+
+	if (strings.TrimSpace(mode) == "1") != *s.AltSpeedEnabled {
+		return b.post(nil, "transfer/toggleSpeedLimitsMode")
+	}
+
+	return nil
+}
+
+// serverState holds the parts of the server_state of sync/maindata trpc
+// knows about.
+type serverState struct {
+	AlltimeDl       int64 `json:"alltime_dl"`
+	AlltimeUl       int64 `json:"alltime_ul"`
+	DlInfoData      int64 `json:"dl_info_data"`
+	DlInfoSpeed     int64 `json:"dl_info_speed"`
+	FreeSpaceOnDisk int64 `json:"free_space_on_disk"`
+	UpInfoData      int64 `json:"up_info_data"`
+	UpInfoSpeed     int64 `json:"up_info_speed"`
+}
+
+// mainData returns the server state and the torrents, keyed by hash.
+func (b *Backend) mainData() (*serverState, map[string]*torrentInfo, error) {
+	var data struct {
+		ServerState serverState             `json:"server_state"`
+		Torrents    map[string]*torrentInfo `json:"torrents"`
+	}
+
+	if err := b.do("GET", "sync/maindata", nil, &data); err != nil {
+		return nil, nil, err
+	}
+
+	return &data.ServerState, data.Torrents, nil
+}
+
+// SessionStats implements backend.Backend. qBittorrent only keeps the
+// amounts of data transferred.
+func (b *Backend) SessionStats() (*backend.SessionStats, error) {
+	state, torrents, err := b.mainData()
+	if err != nil {
+		return nil, err
+	}
+
+	var paused int64
+
+	for _, info := range torrents {
+		if status(info) == backend.StatusStopped {
+			paused++
+		}
+	}
+
+	return &backend.SessionStats{
+		ActiveTorrentCount: int64p(int64(len(torrents)) - paused),
+		PausedTorrentCount: int64p(paused),
+		TorrentCount:       int64p(int64(len(torrents))),
+		DownloadSpeed:      int64p(state.DlInfoSpeed),
+		UploadSpeed:        int64p(state.UpInfoSpeed),
+		Current: backend.Stats{
+			UploadedBytes:   int64p(state.UpInfoData),
+			DownloadedBytes: int64p(state.DlInfoData),
+		},
+		Cumulative: backend.Stats{
+			UploadedBytes:   int64p(state.AlltimeUl),
+			DownloadedBytes: int64p(state.AlltimeDl),
+		},
+	}, nil
+}
+
+// FreeSpace implements backend.Backend. qBittorrent only tells the free
+// space of the default download directory.
+func (b *Backend) FreeSpace(path string) (int64, error) {
+	var prefs preferences
+	if err := b.do("GET", "app/preferences", nil, &prefs); err != nil {
+		return 0, err
+	}
+
+	if strings.TrimRight(path, "/") != strings.TrimRight(prefs.SavePath, "/") {
+		return 0, fmt.Errorf("qbittorrent: free space is only known for the default download dir %s", prefs.SavePath)
+	}
+
+	state, _, err := b.mainData()
+	if err != nil {
+		return 0, err
+	}
+
+	return state.FreeSpaceOnDisk, nil
+}
@@ -0,0 +1,309 @@
+package qbittorrent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+// unsupportedSet lists the fields of a payload qBittorrent has no equivalent for.
+func unsupportedSet(p *backend.TorrentSetPayload) []string {
+	var fields []string
+
+	check := func(set bool, name string) {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+
+	check(p.BandwidthPriority != nil, "bandwidthPriority")
+	check(p.HonorsSessionLimits != nil, "honorsSessionLimits")
+	check(p.Labels != nil, "labels")
+	check(p.PeerLimit != nil, "peer-limit")
+	check(len(p.PriorityLow) > 0, "priority-low")
+	check(p.QueuePosition != nil, "queuePosition")
+	check(p.SeedIdleLimit != nil, "seedIdleLimit")
+	check(p.SeedIdleMode != nil, "seedIdleMode")
+
+	return fields
+}
+
+// speedLimit converts a transmission limit (KB/s and a flag) to bytes/s,
+// where 0 means unlimited. ok is false if nothing is to be changed.
+func speedLimit(limit *int64, limited *bool) (value int64, ok bool) {
+	switch {
+	case limited != nil && !*limited:
+		return 0, true
+	case limit != nil:
+		return *limit * 1024, true
+	}
+
+	return 0, false
+}
+
+// TorrentSet implements backend.Backend. Nothing is changed if the payload
+// holds a setting qBittorrent doesn't support.
+func (b *Backend) TorrentSet(p *backend.TorrentSetPayload) error {
+	if fields := unsupportedSet(p); len(fields) > 0 {
+		return fmt.Errorf("qbittorrent: unsupported torrent settings: %s", strings.Join(fields, ", "))
+	}
+
+	params, err := b.hashParams(p.IDs)
+	if err != nil {
+		return err
+	}
+
+	hashes := params.Get("hashes")
+
+	if limit, ok := speedLimit(p.DownloadLimit, p.DownloadLimited); ok {
+		if err := b.post(url.Values{"hashes": {hashes}, "limit": {fmt.Sprint(limit)}}, "torrents/setDownloadLimit"); err != nil {
+			return err
+		}
+	}
+
+	if limit, ok := speedLimit(p.UploadLimit, p.UploadLimited); ok {
+		if err := b.post(url.Values{"hashes": {hashes}, "limit": {fmt.Sprint(limit)}}, "torrents/setUploadLimit"); err != nil {
+			return err
+		}
+	}
+
+	if p.SeedRatioLimit != nil || p.SeedRatioMode != nil {
+		if err := b.setShareLimits(hashes, p); err != nil {
+			return err
+		}
+	}
+
+	if p.Location != nil {
+		if err := b.post(url.Values{"hashes": {hashes}, "location": {*p.Location}}, "torrents/setLocation"); err != nil {
+			return err
+		}
+	}
+
+	for _, hash := range strings.Split(hashes, "|") {
+		if err := b.setFiles(hash, p); err != nil {
+			return err
+		}
+
+		if err := b.setTrackers(hash, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Backend) setShareLimits(hashes string, p *backend.TorrentSetPayload) error {
+	ratio := float64(ratioLimitGlobal)
+
+	if p.SeedRatioLimit != nil {
+		ratio = *p.SeedRatioLimit
+	}
+
+	if p.SeedRatioMode != nil {
+		switch *p.SeedRatioMode {
+		case backend.SeedRatioModeGlobal:
+			ratio = ratioLimitGlobal
+		case backend.SeedRatioModeNoRatio:
+			ratio = ratioLimitNone
+		case backend.SeedRatioModeCustom:
+			if p.SeedRatioLimit == nil {
+				return errors.New("qbittorrent: a custom seed ratio mode needs a seedRatioLimit")
+			}
+		}
+	}
+
+	return b.post(url.Values{
+		"hashes":                   {hashes},
+		"ratioLimit":               {fmt.Sprint(ratio)},
+		"seedingTimeLimit":         {fmt.Sprint(ratioLimitGlobal)},
+		"inactiveSeedingTimeLimit": {fmt.Sprint(ratioLimitGlobal)},
+	}, "torrents/setShareLimits")
+}
+
+// setFiles applies wanted/unwanted first and priorities last, as qBittorrent
+// ties both to the file priority.
+func (b *Backend) setFiles(hash string, p *backend.TorrentSetPayload) error {
+	changes := []struct {
+		ids      []int64
+		priority int
+	}{
+		{p.FilesWanted, filePriorityNormal},
+		{p.FilesUnwanted, filePriorityNone},
+		{p.PriorityNormal, filePriorityNormal},
+		{p.PriorityHigh, filePriorityHigh},
+	}
+
+	for _, change := range changes {
+		if len(change.ids) == 0 {
+			continue
+		}
+
+		err := b.post(url.Values{
+			"hash":     {hash},
+			"id":       {joinIDs(change.ids)},
+			"priority": {fmt.Sprint(change.priority)},
+		}, "torrents/filePrio")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setTrackers adds, removes and replaces trackers. Tracker IDs are indexes
+// in the list of real trackers, as returned in trackerStats.
+func (b *Backend) setTrackers(hash string, p *backend.TorrentSetPayload) error {
+	var trackers []torrentTracker
+
+	if len(p.TrackerRemove) > 0 || len(p.TrackerReplace) > 0 {
+		var err error
+		if trackers, err = b.trackers(hash); err != nil {
+			return err
+		}
+	}
+
+	trackerURL := func(id int64) (string, error) {
+		if id < 0 || id >= int64(len(trackers)) {
+			return "", fmt.Errorf("qbittorrent: no tracker with ID %d", id)
+		}
+
+		return trackers[id].URL, nil
+	}
+
+	for _, r := range p.TrackerReplace {
+		orig, err := trackerURL(r.ID)
+		if err != nil {
+			return err
+		}
+
+		err = b.post(url.Values{"hash": {hash}, "origUrl": {orig}, "newUrl": {r.Announce}}, "torrents/editTracker")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(p.TrackerRemove) > 0 {
+		urls := make([]string, len(p.TrackerRemove))
+
+		for i, id := range p.TrackerRemove {
+			u, err := trackerURL(id)
+			if err != nil {
+				return err
+			}
+
+			urls[i] = u
+		}
+
+		if err := b.post(url.Values{"hash": {hash}, "urls": {strings.Join(urls, "|")}}, "torrents/removeTrackers"); err != nil {
+			return err
+		}
+	}
+
+	if len(p.TrackerAdd) > 0 {
+		if err := b.post(url.Values{"hash": {hash}, "urls": {strings.Join(p.TrackerAdd, "\n")}}, "torrents/addTrackers"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TorrentAdd implements backend.Backend. qBittorrent doesn't say what it
+// added, so the hash (and so the ID) is worked out from the metainfo or
+// magnet link. Torrents added from a http URL are returned with ID 0.
+func (b *Backend) TorrentAdd(p *backend.TorrentAddPayload) (*backend.Torrent, error) {
+	if p.PeerLimit != nil || p.BandwidthPriority != nil || len(p.FilesWanted)+len(p.FilesUnwanted) > 0 ||
+		len(p.PriorityHigh)+len(p.PriorityLow)+len(p.PriorityNormal) > 0 {
+		return nil, errors.New("qbittorrent: only the download directory and paused can be set when adding torrents")
+	}
+
+	var (
+		body bytes.Buffer
+		hash string
+		name string
+	)
+
+	form := multipart.NewWriter(&body)
+
+	switch {
+	case p.MetaInfo != nil:
+		metainfo, err := base64.StdEncoding.DecodeString(*p.MetaInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		if hash, name, err = infoHash(metainfo); err != nil {
+			return nil, err
+		}
+
+		part, err := form.CreateFormFile("torrents", name+".torrent")
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := part.Write(metainfo); err != nil {
+			return nil, err
+		}
+	case p.Filename != nil:
+		hash, name = magnetHash(*p.Filename)
+		if name == "" {
+			name = *p.Filename
+		}
+
+		if err := form.WriteField("urls", *p.Filename); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("qbittorrent: nothing to add")
+	}
+
+	if p.DownloadDir != nil {
+		if err := form.WriteField("savepath", *p.DownloadDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Paused != nil {
+		// qBittorrent 5 renamed paused to stopped.
+		for _, field := range []string{"paused", "stopped"} {
+			if err := form.WriteField(field, fmt.Sprint(*p.Paused)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", b.config.URL+"/api/v2/torrents/add", &body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	var answer string
+	if err := b.send(req, "torrents/add", &answer); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(answer) == "Fails." {
+		return nil, fmt.Errorf("qbittorrent: couldn't add %s (invalid or already added?)", name)
+	}
+
+	var id int64
+	if hash != "" {
+		id = b.ids.ID(hash)
+	}
+
+	return &backend.Torrent{ID: &id, Name: &name, HashString: &hash}, nil
+}
@@ -0,0 +1,519 @@
+package qbittorrent
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hekmon/cunits/v2"
+	"github.com/shric/trpc/internal/backend"
+)
+
+// Transmission's error code for local errors.
+const errorLocal = 3
+
+// etaInfinity is what qBittorrent reports when there's no estimate.
+const etaInfinity = 8640000
+
+// Special values of ratio_limit.
+const (
+	ratioLimitGlobal = -2
+	ratioLimitNone   = -1
+)
+
+// File priorities.
+const (
+	filePriorityNone    = 0
+	filePriorityNormal  = 1
+	filePriorityHigh    = 6
+	filePriorityMaximal = 7
+)
+
+// torrentInfo is an element of torrents/info.
+type torrentInfo struct {
+	AddedOn      int64   `json:"added_on"`
+	AmountLeft   int64   `json:"amount_left"`
+	CompletionOn int64   `json:"completion_on"`
+	DlLimit      int64   `json:"dl_limit"`
+	Dlspeed      int64   `json:"dlspeed"`
+	Downloaded   int64   `json:"downloaded"`
+	Eta          int64   `json:"eta"`
+	Hash         string  `json:"hash"`
+	LastActivity int64   `json:"last_activity"`
+	MagnetURI    string  `json:"magnet_uri"`
+	Name         string  `json:"name"`
+	NumLeechs    int64   `json:"num_leechs"`
+	NumSeeds     int64   `json:"num_seeds"`
+	Priority     int64   `json:"priority"`
+	Private      *bool   `json:"private"`
+	Progress     float64 `json:"progress"`
+	Ratio        float64 `json:"ratio"`
+	RatioLimit   float64 `json:"ratio_limit"`
+	SavePath     string  `json:"save_path"`
+	SeedingTime  int64   `json:"seeding_time"`
+	Size         int64   `json:"size"`
+	State        string  `json:"state"`
+	Tags         string  `json:"tags"`
+	TimeActive   int64   `json:"time_active"`
+	TotalSize    int64   `json:"total_size"`
+	Tracker      string  `json:"tracker"`
+	UpLimit      int64   `json:"up_limit"`
+	Uploaded     int64   `json:"uploaded"`
+	Upspeed      int64   `json:"upspeed"`
+}
+
+// torrentProperties is the answer of torrents/properties.
+type torrentProperties struct {
+	Comment      string `json:"comment"`
+	CreatedBy    string `json:"created_by"`
+	CreationDate int64  `json:"creation_date"`
+	IsPrivate    *bool  `json:"is_private"`
+	PiecesNum    int64  `json:"pieces_num"`
+	PieceSize    int64  `json:"piece_size"`
+	TotalWasted  int64  `json:"total_wasted"`
+}
+
+// torrentFile is an element of torrents/files.
+type torrentFile struct {
+	Name     string  `json:"name"`
+	Priority int64   `json:"priority"`
+	Progress float64 `json:"progress"`
+	Size     int64   `json:"size"`
+}
+
+// torrentTracker is an element of torrents/trackers.
+type torrentTracker struct {
+	Msg           string `json:"msg"`
+	NumDownloaded int64  `json:"num_downloaded"`
+	NumLeeches    int64  `json:"num_leeches"`
+	NumSeeds      int64  `json:"num_seeds"`
+	Status        int64  `json:"status"`
+	Tier          int64  `json:"tier"`
+	URL           string `json:"url"`
+}
+
+// torrentPeer is an element of sync/torrentPeers.
+type torrentPeer struct {
+	Client   string  `json:"client"`
+	DlSpeed  int64   `json:"dl_speed"`
+	Flags    string  `json:"flags"`
+	IP       string  `json:"ip"`
+	Port     int64   `json:"port"`
+	Progress float64 `json:"progress"`
+	UpSpeed  int64   `json:"up_speed"`
+}
+
+// Tracker status of torrents/trackers.
+const trackerWorking = 2
+
+// Piece state of torrents/pieceStates.
+const pieceDownloaded = 2
+
+// Fields that need an extra request per torrent.
+var (
+	fileFields       = []string{"files", "fileStats", "priorities", "wanted"}
+	propertiesFields = []string{"comment", "creator", "dateCreated", "pieceCount", "pieceSize", "corruptEver", "isPrivate"}
+)
+
+func wants(fields []string, names ...string) bool {
+	for _, field := range fields {
+		for _, name := range names {
+			if field == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// torrentInfo lists all the torrents and refreshes the ID map.
+func (b *Backend) torrentInfo() ([]*torrentInfo, error) {
+	var infos []*torrentInfo
+	if err := b.do("GET", "torrents/info", nil, &infos); err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(infos))
+	for i, info := range infos {
+		hashes[i] = info.Hash
+	}
+
+	b.ids.Assign(hashes)
+
+	return infos, nil
+}
+
+// status maps a qBittorrent state onto a transmission status.
+func status(info *torrentInfo) backend.Status {
+	switch info.State {
+	case "uploading", "stalledUP", "forcedUP":
+		return backend.StatusSeed
+	case "queuedUP":
+		return backend.StatusSeedWait
+	case "downloading", "stalledDL", "forcedDL", "metaDL", "forcedMetaDL":
+		return backend.StatusDownload
+	case "queuedDL":
+		return backend.StatusDownloadWait
+	case "checkingUP", "checkingDL", "checkingResumeData":
+		return backend.StatusCheck
+	case "moving", "allocating":
+		if info.AmountLeft == 0 {
+			return backend.StatusSeed
+		}
+
+		return backend.StatusDownload
+	default: // pausedUP, pausedDL, stoppedUP, stoppedDL, error, missingFiles, unknown
+		return backend.StatusStopped
+	}
+}
+
+// activePeers returns at least one peer while data is flowing, so that the
+// status shown by trpc (Seeding, Downloading, Idle...) follows the rates.
+func activePeers(rate, peers int64) int64 {
+	if rate == 0 {
+		return 0
+	}
+
+	if peers == 0 {
+		return 1
+	}
+
+	return peers
+}
+
+func unixTime(seconds int64) *time.Time {
+	if seconds < 0 {
+		seconds = 0
+	}
+
+	t := time.Unix(seconds, 0)
+
+	return &t
+}
+
+func byteSize(n int64) *cunits.Bits {
+	bits := cunits.ImportInByte(float64(n))
+	return &bits
+}
+
+func int64p(n int64) *int64 {
+	return &n
+}
+
+func boolp(b bool) *bool {
+	return &b
+}
+
+func stringp(s string) *string {
+	return &s
+}
+
+func float64p(f float64) *float64 {
+	return &f
+}
+
+func (b *Backend) fromInfo(info *torrentInfo) *backend.Torrent {
+	st := status(info)
+	t := &backend.Torrent{
+		ID:                  int64p(b.ids.ID(info.Hash)),
+		HashString:          stringp(info.Hash),
+		Name:                stringp(info.Name),
+		Status:              &st,
+		SizeWhenDone:        byteSize(info.Size),
+		TotalSize:           byteSize(info.TotalSize),
+		LeftUntilDone:       int64p(info.AmountLeft),
+		PercentDone:         float64p(info.Progress),
+		RecheckProgress:     float64p(0),
+		RateDownload:        int64p(info.Dlspeed),
+		RateUpload:          int64p(info.Upspeed),
+		DownloadedEver:      int64p(info.Downloaded),
+		UploadedEver:        int64p(info.Uploaded),
+		UploadRatio:         float64p(info.Ratio),
+		Eta:                 int64p(info.Eta),
+		DownloadDir:         stringp(strings.TrimRight(info.SavePath, "/")),
+		AddedDate:           unixTime(info.AddedOn),
+		DoneDate:            unixTime(info.CompletionOn),
+		ActivityDate:        unixTime(info.LastActivity),
+		StartDate:           unixTime(0),
+		IsFinished:          boolp(false),
+		IsPrivate:           info.Private,
+		Error:               int64p(0),
+		ErrorString:         stringp(""),
+		BandwidthPriority:   int64p(0),
+		QueuePosition:       int64p(0),
+		MagnetLink:          stringp(info.MagnetURI),
+		PeersConnected:      int64p(info.NumSeeds + info.NumLeechs),
+		PeersGettingFromUs:  int64p(activePeers(info.Upspeed, info.NumLeechs)),
+		PeersSendingToUs:    int64p(activePeers(info.Dlspeed, info.NumSeeds)),
+		SecondsDownloading:  int64p(info.TimeActive - info.SeedingTime),
+		DownloadLimited:     boolp(info.DlLimit > 0),
+		DownloadLimit:       int64p(info.DlLimit / 1024),
+		UploadLimited:       boolp(info.UpLimit > 0),
+		UploadLimit:         int64p(info.UpLimit / 1024),
+		SeedRatioLimit:      float64p(info.RatioLimit),
+		HonorsSessionLimits: boolp(true),
+		Labels:              []string{},
+		Unsupported:         map[string]bool{"bandwidthPriority": true, "startDate": true},
+	}
+
+	seeding := time.Duration(info.SeedingTime) * time.Second
+	t.SecondsSeeding = &seeding
+
+	if info.Eta >= etaInfinity {
+		*t.Eta = -1
+	}
+
+	if st == backend.StatusCheck {
+		*t.RecheckProgress = info.Progress
+	}
+
+	if info.Priority > 0 {
+		*t.QueuePosition = info.Priority - 1
+	}
+
+	switch info.State {
+	case "error":
+		*t.Error = errorLocal
+		*t.ErrorString = "qBittorrent reported an error"
+	case "missingFiles":
+		*t.Error = errorLocal
+		*t.ErrorString = "missing files"
+	}
+
+	mode := backend.SeedRatioModeCustom
+
+	switch info.RatioLimit {
+	case ratioLimitGlobal:
+		mode = backend.SeedRatioModeGlobal
+	case ratioLimitNone:
+		mode = backend.SeedRatioModeNoRatio
+	}
+
+	t.SeedRatioMode = &mode
+
+	for _, tag := range strings.Split(info.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			t.Labels = append(t.Labels, tag)
+		}
+	}
+
+	// torrents/info only has the current tracker, the full list takes a
+	// request per torrent and is only fetched for trackerStats.
+	if info.Tracker != "" {
+		t.Trackers = []*backend.Tracker{{Announce: info.Tracker}}
+	}
+
+	return t
+}
+
+// TorrentGet implements backend.Backend. Torrents are returned in the order
+// they were added, like transmission does.
+func (b *Backend) TorrentGet(fields []string, ids []int64) ([]*backend.Torrent, error) {
+	infos, err := b.torrentInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	var torrents []*backend.Torrent
+
+	for _, info := range infos {
+		t := b.fromInfo(info)
+		if len(ids) > 0 && !selected[*t.ID] {
+			continue
+		}
+
+		if err := b.addDetails(t, fields); err != nil {
+			return nil, err
+		}
+
+		torrents = append(torrents, t)
+	}
+
+	sort.SliceStable(torrents, func(i, j int) bool {
+		return torrents[i].AddedDate.Before(*torrents[j].AddedDate)
+	})
+
+	return torrents, nil
+}
+
+// addDetails fills in the fields that need extra requests.
+func (b *Backend) addDetails(t *backend.Torrent, fields []string) error {
+	hash := url.Values{"hash": {*t.HashString}}
+
+	if wants(fields, propertiesFields...) {
+		var props torrentProperties
+		if err := b.do("GET", "torrents/properties", hash, &props); err != nil {
+			return err
+		}
+
+		t.Comment = stringp(props.Comment)
+		t.Creator = stringp(props.CreatedBy)
+		t.DateCreated = unixTime(props.CreationDate)
+		t.PieceCount = int64p(props.PiecesNum)
+		t.PieceSize = byteSize(props.PieceSize)
+		t.CorruptEver = int64p(props.TotalWasted)
+
+		if props.IsPrivate != nil {
+			t.IsPrivate = props.IsPrivate
+		}
+	}
+
+	if wants(fields, fileFields...) {
+		var files []torrentFile
+		if err := b.do("GET", "torrents/files", hash, &files); err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			completed := int64(f.Progress * float64(f.Size))
+			priority := int64(0)
+
+			if f.Priority == filePriorityHigh || f.Priority == filePriorityMaximal {
+				priority = 1
+			}
+
+			t.Files = append(t.Files, &backend.File{BytesCompleted: completed, Length: f.Size, Name: f.Name})
+			t.FileStats = append(t.FileStats, &backend.FileStat{
+				BytesCompleted: completed,
+				Wanted:         f.Priority != filePriorityNone,
+				Priority:       priority,
+			})
+			t.Priorities = append(t.Priorities, priority)
+			t.Wanted = append(t.Wanted, f.Priority != filePriorityNone)
+		}
+	}
+
+	if wants(fields, "trackerStats") {
+		trackers, err := b.trackers(*t.HashString)
+		if err != nil {
+			return err
+		}
+
+		t.Trackers = nil
+
+		for i, tr := range trackers {
+			host := tr.URL
+			if u, err := url.Parse(tr.URL); err == nil {
+				host = u.Scheme + "://" + u.Host
+			}
+
+			result := tr.Msg
+			if result == "" && tr.Status == trackerWorking {
+				result = "Success"
+			}
+
+			t.Trackers = append(t.Trackers, &backend.Tracker{Announce: tr.URL, ID: int64(i), Tier: tr.Tier})
+			t.TrackerStats = append(t.TrackerStats, &backend.TrackerStats{
+				Announce:              tr.URL,
+				DownloadCount:         tr.NumDownloaded,
+				Host:                  host,
+				ID:                    int64(i),
+				LastAnnounceResult:    result,
+				LastAnnounceSucceeded: tr.Status == trackerWorking,
+				LeecherCount:          tr.NumLeeches,
+				SeederCount:           tr.NumSeeds,
+				Tier:                  tr.Tier,
+			})
+		}
+	}
+
+	if wants(fields, "peers") {
+		var answer struct {
+			Peers map[string]torrentPeer `json:"peers"`
+		}
+
+		if err := b.do("GET", "sync/torrentPeers", url.Values{"hash": {*t.HashString}, "rid": {"0"}}, &answer); err != nil {
+			return err
+		}
+
+		for _, p := range answer.Peers {
+			t.Peers = append(t.Peers, fromPeer(p))
+		}
+
+		sort.Slice(t.Peers, func(i, j int) bool { return t.Peers[i].Address < t.Peers[j].Address })
+	}
+
+	if wants(fields, "pieces") {
+		var states []int
+		if err := b.do("GET", "torrents/pieceStates", url.Values{"hash": {*t.HashString}}, &states); err != nil {
+			return err
+		}
+
+		t.Pieces = stringp(pieceBitfield(states))
+	}
+
+	return nil
+}
+
+// trackers returns the real trackers of a torrent, without the DHT, PeX and
+// LSD pseudo trackers.
+func (b *Backend) trackers(hash string) ([]torrentTracker, error) {
+	var all, trackers []torrentTracker
+	if err := b.do("GET", "torrents/trackers", url.Values{"hash": {hash}}, &all); err != nil {
+		return nil, err
+	}
+
+	for _, tr := range all {
+		if !strings.HasPrefix(tr.URL, "** [") {
+			trackers = append(trackers, tr)
+		}
+	}
+
+	return trackers, nil
+}
+
+// fromPeer converts a peer, its flags are those of libtorrent.
+func fromPeer(p torrentPeer) *backend.Peer {
+	flags := strings.ReplaceAll(p.Flags, " ", "")
+
+	return &backend.Peer{
+		Address:            p.IP,
+		ClientName:         p.Client,
+		ClientIsChoked:     strings.Contains(flags, "d"),
+		ClientIsInterested: strings.ContainsAny(flags, "Dd"),
+		FlagStr:            flags,
+		IsDownloadingFrom:  strings.Contains(flags, "D"),
+		IsEncrypted:        strings.Contains(flags, "E"),
+		IsIncoming:         strings.Contains(flags, "I"),
+		IsUploadingTo:      strings.Contains(flags, "U"),
+		IsUTP:              strings.Contains(flags, "P"),
+		PeerIsChoked:       strings.Contains(flags, "u"),
+		PeerIsInterested:   strings.ContainsAny(flags, "Uu"),
+		Port:               p.Port,
+		Progress:           p.Progress,
+		RateToClient:       p.DlSpeed,
+		RateToPeer:         p.UpSpeed,
+	}
+}
+
+// pieceBitfield returns the pieces of a torrent as transmission does: a
+// base64 encoded bitfield of the pieces it has, the first in the high bit.
+func pieceBitfield(states []int) string {
+	bits := make([]byte, (len(states)+7)/8)
+
+	for i, state := range states {
+		if state == pieceDownloaded {
+			bits[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+
+	return base64.StdEncoding.EncodeToString(bits)
+}
+
+func joinIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = fmt.Sprint(id)
+	}
+
+	return strings.Join(s, "|")
+}
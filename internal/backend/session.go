@@ -0,0 +1,78 @@
+package backend
+
+// Session holds the session arguments (global settings) of a daemon. The
+// JSON names are those of transmission's session-get/session-set. Only
+// non-nil fields are changed by SessionSet.
+type Session struct {
+	AltSpeedDown              *int64   `json:"alt-speed-down,omitempty"`
+	AltSpeedEnabled           *bool    `json:"alt-speed-enabled,omitempty"`
+	AltSpeedTimeBegin         *int64   `json:"alt-speed-time-begin,omitempty"`
+	AltSpeedTimeEnabled       *bool    `json:"alt-speed-time-enabled,omitempty"`
+	AltSpeedTimeEnd           *int64   `json:"alt-speed-time-end,omitempty"`
+	AltSpeedTimeDay           *int64   `json:"alt-speed-time-day,omitempty"`
+	AltSpeedUp                *int64   `json:"alt-speed-up,omitempty"`
+	BlocklistURL              *string  `json:"blocklist-url,omitempty"`
+	BlocklistEnabled          *bool    `json:"blocklist-enabled,omitempty"`
+	BlocklistSize             *int64   `json:"blocklist-size,omitempty"`
+	CacheSizeMB               *int64   `json:"cache-size-mb,omitempty"`
+	ConfigDir                 *string  `json:"config-dir,omitempty"`
+	DownloadDir               *string  `json:"download-dir,omitempty"`
+	DownloadQueueSize         *int64   `json:"download-queue-size,omitempty"`
+	DownloadQueueEnabled      *bool    `json:"download-queue-enabled,omitempty"`
+	DHTEnabled                *bool    `json:"dht-enabled,omitempty"`
+	Encryption                *string  `json:"encryption,omitempty"`
+	IdleSeedingLimit          *int64   `json:"idle-seeding-limit,omitempty"`
+	IdleSeedingLimitEnabled   *bool    `json:"idle-seeding-limit-enabled,omitempty"`
+	IncompleteDir             *string  `json:"incomplete-dir,omitempty"`
+	IncompleteDirEnabled      *bool    `json:"incomplete-dir-enabled,omitempty"`
+	LPDEnabled                *bool    `json:"lpd-enabled,omitempty"`
+	PeerLimitGlobal           *int64   `json:"peer-limit-global,omitempty"`
+	PeerLimitPerTorrent       *int64   `json:"peer-limit-per-torrent,omitempty"`
+	PEXEnabled                *bool    `json:"pex-enabled,omitempty"`
+	PeerPort                  *int64   `json:"peer-port,omitempty"`
+	PeerPortRandomOnStart     *bool    `json:"peer-port-random-on-start,omitempty"`
+	PortForwardingEnabled     *bool    `json:"port-forwarding-enabled,omitempty"`
+	QueueStalledEnabled       *bool    `json:"queue-stalled-enabled,omitempty"`
+	QueueStalledMinutes       *int64   `json:"queue-stalled-minutes,omitempty"`
+	RenamePartialFiles        *bool    `json:"rename-partial-files,omitempty"`
+	RPCVersion                *int64   `json:"rpc-version,omitempty"`
+	RPCVersionMinimum         *int64   `json:"rpc-version-minimum,omitempty"`
+	ScriptTorrentDoneFilename *string  `json:"script-torrent-done-filename,omitempty"`
+	ScriptTorrentDoneEnabled  *bool    `json:"script-torrent-done-enabled,omitempty"`
+	SeedRatioLimit            *float64 `json:"seedRatioLimit,omitempty"`
+	SeedRatioLimited          *bool    `json:"seedRatioLimited,omitempty"`
+	SeedQueueSize             *int64   `json:"seed-queue-size,omitempty"`
+	SeedQueueEnabled          *bool    `json:"seed-queue-enabled,omitempty"`
+	SessionID                 *string  `json:"session-id,omitempty"`
+	SpeedLimitDown            *int64   `json:"speed-limit-down,omitempty"`
+	SpeedLimitDownEnabled     *bool    `json:"speed-limit-down-enabled,omitempty"`
+	SpeedLimitUp              *int64   `json:"speed-limit-up,omitempty"`
+	SpeedLimitUpEnabled       *bool    `json:"speed-limit-up-enabled,omitempty"`
+	StartAddedTorrents        *bool    `json:"start-added-torrents,omitempty"`
+	TrashOriginalTorrentFiles *bool    `json:"trash-original-torrent-files,omitempty"`
+	UTPEnabled                *bool    `json:"utp-enabled,omitempty"`
+	Version                   *string  `json:"version,omitempty"`
+}
+
+// SessionStats holds the statistics of a daemon. The JSON names are those of
+// transmission's session-stats. Fields are nil when the client doesn't keep
+// them.
+type SessionStats struct {
+	ActiveTorrentCount *int64 `json:"activeTorrentCount"`
+	PausedTorrentCount *int64 `json:"pausedTorrentCount"`
+	TorrentCount       *int64 `json:"torrentCount"`
+	DownloadSpeed      *int64 `json:"downloadSpeed"`
+	UploadSpeed        *int64 `json:"uploadSpeed"`
+	// Current is about the running daemon, Cumulative about every run.
+	Current    Stats `json:"current-stats"`
+	Cumulative Stats `json:"cumulative-stats"`
+}
+
+// Stats are the transfer statistics of SessionStats.
+type Stats struct {
+	UploadedBytes   *int64 `json:"uploadedBytes"`
+	DownloadedBytes *int64 `json:"downloadedBytes"`
+	FilesAdded      *int64 `json:"filesAdded"`
+	SessionCount    *int64 `json:"sessionCount"`
+	SecondsActive   *int64 `json:"secondsActive"`
+}
@@ -0,0 +1,216 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/hekmon/cunits/v2"
+)
+
+// Unsupported is shown in place of the value of a field the bittorrent client
+// doesn't have.
+const Unsupported = "unsupported"
+
+// Torrent represents all the possible fields of data for a torrent.
+type Torrent struct {
+	ActivityDate            *time.Time
+	AddedDate               *time.Time
+	BandwidthPriority       *int64
+	Comment                 *string
+	CorruptEver             *int64
+	Creator                 *string
+	DateCreated             *time.Time
+	DesiredAvailable        *int64
+	DoneDate                *time.Time
+	DownloadDir             *string
+	DownloadedEver          *int64
+	DownloadLimit           *int64
+	DownloadLimited         *bool
+	EditDate                *time.Time
+	Error                   *int64
+	ErrorString             *string
+	Eta                     *int64
+	EtaIdle                 *int64
+	Files                   []*File
+	FileStats               []*FileStat
+	HashString              *string
+	HaveUnchecked           *int64
+	HaveValid               *int64
+	HonorsSessionLimits     *bool
+	ID                      *int64
+	IsFinished              *bool
+	IsPrivate               *bool
+	IsStalled               *bool
+	Labels                  []string
+	LeftUntilDone           *int64
+	MagnetLink              *string
+	ManualAnnounceTime      *int64
+	MaxConnectedPeers       *int64
+	MetadataPercentComplete *float64
+	Name                    *string
+	PeerLimit               *int64
+	Peers                   []*Peer
+	PeersConnected          *int64
+	PeersFrom               *PeersFrom
+	PeersGettingFromUs      *int64
+	PeersSendingToUs        *int64
+	PercentDone             *float64
+	Pieces                  *string // base64 encoded bitfield
+	PieceCount              *int64
+	PieceSize               *cunits.Bits
+	Priorities              []int64
+	QueuePosition           *int64
+	RateDownload            *int64 // B/s
+	RateUpload              *int64 // B/s
+	RecheckProgress         *float64
+	SecondsDownloading      *int64
+	SecondsSeeding          *time.Duration
+	SeedIdleLimit           *int64
+	SeedIdleMode            *int64
+	SeedRatioLimit          *float64
+	SeedRatioMode           *SeedRatioMode
+	SizeWhenDone            *cunits.Bits
+	StartDate               *time.Time
+	Status                  *Status
+	Trackers                []*Tracker
+	TrackerStats            []*TrackerStats
+	TotalSize               *cunits.Bits
+	TorrentFile             *string
+	UploadedEver            *int64
+	UploadLimit             *int64
+	UploadLimited           *bool
+	UploadRatio             *float64
+	Wanted                  []bool
+	WebSeeds                []string
+	WebSeedsSendingToUs     *int64
+
+	// Unsupported holds the names of the requested fields the client doesn't
+	// have. They're set to zero values so that they can be dereferenced, but
+	// should be shown as Unsupported.
+	Unsupported map[string]bool
+}
+
+// Supports returns false if field was requested but the client doesn't have it.
+func (t *Torrent) Supports(field string) bool {
+	return !t.Unsupported[field]
+}
+
+// File represents one file from a Torrent.
+type File struct {
+	BytesCompleted int64
+	Length         int64
+	Name           string
+}
+
+// FileStat represents the metadata of a torrent's file.
+type FileStat struct {
+	BytesCompleted int64
+	Wanted         bool
+	Priority       int64
+}
+
+// Peer represents a peer connected to a torrent.
+type Peer struct {
+	Address            string
+	ClientName         string
+	ClientIsChoked     bool
+	ClientIsInterested bool
+	FlagStr            string
+	IsDownloadingFrom  bool
+	IsEncrypted        bool
+	IsIncoming         bool
+	IsUploadingTo      bool
+	IsUTP              bool
+	PeerIsChoked       bool
+	PeerIsInterested   bool
+	Port               int64
+	Progress           float64
+	RateToClient       int64 // B/s
+	RateToPeer         int64 // B/s
+}
+
+// PeersFrom counts where the peers of a torrent were found.
+type PeersFrom struct {
+	FromCache    int64
+	FromDHT      int64
+	FromIncoming int64
+	FromLPD      int64
+	FromLTEP     int64
+	FromPEX      int64
+	FromTracker  int64
+}
+
+// Tracker represents the base data of a torrent's tracker.
+type Tracker struct {
+	Announce string
+	ID       int64
+	Scrape   string
+	Tier     int64
+}
+
+// TrackerStats represents the extended data of a torrent's tracker.
+type TrackerStats struct {
+	Announce              string
+	AnnounceState         int64
+	DownloadCount         int64
+	HasAnnounced          bool
+	HasScraped            bool
+	Host                  string
+	ID                    int64
+	IsBackup              bool
+	LastAnnouncePeerCount int64
+	LastAnnounceResult    string
+	LastAnnounceStartTime time.Time
+	LastAnnounceSucceeded bool
+	LastAnnounceTime      time.Time
+	LastAnnounceTimedOut  bool
+	LastScrapeResult      string
+	LastScrapeStartTime   time.Time
+	LastScrapeSucceeded   bool
+	LastScrapeTime        time.Time
+	LastScrapeTimedOut    bool
+	LeecherCount          int64
+	NextAnnounceTime      time.Time
+	NextScrapeTime        time.Time
+	Scrape                string
+	ScrapeState           int64
+	SeederCount           int64
+	Tier                  int64
+}
+
+// SeedRatioMode represents a torrent's seeding mode.
+type SeedRatioMode int64
+
+// The seed ratio modes.
+const (
+	SeedRatioModeGlobal  SeedRatioMode = 0
+	SeedRatioModeCustom  SeedRatioMode = 1
+	SeedRatioModeNoRatio SeedRatioMode = 2
+)
+
+func (srm SeedRatioMode) String() string {
+	switch srm {
+	case SeedRatioModeGlobal:
+		return "global"
+	case SeedRatioModeCustom:
+		return "custom"
+	case SeedRatioModeNoRatio:
+		return "no ratio"
+	default:
+		return "<unknown>"
+	}
+}
+
+// Status is the state of a torrent. The values are those of transmission.
+type Status int64
+
+// The torrent statuses.
+const (
+	StatusStopped      Status = 0
+	StatusCheckWait    Status = 1
+	StatusCheck        Status = 2
+	StatusDownloadWait Status = 3
+	StatusDownload     Status = 4
+	StatusSeedWait     Status = 5
+	StatusSeed         Status = 6
+	StatusIsolated     Status = 7
+)
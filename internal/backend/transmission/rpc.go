@@ -0,0 +1,151 @@
+package transmission
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/hekmon/transmissionrpc"
+)
+
+// sessionIDHeader carries the token transmission uses against CSRF. A request
+// without the current one is answered with 409 Conflict and the right one.
+const sessionIDHeader = "X-Transmission-Session-Id"
+
+// Config describes how to reach a transmission daemon.
+type Config struct {
+	// URL is the RPC endpoint, e.g. "http://localhost:9091/transmission/rpc".
+	URL      string
+	User     string
+	Password string
+	// HTTPClient is used for all requests.
+	HTTPClient *http.Client
+	Debug      bool
+}
+
+// New returns a Backend after checking that the daemon speaks a version of
+// the RPC protocol the library understands.
+func New(config Config) (*Backend, error) {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+	}
+
+	b := &Backend{config: config}
+
+	var session transmissionrpc.SessionArguments
+	if err := b.call("session-get", nil, &session); err != nil {
+		return nil, err
+	}
+
+	if session.RPCVersion == nil || session.RPCVersionMinimum == nil {
+		return nil, errors.New("transmission: session-get: the answer has no RPC version")
+	}
+
+	if transmissionrpc.RPCVersion < *session.RPCVersionMinimum {
+		return nil, fmt.Errorf(
+			"remote transmission RPC version (v%d) is incompatible with the transmission library (v%d): remote needs at least v%d",
+			*session.RPCVersion, transmissionrpc.RPCVersion, *session.RPCVersionMinimum)
+	}
+
+	return b, nil
+}
+
+// call calls an RPC method and decodes its arguments into result, unless
+// result is nil.
+func (b *Backend) call(method string, arguments, result interface{}) error {
+	b.tag++
+	request := map[string]interface{}{"method": method, "tag": b.tag}
+
+	if arguments != nil {
+		request["arguments"] = arguments
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	if b.config.Debug {
+		fmt.Fprintf(os.Stderr, "transmission: %s\n", data)
+	}
+
+	data, err = b.post(method, data)
+	if err != nil {
+		return err
+	}
+
+	if b.config.Debug {
+		fmt.Fprintf(os.Stderr, "transmission: %s\n", data)
+	}
+
+	var answer struct {
+		Arguments json.RawMessage `json:"arguments"`
+		Result    string          `json:"result"`
+		Tag       int             `json:"tag"`
+	}
+
+	if err := json.Unmarshal(data, &answer); err != nil {
+		return fmt.Errorf("transmission: %s: %v", method, err)
+	}
+
+	if answer.Result != "success" {
+		return fmt.Errorf("transmission: %s: %s", method, answer.Result)
+	}
+
+	if answer.Tag != b.tag {
+		return fmt.Errorf("transmission: %s: the answer is tagged %d instead of %d", method, answer.Tag, b.tag)
+	}
+
+	if result == nil || len(answer.Arguments) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(answer.Arguments, result); err != nil {
+		return fmt.Errorf("transmission: %s: %v", method, err)
+	}
+
+	return nil
+}
+
+// post sends a request and returns the body of the answer. When the session
+// ID is missing or stale, it's updated and the request sent once more.
+func (b *Backend) post(method string, data []byte) ([]byte, error) {
+	for retry := true; ; retry = false {
+		req, err := http.NewRequest("POST", b.config.URL, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "trpc")
+		req.Header.Set(sessionIDHeader, b.sessionID)
+		req.SetBasicAuth(b.config.User, b.config.Password)
+
+		resp, err := b.config.HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusConflict && retry {
+			b.sessionID = resp.Header.Get(sessionIDHeader)
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("transmission: %s: %d %s", method, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+
+		return body, nil
+	}
+}
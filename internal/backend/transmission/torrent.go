@@ -0,0 +1,141 @@
+package transmission
+
+import (
+	"strings"
+
+	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
+)
+
+func fromTorrent(t *transmissionrpc.Torrent) *backend.Torrent {
+	torrent := &backend.Torrent{
+		ActivityDate:            t.ActivityDate,
+		AddedDate:               t.AddedDate,
+		BandwidthPriority:       t.BandwidthPriority,
+		Comment:                 t.Comment,
+		CorruptEver:             t.CorruptEver,
+		Creator:                 t.Creator,
+		DateCreated:             t.DateCreated,
+		DesiredAvailable:        t.DesiredAvailable,
+		DoneDate:                t.DoneDate,
+		DownloadDir:             t.DownloadDir,
+		DownloadedEver:          t.DownloadedEver,
+		DownloadLimit:           t.DownloadLimit,
+		DownloadLimited:         t.DownloadLimited,
+		EditDate:                t.EditDate,
+		Error:                   t.Error,
+		ErrorString:             t.ErrorString,
+		Eta:                     t.Eta,
+		EtaIdle:                 t.EtaIdle,
+		HashString:              t.HashString,
+		HaveUnchecked:           t.HaveUnchecked,
+		HaveValid:               t.HaveValid,
+		HonorsSessionLimits:     t.HonorsSessionLimits,
+		ID:                      t.ID,
+		IsFinished:              t.IsFinished,
+		IsPrivate:               t.IsPrivate,
+		IsStalled:               t.IsStalled,
+		Labels:                  t.Labels,
+		LeftUntilDone:           t.LeftUntilDone,
+		MagnetLink:              t.MagnetLink,
+		ManualAnnounceTime:      t.ManualAnnounceTime,
+		MaxConnectedPeers:       t.MaxConnectedPeers,
+		MetadataPercentComplete: t.MetadataPercentComplete,
+		Name:                    t.Name,
+		PeerLimit:               t.PeerLimit,
+		PeersConnected:          t.PeersConnected,
+		PeersGettingFromUs:      t.PeersGettingFromUs,
+		PeersSendingToUs:        t.PeersSendingToUs,
+		PercentDone:             t.PercentDone,
+		Pieces:                  t.Pieces,
+		PieceCount:              t.PieceCount,
+		PieceSize:               t.PieceSize,
+		Priorities:              t.Priorities,
+		QueuePosition:           t.QueuePosition,
+		RateDownload:            t.RateDownload,
+		RateUpload:              t.RateUpload,
+		RecheckProgress:         t.RecheckProgress,
+		SecondsDownloading:      t.SecondsDownloading,
+		SecondsSeeding:          t.SecondsSeeding,
+		SeedIdleLimit:           t.SeedIdleLimit,
+		SeedIdleMode:            t.SeedIdleMode,
+		SeedRatioLimit:          t.SeedRatioLimit,
+		SizeWhenDone:            t.SizeWhenDone,
+		StartDate:               t.StartDate,
+		TotalSize:               t.TotalSize,
+		TorrentFile:             t.TorrentFile,
+		UploadedEver:            t.UploadedEver,
+		UploadLimit:             t.UploadLimit,
+		UploadLimited:           t.UploadLimited,
+		UploadRatio:             t.UploadRatio,
+		Wanted:                  t.Wanted,
+		WebSeeds:                t.WebSeeds,
+		WebSeedsSendingToUs:     t.WebSeedsSendingToUs,
+	}
+
+	if t.Status != nil {
+		status := backend.Status(*t.Status)
+		torrent.Status = &status
+	}
+
+	if t.SeedRatioMode != nil {
+		mode := backend.SeedRatioMode(*t.SeedRatioMode)
+		torrent.SeedRatioMode = &mode
+	}
+
+	if t.PeersFrom != nil {
+		from := backend.PeersFrom(*t.PeersFrom)
+		torrent.PeersFrom = &from
+	}
+
+	for _, f := range t.Files {
+		torrent.Files = append(torrent.Files, &backend.File{
+			BytesCompleted: f.BytesCompleted,
+			Length:         f.Length,
+			Name:           f.Name,
+		})
+	}
+
+	for _, f := range t.FileStats {
+		torrent.FileStats = append(torrent.FileStats, &backend.FileStat{
+			BytesCompleted: f.BytesCompleted,
+			Wanted:         f.Wanted,
+			Priority:       f.Priority,
+		})
+	}
+
+	// The interest flags of the library have the wrong JSON names, so they
+	// come from the flags of transmission.
+	for _, p := range t.Peers {
+		torrent.Peers = append(torrent.Peers, &backend.Peer{
+			Address:            p.Address,
+			ClientName:         p.ClientName,
+			ClientIsChoked:     p.ClientIsChoked,
+			ClientIsInterested: p.ClientIsint64erested || strings.ContainsAny(p.FlagStr, "Dd"),
+			FlagStr:            p.FlagStr,
+			IsDownloadingFrom:  p.IsDownloadingFrom,
+			IsEncrypted:        p.IsEncrypted,
+			IsIncoming:         p.IsIncoming,
+			IsUploadingTo:      p.IsUploadingTo,
+			IsUTP:              p.IsUTP,
+			PeerIsChoked:       p.PeerIsChoked,
+			PeerIsInterested:   p.PeerIsint64erested || strings.ContainsAny(p.FlagStr, "Uu"),
+			Port:               p.Port,
+			Progress:           p.Progress,
+			RateToClient:       p.RateToClient,
+			RateToPeer:         p.RateToPeer,
+		})
+	}
+
+	for _, tr := range t.Trackers {
+		tracker := backend.Tracker(*tr)
+		torrent.Trackers = append(torrent.Trackers, &tracker)
+	}
+
+	for _, ts := range t.TrackerStats {
+		stats := backend.TrackerStats(*ts)
+		torrent.TrackerStats = append(torrent.TrackerStats, &stats)
+	}
+
+	return torrent
+}
@@ -0,0 +1,287 @@
+// Package transmission implements backend.Backend on top of the transmission
+// RPC protocol.
+package transmission
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
+)
+
+// Backend talks to a transmission daemon. It has its own RPC transport and
+// only uses transmissionrpc for the types of the payloads and answers.
+type Backend struct {
+	config    Config
+	sessionID string
+	tag       int
+}
+
+// Name implements backend.Backend.
+func (b *Backend) Name() string {
+	return "transmission"
+}
+
+// Version implements backend.Backend.
+func (b *Backend) Version() (string, error) {
+	var session transmissionrpc.SessionArguments
+	if err := b.call("session-get", nil, &session); err != nil {
+		return "", err
+	}
+
+	version := "transmission"
+	if session.Version != nil {
+		version += " " + *session.Version
+	}
+
+	if session.RPCVersion != nil {
+		version += fmt.Sprintf(", RPC version v%d", *session.RPCVersion)
+	}
+
+	return fmt.Sprintf("%s (client library built against RPC version v%d)", version, transmissionrpc.RPCVersion), nil
+}
+
+// TorrentGet implements backend.Backend.
+func (b *Backend) TorrentGet(fields []string, ids []int64) ([]*backend.Torrent, error) {
+	var answer struct {
+		Torrents []*transmissionrpc.Torrent `json:"torrents"`
+	}
+
+	args := map[string]interface{}{"fields": fields}
+	if len(ids) > 0 {
+		args["ids"] = ids
+	}
+
+	if err := b.call("torrent-get", args, &answer); err != nil {
+		return nil, err
+	}
+
+	result := make([]*backend.Torrent, len(answer.Torrents))
+	for i, t := range answer.Torrents {
+		result[i] = fromTorrent(t)
+	}
+
+	return result, nil
+}
+
+// TorrentSet implements backend.Backend.
+func (b *Backend) TorrentSet(p *backend.TorrentSetPayload) error {
+	// Without IDs, torrent-set changes all torrents.
+	if len(p.IDs) == 0 {
+		return errors.New("transmission: torrent-set: no torrent IDs")
+	}
+
+	payload := &transmissionrpc.TorrentSetPayload{
+		BandwidthPriority:   p.BandwidthPriority,
+		DownloadLimit:       p.DownloadLimit,
+		DownloadLimited:     p.DownloadLimited,
+		FilesWanted:         p.FilesWanted,
+		FilesUnwanted:       p.FilesUnwanted,
+		HonorsSessionLimits: p.HonorsSessionLimits,
+		IDs:                 p.IDs,
+		Labels:              p.Labels,
+		Location:            p.Location,
+		PeerLimit:           p.PeerLimit,
+		PriorityHigh:        p.PriorityHigh,
+		PriorityLow:         p.PriorityLow,
+		PriorityNormal:      p.PriorityNormal,
+		QueuePosition:       p.QueuePosition,
+		SeedIdleLimit:       p.SeedIdleLimit,
+		SeedIdleMode:        p.SeedIdleMode,
+		SeedRatioLimit:      p.SeedRatioLimit,
+		TrackerAdd:          p.TrackerAdd,
+		TrackerRemove:       p.TrackerRemove,
+		UploadLimit:         p.UploadLimit,
+		UploadLimited:       p.UploadLimited,
+	}
+
+	if p.SeedRatioMode != nil {
+		mode := transmissionrpc.SeedRatioMode(*p.SeedRatioMode)
+		payload.SeedRatioMode = &mode
+	}
+
+	args, err := trackerReplace(payload, p.TrackerReplace)
+	if err != nil {
+		return err
+	}
+
+	return b.call("torrent-set", args, nil)
+}
+
+// trackerReplace adds the trackerReplace argument to a torrent-set payload.
+// The library types the tracker IDs of trackerReplace as strings, which
+// transmission rejects, so the pairs of ID and announce URL are added to the
+// JSON the library makes.
+func trackerReplace(payload *transmissionrpc.TorrentSetPayload, replace []backend.TrackerReplace) (interface{}, error) {
+	if len(replace) == 0 {
+		return payload, nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+
+	pairs := make([]interface{}, 0, 2*len(replace))
+	for _, r := range replace {
+		pairs = append(pairs, r.ID, r.Announce)
+	}
+
+	args["trackerReplace"] = pairs
+
+	return args, nil
+}
+
+// TorrentAdd implements backend.Backend.
+func (b *Backend) TorrentAdd(p *backend.TorrentAddPayload) (*backend.Torrent, error) {
+	var answer struct {
+		Added     *transmissionrpc.Torrent `json:"torrent-added"`
+		Duplicate *transmissionrpc.Torrent `json:"torrent-duplicate"`
+	}
+
+	err := b.call("torrent-add", &transmissionrpc.TorrentAddPayload{
+		Cookies:           p.Cookies,
+		DownloadDir:       p.DownloadDir,
+		Filename:          p.Filename,
+		MetaInfo:          p.MetaInfo,
+		Paused:            p.Paused,
+		PeerLimit:         p.PeerLimit,
+		BandwidthPriority: p.BandwidthPriority,
+		FilesWanted:       p.FilesWanted,
+		FilesUnwanted:     p.FilesUnwanted,
+		PriorityHigh:      p.PriorityHigh,
+		PriorityLow:       p.PriorityLow,
+		PriorityNormal:    p.PriorityNormal,
+	}, &answer)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case answer.Added != nil:
+		return fromTorrent(answer.Added), nil
+	case answer.Duplicate != nil:
+		return fromTorrent(answer.Duplicate), nil
+	}
+
+	return nil, errors.New("transmission: torrent-add: the answer has no torrent")
+}
+
+// TorrentRemove implements backend.Backend.
+func (b *Backend) TorrentRemove(ids []int64, deleteData bool) error {
+	return b.call("torrent-remove", map[string]interface{}{"ids": ids, "delete-local-data": deleteData}, nil)
+}
+
+// TorrentStart implements backend.Backend.
+func (b *Backend) TorrentStart(ids []int64, now bool) error {
+	if now {
+		return b.call("torrent-start-now", idsArguments(ids), nil)
+	}
+
+	return b.call("torrent-start", idsArguments(ids), nil)
+}
+
+// TorrentStop implements backend.Backend.
+func (b *Backend) TorrentStop(ids []int64) error {
+	return b.call("torrent-stop", idsArguments(ids), nil)
+}
+
+// TorrentVerify implements backend.Backend.
+func (b *Backend) TorrentVerify(ids []int64) error {
+	return b.call("torrent-verify", idsArguments(ids), nil)
+}
+
+// idsArguments returns the arguments of the actions on torrents, which apply
+// to all of them when ids is empty.
+func idsArguments(ids []int64) map[string]interface{} {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return map[string]interface{}{"ids": ids}
+}
+
+// TorrentSetLocation implements backend.Backend.
+func (b *Backend) TorrentSetLocation(id int64, location string, move bool) error {
+	return b.call("torrent-set-location", map[string]interface{}{"ids": []int64{id}, "location": location, "move": move}, nil)
+}
+
+// TorrentRenamePath implements backend.Backend.
+func (b *Backend) TorrentRenamePath(id int64, path, name string) error {
+	return b.call("torrent-rename-path", map[string]interface{}{"ids": []int64{id}, "path": path, "name": name}, nil)
+}
+
+// SessionGet implements backend.Backend.
+func (b *Backend) SessionGet() (*backend.Session, error) {
+	var args transmissionrpc.SessionArguments
+	if err := b.call("session-get", nil, &args); err != nil {
+		return nil, err
+	}
+
+	session := &backend.Session{}
+
+	return session, convertSession(&args, session)
+}
+
+// SessionSet implements backend.Backend.
+func (b *Backend) SessionSet(session *backend.Session) error {
+	args := &transmissionrpc.SessionArguments{}
+	if err := convertSession(session, args); err != nil {
+		return err
+	}
+
+	// These are only read.
+	args.BlocklistSize = nil
+	args.ConfigDir = nil
+	args.RPCVersion = nil
+	args.RPCVersionMinimum = nil
+	args.SessionID = nil
+	args.Version = nil
+
+	return b.call("session-set", args, nil)
+}
+
+// SessionStats implements backend.Backend.
+func (b *Backend) SessionStats() (*backend.SessionStats, error) {
+	var stats transmissionrpc.SessionStats
+	if err := b.call("session-stats", nil, &stats); err != nil {
+		return nil, err
+	}
+
+	result := &backend.SessionStats{}
+
+	return result, convertSession(&stats, result)
+}
+
+// FreeSpace implements backend.Backend.
+func (b *Backend) FreeSpace(path string) (int64, error) {
+	var space transmissionrpc.TransmissionFreeSpace
+	if err := b.call("free-space", map[string]string{"path": path}, &space); err != nil {
+		return 0, err
+	}
+
+	if space.Path != path {
+		return 0, fmt.Errorf("transmission: free-space: asked for %s, got %s", path, space.Path)
+	}
+
+	return space.Size, nil
+}
+
+// convertSession converts between transmissionrpc.SessionArguments and
+// backend.Session, or the session statistics. Both use the session-get JSON names and only marshal
+// non-nil fields, so a JSON round trip does the job.
+func convertSession(from, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, to)
+}
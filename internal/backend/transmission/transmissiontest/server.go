@@ -0,0 +1,747 @@
+// Package transmissiontest provides a fake transmission daemon speaking the
+// RPC protocol over HTTP, including the X-Transmission-Session-Id handshake,
+// for end to end tests of trpc commands.
+//
+// The daemon state is plain data (torrents and session arguments keyed by
+// their RPC names) that tests set up before running a command and inspect
+// afterwards, along with the requests the daemon received.
+package transmissiontest
+
+import (
+	"crypto/sha1" // nolint:gosec
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// SessionIDHeader is the header of the CSRF protection handshake.
+const SessionIDHeader = "X-Transmission-Session-Id"
+
+// RPCPath is where the server answers RPC requests.
+const RPCPath = "/transmission/rpc"
+
+// Torrent is the state of a torrent, keyed by torrent-get field names.
+// Numbers may be any Go integer or float type.
+type Torrent map[string]interface{}
+
+// Request is an RPC request received by the server.
+type Request struct {
+	Method    string
+	Arguments map[string]interface{}
+}
+
+// String returns the method followed by the arguments as JSON (with sorted
+// keys), e.g. `torrent-stop {"ids":[1]}`.
+func (r Request) String() string {
+	args, err := json.Marshal(r.Arguments)
+	if err != nil {
+		return r.Method + " " + err.Error()
+	}
+
+	return r.Method + " " + string(args)
+}
+
+// Server is a fake transmission daemon.
+type Server struct {
+	*httptest.Server
+	// Torrents are returned by torrent-get in this order.
+	Torrents []Torrent
+	// Session holds the session-get arguments.
+	Session map[string]interface{}
+	// Stats holds the current-stats and cumulative-stats of session-stats,
+	// the torrent counts and speeds coming from Torrents.
+	Stats map[string]interface{}
+	// FreeSpace is what free-space answers for every path.
+	FreeSpace int64
+	// User and Password, if User isn't empty, are required with basic
+	// authentication.
+	User     string
+	Password string
+	// SessionID is what clients must send in the SessionIDHeader.
+	SessionID string
+	// Requests records every request that made it past authentication and
+	// the handshake.
+	Requests []Request
+	// Script, if set, is called before each request is handled, e.g. to
+	// make progress between two torrent-get requests.
+	Script func(s *Server, r Request)
+	// Fail maps method names to the error result they answer with.
+	Fail map[string]string
+
+	mu sync.Mutex
+}
+
+// NewServer starts a Server with no torrents and default session arguments.
+// It must be closed after use.
+func NewServer() *Server {
+	s := &Server{
+		Session: map[string]interface{}{
+			"download-dir":             "/downloads",
+			"incomplete-dir":           "/downloads/incomplete",
+			"incomplete-dir-enabled":   false,
+			"rpc-version":              17,
+			"rpc-version-minimum":      14,
+			"speed-limit-down":         100,
+			"speed-limit-down-enabled": false,
+			"speed-limit-up":           100,
+			"speed-limit-up-enabled":   false,
+			"version":                  "4.0.5 (a6fe2a64aa)",
+		},
+		Stats: map[string]interface{}{
+			"current-stats": map[string]interface{}{
+				"uploadedBytes": 0, "downloadedBytes": 0, "filesAdded": 0, "sessionCount": 1, "secondsActive": 0,
+			},
+			"cumulative-stats": map[string]interface{}{
+				"uploadedBytes": 0, "downloadedBytes": 0, "filesAdded": 0, "sessionCount": 1, "secondsActive": 0,
+			},
+		},
+		SessionID: "fake-session-id",
+		Fail:      make(map[string]string),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// RPCURL returns the URL of the RPC endpoint, suitable for --host.
+func (s *Server) RPCURL() string {
+	return s.URL + RPCPath
+}
+
+// NewTorrent returns a stopped, empty torrent with all the fields trpc
+// commands use, which tests then adjust.
+func NewTorrent(id int64, name string) Torrent {
+	sum := sha1.Sum([]byte(name)) // nolint:gosec
+	hash := hex.EncodeToString(sum[:])
+
+	return Torrent{
+		"id":                  id,
+		"name":                name,
+		"hashString":          hash,
+		"magnetLink":          "magnet:?xt=urn:btih:" + hash + "&dn=" + url.QueryEscape(name),
+		"status":              0,
+		"error":               0,
+		"errorString":         "",
+		"comment":             "",
+		"creator":             "",
+		"dateCreated":         0,
+		"pieceCount":          0,
+		"pieceSize":           16384,
+		"haveValid":           0,
+		"haveUnchecked":       0,
+		"corruptEver":         0,
+		"desiredAvailable":    0,
+		"secondsDownloading":  0,
+		"secondsSeeding":      0,
+		"peer-limit":          50,
+		"webseeds":            []string{},
+		"sizeWhenDone":        0,
+		"totalSize":           0,
+		"leftUntilDone":       0,
+		"percentDone":         0,
+		"recheckProgress":     0,
+		"rateDownload":        0,
+		"rateUpload":          0,
+		"uploadedEver":        0,
+		"downloadedEver":      0,
+		"uploadRatio":         0,
+		"eta":                 -1,
+		"downloadDir":         "/downloads",
+		"addedDate":           1600000000,
+		"doneDate":            0,
+		"startDate":           0,
+		"activityDate":        0,
+		"isFinished":          false,
+		"isPrivate":           false,
+		"bandwidthPriority":   0,
+		"queuePosition":       0,
+		"peersConnected":      0,
+		"peersGettingFromUs":  0,
+		"peersSendingToUs":    0,
+		"downloadLimit":       100,
+		"downloadLimited":     false,
+		"uploadLimit":         100,
+		"uploadLimited":       false,
+		"seedRatioLimit":      2,
+		"seedRatioMode":       0,
+		"honorsSessionLimits": true,
+		"labels":              []string{},
+		"trackers":            []interface{}{},
+		"trackerStats":        []interface{}{},
+		"files":               []interface{}{},
+		"fileStats":           []interface{}{},
+		"priorities":          []int64{},
+		"wanted":              []int64{},
+		"peers":               []interface{}{},
+		"pieces":              "",
+	}
+}
+
+// AddTracker appends a tracker to a torrent made by NewTorrent.
+func (t Torrent) AddTracker(announce string) Torrent {
+	trackers, _ := t["trackers"].([]interface{})
+	id := len(trackers)
+
+	return t.addTracker(announce, id, id)
+}
+
+func (t Torrent) addTracker(announce string, id, tier int) Torrent {
+	trackers, _ := t["trackers"].([]interface{})
+	t["trackers"] = append(trackers, map[string]interface{}{
+		"announce": announce, "id": id, "scrape": "", "tier": tier,
+	})
+
+	stats, _ := t["trackerStats"].([]interface{})
+	t["trackerStats"] = append(stats, map[string]interface{}{
+		"announce": announce, "host": trackerHost(announce), "id": id, "tier": tier, "scrape": "", "isBackup": false,
+		"announceState": 1, "hasAnnounced": false, "lastAnnounceSucceeded": true, "lastAnnounceResult": "Success",
+		"lastAnnounceStartTime": 0, "lastAnnounceTime": 0, "lastAnnounceTimedOut": false, "lastAnnouncePeerCount": 0,
+		"nextAnnounceTime": 0, "scrapeState": 1, "hasScraped": false, "lastScrapeSucceeded": false,
+		"lastScrapeResult": "", "lastScrapeStartTime": 0, "lastScrapeTime": 0, "lastScrapeTimedOut": false,
+		"nextScrapeTime": 0, "seederCount": -1, "leecherCount": -1, "downloadCount": -1,
+	})
+
+	return t
+}
+
+func trackerHost(announce string) string {
+	if u, err := url.Parse(announce); err == nil {
+		return u.Scheme + "://" + u.Host
+	}
+
+	return announce
+}
+
+// AddFile appends a file to a torrent made by NewTorrent, updating its sizes.
+func (t Torrent) AddFile(name string, length, completed int64) Torrent {
+	files, _ := t["files"].([]interface{})
+	t["files"] = append(files, map[string]interface{}{
+		"name": name, "length": length, "bytesCompleted": completed,
+	})
+
+	stats, _ := t["fileStats"].([]interface{})
+	t["fileStats"] = append(stats, map[string]interface{}{
+		"bytesCompleted": completed, "wanted": true, "priority": 0,
+	})
+
+	priorities, _ := t["priorities"].([]int64)
+	t["priorities"] = append(priorities, 0)
+
+	wanted, _ := t["wanted"].([]int64)
+	t["wanted"] = append(wanted, 1)
+
+	size := toInt64(t["sizeWhenDone"]) + length
+	left := toInt64(t["leftUntilDone"]) + length - completed
+	t["sizeWhenDone"] = size
+	t["totalSize"] = size
+	t["leftUntilDone"] = left
+	t["percentDone"] = float64(size-left) / float64(size)
+	t["haveValid"] = size - left
+	t["pieceCount"] = (size + toInt64(t["pieceSize"]) - 1) / toInt64(t["pieceSize"])
+	t["pieces"] = pieces(toInt64(t["pieceCount"]), (size-left)/toInt64(t["pieceSize"]))
+
+	return t
+}
+
+// pieces returns the base64 encoded bitfield of a torrent of count pieces
+// that has the first have of them.
+func pieces(count, have int64) string {
+	bits := make([]byte, (count+7)/8)
+	for i := int64(0); i < have; i++ {
+		bits[i/8] |= 0x80 >> uint(i%8)
+	}
+
+	return base64.StdEncoding.EncodeToString(bits)
+}
+
+// Torrent returns the torrent with the given ID, or nil.
+func (s *Server) Torrent(id int64) Torrent {
+	for _, t := range s.Torrents {
+		if toInt64(t["id"]) == id {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// Mutations returns the requests received other than session-get,
+// session-stats, free-space and torrent-get, i.e. those that may change
+// something.
+func (s *Server) Mutations() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Request
+
+	for _, r := range s.Requests {
+		switch r.Method {
+		case "session-get", "session-stats", "free-space", "torrent-get":
+		default:
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+
+	return 0
+}
+
+type rpcRequest struct {
+	Method    string                 `json:"method"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Tag       *int64                 `json:"tag"`
+}
+
+type rpcAnswer struct {
+	Result    string      `json:"result"`
+	Arguments interface{} `json:"arguments"`
+	Tag       *int64      `json:"tag,omitempty"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != RPCPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.User != "" {
+		if user, password, ok := r.BasicAuth(); !ok || user != s.User || password != s.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if r.Header.Get(SessionIDHeader) != s.SessionID {
+		w.Header().Set(SessionIDHeader, s.SessionID)
+		w.WriteHeader(http.StatusConflict)
+
+		return
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.Arguments == nil {
+		req.Arguments = make(map[string]interface{})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request := Request{Method: req.Method, Arguments: req.Arguments}
+	s.Requests = append(s.Requests, request)
+
+	if s.Script != nil {
+		s.Script(s, request)
+	}
+
+	answer := rpcAnswer{Result: "success", Arguments: map[string]interface{}{}, Tag: req.Tag}
+
+	if msg, ok := s.Fail[req.Method]; ok {
+		answer.Result = msg
+	} else if result, err := s.handle(request); err != nil {
+		answer.Result = err.Error()
+	} else if result != nil {
+		answer.Arguments = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(answer)
+}
+
+func (s *Server) handle(r Request) (interface{}, error) {
+	switch r.Method {
+	case "session-get":
+		return s.Session, nil
+	case "session-set":
+		for k, v := range r.Arguments {
+			s.Session[k] = v
+		}
+
+		return nil, nil
+	case "session-stats":
+		return s.sessionStats(), nil
+	case "free-space":
+		return map[string]interface{}{"path": r.Arguments["path"], "size-bytes": s.FreeSpace}, nil
+	case "torrent-get":
+		return s.torrentGet(r.Arguments)
+	case "torrent-set":
+		return nil, s.forEach(r.Arguments, func(t Torrent) error { return torrentSet(t, r.Arguments) })
+	case "torrent-add":
+		return s.torrentAdd(r.Arguments)
+	case "torrent-remove":
+		return nil, s.torrentRemove(r.Arguments)
+	case "torrent-start", "torrent-start-now":
+		return nil, s.forEach(r.Arguments, func(t Torrent) error {
+			t["status"] = 4
+			if toInt64(t["leftUntilDone"]) == 0 {
+				t["status"] = 6
+			}
+
+			return nil
+		})
+	case "torrent-stop":
+		return nil, s.forEach(r.Arguments, func(t Torrent) error {
+			t["status"] = 0
+			return nil
+		})
+	case "torrent-verify":
+		return nil, s.forEach(r.Arguments, func(t Torrent) error {
+			t["status"] = 1
+			return nil
+		})
+	case "torrent-set-location":
+		location, _ := r.Arguments["location"].(string)
+
+		return nil, s.forEach(r.Arguments, func(t Torrent) error {
+			t["downloadDir"] = location
+			return nil
+		})
+	case "torrent-rename-path":
+		return s.torrentRenamePath(r.Arguments)
+	}
+
+	return nil, fmt.Errorf("method name not recognized")
+}
+
+// sessionStats returns the session-stats arguments.
+func (s *Server) sessionStats() map[string]interface{} {
+	stats := make(map[string]interface{})
+	for k, v := range s.Stats {
+		stats[k] = v
+	}
+
+	var active, paused, down, up int64
+
+	for _, t := range s.Torrents {
+		if toInt64(t["status"]) == 0 {
+			paused++
+		} else {
+			active++
+		}
+
+		down += toInt64(t["rateDownload"])
+		up += toInt64(t["rateUpload"])
+	}
+
+	stats["activeTorrentCount"] = active
+	stats["pausedTorrentCount"] = paused
+	stats["torrentCount"] = len(s.Torrents)
+	stats["downloadSpeed"] = down
+	stats["uploadSpeed"] = up
+
+	return stats
+}
+
+// selected returns the torrents the ids argument refers to: all of them if
+// it's missing, otherwise a list of IDs and hashes, or a single ID.
+func (s *Server) selected(args map[string]interface{}) []Torrent {
+	ids, ok := args["ids"]
+	if !ok || ids == "recently-active" {
+		return s.Torrents
+	}
+
+	list, ok := ids.([]interface{})
+	if !ok {
+		list = []interface{}{ids}
+	}
+
+	var result []Torrent
+
+	for _, t := range s.Torrents {
+		for _, id := range list {
+			if hash, ok := id.(string); ok && hash == t["hashString"] || toInt64(id) == toInt64(t["id"]) {
+				result = append(result, t)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+func (s *Server) forEach(args map[string]interface{}, do func(t Torrent) error) error {
+	for _, t := range s.selected(args) {
+		if err := do(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) torrentGet(args map[string]interface{}) (interface{}, error) {
+	fields, ok := args["fields"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no fields")
+	}
+
+	torrents := []Torrent{}
+
+	for _, t := range s.selected(args) {
+		result := Torrent{}
+
+		for _, f := range fields {
+			name, _ := f.(string)
+			if v, ok := t[name]; ok {
+				result[name] = v
+			}
+		}
+
+		torrents = append(torrents, result)
+	}
+
+	return map[string]interface{}{"torrents": torrents}, nil
+}
+
+// torrentSettings are the torrent-set arguments copied as is.
+var torrentSettings = []string{
+	"bandwidthPriority", "downloadLimit", "downloadLimited", "honorsSessionLimits", "labels", "peer-limit",
+	"queuePosition", "seedIdleLimit", "seedIdleMode", "seedRatioLimit", "seedRatioMode", "uploadLimit",
+	"uploadLimited",
+}
+
+func torrentSet(t Torrent, args map[string]interface{}) error {
+	for _, name := range torrentSettings {
+		if v, ok := args[name]; ok {
+			t[name] = v
+		}
+	}
+
+	if location, ok := args["location"].(string); ok {
+		t["downloadDir"] = location
+	}
+
+	files := map[string]func(i int){
+		"files-wanted":    func(i int) { t["wanted"].([]int64)[i] = 1 },
+		"files-unwanted":  func(i int) { t["wanted"].([]int64)[i] = 0 },
+		"priority-high":   func(i int) { t["priorities"].([]int64)[i] = 1 },
+		"priority-normal": func(i int) { t["priorities"].([]int64)[i] = 0 },
+		"priority-low":    func(i int) { t["priorities"].([]int64)[i] = -1 },
+	}
+
+	for name, set := range files {
+		ids, _ := args[name].([]interface{})
+		for _, id := range ids {
+			i := int(toInt64(id))
+			if i < 0 || i >= len(t["wanted"].([]int64)) {
+				return fmt.Errorf("invalid file ID %d", i)
+			}
+
+			set(i)
+		}
+	}
+
+	return setTrackers(t, args)
+}
+
+// setTrackers adds, removes and replaces trackers in the order transmission
+// does. Added trackers get an ID and a tier of their own and, as with
+// transmission, tracker IDs must be numbers.
+func setTrackers(t Torrent, args map[string]interface{}) error {
+	add, _ := args["trackerAdd"].([]interface{})
+	remove, _ := args["trackerRemove"].([]interface{})
+	replace, _ := args["trackerReplace"].([]interface{})
+
+	find := func(id interface{}) (int, error) {
+		if _, ok := id.(float64); !ok {
+			return 0, fmt.Errorf("invalid argument")
+		}
+
+		for i, tr := range t["trackers"].([]interface{}) {
+			if toInt64(tr.(map[string]interface{})["id"]) == toInt64(id) {
+				return i, nil
+			}
+		}
+
+		return 0, fmt.Errorf("invalid argument")
+	}
+
+	for _, a := range add {
+		announce, _ := a.(string)
+		id, tier := 0, 0
+
+		for _, tr := range t["trackers"].([]interface{}) {
+			tracker := tr.(map[string]interface{})
+			if tracker["announce"] == announce {
+				return fmt.Errorf("invalid argument")
+			}
+
+			if n := int(toInt64(tracker["id"])) + 1; n > id {
+				id = n
+			}
+
+			if n := int(toInt64(tracker["tier"])) + 1; n > tier {
+				tier = n
+			}
+		}
+
+		t.addTracker(announce, id, tier)
+	}
+
+	removed := make(map[int]bool)
+
+	for _, id := range remove {
+		i, err := find(id)
+		if err != nil {
+			return err
+		}
+
+		removed[i] = true
+	}
+
+	trackers, stats := []interface{}{}, []interface{}{}
+
+	for i, tr := range t["trackers"].([]interface{}) {
+		if !removed[i] {
+			trackers = append(trackers, tr)
+			stats = append(stats, t["trackerStats"].([]interface{})[i])
+		}
+	}
+
+	t["trackers"], t["trackerStats"] = trackers, stats
+
+	for i := 0; i+1 < len(replace); i += 2 {
+		j, err := find(replace[i])
+		if err != nil {
+			return err
+		}
+
+		announce, _ := replace[i+1].(string)
+		t["trackers"].([]interface{})[j].(map[string]interface{})["announce"] = announce
+		stats := t["trackerStats"].([]interface{})[j].(map[string]interface{})
+		stats["announce"], stats["host"] = announce, trackerHost(announce)
+	}
+
+	return nil
+}
+
+func (s *Server) torrentAdd(args map[string]interface{}) (interface{}, error) {
+	var name, key string
+
+	switch {
+	case args["metainfo"] != nil:
+		key, _ = args["metainfo"].(string)
+		name = "added"
+	case args["filename"] != nil:
+		key, _ = args["filename"].(string)
+		name = path.Base(key)
+
+		if u, err := url.Parse(key); err == nil && u.Scheme == "magnet" && u.Query().Get("dn") != "" {
+			name = u.Query().Get("dn")
+		}
+	default:
+		return nil, fmt.Errorf("no filename or metainfo argument")
+	}
+
+	var id int64
+
+	for _, t := range s.Torrents {
+		if t["source"] == key {
+			return map[string]interface{}{"torrent-duplicate": brief(t)}, nil
+		}
+
+		if toInt64(t["id"]) > id {
+			id = toInt64(t["id"])
+		}
+	}
+
+	t := NewTorrent(id+1, name)
+	t["source"] = key
+	t["downloadDir"] = s.Session["download-dir"]
+
+	if dir, ok := args["download-dir"].(string); ok {
+		t["downloadDir"] = dir
+	}
+
+	if paused, _ := args["paused"].(bool); !paused {
+		t["status"] = 4
+	}
+
+	s.Torrents = append(s.Torrents, t)
+
+	return map[string]interface{}{"torrent-added": brief(t)}, nil
+}
+
+func brief(t Torrent) map[string]interface{} {
+	return map[string]interface{}{"id": t["id"], "name": t["name"], "hashString": t["hashString"]}
+}
+
+func (s *Server) torrentRemove(args map[string]interface{}) error {
+	removed := make(map[int64]bool)
+	for _, t := range s.selected(args) {
+		removed[toInt64(t["id"])] = true
+	}
+
+	kept := s.Torrents[:0]
+
+	for _, t := range s.Torrents {
+		if !removed[toInt64(t["id"])] {
+			kept = append(kept, t)
+		}
+	}
+
+	s.Torrents = kept
+
+	return nil
+}
+
+// torrentRenamePath renames a file or directory of a single torrent, and
+// the torrent itself when the path is its name.
+func (s *Server) torrentRenamePath(args map[string]interface{}) (interface{}, error) {
+	torrents := s.selected(args)
+	if len(torrents) != 1 {
+		return nil, fmt.Errorf("torrent-rename-path requires 1 torrent")
+	}
+
+	t := torrents[0]
+	oldPath, _ := args["path"].(string)
+	name, _ := args["name"].(string)
+	newPath := path.Join(path.Dir(oldPath), name)
+
+	renamed := oldPath == t["name"]
+	if renamed {
+		t["name"] = name
+	}
+
+	files, _ := t["files"].([]interface{})
+
+	for _, f := range files {
+		file := f.(map[string]interface{})
+		fileName, _ := file["name"].(string)
+
+		if fileName == oldPath || strings.HasPrefix(fileName, oldPath+"/") {
+			file["name"] = newPath + strings.TrimPrefix(fileName, oldPath)
+			renamed = true
+		}
+	}
+
+	if !renamed {
+		return nil, fmt.Errorf("invalid argument")
+	}
+
+	return map[string]interface{}{"id": t["id"], "path": oldPath, "name": name}, nil
+}
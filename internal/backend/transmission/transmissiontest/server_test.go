@@ -0,0 +1,108 @@
+package transmissiontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func post(t *testing.T, s *Server, sessionID, body string) (*http.Response, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodPost, s.RPCURL(), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.SetBasicAuth("user", "pass")
+	req.Header.Set(SessionIDHeader, sessionID)
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var answer map[string]interface{}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return resp, answer
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.User, s.Password = "user", "pass"
+	s.Torrents = []Torrent{NewTorrent(1, "a").AddFile("a", 100, 25), NewTorrent(2, "b")}
+
+	resp, _ := post(t, s, "", `{"method": "session-get"}`)
+	if resp.StatusCode != http.StatusConflict || resp.Header.Get(SessionIDHeader) != s.SessionID {
+		t.Fatalf("without a session ID: status %d, %s %q", resp.StatusCode, SessionIDHeader,
+			resp.Header.Get(SessionIDHeader))
+	}
+
+	body := `{"method": "torrent-get", "arguments": {"ids": [1], "fields": ["id", "percentDone"]}, "tag": 7}`
+
+	_, answer := post(t, s, s.SessionID, body)
+	want := map[string]interface{}{
+		"result":    "success",
+		"tag":       7.0,
+		"arguments": map[string]interface{}{"torrents": []interface{}{map[string]interface{}{"id": 1.0, "percentDone": 0.25}}},
+	}
+
+	if !reflect.DeepEqual(answer, want) {
+		t.Errorf("torrent-get = %v, want %v", answer, want)
+	}
+
+	s.Fail["torrent-stop"] = "no can do"
+
+	if _, answer = post(t, s, s.SessionID, `{"method": "torrent-stop"}`); answer["result"] != "no can do" {
+		t.Errorf("failing torrent-stop: result %v", answer["result"])
+	}
+
+	if got := len(s.Mutations()); got != 1 {
+		t.Errorf("Mutations() has %d requests, want 1", got)
+	}
+
+	s.Password = "other"
+
+	if resp, _ = post(t, s, s.SessionID, body); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password: status %d", resp.StatusCode)
+	}
+}
+
+func TestTorrentSetTrackers(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Torrents = []Torrent{NewTorrent(1, "a").AddTracker("http://a.example/announce").AddTracker("http://b.example/announce")}
+
+	body := `{"method": "torrent-set", "arguments": {"ids": [1], "trackerAdd": ["http://c.example/announce"],
+		"trackerRemove": [0], "trackerReplace": [1, "http://d.example/announce"]}}`
+	if _, answer := post(t, s, s.SessionID, body); answer["result"] != "success" {
+		t.Fatalf("torrent-set: result %v", answer["result"])
+	}
+
+	var got []string
+
+	for _, tr := range s.Torrents[0]["trackers"].([]interface{}) {
+		tracker := tr.(map[string]interface{})
+		got = append(got, fmt.Sprint(tracker["id"], " ", tracker["tier"], " ", tracker["announce"]))
+	}
+
+	want := []string{"1 1 http://d.example/announce", "2 2 http://c.example/announce"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trackers = %q, want %q", got, want)
+	}
+
+	body = `{"method": "torrent-set", "arguments": {"ids": [1], "trackerReplace": ["1", "http://e.example/announce"]}}`
+	if _, answer := post(t, s, s.SessionID, body); answer["result"] != "invalid argument" {
+		t.Errorf("trackerReplace with a string ID: result %v", answer["result"])
+	}
+}
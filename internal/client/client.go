@@ -2,83 +2,248 @@ package client
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
 )
 
 const (
-	defaultPort    = 9091
+	defaultHost    = "127.0.0.1"
 	defaultTimeout = "30s"
 )
 
-func getHostPort() (string, uint16) {
-	address, exists := os.LookupEnv("TR_HOST")
-	host := "127.0.0.1"
-	port := uint16(defaultPort)
+// The bittorrent clients a profile can connect to.
+const (
+	TypeTransmission = "transmission"
+	TypeQBittorrent  = "qbittorrent"
+	TypeDeluge       = "deluge"
+)
 
-	if exists {
-		x := strings.Split(address, ":")
-		host = x[0]
+// defaultEndpoints holds the default port and RPC path of each client.
+var defaultEndpoints = map[string]endpoint{
+	TypeTransmission: {port: 9091, rpcURI: "/transmission/rpc"},
+	TypeQBittorrent:  {port: 8080, rpcURI: "/"},
+	TypeDeluge:       {port: 8112, rpcURI: "/json"},
+}
 
-		if len(x) > 1 {
-			val, err := strconv.ParseInt(x[1], 10, 16)
-			if err == nil {
-				port = uint16(val)
+// profileType returns the client type of a profile.
+func profileType(profile *config.Profile) (string, error) {
+	t := strings.ToLower(profile.Type)
+	if t == "" {
+		t = TypeTransmission
+	}
+
+	if _, ok := defaultEndpoints[t]; !ok {
+		return "", fmt.Errorf("profile %s: unknown type %q (use %s, %s or %s)", profile.Name, profile.Type,
+			TypeTransmission, TypeQBittorrent, TypeDeluge)
+	}
+
+	return t, nil
+}
+
+// endpoint is where the RPC server lives.
+type endpoint struct {
+	host   string
+	port   uint16
+	https  bool
+	rpcURI string
+}
+
+// parsePort parses a TCP port number, 1 to 65535.
+func parsePort(s string) (uint16, bool) {
+	val, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || val == 0 {
+		return 0, false
+	}
+
+	return uint16(val), true
+}
+
+// parseAddress parses either "host[:port]", where an IPv6 host is bracketed
+// when followed by a port, or a full URL such as
+// "https://host[:port]/path/to/rpc" on top of the supplied endpoint.
+func parseAddress(address string, e endpoint) (endpoint, error) {
+	if !strings.Contains(address, "://") {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			// There's no port: the address is a host name or an IP address,
+			// IPv6 ones being bracketed or not.
+			host = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+			if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+				return e, fmt.Errorf("invalid address %q", address)
 			}
+
+			e.host = host
+
+			return e, nil
 		}
+
+		e.host = host
+
+		val, ok := parsePort(port)
+		if !ok {
+			return e, fmt.Errorf("invalid port in %q", address)
+		}
+
+		e.port = val
+
+		return e, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return e, fmt.Errorf("invalid URL %q: %v", address, err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		e.https = false
+		e.port = 80
+	case "https":
+		e.https = true
+		e.port = 443
+	default:
+		return e, fmt.Errorf("unsupported URL scheme %q in %q (use http or https)", u.Scheme, address)
+	}
+
+	e.host = u.Hostname()
+
+	if u.Port() != "" {
+		port, ok := parsePort(u.Port())
+		if !ok {
+			return e, fmt.Errorf("invalid port in %q", address)
+		}
+
+		e.port = port
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		e.rpcURI = u.Path
 	}
 
-	return host, port
+	return e, nil
 }
 
-func getAuth() (user string, pass string) {
-	auth, exists := os.LookupEnv("TR_AUTH")
-	if exists {
-		x := strings.Split(auth, ":")
-		user, pass = x[0], x[1]
+// getEndpoint works out where to connect to. In increasing order of precedence:
+// built in defaults (which depend on the profile type), the profile, TR_HOST
+// and finally address. It also returns the client type of the profile.
+func getEndpoint(profile *config.Profile, address string) (endpoint, string, error) {
+	kind, err := profileType(profile)
+	if err != nil {
+		return endpoint{}, "", err
+	}
+
+	defaults := defaultEndpoints[kind]
+
+	e := endpoint{
+		host:   profile.Host,
+		port:   defaults.port,
+		https:  profile.HTTPS,
+		rpcURI: profile.RPCURI,
+	}
+
+	if profile.Port != 0 {
+		port, ok := parsePort(strconv.FormatInt(profile.Port, 10))
+		if !ok {
+			return e, "", fmt.Errorf("profile %s: invalid port %d", profile.Name, profile.Port)
+		}
+
+		e.port = port
+	}
+
+	if profile.URL != "" {
+		if e, err = parseAddress(profile.URL, e); err != nil {
+			return e, "", fmt.Errorf("profile %s: %v", profile.Name, err)
+		}
+	}
+
+	if address == "" {
+		address = os.Getenv("TR_HOST")
+	}
+
+	if address != "" {
+		if e, err = parseAddress(address, e); err != nil {
+			return e, "", err
+		}
+	}
+
+	if e.host == "" {
+		e.host = defaultHost
+	}
+
+	if e.rpcURI == "" {
+		e.rpcURI = defaults.rpcURI
 	}
 
-	return
+	return e, kind, nil
 }
 
-// Connect returns a transmissionrpc.Client after connecting
-// Parses environment variables:
-//   TR_HOST: "host[:port]" (default port 9091)
-//   TR_AUTH: "user:password"
-func Connect(debug bool) *transmissionrpc.Client {
-	host, port := getHostPort()
-	user, pass := getAuth()
+func getAuth(profile *config.Profile) (user string, pass string, err error) {
+	user, pass = profile.User, profile.Password
+
+	if auth, exists := os.LookupEnv("TR_AUTH"); exists {
+		x := strings.SplitN(auth, ":", 2)
+		user, pass = x[0], ""
+
+		if len(x) > 1 {
+			pass = x[1]
+		}
+
+		return user, pass, nil
+	}
 
-	timeout, err := time.ParseDuration(defaultTimeout)
+	if pass == "" && profile.PasswordCommand != "" {
+		out, err := exec.Command("sh", "-c", profile.PasswordCommand).Output()
+		if err != nil {
+			return "", "", fmt.Errorf("password_command for profile %s failed: %v", profile.Name, err)
+		}
+
+		pass = strings.TrimRight(string(out), "\r\n")
+	}
+
+	return user, pass, nil
+}
+
+// Connect returns a backend.Backend after connecting using the given profile.
+// A non-empty address (from --host) takes precedence over everything else.
+// Environment variables override the profile:
+//
+//	TR_HOST: "host[:port]" (default port 9091, 8080 for qBittorrent, 8112 for Deluge) or a URL, e.g. "https://host/transmission/rpc"
+//	TR_AUTH: "user[:password]"
+func Connect(profile *config.Profile, address string, debug bool) (backend.Backend, error) {
+	e, kind, err := getEndpoint(profile, address)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 
-	transmissionbt, err := transmissionrpc.New(host, user, pass, &transmissionrpc.AdvancedConfig{
-		Debug:       debug,
-		HTTPS:       false,
-		Port:        port,
-		RPCURI:      "/transmission/rpc",
-		HTTPTimeout: timeout,
-		UserAgent:   "trpc"})
+	user, pass, err := getAuth(profile)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	timeoutStr := profile.Timeout
+	if timeoutStr == "" {
+		timeoutStr = defaultTimeout
 	}
 
-	ok, serverVersion, serverMinimumVersion, err := transmissionbt.RPCVersion()
+	timeout, err := time.ParseDuration(timeoutStr)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid timeout %q: %v", timeoutStr, err)
 	}
 
-	if !ok {
-		panic(fmt.Sprintf(
-			"Remote transmission RPC version (v%d) is incompatible with the transmission library (v%d): remote needs at least v%d",
-			serverVersion, transmissionrpc.RPCVersion, serverMinimumVersion))
+	switch kind {
+	case TypeQBittorrent:
+		return connectQBittorrent(profile, e, user, pass, timeout, debug)
+	case TypeDeluge:
+		return connectDeluge(profile, e, pass, timeout, debug)
 	}
 
-	return transmissionbt
+	return connectTransmission(profile, e, user, pass, timeout, debug)
 }
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shric/trpc/internal/config"
+)
+
+func TestGetEndpoint(t *testing.T) {
+	tests := []struct {
+		profile config.Profile
+		address string
+		want    endpoint
+	}{
+		{address: "", want: endpoint{"127.0.0.1", 9091, false, "/transmission/rpc"}},
+		{address: "foo", want: endpoint{"foo", 9091, false, "/transmission/rpc"}},
+		{address: "foo:1234", want: endpoint{"foo", 1234, false, "/transmission/rpc"}},
+		{address: "[::1]:1234", want: endpoint{"::1", 1234, false, "/transmission/rpc"}},
+		{address: "[::1]", want: endpoint{"::1", 9091, false, "/transmission/rpc"}},
+		{address: "::1", want: endpoint{"::1", 9091, false, "/transmission/rpc"}},
+		{address: "http://[::1]:8080", want: endpoint{"::1", 8080, false, "/transmission/rpc"}},
+		{address: "https://foo/torrents/rpc", want: endpoint{"foo", 443, true, "/torrents/rpc"}},
+		{address: "http://foo:8080", want: endpoint{"foo", 8080, false, "/transmission/rpc"}},
+		{
+			profile: config.Profile{Host: "bar", Port: 1, HTTPS: true, RPCURI: "/rpc"},
+			want:    endpoint{"bar", 1, true, "/rpc"},
+		},
+		{
+			profile: config.Profile{Type: "qbittorrent"},
+			want:    endpoint{"127.0.0.1", 8080, false, "/"},
+		},
+		{
+			profile: config.Profile{Type: "qbittorrent", URL: "https://bar/qbt"},
+			want:    endpoint{"bar", 443, true, "/qbt"},
+		},
+		{
+			profile: config.Profile{Type: "deluge", Host: "bar"},
+			want:    endpoint{"bar", 8112, false, "/json"},
+		},
+		{
+			profile: config.Profile{URL: "https://bar:8443/rpc"},
+			address: "baz",
+			want:    endpoint{"baz", 8443, true, "/rpc"},
+		},
+	}
+
+	os.Unsetenv("TR_HOST")
+
+	for _, tc := range tests {
+		got, _, err := getEndpoint(&tc.profile, tc.address)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.address, err)
+		}
+
+		if !reflect.DeepEqual(tc.want, got) {
+			t.Fatalf("%q: expected: %v, got: %v", tc.address, tc.want, got)
+		}
+	}
+}
+
+func TestGetEndpointErrors(t *testing.T) {
+	for _, address := range []string{"foo:bar", "ftp://foo", "https://foo:99999", "foo:0", "foo:", "[::1]:x", "a:b:c"} {
+		if _, _, err := getEndpoint(&config.Profile{}, address); err == nil {
+			t.Fatalf("%q: expected an error", address)
+		}
+	}
+
+	if _, _, err := getEndpoint(&config.Profile{Type: "utorrent"}, ""); err == nil {
+		t.Fatalf("unknown type: expected an error")
+	}
+
+	for _, port := range []int64{70000, -1} {
+		if _, _, err := getEndpoint(&config.Profile{Port: port}, ""); err == nil {
+			t.Fatalf("port %d: expected an error", port)
+		}
+	}
+}
+
+func TestGetAuth(t *testing.T) {
+	tests := []struct {
+		auth, user, pass string
+	}{
+		{"user:pass", "user", "pass"},
+		{"user", "user", ""},
+		{"user:pa:ss", "user", "pa:ss"},
+	}
+
+	defer os.Unsetenv("TR_AUTH")
+
+	for _, tc := range tests {
+		os.Setenv("TR_AUTH", tc.auth)
+
+		user, pass, err := getAuth(&config.Profile{})
+		if err != nil || user != tc.user || pass != tc.pass {
+			t.Fatalf("%q: expected %q/%q, got %q/%q (%v)", tc.auth, tc.user, tc.pass, user, pass, err)
+		}
+	}
+}
+
+func TestConnectUnknownAuthority(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := Connect(&config.Profile{}, server.URL+"/transmission/rpc", false)
+	if err == nil || !strings.Contains(err.Error(), "unknown authority") {
+		t.Fatalf("expected an unknown authority error, got: %v", err)
+	}
+}
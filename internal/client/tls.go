@@ -0,0 +1,92 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/shric/trpc/internal/config"
+)
+
+// errorRecorder remembers the last transport error so that TLS failures can
+// be reported with their original type, as the backends wrap them.
+type errorRecorder struct {
+	transport http.RoundTripper
+	err       error
+}
+
+func (r *errorRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		r.err = err
+	}
+
+	return resp, err
+}
+
+func tlsConfig(profile *config.Profile) (*tls.Config, error) {
+	conf := &tls.Config{
+		InsecureSkipVerify: profile.InsecureSkipVerify, // nolint:gosec // explicitly requested by the user
+	}
+
+	if profile.CAFile != "" {
+		pem, err := ioutil.ReadFile(profile.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read ca_file: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in ca_file %s", profile.CAFile)
+		}
+
+		conf.RootCAs = pool
+	}
+
+	if profile.CertFile != "" || profile.KeyFile != "" {
+		if profile.CertFile == "" || profile.KeyFile == "" {
+			return nil, errors.New("cert_file and key_file must be given together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(profile.CertFile, profile.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client certificate: %v", err)
+		}
+
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+// describeTLSError turns certificate verification failures into something
+// actionable. It returns nil if err isn't a TLS error.
+func describeTLSError(host string, err error) error {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return fmt.Errorf("TLS: the certificate of %s is signed by an unknown authority "+
+			"(set ca_file, or insecure_skip_verify if you really trust this host)", host)
+	case errors.As(err, &hostname):
+		return fmt.Errorf("TLS: %v", hostname.Error())
+	case errors.As(err, &invalid):
+		return fmt.Errorf("TLS: the certificate of %s is invalid: %v", host, invalid.Error())
+	case errors.As(err, &recordHeader):
+		return fmt.Errorf("TLS: %s doesn't appear to speak HTTPS (try http:// or https = false)", host)
+	}
+
+	return nil
+}
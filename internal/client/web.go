@@ -0,0 +1,114 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/backend/deluge"
+	"github.com/shric/trpc/internal/backend/qbittorrent"
+	"github.com/shric/trpc/internal/backend/transmission"
+	"github.com/shric/trpc/internal/config"
+)
+
+// webClient returns an HTTP client for the RPC endpoint or Web UI at e,
+// along with the URL of e and the recorder used to explain TLS failures.
+func webClient(profile *config.Profile, e endpoint, timeout time.Duration) (*http.Client, string, *errorRecorder, error) {
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, "", nil, fmt.Errorf("unexpected default HTTP transport %T", http.DefaultTransport)
+	}
+
+	transport = transport.Clone()
+
+	if e.https {
+		conf, err := tlsConfig(profile)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		transport.TLSClientConfig = conf
+	}
+
+	recorder := &errorRecorder{transport: transport}
+	scheme := "http"
+
+	if e.https {
+		scheme = "https"
+	}
+
+	u := scheme + "://" + net.JoinHostPort(e.host, strconv.Itoa(int(e.port))) + e.rpcURI
+
+	return &http.Client{Transport: recorder, Timeout: timeout}, u, recorder, nil
+}
+
+// dialer creates a backend for the RPC endpoint or Web UI at u, checking the
+// daemon answers and logging in to it when the backend has to.
+type dialer func(u string, client *http.Client) (backend.Backend, error)
+
+// connectWeb creates the backend for e with dial, explaining TLS failures.
+func connectWeb(profile *config.Profile, e endpoint, timeout time.Duration, dial dialer) (backend.Backend, error) {
+	client, u, recorder, err := webClient(profile, e, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := dial(u, client)
+	if err != nil {
+		if tlsErr := describeTLSError(e.host, recorder.err); tlsErr != nil {
+			return nil, tlsErr
+		}
+
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// connectTransmission checks that a transmission daemon speaks an RPC version
+// we understand.
+func connectTransmission(profile *config.Profile, e endpoint, user, pass string, timeout time.Duration,
+	debug bool,
+) (backend.Backend, error) {
+	return connectWeb(profile, e, timeout, func(u string, client *http.Client) (backend.Backend, error) {
+		return transmission.New(transmission.Config{
+			URL:        u,
+			User:       user,
+			Password:   pass,
+			HTTPClient: client,
+			Debug:      debug,
+		})
+	})
+}
+
+// connectQBittorrent logs in to a qBittorrent Web UI.
+func connectQBittorrent(profile *config.Profile, e endpoint, user, pass string, timeout time.Duration,
+	debug bool,
+) (backend.Backend, error) {
+	return connectWeb(profile, e, timeout, func(u string, client *http.Client) (backend.Backend, error) {
+		return qbittorrent.New(qbittorrent.Config{
+			URL:        u,
+			User:       user,
+			Password:   pass,
+			HTTPClient: client,
+			Debug:      debug,
+		})
+	})
+}
+
+// connectDeluge logs in to a Deluge Web UI. Deluge only has a password.
+func connectDeluge(profile *config.Profile, e endpoint, pass string, timeout time.Duration,
+	debug bool,
+) (backend.Backend, error) {
+	return connectWeb(profile, e, timeout, func(u string, client *http.Client) (backend.Backend, error) {
+		return deluge.New(deluge.Config{
+			URL:        u,
+			Password:   pass,
+			HTTPClient: client,
+			Debug:      debug,
+		})
+	})
+}
@@ -3,6 +3,7 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"os/user"
 	"path"
 
@@ -12,7 +13,66 @@ import (
 // Config contains all the external configuration data from .trpc.conf.
 type Config struct {
 	Trackernames map[string]string
-	Settings     *toml.Tree
+	Profiles     map[string]*Profile
+	// Formats are the named list formats of the [formats] section.
+	Formats map[string]string
+	// Filters are the named filter expressions of the [filters] section.
+	Filters  map[string]string
+	Settings *toml.Tree
+	// Errors are the entries that are skipped as they're wrong.
+	Errors []*EntryError
+}
+
+// EntryError is a wrong entry of .trpc.conf.
+type EntryError struct {
+	Section string
+	Name    string
+	Problem string
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("~/.trpc.conf: %s.%s %s, skipped", e.Section, e.Name, e.Problem)
+}
+
+// skip records a wrong entry.
+func (c *Config) skip(section, name, format string, a ...interface{}) {
+	c.Errors = append(c.Errors, &EntryError{Section: section, Name: name, Problem: fmt.Sprintf(format, a...)})
+}
+
+// Profile describes how to connect to a single daemon. Profiles are defined
+// in [profiles.<name>] sections of .trpc.conf. Type is the bittorrent client
+// ("transmission" if empty, "qbittorrent" or "deluge").
+type Profile struct {
+	Name               string `toml:"-"`
+	Type               string `toml:"type"`
+	URL                string `toml:"url"`
+	Host               string `toml:"host"`
+	Port               int64  `toml:"port"`
+	User               string `toml:"user"`
+	Password           string `toml:"password"`
+	PasswordCommand    string `toml:"password_command"`
+	RPCURI             string `toml:"rpc_uri"`
+	HTTPS              bool   `toml:"https"`
+	Timeout            string `toml:"timeout"`
+	CAFile             string `toml:"ca_file"`
+	CertFile           string `toml:"cert_file"`
+	KeyFile            string `toml:"key_file"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+}
+
+// homeDir returns $HOME, or the home directory of the current user if it
+// isn't set.
+func homeDir() (string, error) {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home, nil
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return usr.HomeDir, nil
 }
 
 // ReadConfig attempts to read ~/.trpc.conf as a toml file and returns a config tree.
@@ -21,14 +81,18 @@ func ReadConfig() *Config {
 
 	c := &Config{
 		Trackernames: make(map[string]string),
+		Profiles:     make(map[string]*Profile),
+		Formats:      make(map[string]string),
+		Filters:      make(map[string]string),
+		Settings:     &toml.Tree{},
 	}
 
-	usr, err := user.Current()
+	home, err := homeDir()
 	if err != nil {
 		return nil
 	}
 
-	TomlConfig, err = toml.LoadFile(path.Join(usr.HomeDir, ".trpc.conf"))
+	TomlConfig, err = toml.LoadFile(path.Join(home, ".trpc.conf"))
 	if err != nil {
 		return c
 	}
@@ -45,23 +109,88 @@ func ReadConfig() *Config {
 		trackers := tnames.Get(shortname)
 		switch v := trackers.(type) {
 		case string:
-			c.Trackernames[trackers.(string)] = shortname
+			c.Trackernames[v] = shortname
 		case []interface{}:
-			for _, tracker := range trackers.([]interface{}) {
-				c.Trackernames[tracker.(string)] = shortname
+			for _, tracker := range v {
+				if announce, ok := tracker.(string); ok {
+					c.Trackernames[announce] = shortname
+				} else {
+					c.skip("trackernames", shortname, "has %v, which is not a string", tracker)
+				}
 			}
 		default:
-			fmt.Printf("Unknown %T\n", v)
+			c.skip("trackernames", shortname, "is neither a string nor a list")
+		}
+	}
+
+	if profiles, ok := TomlConfig.Get("profiles").(*toml.Tree); ok {
+		for _, name := range profiles.Keys() {
+			tree, ok := profiles.Get(name).(*toml.Tree)
+			if !ok {
+				c.skip("profiles", name, "is not a table")
+				continue
+			}
+
+			profile := &Profile{}
+			if err := tree.Unmarshal(profile); err != nil {
+				c.skip("profiles", name, "is invalid: %v", err)
+				continue
+			}
+
+			profile.Name = name
+			c.Profiles[name] = profile
+		}
+	}
+
+	if formats, ok := TomlConfig.Get("formats").(*toml.Tree); ok {
+		for _, name := range formats.Keys() {
+			format, ok := formats.Get(name).(string)
+			if !ok {
+				c.skip("formats", name, "is not a string")
+				continue
+			}
+
+			c.Formats[name] = format
+		}
+	}
+
+	if filters, ok := TomlConfig.Get("filters").(*toml.Tree); ok {
+		for _, name := range filters.Keys() {
+			expr, ok := filters.Get(name).(string)
+			if !ok {
+				c.skip("filters", name, "is not a string")
+				continue
+			}
+
+			c.Filters[name] = expr
 		}
 	}
 
 	settings := TomlConfig.Get("settings")
 	if settings != nil {
 		c.Settings = settings.(*toml.Tree)
-	} else {
-		x := toml.Tree{}
-		c.Settings = &x
 	}
 
 	return c
 }
+
+// Profile returns the named connection profile. An empty name selects the
+// default_profile setting, and if that isn't set either an empty profile is
+// returned so that the built in defaults (and environment) apply.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" && c != nil && c.Settings.Has("default_profile") {
+		name, _ = c.Settings.Get("default_profile").(string)
+	}
+
+	if name == "" {
+		return &Profile{}, nil
+	}
+
+	if c != nil {
+		if profile, ok := c.Profiles[name]; ok {
+			return profile, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown profile %q (check [profiles.%s] in ~/.trpc.conf)", name, name)
+}
@@ -1,6 +1,8 @@
 package fileutils
 
 import (
+	"encoding/base64"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 )
@@ -30,3 +32,14 @@ func RealPath(filename string) string {
 
 	return filename
 }
+
+// Base64 returns the content of filename encoded as base64, as expected by
+// the metainfo field of a torrent add request.
+func Base64(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
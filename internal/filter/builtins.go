@@ -0,0 +1,261 @@
+package filter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/shric/monkey/evaluator"
+	"github.com/shric/monkey/object"
+)
+
+// function is a builtin function of the filter language.
+type function struct {
+	name string
+	// args are the names of the arguments, for documentation and checks.
+	args        []string
+	description string
+	fn          func(args []object.Object) object.Object
+}
+
+// functions are the builtins added to those of monkey (len, first...).
+var functions = []*function{
+	{
+		name: "any", args: []string{"list", "regex"},
+		description: "some element of list matches regex, e.g. `any(trackers, \"example\")`",
+		fn: func(args []object.Object) object.Object {
+			list, err := arrayArg(args, 0, "any")
+			if err != nil {
+				return err
+			}
+
+			re, err := regexArg(args, 1, "any")
+			if err != nil {
+				return err
+			}
+
+			for _, e := range list {
+				if s, ok := e.(*object.String); ok && re.MatchString(s.Value) {
+					return evaluator.TRUE
+				}
+			}
+
+			return evaluator.FALSE
+		},
+	},
+	{
+		name: "basename", args: []string{"path"},
+		description: "last element of path",
+		fn: func(args []object.Object) object.Object {
+			path, err := stringArg(args, 0, "basename")
+			if err != nil {
+				return err
+			}
+
+			return &object.String{Value: filepath.Base(path)}
+		},
+	},
+	{
+		name: "contains", args: []string{"s", "x"},
+		description: "string s contains x, or list s has an element equal to x",
+		fn: func(args []object.Object) object.Object {
+			if list, ok := args[0].(*object.Array); ok {
+				for _, e := range list.Elements {
+					if e.Inspect() == args[1].Inspect() && e.Type() == args[1].Type() {
+						return evaluator.TRUE
+					}
+				}
+
+				return evaluator.FALSE
+			}
+
+			s, err := stringArg(args, 0, "contains")
+			if err != nil {
+				return err
+			}
+
+			x, err := stringArg(args, 1, "contains")
+			if err != nil {
+				return err
+			}
+
+			return boolean(strings.Contains(s, x))
+		},
+	},
+	{
+		name: "exists", args: []string{"path"},
+		description: "path exists on this machine, e.g. `!exists(path)` for missing data",
+		fn: func(args []object.Object) object.Object {
+			path, err := stringArg(args, 0, "exists")
+			if err != nil {
+				return err
+			}
+
+			_, statErr := os.Stat(path)
+
+			return boolean(statErr == nil)
+		},
+	},
+	{
+		name: "lower", args: []string{"s"},
+		description: "s in lower case",
+		fn: func(args []object.Object) object.Object {
+			s, err := stringArg(args, 0, "lower")
+			if err != nil {
+				return err
+			}
+
+			return &object.String{Value: strings.ToLower(s)}
+		},
+	},
+	{
+		name: "matches", args: []string{"s", "regex"},
+		description: "s matches regex, e.g. `matches(name, \"(?i)ubuntu\")`",
+		fn: func(args []object.Object) object.Object {
+			s, err := stringArg(args, 0, "matches")
+			if err != nil {
+				return err
+			}
+
+			re, err := regexArg(args, 1, "matches")
+			if err != nil {
+				return err
+			}
+
+			return boolean(re.MatchString(s))
+		},
+	},
+	{
+		name: "startsWith", args: []string{"s", "prefix"},
+		description: "s starts with prefix",
+		fn: func(args []object.Object) object.Object {
+			s, err := stringArg(args, 0, "startsWith")
+			if err != nil {
+				return err
+			}
+
+			prefix, err := stringArg(args, 1, "startsWith")
+			if err != nil {
+				return err
+			}
+
+			return boolean(strings.HasPrefix(s, prefix))
+		},
+	},
+}
+
+// functionByName returns the named builtin, or nil.
+func functionByName(name string) *function {
+	for _, f := range functions {
+		if f.name == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// builtins is the environment the variables of torrents are added to.
+var builtins = func() *object.Environment {
+	env := object.NewEnvironment()
+
+	for _, f := range functions {
+		f := f
+		env.Set(f.name, &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != len(f.args) {
+				return argError(f.name, "takes %d arguments, got %d", len(f.args), len(args))
+			}
+
+			return f.fn(args)
+		}})
+	}
+
+	return env
+}()
+
+func boolean(b bool) object.Object {
+	if b {
+		return evaluator.TRUE
+	}
+
+	return evaluator.FALSE
+}
+
+func argError(name, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: name + ": " + fmt.Sprintf(format, a...)}
+}
+
+func stringArg(args []object.Object, i int, name string) (string, *object.Error) {
+	s, ok := args[i].(*object.String)
+	if !ok {
+		return "", argError(name, "argument %d must be a string, got %s", i+1, args[i].Type())
+	}
+
+	return s.Value, nil
+}
+
+func arrayArg(args []object.Object, i int, name string) ([]object.Object, *object.Error) {
+	a, ok := args[i].(*object.Array)
+	if !ok {
+		return nil, argError(name, "argument %d must be a list, got %s", i+1, args[i].Type())
+	}
+
+	return a.Elements, nil
+}
+
+// regexps are the regex arguments of builtins that are string literals, by
+// pattern. Expressions compile them, builtins only compile those they're
+// given otherwise.
+var regexps sync.Map
+
+// compileRegexp compiles pattern, once.
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexps.Store(pattern, re)
+
+	return re, nil
+}
+
+func regexArg(args []object.Object, i int, name string) (*regexp.Regexp, *object.Error) {
+	s, err := stringArg(args, i, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if re, ok := regexps.Load(s); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, compileErr := regexp.Compile(s)
+	if compileErr != nil {
+		return nil, argError(name, "%v", compileErr)
+	}
+
+	return re, nil
+}
+
+// FunctionsMarkdown documents the builtins as a Markdown table, for the
+// README.
+func FunctionsMarkdown() string {
+	var b strings.Builder
+
+	b.WriteString("| Function | Description |\n|---|---|\n")
+	b.WriteString("| `len(x)` | number of elements of list x, or of bytes of string x |\n")
+
+	for _, f := range functions {
+		fmt.Fprintf(&b, "| `%s(%s)` | %s |\n", f.name, strings.Join(f.args, ", "), f.description)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package filter
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+var update = flag.Bool("update", false, "update the function list in README.md")
+
+// The README lists the filter functions between these lines.
+const (
+	readme      = "../../README.md"
+	readmeStart = "<!-- functions: generated by go test ./internal/filter -update -->\n"
+	readmeEnd   = "<!-- end of functions -->\n"
+)
+
+func TestREADMEFunctions(t *testing.T) {
+	content, err := ioutil.ReadFile(readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := string(content)
+	start := strings.Index(text, readmeStart)
+	end := strings.Index(text, readmeEnd)
+
+	if start < 0 || end < start {
+		t.Fatalf("%s has no function list", readme)
+	}
+
+	want := text[:start+len(readmeStart)] + FunctionsMarkdown() + text[end:]
+
+	if *update {
+		if err := ioutil.WriteFile(readme, []byte(want), 0o644); err != nil { // nolint:gosec
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	if text != want {
+		t.Errorf("the function list of %s is out of date, run go test ./internal/filter -update", readme)
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "ubuntu.iso"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "ubuntu.iso"
+	missing := "debian.iso"
+	torrent := &backend.Torrent{
+		Name:        &name,
+		DownloadDir: &dir,
+		Trackers:    []*backend.Tracker{{Announce: "https://tracker.example.org/announce"}},
+		Files:       []*backend.File{{Name: "ubuntu/ubuntu.iso"}, {Name: "ubuntu/README"}},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`any(trackers, "example")`, true},
+		{`any(trackers, "^example")`, false},
+		{`any(files, "(?i)readme$")`, true},
+		{`basename(path) == name`, true},
+		{`contains(name, "bun")`, true},
+		{`contains(files, "ubuntu/README")`, true},
+		{`contains(files, "README")`, false},
+		{`exists(path)`, true},
+		{`exists(downloadDir + "/` + missing + `")`, false},
+		{`lower("UbUnTu") == "ubuntu"`, true},
+		{`matches(name, "[.]iso$")`, true},
+		{`startsWith(path, downloadDir)`, true},
+		{`startsWith(name, "debian")`, false},
+		{`len(files) == 2`, true},
+	}
+
+	for _, tt := range tests {
+		f, err := New(Options{Filter: []string{tt.expr}}, nil)
+		if err != nil {
+			t.Errorf("New(%q) error = %v", tt.expr, err)
+			continue
+		}
+
+		got, err := f.CheckFilter(torrent)
+		if err != nil {
+			t.Errorf("CheckFilter(%q) error = %v", tt.expr, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("CheckFilter(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	name := "ubuntu.iso"
+	torrent := &backend.Torrent{Name: &name}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`lower(1) == ""`, `invalid filter expression "lower(1) == \"\"": lower: argument 1 must be a string, got INTEGER`},
+		{`any(name, "x")`, `invalid filter expression "any(name, \"x\")": any: argument 1 must be a list, got STRING`},
+		{`matches(name, name + "(")`, "invalid filter expression \"matches(name, name + \\\"(\\\")\": " +
+			"matches: error parsing regexp: missing closing ): `ubuntu.iso(`"},
+	}
+
+	for _, tt := range tests {
+		f, err := New(Options{Filter: []string{tt.expr}}, nil)
+		if err != nil {
+			t.Errorf("New(%q) error = %v", tt.expr, err)
+			continue
+		}
+
+		if _, err := f.CheckFilter(torrent); err == nil || err.Error() != tt.want {
+			t.Errorf("CheckFilter(%q) error = %v, want %s", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestRegexLiterals(t *testing.T) {
+	if _, err := New(Options{Filter: []string{`matches(name, "^[a-z]+[.]iso$")`}}, nil); err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Literals are compiled along with the expression, other arguments as
+	// the expression runs.
+	if _, ok := regexps.Load("^[a-z]+[.]iso$"); !ok {
+		t.Errorf("regex literal wasn't compiled with the expression")
+	}
+}
@@ -0,0 +1,421 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shric/monkey/ast"
+	"github.com/shric/monkey/evaluator"
+	"github.com/shric/monkey/lexer"
+	"github.com/shric/monkey/object"
+	"github.com/shric/monkey/parser"
+	"github.com/shric/monkey/token"
+
+	"github.com/shric/trpc/internal/torrent"
+)
+
+// SyntaxError is an invalid filter expression, with the position of what's
+// wrong with it.
+type SyntaxError struct {
+	Expression string
+	// Offset is the byte offset in Expression of the offending token.
+	Offset  int
+	Message string
+}
+
+// Error shows the expression with a marker under the offending token.
+func (e *SyntaxError) Error() string {
+	column := utf8.RuneCountInString(e.Expression[:e.Offset])
+
+	return fmt.Sprintf("invalid filter expression: %s\n    %s\n    %s^",
+		e.Message, e.Expression, strings.Repeat(" ", column))
+}
+
+// expression is a parsed filter expression.
+type expression struct {
+	source  string
+	program *ast.Program
+	// variables are the variables the expression refers to, builtins aside.
+	variables []string
+}
+
+// torrentVariable tells if name is a variable of torrent filters.
+func torrentVariable(name string) bool {
+	return torrent.FieldByName(name) != nil
+}
+
+// fileVariable tells if name is a variable of file filters.
+func fileVariable(name string) bool {
+	return torrent.FileFieldByName(name) != nil
+}
+
+// positioned is a token and where it is in the expression.
+type positioned struct {
+	token.Token
+	start, end int
+}
+
+// tokenize lexes source like the parser does, keeping track of where tokens
+// are as the lexer doesn't.
+func tokenize(source string) []positioned {
+	var tokens []positioned
+
+	l := lexer.New(source)
+	pos := 0
+
+	for {
+		tok := l.NextToken()
+
+		for pos < len(source) && strings.ContainsRune(" \t\n\r", rune(source[pos])) {
+			pos++
+		}
+
+		length := len(tok.Literal)
+
+		switch tok.Type {
+		case token.EOF:
+			return append(tokens, positioned{tok, len(source), len(source)})
+		case token.STRING:
+			length += 2
+		}
+
+		end := pos + length
+		if end > len(source) {
+			end = len(source)
+		}
+
+		tokens = append(tokens, positioned{tok, pos, end})
+		pos = end
+	}
+}
+
+// parse parses source, returning the first parser error if any.
+func parse(source string) (*ast.Program, string) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return nil, p.Errors()[0]
+	}
+
+	return program, ""
+}
+
+// compile parses and checks a filter expression, which can refer to the
+// named filters of a and to the variables known tells about.
+func compile(source string, a *aliases, known func(name string) bool) (*expression, error) {
+	e, err := expand(source, a)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := tokenize(e.source)
+
+	// Tokens are where they are in the expanded expression, errors point
+	// into the original one.
+	syntaxError := func(tok positioned, msg string) error {
+		return &SyntaxError{source, e.original(tok.start), msg}
+	}
+
+	for _, tok := range tokens {
+		text := e.source[tok.start:tok.end]
+		if tok.Type == token.STRING && (len(text) < 2 || !strings.HasSuffix(text, `"`)) {
+			return nil, syntaxError(tok, "unterminated string")
+		}
+	}
+
+	program, msg := parse(e.source)
+	if msg != "" {
+		tok := errorToken(e.source, tokens, msg)
+		return nil, syntaxError(tok, describe(msg, source[e.original(tok.start):e.original(tok.end)], tok))
+	}
+
+	if len(program.Statements) == 0 {
+		return nil, &SyntaxError{source, 0, "empty expression"}
+	}
+
+	// The value of a program is that of its last statement. Others can only
+	// be lets, the parser takes "1d 2h" for two statements.
+	for i, statement := range program.Statements[:len(program.Statements)-1] {
+		if _, ok := statement.(*ast.LetStatement); !ok {
+			tok := statementToken(e.source, tokens, i+1)
+			return nil, syntaxError(tok, "unexpected "+source[e.original(tok.start):e.original(tok.end)])
+		}
+	}
+
+	expr := &expression{source: source, program: program}
+
+	for _, name := range variables(program) {
+		if known(name) {
+			expr.variables = append(expr.variables, name)
+			continue
+		}
+
+		if builtin(name) {
+			continue
+		}
+
+		for _, tok := range tokens {
+			if tok.Type == token.IDENT && tok.Literal == name {
+				return nil, syntaxError(tok, "unknown variable "+name)
+			}
+		}
+	}
+
+	if name, msg := badCall(program); msg != "" {
+		for _, tok := range tokens {
+			if tok.Type == token.IDENT && tok.Literal == name {
+				return nil, syntaxError(tok, msg)
+			}
+		}
+	}
+
+	if pattern, msg := compileRegexps(program); msg != "" {
+		for _, tok := range tokens {
+			if tok.Type == token.STRING && tok.Literal == pattern {
+				return nil, syntaxError(tok, msg)
+			}
+		}
+	}
+
+	return expr, nil
+}
+
+// errorToken finds the token the parser complained about with msg: the last
+// of the shortest leading tokens that make the parser say the same.
+func errorToken(source string, tokens []positioned, msg string) positioned {
+	eof := tokens[len(tokens)-1]
+
+	if strings.Contains(msg, token.Type(token.EOF).String()) {
+		return eof
+	}
+
+	for _, tok := range tokens {
+		if _, m := parse(source[:tok.end]); m == msg {
+			return tok
+		}
+	}
+
+	return eof
+}
+
+// statementToken returns the first token of statement n of source.
+func statementToken(source string, tokens []positioned, n int) positioned {
+	for _, tok := range tokens {
+		if program, _ := parse(source[:tok.end]); program != nil && len(program.Statements) > n {
+			return tok
+		}
+	}
+
+	return tokens[len(tokens)-1]
+}
+
+var (
+	peekError   = regexp.MustCompile(`^expected next token to be (\S+), got \S+ instead$`)
+	prefixError = regexp.MustCompile(`^no prefix parse function for \S+ found$`)
+)
+
+// describe rewrites the parser error msg about tok, which is text in the
+// expression, in terms of the expression.
+func describe(msg, text string, tok positioned) string {
+	got := text
+	if tok.Type == token.EOF {
+		got = "end of expression"
+	}
+
+	if m := peekError.FindStringSubmatch(msg); m != nil {
+		return fmt.Sprintf("expected %s, got %s", tokenName(m[1]), got)
+	}
+
+	if prefixError.MatchString(msg) {
+		return "unexpected " + got
+	}
+
+	return msg
+}
+
+// tokenName returns what a token type the parser names is. The parser is off
+// by one from the ( token on.
+func tokenName(name string) string {
+	for t := token.Type(token.LPAREN); t < token.NUMERIC_SUFFIX; t++ {
+		if t.String() == name {
+			return strings.ToLower((t + 1).String())
+		}
+	}
+
+	return name
+}
+
+// inspect calls visit for node and every node under it.
+func inspect(node ast.Node, visit func(ast.Node)) {
+	walk := func(nodes ...ast.Node) {
+		for _, n := range nodes {
+			inspect(n, visit)
+		}
+	}
+
+	switch n := node.(type) {
+	case nil:
+		return
+	case *ast.BlockStatement:
+		if n == nil {
+			return
+		}
+	}
+
+	visit(node)
+
+	switch n := node.(type) {
+	case *ast.Program:
+		for _, s := range n.Statements {
+			walk(s)
+		}
+	case *ast.BlockStatement:
+		for _, s := range n.Statements {
+			walk(s)
+		}
+	case *ast.ExpressionStatement:
+		walk(n.Expression)
+	case *ast.LetStatement:
+		walk(n.Value)
+	case *ast.ReturnStatement:
+		walk(n.ReturnValue)
+	case *ast.PrefixExpression:
+		walk(n.Right)
+	case *ast.InfixExpression:
+		walk(n.Left, n.Right)
+	case *ast.IfExpression:
+		walk(n.Condition, n.Consequence, n.Alternative)
+	case *ast.FunctionLiteral:
+		walk(n.Body)
+	case *ast.CallExpression:
+		walk(n.Function)
+
+		for _, a := range n.Arguments {
+			walk(a)
+		}
+	case *ast.ArrayLiteral:
+		for _, e := range n.Elements {
+			walk(e)
+		}
+	case *ast.IndexExpression:
+		walk(n.Left, n.Index)
+	case *ast.HashLiteral:
+		for k, v := range n.Pairs {
+			walk(k, v)
+		}
+	}
+}
+
+// variables returns the identifiers of a program that aren't bound by let or
+// fn, in order of appearance.
+func variables(program *ast.Program) []string {
+	var used []string
+
+	bound := make(map[string]bool)
+
+	inspect(program, func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			bound[n.Name.Value] = true
+		case *ast.FunctionLiteral:
+			for _, p := range n.Parameters {
+				bound[p.Value] = true
+			}
+		case *ast.Identifier:
+			used = append(used, n.Value)
+		}
+	})
+
+	var free []string
+
+	seen := make(map[string]bool)
+
+	for _, name := range used {
+		if !bound[name] && !seen[name] {
+			free = append(free, name)
+			seen[name] = true
+		}
+	}
+
+	return free
+}
+
+// badCall returns the first call of a builtin of the filter language with the
+// wrong number of arguments, and what's wrong with it.
+func badCall(program *ast.Program) (string, string) {
+	var name, msg string
+
+	inspect(program, func(node ast.Node) {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || msg != "" {
+			return
+		}
+
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return
+		}
+
+		if f := functionByName(ident.Value); f != nil && len(call.Arguments) != len(f.args) {
+			name = ident.Value
+			msg = fmt.Sprintf("%s(%s) takes %d arguments, got %d",
+				f.name, strings.Join(f.args, ", "), len(f.args), len(call.Arguments))
+		}
+	})
+
+	return name, msg
+}
+
+// compileRegexps compiles the regex arguments of builtins that are string
+// literals, so that they are compiled once rather than for every torrent. It
+// returns the first that doesn't compile, and what's wrong with it.
+func compileRegexps(program *ast.Program) (string, string) {
+	var pattern, msg string
+
+	inspect(program, func(node ast.Node) {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || msg != "" {
+			return
+		}
+
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return
+		}
+
+		f := functionByName(ident.Value)
+		if f == nil {
+			return
+		}
+
+		for i, arg := range f.args {
+			if arg != "regex" || i >= len(call.Arguments) {
+				continue
+			}
+
+			literal, ok := call.Arguments[i].(*ast.StringLiteral)
+			if !ok {
+				continue
+			}
+
+			if _, err := compileRegexp(literal.Value); err != nil {
+				pattern = literal.Value
+				msg = fmt.Sprintf("%s: %v", f.name, err)
+
+				return
+			}
+		}
+	})
+
+	return pattern, msg
+}
+
+// builtin tells if name is a builtin function.
+func builtin(name string) bool {
+	_, isError := evaluator.Eval(&ast.Identifier{Value: name}, builtins).(*object.Error)
+
+	return !isError
+}
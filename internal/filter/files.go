@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"github.com/shric/monkey/object"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+// FileFilter selects files of torrents with expressions over the file
+// variables (name, ext, length...).
+type FileFilter struct {
+	expressions []*expression
+	// fields are the file fields the expressions refer to.
+	fields []*torrent.FileField
+}
+
+// NewFileFilter returns a filter matching the files for which all
+// expressions are true. Without expressions every file matches.
+func NewFileFilter(expressions []string) (*FileFilter, error) {
+	filter := &FileFilter{}
+
+	for _, source := range expressions {
+		// Named filters are torrent filters, so there are none to refer to.
+		expr, err := compile(source, nil, fileVariable)
+		if err != nil {
+			return nil, err
+		}
+
+		filter.expressions = append(filter.expressions, expr)
+	}
+
+	filter.fields = fileFieldsOf(filter.expressions)
+
+	return filter, nil
+}
+
+// Match tells if file i of a torrent matches. The torrent needs its files,
+// priorities and wanted fields.
+func (f *FileFilter) Match(t *backend.Torrent, i int) (bool, error) {
+	if len(f.expressions) == 0 {
+		return true, nil
+	}
+
+	return check(f.expressions, fileEnv(f.fields, t, i))
+}
+
+// fileFieldsOf returns the file fields expressions refer to.
+func fileFieldsOf(expressions []*expression) []*torrent.FileField {
+	var fields []*torrent.FileField
+
+	seen := make(map[string]bool)
+
+	for _, expr := range expressions {
+		for _, name := range expr.variables {
+			if !seen[name] {
+				seen[name] = true
+				fields = append(fields, torrent.FileFieldByName(name))
+			}
+		}
+	}
+
+	return fields
+}
+
+// fileEnv returns the values of fields for file i of a torrent, along with
+// the builtins, as the variables of expressions.
+func fileEnv(fields []*torrent.FileField, t *backend.Torrent, i int) *object.Environment {
+	env := object.NewEnclosedEnvironment(builtins)
+
+	for _, field := range fields {
+		env.Set(field.Name, toObject(field.Value(t, i)))
+	}
+
+	return env
+}
+
+// Files returns the indexes of the files of a torrent that match.
+func (f *FileFilter) Files(t *backend.Torrent) ([]int, error) {
+	var files []int
+
+	for i := range t.Files {
+		match, err := f.Match(t, i)
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			files = append(files, i)
+		}
+	}
+
+	return files, nil
+}
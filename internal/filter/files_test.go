@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+func TestFileFilter(t *testing.T) {
+	name := "Album"
+	torrent := &backend.Torrent{
+		Name: &name,
+		Files: []*backend.File{
+			{Name: "Album/01 Intro.flac", Length: 10 << 20, BytesCompleted: 10 << 20},
+			{Name: "Album/02 Song.FLAC", Length: 20 << 20, BytesCompleted: 5 << 20},
+			{Name: "Album/album.nfo", Length: 1000},
+			{Name: "Album/Sample/sample.flac", Length: 1 << 20},
+		},
+		Priorities: []int64{0, 1, -1, 0},
+		Wanted:     []bool{true, true, false, true},
+	}
+
+	tests := []struct {
+		exprs []string
+		want  []int
+	}{
+		{nil, []int{0, 1, 2, 3}},
+		{[]string{`ext == "flac"`}, []int{0, 1, 3}},
+		{[]string{`ext == "flac"`, "progress < 100"}, []int{1, 3}},
+		{[]string{"length > 5 MiB && bytesCompleted < length"}, []int{1}},
+		{[]string{`priority == "high" || !wanted`}, []int{1, 2}},
+		{[]string{`name == "album.nfo" || matches(name, "(?i)^sample/")`}, []int{2, 3}},
+		{[]string{"length > 1 TiB"}, nil},
+	}
+
+	for _, tt := range tests {
+		f, err := NewFileFilter(tt.exprs)
+		if err != nil {
+			t.Errorf("NewFileFilter(%q) error = %v", tt.exprs, err)
+			continue
+		}
+
+		got, err := f.Files(torrent)
+		if err != nil {
+			t.Errorf("Files(%q) error = %v", tt.exprs, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Files(%q) = %v, want %v", tt.exprs, got, tt.want)
+		}
+	}
+}
+
+func TestFileFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"ratio > 1", "invalid filter expression: unknown variable ratio\n" +
+			"    ratio > 1\n" +
+			"    ^"},
+		{"@big", "invalid filter expression: unknown filter @big (check [filters] in ~/.trpc.conf)\n" +
+			"    @big\n" +
+			"    ^"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewFileFilter([]string{tt.expr})
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("NewFileFilter(%q) error =\n%v\nwant\n%s", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -2,8 +2,6 @@ package filter
 
 import (
 	"fmt"
-	"net/url"
-	"os"
 
 	"github.com/shric/trpc/internal/fileutils"
 
@@ -11,17 +9,16 @@ import (
 
 	"github.com/shric/trpc/internal/config"
 
+	"github.com/shric/trpc/internal/backend"
+
 	"github.com/shric/monkey/evaluator"
-	"github.com/shric/monkey/lexer"
 	"github.com/shric/monkey/object"
-	"github.com/shric/monkey/parser"
-
-	"github.com/hekmon/transmissionrpc"
 )
 
 // Options declares all the command line arguments for filtering torrents.
 type Options struct {
 	Filter      []string `short:"f" long:"filter" description:"apply filter expression" unquote:"false"`
+	Named       []string `short:"F" long:"named" description:"apply a named filter from [filters] in ~/.trpc.conf"`
 	Incomplete  bool     `short:"i" long:"incomplete" description:"only incomplete torrents"`
 	Complete    bool     `short:"c" long:"complete" description:"only complete torrents"`
 	Active      bool     `short:"a" long:"active" description:"torrents currently uploading or downloading"`
@@ -34,14 +31,22 @@ type Options struct {
 // Instance is used to hold all data required for a filter.
 type Instance struct {
 	conf        *config.Config
-	expressions []string
-	Args        []string
+	expressions []*expression
+	// fields are the torrent fields the expressions refer to.
+	fields []*torrent.Field
+	// Args are the torrent-get fields needed to evaluate the expressions.
+	Args []string
 }
 
-// New returns a new filter based on the options passed.
-func New(opts Options, conf *config.Config) *Instance {
+// New returns a new filter based on the options passed. Expressions are
+// parsed here, once, so that mistakes are reported before anything is asked
+// of the daemon.
+func New(opts Options, conf *config.Config) (*Instance, error) {
 	expressions := opts.Filter
-	args := make([]string, 0)
+
+	for _, name := range opts.Named {
+		expressions = append(expressions, "@"+name)
+	}
 
 	if opts.Complete {
 		expressions = append(expressions, "complete")
@@ -71,99 +76,118 @@ func New(opts Options, conf *config.Config) *Instance {
 		expressions = append(expressions, fmt.Sprintf("name ~ \"%s\"", opts.Name))
 	}
 
-	filter := Instance{
-		conf:        conf,
-		expressions: expressions,
-		Args:        args,
+	filter := Instance{conf: conf}
+
+	named := newAliases(conf)
+
+	for _, source := range expressions {
+		expr, err := compile(source, named, torrentVariable)
+		if err != nil {
+			return nil, err
+		}
+
+		filter.expressions = append(filter.expressions, expr)
 	}
 
-	return &filter
+	filter.fields, filter.Args = fieldsOf(filter.expressions)
+
+	return &filter, nil
 }
 
-func (f *Instance) envForTorrent(t *transmissionrpc.Torrent) *object.Environment {
-	env := object.NewEnvironment()
+// fieldsOf returns the torrent fields expressions refer to, and the
+// torrent-get fields needed to evaluate them.
+func fieldsOf(expressions []*expression) ([]*torrent.Field, []string) {
+	var fields []*torrent.Field
 
-	if *t.LeftUntilDone == 0 {
-		env.Set("complete", evaluator.TRUE)
-		env.Set("incomplete", evaluator.FALSE)
-	} else {
-		env.Set("complete", evaluator.FALSE)
-		env.Set("incomplete", evaluator.TRUE)
-	}
+	args := make([]string, 0)
+	seen := make(map[string]bool)
+	asked := make(map[string]bool)
 
-	env.Set("size", &object.Integer{Value: int64(t.SizeWhenDone.Byte())})
+	for _, expr := range expressions {
+		for _, name := range expr.variables {
+			if seen[name] {
+				continue
+			}
 
-	trackers := make([]object.Object, len(t.Trackers))
-	trackerStrings := make([]object.String, len(t.Trackers))
+			seen[name] = true
+			field := torrent.FieldByName(name)
+			fields = append(fields, field)
 
-	for i, tracker := range t.Trackers {
-		URL, err := url.Parse(tracker.Announce)
-		if err != nil {
-			continue
+			for _, rpc := range field.RPC {
+				if !asked[rpc] {
+					asked[rpc] = true
+					args = append(args, rpc)
+				}
+			}
 		}
-
-		trackerStrings[i] = object.String{Value: URL.Hostname()}
-		trackers[i] = &trackerStrings[i]
 	}
 
-	env.Set("trackers", &object.Array{Elements: trackers})
-	env.Set("tracker", &object.String{Value: torrent.TrackerShortName(t, f.conf)})
-	env.Set("down", &object.Integer{Value: *t.RateDownload})
-	env.Set("up", &object.Integer{Value: *t.RateUpload})
-	env.Set("age", &object.Integer{Value: torrent.Age(t)})
-	env.Set("downloadDir", &object.String{Value: *t.DownloadDir})
-	env.Set("priority", &object.String{Value: torrent.Priority(t)})
-
-	status, _ := torrent.Status(t)
+	return fields, args
+}
 
-	env.Set("status", &object.String{Value: status})
-	env.Set("name", &object.String{Value: *t.Name})
+// torrentEnv returns the values of fields for a torrent, along with the
+// builtins, as the variables of expressions.
+func torrentEnv(fields []*torrent.Field, t *backend.Torrent, conf *config.Config) *object.Environment {
+	env := object.NewEnclosedEnvironment(builtins)
 
-	if *t.Error != 0 {
-		env.Set("error", &object.String{Value: *t.ErrorString})
-	} else {
-		env.Set("error", &object.String{Value: ""})
+	for _, field := range fields {
+		env.Set(field.Name, toObject(field.ValueOf(t, conf)))
 	}
 
 	return env
 }
 
-// CheckFilter checks if the supplied torrent matches after filters.
-func (f *Instance) CheckFilter(torrent *transmissionrpc.Torrent) bool {
-	env := f.envForTorrent(torrent)
+// toObject converts the value of a torrent field to a filter language object.
+func toObject(value interface{}) object.Object {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return evaluator.TRUE
+		}
 
-	for _, expr := range f.expressions {
-		l := lexer.New(expr)
-		p := parser.New(l)
-		program := p.ParseProgram()
+		return evaluator.FALSE
+	case int64:
+		return &object.Integer{Value: v}
+	case float64:
+		return &object.Float{Value: v}
+	case []string:
+		elements := make([]object.Object, len(v))
+		for i, s := range v {
+			elements[i] = &object.String{Value: s}
+		}
 
-		if len(p.Errors()) != 0 {
-			fmt.Fprintln(os.Stderr, "Filter parser error(s):")
+		return &object.Array{Elements: elements}
+	default:
+		return &object.String{Value: fmt.Sprint(v)}
+	}
+}
 
-			for _, msg := range p.Errors() {
-				fmt.Fprintln(os.Stderr, "\t", msg)
-			}
+// CheckFilter checks if the supplied torrent matches after filters. It fails
+// if an expression can't be evaluated for the torrent.
+func (f *Instance) CheckFilter(torrent *backend.Torrent) (bool, error) {
+	if len(f.expressions) == 0 {
+		return true, nil
+	}
 
-			fmt.Println(program.String())
-			os.Exit(1)
-		}
+	// Only the fields in Args have been asked for, so only those are set.
+	return check(f.expressions, torrentEnv(f.fields, torrent, f.conf))
+}
 
-		result := evaluator.Eval(program, env)
-		switch v := result.(type) {
+// check evaluates expressions in env, telling if they're all true.
+func check(expressions []*expression, env *object.Environment) (bool, error) {
+	for _, expr := range expressions {
+		switch v := evaluator.Eval(expr.program, env).(type) {
 		case *object.Boolean:
 			if !v.Value {
-				return false
+				return false, nil
 			}
-
-			continue
 		case *object.Error:
-			fmt.Fprintf(os.Stderr, "Invalid filter expression: %s\n", v.Message)
-			os.Exit(1)
+			return false, fmt.Errorf("invalid filter expression %q: %s", expr.source, v.Message)
 		default:
-			fmt.Fprintf(os.Stderr, "Invalid filter expression: doesn't evaluate to boolean: %q\n", v)
-			os.Exit(1)
+			return false, fmt.Errorf("invalid filter expression %q: doesn't evaluate to boolean: %s",
+				expr.source, v.Inspect())
 		}
 	}
 
-	return true
+	return true, nil
 }
@@ -0,0 +1,100 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"size > > 3", "invalid filter expression: unexpected >\n" +
+			"    size > > 3\n" +
+			"           ^"},
+		{"(size > 3", "invalid filter expression: expected ), got end of expression\n" +
+			"    (size > 3\n" +
+			"             ^"},
+		{"complete & up > 0", "invalid filter expression: unexpected &\n" +
+			"    complete & up > 0\n" +
+			"             ^"},
+		{"len(trackers > 1", "invalid filter expression: expected ), got end of expression\n" +
+			"    len(trackers > 1\n" +
+			"                    ^"},
+		{"[1, 2 3]", "invalid filter expression: expected ], got 3\n" +
+			"    [1, 2 3]\n" +
+			"          ^"},
+		{`name == "ubuntu`, "invalid filter expression: unterminated string\n" +
+			"    name == \"ubuntu\n" +
+			"            ^"},
+		{`nmae == "ubuntu"`, "invalid filter expression: unknown variable nmae\n" +
+			"    nmae == \"ubuntu\"\n" +
+			"    ^"},
+		{`"é" == name && sise > 1`, "invalid filter expression: unknown variable sise\n" +
+			"    \"é\" == name && sise > 1\n" +
+			"                   ^"},
+		{`size > 1 && startsWith(name)`, "invalid filter expression: startsWith(s, prefix) takes 2 arguments, got 1\n" +
+			"    size > 1 && startsWith(name)\n" +
+			"                ^"},
+		{`lowr(name) == "x"`, "invalid filter expression: unknown variable lowr\n" +
+			"    lowr(name) == \"x\"\n" +
+			"    ^"},
+		{`size > 1 && any(trackers, "(?i)ubuntu") && matches(name, "(")`,
+			"invalid filter expression: matches: error parsing regexp: missing closing ): `(`\n" +
+				"    size > 1 && any(trackers, \"(?i)ubuntu\") && matches(name, \"(\")\n" +
+				"                                                             ^"},
+		{" ", "invalid filter expression: empty expression\n" +
+			"     \n" +
+			"    ^"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(Options{Filter: []string{tt.expr}}, nil)
+		if err == nil {
+			t.Errorf("New(%q) error = nil, want %q", tt.expr, tt.want)
+			continue
+		}
+
+		if err.Error() != tt.want {
+			t.Errorf("New(%q) error =\n%s\nwant\n%s", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestNewValid(t *testing.T) {
+	for _, expr := range []string{
+		"complete",
+		"up > 0 || down > 0",
+		`tracker ~ "foo" && len(trackers) > 1`,
+		"let big = size > 1000; big",
+		`!exists(path) && any(trackers, "example")`,
+	} {
+		if _, err := New(Options{Filter: []string{expr}}, nil); err != nil {
+			t.Errorf("New(%q) error = %v", expr, err)
+		}
+	}
+}
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want []string
+	}{
+		{Options{}, []string{}},
+		{Options{Filter: []string{"complete"}}, []string{"leftUntilDone"}},
+		{Options{Filter: []string{"complete || incomplete", "let n = name; n == \"x\""}}, []string{"leftUntilDone", "name"}},
+		{Options{Active: true, Name: "x"}, []string{"rateUpload", "rateDownload", "name"}},
+	}
+
+	for _, tt := range tests {
+		f, err := New(tt.opts, nil)
+		if err != nil {
+			t.Fatalf("New(%+v) error = %v", tt.opts, err)
+		}
+
+		if !reflect.DeepEqual(f.Args, tt.want) {
+			t.Errorf("New(%+v).Args = %v, want %v", tt.opts, f.Args, tt.want)
+		}
+	}
+}
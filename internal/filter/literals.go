@@ -0,0 +1,173 @@
+package filter
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shric/trpc/internal/torrent"
+)
+
+// Literals of the filter language the parser knows nothing about. They're
+// replaced by the numbers they stand for before parsing.
+var (
+	dateLiteral = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2})?)?`)
+	sizeLiteral = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(B|KB|KiB|MB|MiB|GB|GiB|TB|TiB)(/s)?`)
+	timeLiteral = regexp.MustCompile(`^(\d+(?:\.\d+)?)(s|m|h|d|w)`)
+)
+
+// durations are the lengths of the units of duration literals.
+var durations = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// dateLayouts are the layouts of date literals, by length.
+var dateLayouts = map[int]string{
+	len("2006-01-02"):          "2006-01-02",
+	len("2006-01-02T15:04"):    "2006-01-02T15:04",
+	len("2006-01-02T15:04:05"): "2006-01-02T15:04:05",
+}
+
+// replacement is a literal replaced by a number, or a reference to a named
+// filter replaced by its expression.
+type replacement struct {
+	// from and to delimit the literal in the original expression, at and end
+	// the number in the expanded one.
+	from, to, at, end int
+}
+
+// expanded is an expression with its literals replaced.
+type expanded struct {
+	source       string
+	replacements []replacement
+}
+
+// original returns the offset in the original expression of an offset in the
+// expanded one.
+func (e *expanded) original(offset int) int {
+	shift := 0
+
+	for _, r := range e.replacements {
+		if offset < r.at {
+			break
+		}
+
+		if offset < r.end {
+			return r.from
+		}
+
+		shift = r.to - r.end
+	}
+
+	return offset + shift
+}
+
+// identChar tells if c can be part of an identifier or a number, so that a
+// literal can't start after it.
+func identChar(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// literal returns the length and value of the literal at the start of s, or
+// 0 if there's none. Units must not run into an identifier.
+func literal(s string) (int, int64, bool) {
+	ends := func(n int) bool { return n == len(s) || !identChar(s[n]) }
+
+	if m := dateLiteral.FindString(s); m != "" && ends(len(m)) {
+		date, err := time.ParseInLocation(dateLayouts[len(m)], m, time.Local)
+		if err != nil {
+			return len(m), 0, false
+		}
+
+		return len(m), date.Unix(), true
+	}
+
+	if m := sizeLiteral.FindStringSubmatch(s); m != nil && ends(len(m[0])) {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		return len(m[0]), int64(math.Round(n * float64(torrent.Units[m[2]]))), true
+	}
+
+	if m := timeLiteral.FindStringSubmatch(s); m != nil && ends(len(m[0])) {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		return len(m[0]), int64(math.Round(n * durations[m[2]].Seconds())), true
+	}
+
+	return 0, 0, true
+}
+
+// expand replaces the size, rate, duration and date literals of source by
+// numbers: bytes, bytes per second, seconds and seconds since the epoch.
+// References to named filters are replaced by their expressions.
+func expand(source string, a *aliases) (*expanded, error) {
+	var b strings.Builder
+
+	e := &expanded{}
+
+	for i := 0; i < len(source); {
+		if source[i] == '"' {
+			end := strings.IndexByte(source[i+1:], '"')
+			if end < 0 {
+				end = len(source)
+			} else {
+				end += i + 2
+			}
+
+			b.WriteString(source[i:end])
+			i = end
+
+			continue
+		}
+
+		if source[i] == '@' {
+			m := namedRef.FindStringSubmatch(source[i:])
+			if m == nil {
+				return nil, &SyntaxError{source, i, "expected a filter name after @"}
+			}
+
+			body, err := a.expand(source, i, m[1])
+			if err != nil {
+				return nil, err
+			}
+
+			e.replacements = append(e.replacements, replacement{i, i + len(m[0]), b.Len(), b.Len() + len(body)})
+			b.WriteString(body)
+			i += len(m[0])
+
+			continue
+		}
+
+		if i > 0 && identChar(source[i-1]) {
+			b.WriteByte(source[i])
+			i++
+
+			continue
+		}
+
+		n, value, ok := literal(source[i:])
+		if !ok {
+			return nil, &SyntaxError{source, i, "invalid date " + source[i:i+n]}
+		}
+
+		if n == 0 {
+			b.WriteByte(source[i])
+			i++
+
+			continue
+		}
+
+		number := strconv.FormatInt(value, 10)
+		e.replacements = append(e.replacements, replacement{i, i + n, b.Len(), b.Len() + len(number)})
+		b.WriteString(number)
+		i += n
+	}
+
+	e.source = b.String()
+
+	return e, nil
+}
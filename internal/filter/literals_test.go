@@ -0,0 +1,83 @@
+package filter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	date := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+	dateTime := time.Date(2026, 1, 1, 12, 30, 0, 0, time.Local).Unix()
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"size > 1 GiB", "size > 1073741824"},
+		{"size > 1.5GB && size < 2 TiB", "size > 1500000000 && size < 2199023255552"},
+		{"up > 500 KiB/s", "up > 512000"},
+		{"down < 10KB/s", "down < 10000"},
+		{"age > 30d || eta < 2h", "age > 2592000 || eta < 7200"},
+		{"age > 1w && age < 90m", "age > 604800 && age < 5400"},
+		{"addedDate < 2026-01-01", "addedDate < " + strconv.FormatInt(date, 10)},
+		{"doneDate > 2026-01-01T12:30", "doneDate > " + strconv.FormatInt(dateTime, 10)},
+		{`name == "1 GiB" && size > 1`, `name == "1 GiB" && size > 1`},
+		{"ratio > 1.5 && x2 GiB", "ratio > 1.5 && x2 GiB"},
+		{"size > 1 GiBs", "size > 1 GiBs"},
+		{"size > 3 && 3d2", "size > 3 && 3d2"},
+	}
+
+	for _, tt := range tests {
+		e, err := expand(tt.source, nil)
+		if err != nil {
+			t.Errorf("expand(%q) error = %v", tt.source, err)
+			continue
+		}
+
+		if e.source != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.source, e.source, tt.want)
+		}
+	}
+}
+
+func TestExpandedOriginal(t *testing.T) {
+	e, err := expand("size > 1 GiB && x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// size > 1073741824 && x
+	for offset, want := range map[int]int{0: 0, 7: 7, 12: 7, 17: 12, 18: 13, 21: 16} {
+		if got := e.original(offset); got != want {
+			t.Errorf("original(%d) = %d, want %d", offset, got, want)
+		}
+	}
+}
+
+func TestLiteralErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"addedDate < 2026-13-01", "invalid filter expression: invalid date 2026-13-01\n" +
+			"    addedDate < 2026-13-01\n" +
+			"                ^"},
+		{"size > 1 GiB && 1 GiB + x", "invalid filter expression: unknown variable x\n" +
+			"    size > 1 GiB && 1 GiB + x\n" +
+			"                            ^"},
+		{"size > > 1 GiB", "invalid filter expression: unexpected >\n" +
+			"    size > > 1 GiB\n" +
+			"           ^"},
+		{"age > 2d 3h", "invalid filter expression: unexpected 3h\n" +
+			"    age > 2d 3h\n" +
+			"             ^"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(Options{Filter: []string{tt.expr}}, nil)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("New(%q) error =\n%v\nwant\n%s", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/shric/trpc/internal/config"
+)
+
+// namedRef is a reference to a named filter in an expression, such as
+// @stale-foo.
+var namedRef = regexp.MustCompile(`^@([A-Za-z_][A-Za-z0-9_-]*)`)
+
+// aliases are the named filters an expression can refer to.
+type aliases struct {
+	filters map[string]string
+	// using are the named filters being expanded, to catch loops.
+	using []string
+}
+
+// newAliases returns the named filters of the [filters] section of conf.
+func newAliases(conf *config.Config) *aliases {
+	if conf == nil {
+		return &aliases{}
+	}
+
+	return &aliases{filters: conf.Filters}
+}
+
+// expand returns the expression of the named filter referred to at offset in
+// source, in parentheses and with its own literals and references expanded.
+func (a *aliases) expand(source string, offset int, name string) (string, error) {
+	if a == nil {
+		a = &aliases{}
+	}
+
+	for _, n := range a.using {
+		if n == name {
+			return "", &SyntaxError{source, offset, "@" + name + " refers to itself"}
+		}
+	}
+
+	body, ok := a.filters[name]
+	if !ok {
+		return "", &SyntaxError{source, offset, "unknown filter @" + name + " (check [filters] in ~/.trpc.conf)"}
+	}
+
+	inner := &aliases{filters: a.filters, using: append(a.using[:len(a.using):len(a.using)], name)}
+
+	// Mistakes are pointed at in the named filter rather than where it's
+	// used. Named filters are torrent filters.
+	expr, err := compile(body, inner, torrentVariable)
+	if err != nil {
+		if se, ok := err.(*SyntaxError); ok {
+			return "", &SyntaxError{se.Expression, se.Offset, "@" + name + ": " + se.Message}
+		}
+
+		return "", err
+	}
+
+	if len(expr.program.Statements) != 1 {
+		return "", &SyntaxError{body, 0, "@" + name + ": a named filter can't use let"}
+	}
+
+	e, err := expand(body, inner)
+	if err != nil {
+		return "", err
+	}
+
+	return "(" + e.source + ")", nil
+}
+
+// Names returns the names of the filters of the [filters] section of conf,
+// sorted.
+func Names(conf *config.Config) []string {
+	var names []string
+
+	if conf != nil {
+		for name := range conf.Filters {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// CheckNamed checks the named filter of conf, returning what's wrong with it.
+func CheckNamed(name string, conf *config.Config) error {
+	if namedRef.FindString("@"+name) != "@"+name {
+		return fmt.Errorf("invalid filter name %q: use letters, digits, _ and -", name)
+	}
+
+	_, err := compile("@"+name, newAliases(conf), torrentVariable)
+
+	return err
+}
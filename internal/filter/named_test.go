@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shric/trpc/internal/config"
+)
+
+var namedConf = &config.Config{Filters: map[string]string{
+	"big":     "size > 1 GiB",
+	"stale":   "@big && age > 30d",
+	"lets":    "let x = 1; x > 0",
+	"broken":  "size > > 1",
+	"loop":    "@loop2",
+	"loop2":   "id > 1 || @loop",
+	"bad.key": "complete",
+}}
+
+func TestNamedExpand(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"@big", "(size > 1073741824)"},
+		{"complete && @stale", "complete && ((size > 1073741824) && age > 2592000)"},
+		{`name == "@big"`, `name == "@big"`},
+	}
+
+	for _, tt := range tests {
+		e, err := expand(tt.source, newAliases(namedConf))
+		if err != nil {
+			t.Errorf("expand(%q) error = %v", tt.source, err)
+			continue
+		}
+
+		if e.source != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.source, e.source, tt.want)
+		}
+	}
+}
+
+func TestNamedErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"@nope", "invalid filter expression: unknown filter @nope (check [filters] in ~/.trpc.conf)\n" +
+			"    @nope\n" +
+			"    ^"},
+		{"complete && @", "invalid filter expression: expected a filter name after @\n" +
+			"    complete && @\n" +
+			"                ^"},
+		{"@broken", "invalid filter expression: @broken: unexpected >\n" +
+			"    size > > 1\n" +
+			"           ^"},
+		{"@lets", "invalid filter expression: @lets: a named filter can't use let\n" +
+			"    let x = 1; x > 0\n" +
+			"    ^"},
+		{"@loop", "invalid filter expression: @loop: @loop2: @loop refers to itself\n" +
+			"    id > 1 || @loop\n" +
+			"              ^"},
+		{"@big > 1 &&", "invalid filter expression: unexpected end of expression\n" +
+			"    @big > 1 &&\n" +
+			"               ^"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(Options{Filter: []string{tt.expr}}, namedConf)
+		if err == nil {
+			t.Errorf("New(%q) error = nil, want %q", tt.expr, tt.want)
+			continue
+		}
+
+		if err.Error() != tt.want {
+			t.Errorf("New(%q) error =\n%s\nwant\n%s", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestNamedOption(t *testing.T) {
+	f, err := New(Options{Named: []string{"stale"}, Complete: true}, namedConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"sizeWhenDone", "addedDate", "doneDate", "leftUntilDone"}; !reflect.DeepEqual(f.Args, want) {
+		t.Errorf("Args = %v, want %v", f.Args, want)
+	}
+}
+
+func TestCheckNamed(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"big", true},
+		{"stale", true},
+		{"broken", false},
+		{"loop", false},
+		{"bad.key", false},
+		{"nope", false},
+	}
+
+	for _, tt := range tests {
+		if err := CheckNamed(tt.name, namedConf); (err == nil) != tt.ok {
+			t.Errorf("CheckNamed(%q) error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+
+	if got, want := Names(namedConf), []string{"bad.key", "big", "broken", "lets", "loop", "loop2", "stale"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,290 @@
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shric/monkey/evaluator"
+	"github.com/shric/monkey/object"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+// sortKey is an expression to sort by.
+type sortKey struct {
+	expr       *expression
+	descending bool
+}
+
+// keySpans returns where the comma separated keys of spec are. Commas in
+// parentheses, brackets and strings don't separate keys.
+func keySpans(spec string) [][2]int {
+	var spans [][2]int
+
+	depth, start, quoted := 0, 0, false
+
+	for i := 0; i < len(spec); i++ {
+		switch c := spec[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			spans = append(spans, [2]int{start, i})
+			start = i + 1
+		}
+	}
+
+	return append(spans, [2]int{start, len(spec)})
+}
+
+// compileKeys parses the sort keys of spec, such as "tracker,-ratio,name", a
+// leading - sorting by a key in descending order. Mistakes are pointed at in
+// spec.
+func compileKeys(spec string, a *aliases, known func(name string) bool) ([]sortKey, error) {
+	var keys []sortKey
+
+	for _, span := range keySpans(spec) {
+		start, end := span[0], span[1]
+
+		for start < end && spec[start] == ' ' {
+			start++
+		}
+
+		key := sortKey{}
+
+		switch {
+		case start < end && spec[start] == '-':
+			key.descending = true
+			start++
+		case start < end && spec[start] == '+':
+			start++
+		}
+
+		source := spec[start:end]
+
+		expr, err := compile(source, a, known)
+		if err != nil {
+			if se, ok := err.(*SyntaxError); ok && se.Expression == source {
+				return nil, &SyntaxError{spec, start + se.Offset, se.Message}
+			}
+
+			return nil, err
+		}
+
+		key.expr = expr
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// rank orders the types of values of different types: null, then numbers,
+// booleans, strings and lists.
+func rank(o object.Object) int {
+	switch o.(type) {
+	case *object.Null:
+		return 0
+	case *object.Integer, *object.Float:
+		return 1
+	case *object.Boolean:
+		return 2
+	case *object.String:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// number returns the value of an integer or a float.
+func number(o object.Object) float64 {
+	if i, ok := o.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+
+	return o.(*object.Float).Value
+}
+
+// compareObjects returns -1, 0 or 1 as a is less than, equal to or greater
+// than b. Strings are compared ignoring case first.
+func compareObjects(a, b object.Object) int {
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+
+	var less, greater bool
+
+	switch x := a.(type) {
+	case *object.Integer, *object.Float:
+		less, greater = number(a) < number(b), number(a) > number(b)
+	case *object.Boolean:
+		y := b.(*object.Boolean)
+		less, greater = !x.Value && y.Value, x.Value && !y.Value
+	case *object.String:
+		y := b.(*object.String)
+		lx, ly := strings.ToLower(x.Value), strings.ToLower(y.Value)
+		less, greater = lx < ly || lx == ly && x.Value < y.Value, lx > ly || lx == ly && x.Value > y.Value
+	default:
+		less, greater = a.Inspect() < b.Inspect(), a.Inspect() > b.Inspect()
+	}
+
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+
+	return 0
+}
+
+// keyValues evaluates the keys in env.
+func keyValues(keys []sortKey, env *object.Environment) ([]object.Object, error) {
+	values := make([]object.Object, len(keys))
+
+	for i, key := range keys {
+		v := evaluator.Eval(key.expr.program, env)
+		if e, ok := v.(*object.Error); ok {
+			return nil, fmt.Errorf("invalid sort key %q: %s", key.expr.source, e.Message)
+		}
+
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// sortByKeys returns the order of things given the values of their keys: the
+// indexes of values, sorted stably, in reverse if asked to.
+func sortByKeys(keys []sortKey, values [][]object.Object, reverse bool) []int {
+	index := make([]int, len(values))
+	for i := range index {
+		index[i] = i
+	}
+
+	sort.SliceStable(index, func(i, j int) bool {
+		x, y := values[index[i]], values[index[j]]
+		if reverse {
+			x, y = y, x
+		}
+
+		for k, key := range keys {
+			c := compareObjects(x[k], y[k])
+			if key.descending {
+				c = -c
+			}
+
+			if c != 0 {
+				return c < 0
+			}
+		}
+
+		return false
+	})
+
+	return index
+}
+
+// Order sorts torrents by keys which are filter expressions.
+type Order struct {
+	conf *config.Config
+	keys []sortKey
+	// fields are the torrent fields the keys refer to.
+	fields []*torrent.Field
+	// Args are the torrent-get fields needed to evaluate the keys.
+	Args []string
+}
+
+// NewOrder returns the order of comma separated sort keys such as
+// "tracker,-ratio,name".
+func NewOrder(spec string, conf *config.Config) (*Order, error) {
+	keys, err := compileKeys(spec, newAliases(conf), torrentVariable)
+	if err != nil {
+		return nil, err
+	}
+
+	var exprs []*expression
+	for _, key := range keys {
+		exprs = append(exprs, key.expr)
+	}
+
+	o := &Order{conf: conf, keys: keys}
+	o.fields, o.Args = fieldsOf(exprs)
+
+	return o, nil
+}
+
+// Sort sorts torrents, stably. The torrents need the fields of Args.
+func (o *Order) Sort(torrents []*backend.Torrent, reverse bool) error {
+	values := make([][]object.Object, len(torrents))
+
+	for i, t := range torrents {
+		v, err := keyValues(o.keys, torrentEnv(o.fields, t, o.conf))
+		if err != nil {
+			return err
+		}
+
+		values[i] = v
+	}
+
+	sorted := make([]*backend.Torrent, len(torrents))
+	for i, j := range sortByKeys(o.keys, values, reverse) {
+		sorted[i] = torrents[j]
+	}
+
+	copy(torrents, sorted)
+
+	return nil
+}
+
+// FileOrder sorts the files of torrents by keys which are file filter
+// expressions.
+type FileOrder struct {
+	keys   []sortKey
+	fields []*torrent.FileField
+}
+
+// NewFileOrder returns the order of comma separated sort keys over the file
+// variables, such as "-length,name".
+func NewFileOrder(spec string) (*FileOrder, error) {
+	keys, err := compileKeys(spec, nil, fileVariable)
+	if err != nil {
+		return nil, err
+	}
+
+	var exprs []*expression
+	for _, key := range keys {
+		exprs = append(exprs, key.expr)
+	}
+
+	return &FileOrder{keys: keys, fields: fileFieldsOf(exprs)}, nil
+}
+
+// Sort sorts the indexes of files of a torrent, stably.
+func (o *FileOrder) Sort(t *backend.Torrent, files []int, reverse bool) error {
+	values := make([][]object.Object, len(files))
+
+	for i, file := range files {
+		v, err := keyValues(o.keys, fileEnv(o.fields, t, file))
+		if err != nil {
+			return err
+		}
+
+		values[i] = v
+	}
+
+	sorted := make([]int, len(files))
+	for i, j := range sortByKeys(o.keys, values, reverse) {
+		sorted[i] = files[j]
+	}
+
+	copy(files, sorted)
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hekmon/cunits/v2"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+func TestKeySpans(t *testing.T) {
+	tests := []struct {
+		spec string
+		want [][2]int
+	}{
+		{"name", [][2]int{{0, 4}}},
+		{"tracker,-ratio,name", [][2]int{{0, 7}, {8, 14}, {15, 19}}},
+		{`any(trackers, "a,b"),[1, 2][0]`, [][2]int{{0, 20}, {21, 30}}},
+		{"", [][2]int{{0, 0}}},
+	}
+
+	for _, tt := range tests {
+		if got := keySpans(tt.spec); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("keySpans(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func sortTorrent(id int64, name string, size float64, left int64) *backend.Torrent {
+	sizeWhenDone := cunits.ImportInByte(size)
+
+	return &backend.Torrent{ID: &id, Name: &name, SizeWhenDone: &sizeWhenDone, LeftUntilDone: &left}
+}
+
+func TestOrderSort(t *testing.T) {
+	tests := []struct {
+		spec    string
+		reverse bool
+		want    []int64
+	}{
+		{"name", false, []int64{2, 4, 3, 1}},
+		{"-name", false, []int64{1, 3, 4, 2}},
+		{"size,name", false, []int64{2, 4, 3, 1}},
+		{"complete,-size, id", false, []int64{3, 4, 1, 2}},
+		{"complete,-size, id", true, []int64{2, 1, 4, 3}},
+		{"+len(name),name", false, []int64{2, 4, 1, 3}},
+		{`if (size > 150) { "big" } else { 0 }`, false, []int64{2, 4, 1, 3}},
+	}
+
+	for _, tt := range tests {
+		torrents := []*backend.Torrent{
+			sortTorrent(1, "delta", 200, 0),
+			sortTorrent(2, "Alpha", 100, 0),
+			sortTorrent(3, "charlie", 200, 50),
+			sortTorrent(4, "alpha", 100, 10),
+		}
+
+		o, err := NewOrder(tt.spec, nil)
+		if err != nil {
+			t.Errorf("NewOrder(%q) error = %v", tt.spec, err)
+			continue
+		}
+
+		if err := o.Sort(torrents, tt.reverse); err != nil {
+			t.Errorf("Sort(%q) error = %v", tt.spec, err)
+			continue
+		}
+
+		var got []int64
+		for _, torrent := range torrents {
+			got = append(got, *torrent.ID)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Sort(%q, %v) = %v, want %v", tt.spec, tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestOrderArgs(t *testing.T) {
+	o, err := NewOrder("complete,-size,name", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"leftUntilDone", "sizeWhenDone", "name"}; !reflect.DeepEqual(o.Args, want) {
+		t.Errorf("Args = %v, want %v", o.Args, want)
+	}
+}
+
+func TestOrderErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"name,-sise", "invalid filter expression: unknown variable sise\n" +
+			"    name,-sise\n" +
+			"          ^"},
+		{"name,", "invalid filter expression: empty expression\n" +
+			"    name,\n" +
+			"         ^"},
+		{"size > >", "invalid filter expression: unexpected >\n" +
+			"    size > >\n" +
+			"           ^"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewOrder(tt.spec, nil)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("NewOrder(%q) error =\n%v\nwant\n%s", tt.spec, err, tt.want)
+		}
+	}
+
+	o, err := NewOrder(`lower(size)`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Sort([]*backend.Torrent{sortTorrent(1, "a", 1, 0)}, false)
+	if want := `invalid sort key "lower(size)": lower: argument 1 must be a string, got INTEGER`; err == nil || err.Error() != want {
+		t.Errorf("Sort() error = %v, want %s", err, want)
+	}
+}
+
+func TestFileOrderSort(t *testing.T) {
+	name := "Album"
+	torrent := &backend.Torrent{
+		Name: &name,
+		Files: []*backend.File{
+			{Name: "Album/b.flac", Length: 20},
+			{Name: "Album/a.nfo", Length: 1},
+			{Name: "Album/c.flac", Length: 20},
+			{Name: "Album/A.flac", Length: 5},
+		},
+	}
+
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		{"name", []int{3, 1, 0, 2}},
+		{"-length,name", []int{0, 2, 3, 1}},
+		{"ext,-name", []int{2, 0, 3, 1}},
+	}
+
+	for _, tt := range tests {
+		o, err := NewFileOrder(tt.spec)
+		if err != nil {
+			t.Errorf("NewFileOrder(%q) error = %v", tt.spec, err)
+			continue
+		}
+
+		files := []int{0, 1, 2, 3}
+		if err := o.Sort(torrent, files, false); err != nil {
+			t.Errorf("Sort(%q) error = %v", tt.spec, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(files, tt.want) {
+			t.Errorf("Sort(%q) = %v, want %v", tt.spec, files, tt.want)
+		}
+	}
+}
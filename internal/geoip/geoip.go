@@ -0,0 +1,33 @@
+// Package geoip looks up the country of IP addresses in a local database:
+// either a MaxMind DB (.mmdb) file such as GeoLite2-Country, or a CSV file
+// of IP ranges and country codes such as DB-IP's IP to Country Lite or
+// IP2Location LITE DB1.
+package geoip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+)
+
+// DB is a country database.
+type DB interface {
+	// Country returns the ISO 3166 code of the country of ip, or "" if it
+	// isn't in the database.
+	Country(ip net.IP) string
+}
+
+// Open reads the database of a file, telling the formats apart by their
+// content.
+func Open(path string) (DB, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(data, metadataStart) {
+		return newMMDB(path, data)
+	}
+
+	return newRanges(path, data)
+}
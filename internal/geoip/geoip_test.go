@@ -0,0 +1,267 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Encoders of the MaxMind DB data section, for small values.
+
+func str(s string) []byte {
+	return append([]byte{typeString<<5 | byte(len(s))}, s...)
+}
+
+func uint32v(n uint32) []byte {
+	b := []byte{typeUint32<<5 | 4, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], n)
+
+	return b
+}
+
+func uint64v(n uint64) []byte {
+	b := []byte{typeExtended<<5 | 8, typeUint64 - 7, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[2:], n)
+
+	return b
+}
+
+func pointer(offset int) []byte {
+	return []byte{typePointer<<5 | byte(offset>>8), byte(offset)}
+}
+
+func mapv(pairs ...[]byte) []byte {
+	b := []byte{typeMap<<5 | byte(len(pairs)/2)}
+	for _, p := range pairs {
+		b = append(b, p...)
+	}
+
+	return b
+}
+
+// node is a node of the search tree being built, whose records are either
+// nodes or data offsets.
+type node struct {
+	children [2]*node
+	data     [2]int
+	index    int
+}
+
+// network is a network of the database and the offset of its data.
+type network struct {
+	cidr string
+	data int
+}
+
+// buildMMDB returns a MaxMind DB of an IPv6 tree with records of size bits
+// holding the networks.
+func buildMMDB(t *testing.T, size uint, networks []network, data []byte) []byte {
+	root := &node{data: [2]int{-1, -1}}
+
+	for _, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP.To16()
+
+		if ipNet.IP.To4() != nil {
+			ones += 96
+			ip = append(make(net.IP, 12), ipNet.IP.To4()...)
+		}
+
+		at := root
+
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if i == ones-1 {
+				at.data[bit] = n.data
+				break
+			}
+
+			if at.children[bit] == nil {
+				at.children[bit] = &node{data: [2]int{-1, -1}}
+			}
+
+			at = at.children[bit]
+		}
+	}
+
+	var nodes []*node
+
+	for queue := []*node{root}; len(queue) > 0; queue = queue[1:] {
+		queue[0].index = len(nodes)
+		nodes = append(nodes, queue[0])
+
+		for _, child := range queue[0].children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	count := uint(len(nodes))
+
+	var tree []byte
+
+	for _, n := range nodes {
+		var records [2]uint
+
+		for side := range records {
+			switch {
+			case n.children[side] != nil:
+				records[side] = uint(n.children[side].index)
+			case n.data[side] >= 0:
+				records[side] = count + dataSeparator + uint(n.data[side])
+			default:
+				records[side] = count
+			}
+		}
+
+		l, r := records[0], records[1]
+
+		switch size {
+		case 24:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(l>>20&0xf0|r>>24&0x0f),
+				byte(r>>16), byte(r>>8), byte(r))
+		default:
+			tree = append(tree, byte(l>>24), byte(l>>16), byte(l>>8), byte(l),
+				byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+
+	meta := mapv(
+		str("node_count"), uint32v(uint32(count)),
+		str("record_size"), uint32v(uint32(size)),
+		str("ip_version"), uint32v(6),
+		str("build_epoch"), uint64v(1600000000),
+		str("database_type"), str("Test-Country"),
+	)
+
+	file := append(tree, make([]byte, dataSeparator)...)
+	file = append(file, data...)
+	file = append(file, metadataStart...)
+
+	return append(file, meta...)
+}
+
+var lookups = []struct {
+	ip   string
+	want string
+}{
+	{"203.0.113.5", "NZ"},
+	{"198.51.100.7", "US"},
+	{"198.51.100.200", ""},
+	{"2001:db8::1", "DE"},
+	{"192.0.2.1", ""},
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	dir, err := ioutil.TempDir("", "geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestMMDB(t *testing.T) {
+	nz := mapv(str("country"), mapv(str("iso_code"), str("NZ")))
+	// The key of the US record points to that of the NZ one.
+	us := mapv(str("registered_country"), mapv(pointer(len(str("country"))+2), str("US")))
+	de := mapv(str("country"), mapv(str("iso_code"), str("DE"), str("geoname_id"), uint32v(2921044)))
+
+	data := append(append(append([]byte{}, nz...), us...), de...)
+	networks := []network{
+		{"203.0.113.0/24", 0},
+		{"198.51.100.0/25", len(nz)},
+		{"2001:db8::/32", len(nz) + len(us)},
+	}
+
+	for _, size := range []uint{24, 28, 32} {
+		db, err := Open(writeFile(t, "test.mmdb", buildMMDB(t, size, networks, data)))
+		if err != nil {
+			t.Fatalf("record size %d: Open() error = %v", size, err)
+		}
+
+		for _, tt := range lookups {
+			if got := db.Country(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("record size %d: Country(%s) = %q, want %q", size, tt.ip, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"pointer to a pointer", append(pointer(2), pointer(4)...), "pointer to a pointer"},
+		{"cycle", mapv(str("a"), pointer(0)), "values nested more than 512 deep"},
+		{"huge map", []byte{typeMap<<5 | 31, 0xff, 0xff, 0xff}, "truncated data"},
+		{"huge array", []byte{typeExtended<<5 | 30, typeArray - 7, 0xff, 0xff}, "truncated data"},
+	}
+
+	for _, tt := range tests {
+		data := append(tt.data, str("US")...)
+		if _, _, err := (&decoder{data: data}).decode(0); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: decode() error = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRanges(t *testing.T) {
+	files := map[string]string{
+		"dbip.csv": `198.51.100.0,198.51.100.127,US
+203.0.113.0,203.0.113.255,NZ
+2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,DE
+`,
+		"ip2location.csv": `"ip_from","ip_to","country_code","country_name"
+"3221225984","3221226239","-","-"
+"3325256704","3325256831","US","United States of America"
+"3405803776","3405804031","NZ","New Zealand"
+"42540766411282592856903984951653826560","42540766490510755371168322545197776895","DE","Germany"
+`,
+	}
+
+	for name, content := range files {
+		db, err := Open(writeFile(t, name, []byte(content)))
+		if err != nil {
+			t.Fatalf("%s: Open() error = %v", name, err)
+		}
+
+		for _, tt := range lookups {
+			if got := db.Country(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("%s: Country(%s) = %q, want %q", name, tt.ip, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open(writeFile(t, "countries.txt", []byte("not,a\nrange\n"))); err == nil ||
+		!strings.Contains(err.Error(), "neither a MaxMind DB nor a CSV file of IP ranges") {
+		t.Errorf("Open() of a text file: error = %v", err)
+	}
+
+	if _, err := Open(filepath.Join("testdata", "missing.mmdb")); err == nil {
+		t.Error("Open() of a missing file: expected an error")
+	}
+}
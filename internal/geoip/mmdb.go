@@ -0,0 +1,378 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+)
+
+// metadataStart comes before the metadata at the end of a MaxMind DB file.
+var metadataStart = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSeparator is the size of the zeroes between the search tree and the
+// data section.
+const dataSeparator = 16
+
+// The types of the MaxMind DB data section.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// mmdb is a MaxMind DB, as specified by
+// https://maxmind.github.io/MaxMind-DB/.
+type mmdb struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node IPv4 addresses start from in an IPv6 tree.
+	ipv4Start uint
+}
+
+func newMMDB(path string, file []byte) (*mmdb, error) {
+	i := bytes.LastIndex(file, metadataStart)
+	meta := decoder{data: file[i+len(metadataStart):]}
+
+	value, _, err := meta.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: metadata: %v", path, err)
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: metadata isn't a map", path)
+	}
+
+	db := &mmdb{
+		nodeCount:  metaUint(fields, "node_count"),
+		recordSize: metaUint(fields, "record_size"),
+		ipVersion:  metaUint(fields, "ip_version"),
+	}
+
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%s: unsupported record size %d", path, db.recordSize)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSeparator > uint(i) {
+		return nil, fmt.Errorf("%s: search tree larger than the file", path)
+	}
+
+	db.tree = file[:treeSize]
+	db.data = file[treeSize+dataSeparator : i]
+
+	if db.ipVersion == 6 {
+		for bit := 0; bit < 96 && db.ipv4Start < db.nodeCount; bit++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+
+	return db, nil
+}
+
+func metaUint(fields map[string]interface{}, key string) uint {
+	n, _ := fields[key].(uint64)
+	return uint(n)
+}
+
+// record returns the left (0) or right (1) record of a node of the search
+// tree.
+func (db *mmdb) record(node uint, side int) uint {
+	b := db.tree[node*db.recordSize/4:]
+
+	switch db.recordSize {
+	case 24:
+		b = b[side*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if side == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+
+	return uint(binary.BigEndian.Uint32(b[side*4:]))
+}
+
+// Country implements DB.
+func (db *mmdb) Country(ip net.IP) string {
+	node, bits := uint(0), ip.To16()
+
+	if ip4 := ip.To4(); ip4 != nil {
+		bits = ip4
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return ""
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, int(bits[i/8]>>(7-uint(i%8))&1))
+	}
+
+	if node <= db.nodeCount {
+		return ""
+	}
+
+	value, _, err := (&decoder{data: db.data}).decode(node - db.nodeCount - dataSeparator)
+	if err != nil {
+		return ""
+	}
+
+	record, _ := value.(map[string]interface{})
+
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := record[key].(map[string]interface{})
+		if code, ok := country["iso_code"].(string); ok {
+			return code
+		}
+	}
+
+	return ""
+}
+
+// maxDepth is how deeply values may be nested, pointers included, so that
+// pointers going round in circles can't recurse forever. libmaxminddb has the
+// same limit.
+const maxDepth = 512
+
+// decoder decodes values of a MaxMind DB data section.
+type decoder struct {
+	data []byte
+	// depth is how deeply the value being decoded is nested.
+	depth int
+}
+
+var errTruncated = fmt.Errorf("truncated data")
+
+// decode returns the value at offset, and the offset after it.
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	if d.depth >= maxDepth {
+		return nil, 0, fmt.Errorf("values nested more than %d deep", maxDepth)
+	}
+
+	d.depth++
+	defer func() { d.depth-- }()
+
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ != typePointer {
+		return d.value(typ, size, offset)
+	}
+
+	// The spec doesn't allow a pointer to point to a pointer.
+	typ, size, next, err := d.control(size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		return nil, 0, fmt.Errorf("pointer to a pointer")
+	}
+
+	value, _, err := d.value(typ, size, next)
+
+	return value, offset, err
+}
+
+// control reads the type and size of the value at offset. For pointers the
+// size is where they point to.
+func (d *decoder) control(offset uint) (typ, size, next uint, err error) {
+	if offset >= uint(len(d.data)) {
+		return 0, 0, 0, errTruncated
+	}
+
+	ctrl := d.data[offset]
+	offset++
+	typ = uint(ctrl >> 5)
+
+	if typ == typePointer {
+		return d.pointer(ctrl, offset)
+	}
+
+	if typ == typeExtended {
+		if offset >= uint(len(d.data)) {
+			return 0, 0, 0, errTruncated
+		}
+
+		typ = 7 + uint(d.data[offset])
+		offset++
+	}
+
+	size = uint(ctrl & 0x1f)
+	if size < 29 {
+		return typ, size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > uint(len(d.data)) {
+		return 0, 0, 0, errTruncated
+	}
+
+	n := uintFrom(d.data[offset : offset+extra])
+
+	switch extra {
+	case 1:
+		size = 29 + n
+	case 2:
+		size = 285 + n
+	default:
+		size = 65821 + n
+	}
+
+	return typ, size, offset + extra, nil
+}
+
+func (d *decoder) pointer(ctrl byte, offset uint) (typ, size, next uint, err error) {
+	extra := uint(ctrl>>3&0x3) + 1
+	if offset+extra > uint(len(d.data)) {
+		return 0, 0, 0, errTruncated
+	}
+
+	n := uintFrom(d.data[offset : offset+extra])
+	prefix := uint(ctrl & 0x7)
+
+	switch extra {
+	case 1:
+		size = prefix<<8 | n
+	case 2:
+		size = (prefix<<16 | n) + 2048
+	case 3:
+		size = (prefix<<24 | n) + 526336
+	default:
+		size = n
+	}
+
+	return typePointer, size, offset + extra, nil
+}
+
+func uintFrom(b []byte) uint {
+	var n uint
+
+	for _, c := range b {
+		n = n<<8 | uint(c)
+	}
+
+	return n
+}
+
+// value decodes a value of a type and size at offset.
+func (d *decoder) value(typ, size, offset uint) (interface{}, uint, error) {
+	switch typ {
+	case typeMap:
+		return d.decodeMap(size, offset)
+	case typeArray:
+		return d.decodeArray(size, offset)
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, errTruncated
+	}
+
+	b, next := d.data[offset:offset+size], offset+size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of %d bytes", size)
+		}
+
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of %d bytes", size)
+		}
+
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		return uint64(uintFrom(b)), next, nil
+	case typeInt32:
+		return int32(uintFrom(b)), next, nil
+	case typeBytes, typeUint128:
+		return b, next, nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown type %d", typ)
+}
+
+// checkSize checks that there is data left for the entries of a map or
+// array, each taking at least a byte, before making room for them.
+func (d *decoder) checkSize(size, offset uint) error {
+	if offset > uint(len(d.data)) || size > uint(len(d.data))-offset {
+		return errTruncated
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeMap(size, offset uint) (interface{}, uint, error) {
+	if err := d.checkSize(size, offset); err != nil {
+		return nil, 0, err
+	}
+
+	m := make(map[string]interface{}, size)
+
+	for i := uint(0); i < size; i++ {
+		key, next, err := d.decode(offset)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		name, ok := key.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("map key isn't a string")
+		}
+
+		if m[name], offset, err = d.decode(next); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return m, offset, nil
+}
+
+func (d *decoder) decodeArray(size, offset uint) (interface{}, uint, error) {
+	if err := d.checkSize(size, offset); err != nil {
+		return nil, 0, err
+	}
+
+	a := make([]interface{}, size)
+
+	for i := range a {
+		var err error
+		if a[i], offset, err = d.decode(offset); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return a, offset, nil
+}
@@ -0,0 +1,111 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ipRange is a line of a CSV database: the first and last address of a
+// range, as 16 bytes, and its country.
+type ipRange struct {
+	first, last net.IP
+	country     string
+}
+
+// ranges is a CSV database of IP ranges, sorted.
+type ranges []ipRange
+
+// newRanges reads lines of the first address, the last address and the
+// country code of ranges. The addresses are written out, as by DB-IP, or
+// numbers, as by IP2Location. Lines that aren't ranges, such as headers, are
+// skipped.
+func newRanges(path string, data []byte) (ranges, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	var db ranges
+
+	for {
+		fields, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		if len(fields) < 3 {
+			continue
+		}
+
+		first, last := parseAddress(fields[0]), parseAddress(fields[1])
+		if first == nil || last == nil {
+			continue
+		}
+
+		country := strings.TrimSpace(fields[2])
+		if country == "-" {
+			country = ""
+		}
+
+		db = append(db, ipRange{first, last, country})
+	}
+
+	if len(db) == 0 {
+		return nil, fmt.Errorf("%s: neither a MaxMind DB nor a CSV file of IP ranges", path)
+	}
+
+	sort.Slice(db, func(i, j int) bool { return bytes.Compare(db[i].first, db[j].first) < 0 })
+
+	return db, nil
+}
+
+// parseAddress returns an address written out or as a number, as 16 bytes,
+// or nil. Numbers below 2^32 are IPv4 addresses.
+func parseAddress(s string) net.IP {
+	s = strings.TrimSpace(s)
+
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.To16()
+	}
+
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return nil
+	}
+
+	size := 16
+	if n.BitLen() <= 32 {
+		size = 4
+	}
+
+	b := n.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+
+	return ip.To16()
+}
+
+// Country implements DB.
+func (db ranges) Country(ip net.IP) string {
+	ip = ip.To16()
+	if ip == nil {
+		return ""
+	}
+
+	// The first range starting after ip, the one before may hold it.
+	i := sort.Search(len(db), func(i int) bool { return bytes.Compare(db[i].first, ip) > 0 })
+	if i == 0 || bytes.Compare(ip, db[i-1].last) > 0 {
+		return ""
+	}
+
+	return db[i-1].country
+}
@@ -0,0 +1,22 @@
+// Package terminal tells whether output goes to a terminal, and how wide it is.
+package terminal
+
+import (
+	"os"
+	"strconv"
+)
+
+// Width returns the number of columns of the terminal f is, and false if it
+// isn't a terminal. $COLUMNS, if set, overrides the width of a terminal.
+func Width(f *os.File) (int, bool) {
+	width, ok := size(f)
+	if !ok {
+		return 0, false
+	}
+
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		width = columns
+	}
+
+	return width, true
+}
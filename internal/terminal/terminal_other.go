@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package terminal
+
+import "os"
+
+// size can't tell terminals from other files on this platform, so output is
+// treated as going to a file.
+func size(f *os.File) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package terminal
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	row, col       uint16
+	xpixel, ypixel uint16
+}
+
+// size asks the terminal driver for the window size, which fails if f isn't
+// a terminal.
+func size(f *os.File) (int, bool) {
+	var ws winsize
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ),
+		uintptr(unsafe.Pointer(&ws))) // nolint:gosec
+	if errno != 0 {
+		return 0, false
+	}
+
+	// Some terminals (e.g. serial consoles) don't know their size.
+	if ws.col == 0 {
+		return 80, true
+	}
+
+	return int(ws.col), true
+}
@@ -0,0 +1,377 @@
+package torrent
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hekmon/cunits/v2"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/config"
+)
+
+// Kind tells what the value of a Field is and how it's shown.
+type Kind int
+
+// The kinds of fields. Bytes, Rate (bytes per second), Duration (seconds) and
+// Date (seconds since the Unix epoch, 0 for never) are int64 values, Strings
+// are []string.
+const (
+	KindBool Kind = iota
+	KindInt
+	KindFloat
+	KindString
+	KindStrings
+	KindBytes
+	KindRate
+	KindDuration
+	KindDate
+)
+
+var kindNames = map[Kind]string{
+	KindBool:     "bool",
+	KindInt:      "integer",
+	KindFloat:    "float",
+	KindString:   "string",
+	KindStrings:  "list of strings",
+	KindBytes:    "size",
+	KindRate:     "rate",
+	KindDuration: "duration",
+	KindDate:     "date",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Field is a property of a torrent, available as a variable in filter
+// expressions and as a column of list.
+type Field struct {
+	Name string
+	Kind Kind
+	// Description says what the field is, for documentation.
+	Description string
+	// RPC lists the torrent-get fields the value is computed from.
+	RPC []string
+	// Sum marks fields that add up in the totals of list.
+	Sum   bool
+	Value func(t *backend.Torrent, conf *config.Config) interface{}
+}
+
+var (
+	statusRPC   = []string{"status", "isFinished", "peersGettingFromUs", "peersSendingToUs", "leftUntilDone"}
+	progressRPC = []string{"sizeWhenDone", "leftUntilDone", "recheckProgress"}
+)
+
+// unixTime returns a date as seconds since the epoch, or 0 if it's not set.
+func unixTime(t *time.Time) int64 {
+	if t == nil || t.IsZero() || t.Unix() < 0 {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// swarm returns the largest number of seeders or leechers a tracker reports.
+func swarm(t *backend.Torrent, count func(*backend.TrackerStats) int64) int64 {
+	var most int64
+
+	for _, stats := range t.TrackerStats {
+		if n := count(stats); n > most {
+			most = n
+		}
+	}
+
+	return most
+}
+
+// Fields are all the fields, by name.
+var Fields = []*Field{
+	{
+		Name: "activityDate", Kind: KindDate, RPC: []string{"activityDate"},
+		Description: "when data was last sent or received",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return unixTime(t.ActivityDate) },
+	},
+	{
+		Name: "addedDate", Kind: KindDate, RPC: []string{"addedDate"},
+		Description: "when the torrent was added",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return unixTime(t.AddedDate) },
+	},
+	{
+		Name: "age", Kind: KindDuration, RPC: []string{"addedDate", "doneDate"},
+		Description: "time since the torrent was added or completed, whichever is later",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return Age(t) },
+	},
+	{
+		Name: "complete", Kind: KindBool, RPC: []string{"leftUntilDone"},
+		Description: "everything wanted has been downloaded",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.LeftUntilDone == 0 },
+	},
+	{
+		Name: "doneDate", Kind: KindDate, RPC: []string{"doneDate"},
+		Description: "when the download completed",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return unixTime(t.DoneDate) },
+	},
+	{
+		Name: "down", Kind: KindRate, RPC: []string{"rateDownload"}, Sum: true,
+		Description: "download rate",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.RateDownload },
+	},
+	{
+		Name: "downloadDir", Kind: KindString, RPC: []string{"downloadDir"},
+		Description: "directory the data is in",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.DownloadDir },
+	},
+	{
+		Name: "downloaded", Kind: KindBytes, RPC: []string{"downloadedEver"}, Sum: true,
+		Description: "bytes downloaded ever",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.DownloadedEver },
+	},
+	{
+		Name: "error", Kind: KindString, RPC: []string{"error", "errorString"},
+		Description: "error message, empty if none",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			if *t.Error != 0 {
+				return *t.ErrorString
+			}
+
+			return ""
+		},
+	},
+	{
+		Name: "eta", Kind: KindDuration, RPC: []string{"eta"},
+		Description: "estimated time until the download completes, negative if unknown",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.Eta },
+	},
+	{
+		Name: "files", Kind: KindStrings, RPC: []string{"files"},
+		Description: "names of the files of the torrent",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			names := make([]string, 0, len(t.Files))
+
+			for _, f := range t.Files {
+				names = append(names, f.Name)
+			}
+
+			return names
+		},
+	},
+	{
+		Name: "hash", Kind: KindString, RPC: []string{"hashString"},
+		Description: "info hash",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.HashString },
+	},
+	{
+		Name: "have", Kind: KindBytes, RPC: []string{"sizeWhenDone", "leftUntilDone"}, Sum: true,
+		Description: "bytes downloaded of those wanted",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return Have(t) },
+	},
+	{
+		Name: "id", Kind: KindInt, RPC: []string{"id"},
+		Description: "torrent ID",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.ID },
+	},
+	{
+		Name: "incomplete", Kind: KindBool, RPC: []string{"leftUntilDone"},
+		Description: "some wanted data is yet to be downloaded",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.LeftUntilDone != 0 },
+	},
+	{
+		Name: "isPrivate", Kind: KindBool, RPC: []string{"isPrivate"},
+		Description: "the torrent is private (no DHT or PEX)",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.IsPrivate },
+	},
+	{
+		Name: "labels", Kind: KindStrings, RPC: []string{"labels"},
+		Description: "labels of the torrent",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return append([]string{}, t.Labels...) },
+	},
+	{
+		Name: "leechers", Kind: KindInt, RPC: []string{"trackerStats"},
+		Description: "leechers in the swarm, as reported by the trackers",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			return swarm(t, func(s *backend.TrackerStats) int64 { return s.LeecherCount })
+		},
+	},
+	{
+		Name: "left", Kind: KindBytes, RPC: []string{"leftUntilDone"}, Sum: true,
+		Description: "bytes left to download",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.LeftUntilDone },
+	},
+	{
+		Name: "name", Kind: KindString, RPC: []string{"name"},
+		Description: "torrent name",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.Name },
+	},
+	{
+		Name: "path", Kind: KindString, RPC: []string{"downloadDir", "name"},
+		Description: "where the data of the torrent is, downloadDir/name",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			return filepath.Join(*t.DownloadDir, *t.Name)
+		},
+	},
+	{
+		Name: "peers", Kind: KindInt, RPC: []string{"peersConnected"},
+		Description: "connected peers",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.PeersConnected },
+	},
+	{
+		Name: "priority", Kind: KindString, RPC: []string{"bandwidthPriority"},
+		Description: "low, normal or high",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return Priority(t) },
+	},
+	{
+		Name: "progress", Kind: KindFloat, RPC: progressRPC,
+		Description: "percentage downloaded, or hash checked while verifying",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			if t.SizeWhenDone.Byte() == 0 && *t.RecheckProgress == 0 {
+				return 0.0
+			}
+
+			return Progress(t)
+		},
+	},
+	{
+		Name: "queuePosition", Kind: KindInt, RPC: []string{"queuePosition"},
+		Description: "position in the download or seed queue",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.QueuePosition },
+	},
+	{
+		Name: "ratio", Kind: KindFloat, RPC: []string{"uploadedEver", "sizeWhenDone"},
+		Description: "bytes uploaded divided by the size, as in list",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			if t.SizeWhenDone.Byte() == 0 {
+				return 0.0
+			}
+
+			return Ratio(t)
+		},
+	},
+	{
+		Name: "seedRatioLimit", Kind: KindFloat, RPC: []string{"seedRatioLimit"},
+		Description: "ratio at which seeding stops, if the torrent has its own",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.SeedRatioLimit },
+	},
+	{
+		Name: "seeders", Kind: KindInt, RPC: []string{"trackerStats"},
+		Description: "seeders in the swarm, as reported by the trackers",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			return swarm(t, func(s *backend.TrackerStats) int64 { return s.SeederCount })
+		},
+	},
+	{
+		Name: "size", Kind: KindBytes, RPC: []string{"sizeWhenDone"}, Sum: true,
+		Description: "bytes wanted",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return int64(t.SizeWhenDone.Byte()) },
+	},
+	{
+		Name: "status", Kind: KindString, RPC: statusRPC,
+		Description: "status as shown by list, e.g. Seeding or Stopped",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			status, _ := Status(t)
+			return status
+		},
+	},
+	{
+		Name: "tracker", Kind: KindString, RPC: []string{"trackers"},
+		Description: "short name of the tracker, see [trackernames]",
+		Value:       func(t *backend.Torrent, conf *config.Config) interface{} { return TrackerShortName(t, conf) },
+	},
+	{
+		Name: "trackers", Kind: KindStrings, RPC: []string{"trackers"},
+		Description: "host names of all trackers",
+		Value: func(t *backend.Torrent, _ *config.Config) interface{} {
+			hosts := make([]string, 0, len(t.Trackers))
+
+			for _, tracker := range t.Trackers {
+				if u, err := url.Parse(tracker.Announce); err == nil {
+					hosts = append(hosts, u.Hostname())
+				}
+			}
+
+			return hosts
+		},
+	},
+	{
+		Name: "up", Kind: KindRate, RPC: []string{"rateUpload"}, Sum: true,
+		Description: "upload rate",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.RateUpload },
+	},
+	{
+		Name: "uploaded", Kind: KindBytes, RPC: []string{"uploadedEver"}, Sum: true,
+		Description: "bytes uploaded ever",
+		Value:       func(t *backend.Torrent, _ *config.Config) interface{} { return *t.UploadedEver },
+	},
+}
+
+// FieldsMarkdown documents the fields as a Markdown table, for the README.
+func FieldsMarkdown() string {
+	var b strings.Builder
+
+	b.WriteString("| Variable | Type | Description |\n|---|---|---|\n")
+
+	for _, f := range Fields {
+		fmt.Fprintf(&b, "| `%s` | %s | %s |\n", f.Name, f.Kind, f.Description)
+	}
+
+	return b.String()
+}
+
+// FieldByName returns the named field, or nil.
+func FieldByName(name string) *Field {
+	for _, f := range Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// ValueOf returns the value of the field for a torrent, or backend.Unsupported
+// if the client of the torrent doesn't have what it's computed from.
+func (f *Field) ValueOf(t *backend.Torrent, conf *config.Config) interface{} {
+	for _, rpc := range f.RPC {
+		if !t.Supports(rpc) {
+			return backend.Unsupported
+		}
+	}
+
+	return f.Value(t, conf)
+}
+
+// Display returns a value of the field as shown in list columns: sizes and
+// rates human readable, durations like the ETA of list.
+func (f *Field) Display(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case int64:
+		switch f.Kind {
+		case KindBytes:
+			return cunits.ImportInByte(float64(v)).GetHumanSizeRepresentation()
+		case KindRate:
+			return cunits.ImportInByte(float64(v)).GetHumanSizeRepresentation() + "/s"
+		case KindDuration:
+			if v < 0 {
+				return "Unknown"
+			}
+
+			return etastr(v)
+		case KindDate:
+			if v == 0 {
+				return "never"
+			}
+
+			return time.Unix(v, 0).Format("2006-01-02 15:04")
+		}
+	}
+
+	return fmt.Sprint(value)
+}
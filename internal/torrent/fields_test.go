@@ -0,0 +1,127 @@
+package torrent_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hekmon/cunits/v2"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/torrent"
+)
+
+var update = flag.Bool("update", false, "update the variable lists in README.md")
+
+const readme = "../../README.md"
+
+// The README lists the filter variables between these lines.
+var readmeSections = []struct {
+	start, end string
+	markdown   func() string
+}{
+	{
+		"<!-- variables: generated by go test ./internal/torrent -update -->\n",
+		"<!-- end of variables -->\n",
+		torrent.FieldsMarkdown,
+	},
+	{
+		"<!-- file variables: generated by go test ./internal/torrent -update -->\n",
+		"<!-- end of file variables -->\n",
+		torrent.FileFieldsMarkdown,
+	},
+}
+
+func TestREADMEVariables(t *testing.T) {
+	content, err := ioutil.ReadFile(readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := string(content)
+	want := text
+
+	for _, section := range readmeSections {
+		start := strings.Index(want, section.start)
+		end := strings.Index(want, section.end)
+
+		if start < 0 || end < start {
+			t.Fatalf("%s has no list between %q and %q", readme, section.start, section.end)
+		}
+
+		want = want[:start+len(section.start)] + section.markdown() + want[end:]
+	}
+
+	if *update {
+		if err := ioutil.WriteFile(readme, []byte(want), 0o644); err != nil { // nolint:gosec
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	if text != want {
+		t.Errorf("the variable lists of %s are out of date, run go test ./internal/torrent -update", readme)
+	}
+}
+
+func TestFieldValueOf(t *testing.T) {
+	size := cunits.ImportInByte(1000)
+	left := int64(250)
+	uploaded := int64(3000)
+	recheck := 0.0
+	eta := int64(-1)
+	private := true
+	added := time.Unix(1600000000, 0)
+
+	bt := &backend.Torrent{
+		SizeWhenDone:    &size,
+		LeftUntilDone:   &left,
+		UploadedEver:    &uploaded,
+		RecheckProgress: &recheck,
+		Eta:             &eta,
+		IsPrivate:       &private,
+		AddedDate:       &added,
+		DoneDate:        &time.Time{},
+		Labels:          []string{"linux"},
+		TrackerStats: []*backend.TrackerStats{
+			{SeederCount: 10, LeecherCount: 1}, {SeederCount: 12, LeecherCount: 0},
+		},
+		Unsupported: map[string]bool{"queuePosition": true},
+	}
+
+	tests := []struct {
+		name    string
+		want    interface{}
+		display string
+	}{
+		{"have", int64(750), "750.00 B"},
+		{"left", int64(250), "250.00 B"},
+		{"progress", 75.0, "75.00"},
+		{"ratio", 3.0, "3.00"},
+		{"eta", int64(-1), "Unknown"},
+		{"isPrivate", true, "true"},
+		{"addedDate", int64(1600000000), time.Unix(1600000000, 0).Format("2006-01-02 15:04")},
+		{"doneDate", int64(0), "never"},
+		{"labels", []string{"linux"}, "linux"},
+		{"seeders", int64(12), "12"},
+		{"leechers", int64(1), "1"},
+		{"queuePosition", backend.Unsupported, backend.Unsupported},
+	}
+
+	for _, tt := range tests {
+		f := torrent.FieldByName(tt.name)
+		if f == nil {
+			t.Errorf("no field %s", tt.name)
+			continue
+		}
+
+		got := f.ValueOf(bt, nil)
+		if !reflect.DeepEqual(got, tt.want) || f.Display(got) != tt.display {
+			t.Errorf("%s = %v (%q), want %v (%q)", tt.name, got, f.Display(got), tt.want, tt.display)
+		}
+	}
+}
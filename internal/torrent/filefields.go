@@ -0,0 +1,106 @@
+package torrent
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/shric/trpc/internal/backend"
+)
+
+// FileField is a property of a file of a torrent, available as a variable in
+// file filter expressions.
+type FileField struct {
+	Name string
+	Kind Kind
+	// Description says what the field is, for documentation.
+	Description string
+	// Value is the value of the field for file i of a torrent, which has its
+	// files, priorities and wanted fields.
+	Value func(t *backend.Torrent, i int) interface{}
+}
+
+// FileName returns the name of a file of a torrent within the torrent, as
+// files shows it.
+func FileName(t *backend.Torrent, i int) string {
+	return strings.Replace(t.Files[i].Name, *t.Name+"/", "", 1)
+}
+
+// FileFields are the file variables of file filter expressions, in
+// alphabetical order.
+var FileFields = []*FileField{
+	{
+		Name: "bytesCompleted", Kind: KindBytes,
+		Description: "bytes of the file downloaded",
+		Value:       func(t *backend.Torrent, i int) interface{} { return t.Files[i].BytesCompleted },
+	},
+	{
+		Name: "ext", Kind: KindString,
+		Description: "extension of the file in lower case, without the dot, e.g. `nfo`",
+		Value: func(t *backend.Torrent, i int) interface{} {
+			return strings.ToLower(strings.TrimPrefix(path.Ext(t.Files[i].Name), "."))
+		},
+	},
+	{
+		Name: "length", Kind: KindBytes,
+		Description: "size of the file",
+		Value:       func(t *backend.Torrent, i int) interface{} { return t.Files[i].Length },
+	},
+	{
+		Name: "name", Kind: KindString,
+		Description: "path of the file within the torrent",
+		Value:       func(t *backend.Torrent, i int) interface{} { return FileName(t, i) },
+	},
+	{
+		Name: "priority", Kind: KindString,
+		Description: "`low`, `normal` or `high`",
+		Value: func(t *backend.Torrent, i int) interface{} {
+			if i >= len(t.Priorities) {
+				return backend.Unsupported
+			}
+
+			return FilePriority(t, int64(i))
+		},
+	},
+	{
+		Name: "progress", Kind: KindFloat,
+		Description: "percentage of the file downloaded",
+		Value:       func(t *backend.Torrent, i int) interface{} { return 100.0 * FileProgress(t, int64(i)) },
+	},
+	{
+		Name: "wanted", Kind: KindBool,
+		Description: "the file is to be downloaded",
+		Value: func(t *backend.Torrent, i int) interface{} {
+			if i >= len(t.Wanted) {
+				return backend.Unsupported
+			}
+
+			return t.Wanted[i]
+		},
+	},
+}
+
+// FileFieldsMarkdown documents the file fields as a Markdown table, for the
+// README.
+func FileFieldsMarkdown() string {
+	var b strings.Builder
+
+	b.WriteString("| Variable | Type | Description |\n|---|---|---|\n")
+
+	for _, f := range FileFields {
+		fmt.Fprintf(&b, "| `%s` | %s | %s |\n", f.Name, f.Kind, f.Description)
+	}
+
+	return b.String()
+}
+
+// FileFieldByName returns the named file field, or nil.
+func FileFieldByName(name string) *FileField {
+	for _, f := range FileFields {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	return nil
+}
@@ -9,10 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/config"
 
 	"github.com/hekmon/cunits/v2"
-	"github.com/hekmon/transmissionrpc"
 )
 
 type unitMap struct {
@@ -35,24 +35,45 @@ const (
 	EiB
 )
 
+// Constants for decimal units.
+const (
+	KB = 1000
+	MB = 1000 * KB
+	GB = 1000 * MB
+	TB = 1000 * GB
+)
+
+// Units are the sizes of the units of bytes, by symbol.
+var Units = map[string]int64{
+	"B":   1,
+	"KB":  KB,
+	"KiB": KiB,
+	"MB":  MB,
+	"MiB": MiB,
+	"GB":  GB,
+	"GiB": GiB,
+	"TB":  TB,
+	"TiB": TiB,
+}
+
 // Status returns the status of a torrent.
-func Status(torrent *transmissionrpc.Torrent) (status string, showInUpDown bool) {
+func Status(torrent *backend.Torrent) (status string, showInUpDown bool) {
 	switch *torrent.Status {
-	case transmissionrpc.TorrentStatusDownloadWait, transmissionrpc.TorrentStatusSeedWait:
+	case backend.StatusDownloadWait, backend.StatusSeedWait:
 		return "Queued", true
-	case transmissionrpc.TorrentStatusStopped:
+	case backend.StatusStopped:
 		if *torrent.IsFinished {
 			return "Finished", true
 		}
 
 		return "Stopped", true
-	case transmissionrpc.TorrentStatusCheckWait:
+	case backend.StatusCheckWait:
 		return "To Hash", true
-	case transmissionrpc.TorrentStatusCheck:
+	case backend.StatusCheck:
 		return "Hashing", true
-	case transmissionrpc.TorrentStatusIsolated:
+	case backend.StatusIsolated:
 		return "No peers", true
-	case transmissionrpc.TorrentStatusSeed, transmissionrpc.TorrentStatusDownload:
+	case backend.StatusSeed, backend.StatusDownload:
 		fromUs := *torrent.PeersGettingFromUs
 		toUs := *torrent.PeersSendingToUs
 
@@ -112,12 +133,12 @@ func (torrent Torrent) eta() string {
 }
 
 // Have returns the number of bytes downloaded so far.
-func Have(t *transmissionrpc.Torrent) int64 {
+func Have(t *backend.Torrent) int64 {
 	return int64(t.SizeWhenDone.Byte()) - *t.LeftUntilDone
 }
 
 // Progress returns the progress as a percentage of a download or hash check.
-func Progress(t *transmissionrpc.Torrent) float64 {
+func Progress(t *backend.Torrent) float64 {
 	if *t.RecheckProgress != 0 {
 		return 100.0 * *t.RecheckProgress
 	}
@@ -126,12 +147,12 @@ func Progress(t *transmissionrpc.Torrent) float64 {
 }
 
 // Ratio returns the upload/size ratio.
-func Ratio(t *transmissionrpc.Torrent) float64 {
+func Ratio(t *backend.Torrent) float64 {
 	return float64(*t.UploadedEver) / t.SizeWhenDone.Byte()
 }
 
 // Age returns the age of the torrent (the later of DoneDate and AddedDate).
-func Age(t *transmissionrpc.Torrent) int64 {
+func Age(t *backend.Torrent) int64 {
 	lastActivity := int64(math.Max(float64(t.DoneDate.Unix()), float64(t.AddedDate.Unix())))
 	now := time.Now().Unix()
 
@@ -149,7 +170,7 @@ func priorityString(priority int64) string {
 }
 
 // FileProgress returns the progress of a torrent file ([0.0..1.0]).
-func FileProgress(t *transmissionrpc.Torrent, id int64) float64 {
+func FileProgress(t *backend.Torrent, id int64) float64 {
 	bytesCompleted := t.Files[id].BytesCompleted
 
 	length := t.Files[id].Length
@@ -161,17 +182,21 @@ func FileProgress(t *transmissionrpc.Torrent, id int64) float64 {
 }
 
 // FilePriority returns the priority of a torrent file (low, medium, high).
-func FilePriority(t *transmissionrpc.Torrent, id int64) string {
+func FilePriority(t *backend.Torrent, id int64) string {
 	return priorityString(t.Priorities[id])
 }
 
 // Priority returns the priority of a torrent (low, medium, high).
-func Priority(t *transmissionrpc.Torrent) string {
+func Priority(t *backend.Torrent) string {
+	if !t.Supports("bandwidthPriority") {
+		return backend.Unsupported
+	}
+
 	return priorityString(*t.BandwidthPriority)
 }
 
 // TrackerShortName returns the configured short name of a torrent.
-func TrackerShortName(torrent *transmissionrpc.Torrent, conf *config.Config) string {
+func TrackerShortName(torrent *backend.Torrent, conf *config.Config) string {
 	if conf != nil {
 		for _, url := range torrent.Trackers {
 			for match, shortname := range conf.Trackernames {
@@ -185,12 +210,18 @@ func TrackerShortName(torrent *transmissionrpc.Torrent, conf *config.Config) str
 	return ""
 }
 
-func (torrent Torrent) trackershortname(conf *config.Config) string {
-	if tsn := TrackerShortName(torrent.original, conf); tsn != "" {
+// TrackerName returns the name list shows for the tracker of a torrent: its
+// configured short name, or the start of the host name of its first tracker.
+func TrackerName(torrent *backend.Torrent, conf *config.Config) string {
+	if tsn := TrackerShortName(torrent, conf); tsn != "" {
 		return tsn
 	}
 
-	url, err := url.Parse(torrent.original.Trackers[0].Announce)
+	if len(torrent.Trackers) == 0 {
+		return "UNK"
+	}
+
+	url, err := url.Parse(torrent.Trackers[0].Announce)
 	if err != nil {
 		return "UNK"
 	}
@@ -203,6 +234,26 @@ func (torrent Torrent) trackershortname(conf *config.Config) string {
 	return "UNK"
 }
 
+// humanSize returns a size the way list shows it: in binary units, which
+// are named like decimal ones.
+func humanSize(size cunits.Bits) (float64, string) {
+	amount, suffix := size.GetHumanSizeAndSuffix()
+
+	return amount, strings.Replace(suffix, "i", "", 1)
+}
+
+// HumanSize returns a number of bytes the way list shows sizes, e.g. "3.0 GB".
+func HumanSize(bytes int64) string {
+	amount, suffix := humanSize(cunits.ImportInByte(float64(bytes)))
+
+	return fmt.Sprintf("%.1f %s", amount, suffix)
+}
+
+// HumanRate returns a rate the way list shows it, in KiB/s.
+func HumanRate(rate int64) string {
+	return fmt.Sprintf("%.1f", float64(rate)/float64(KiB))
+}
+
 // UpdateTotal updates the Torrent carrying a total sum of torrents.
 func (torrent *Torrent) UpdateTotal(result *Torrent) {
 	*torrent.original.SizeWhenDone += result.SizeWhenDone
@@ -215,10 +266,9 @@ func (torrent *Torrent) UpdateTotal(result *Torrent) {
 	torrent.Up = fmt.Sprintf("%7.1f", torrent.up/float64(KiB))
 	torrent.Down = fmt.Sprintf("%7.1f", torrent.down/float64(KiB))
 	torrent.UploadedEver += result.UploadedEver
-	torrent.Ratio = Ratio(result.original)
+	torrent.Ratio = float64(torrent.UploadedEver) / torrent.SizeWhenDone.Byte()
 
-	torrent.Size, torrent.SizeSuffix = torrent.SizeWhenDone.GetHumanSizeAndSuffix()
-	torrent.SizeSuffix = strings.Replace(torrent.SizeSuffix, "i", "", 1)
+	torrent.Size, torrent.SizeSuffix = humanSize(torrent.SizeWhenDone)
 
 	if torrent.LeftUntilDone != 0 && torrent.down != 0 {
 		torrent.Eta = etastr(torrent.LeftUntilDone / int64(torrent.down))
@@ -231,7 +281,7 @@ func NewForTotal() *Torrent {
 	reCheckProgress := float64(0)
 	sizeWhenDone := cunits.ImportInByte(0)
 
-	t := transmissionrpc.Torrent{
+	t := backend.Torrent{
 		LeftUntilDone:   &leftUntilDone,
 		RecheckProgress: &reCheckProgress,
 		SizeWhenDone:    &sizeWhenDone,
@@ -244,17 +294,17 @@ func NewForTotal() *Torrent {
 	return torrent
 }
 
-// NewFrom takes a transmissionrpc Torrent and provides useful human readable fields.
-func NewFrom(transmissionrpcTorrent *transmissionrpc.Torrent, conf *config.Config) *Torrent {
+// NewFrom takes a backend Torrent and provides useful human readable fields.
+func NewFrom(backendTorrent *backend.Torrent, conf *config.Config) *Torrent {
 	torrent := &Torrent{
-		original:        transmissionrpcTorrent,
-		ID:              strconv.FormatInt(*transmissionrpcTorrent.ID, 10),
-		Name:            *transmissionrpcTorrent.Name,
-		SizeWhenDone:    *transmissionrpcTorrent.SizeWhenDone,
-		Status:          *transmissionrpcTorrent.Status,
-		LeftUntilDone:   *transmissionrpcTorrent.LeftUntilDone,
-		RecheckProgress: *transmissionrpcTorrent.RecheckProgress,
-		UploadedEver:    *transmissionrpcTorrent.UploadedEver,
+		original:        backendTorrent,
+		ID:              strconv.FormatInt(*backendTorrent.ID, 10),
+		Name:            *backendTorrent.Name,
+		SizeWhenDone:    *backendTorrent.SizeWhenDone,
+		Status:          *backendTorrent.Status,
+		LeftUntilDone:   *backendTorrent.LeftUntilDone,
+		RecheckProgress: *backendTorrent.RecheckProgress,
+		UploadedEver:    *backendTorrent.UploadedEver,
 		Error:           " ",
 	}
 
@@ -262,8 +312,7 @@ func NewFrom(transmissionrpcTorrent *transmissionrpc.Torrent, conf *config.Confi
 		torrent.Error = "*"
 	}
 
-	torrent.Size, torrent.SizeSuffix = torrent.SizeWhenDone.GetHumanSizeAndSuffix()
-	torrent.SizeSuffix = strings.Replace(torrent.SizeSuffix, "i", "", 1)
+	torrent.Size, torrent.SizeSuffix = humanSize(torrent.SizeWhenDone)
 
 	torrent.Pct = int64(Progress(torrent.original))
 	torrent.Eta = torrent.eta()
@@ -273,7 +322,7 @@ func NewFrom(transmissionrpcTorrent *transmissionrpc.Torrent, conf *config.Confi
 	torrent.Down = fmt.Sprintf("%7.1f", torrent.down/float64(KiB))
 	torrent.Ratio = Ratio(torrent.original)
 	torrent.Priority = Priority(torrent.original)
-	torrent.Trackershortname = torrent.trackershortname(conf)
+	torrent.Trackershortname = TrackerName(torrent.original, conf)
 
 	status, showInUpDown := Status(torrent.original)
 	if showInUpDown {
@@ -284,7 +333,7 @@ func NewFrom(transmissionrpcTorrent *transmissionrpc.Torrent, conf *config.Confi
 	return torrent
 }
 
-// Torrent contains all the fields of transmissionrpc.Torrent but with non-pointer values
+// Torrent contains all the fields of backend.Torrent but with non-pointer values
 // useful for formatted output.
 type Torrent struct {
 	ID               string
@@ -305,6 +354,6 @@ type Torrent struct {
 	LeftUntilDone    int64
 	RecheckProgress  float64
 	UploadedEver     int64
-	Status           transmissionrpc.TorrentStatus
-	original         *transmissionrpc.Torrent
+	Status           backend.Status
+	original         *backend.Torrent
 }
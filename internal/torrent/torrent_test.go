@@ -8,7 +8,7 @@ import (
 	"github.com/shric/trpc/internal/torrent"
 
 	"github.com/hekmon/cunits/v2"
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/config"
 )
 
@@ -21,11 +21,11 @@ func makeTorrent(sizeWhenDone cunits.Bits, eta int64, recheckProgress float64, l
 	RateUpload := int64(0)
 	RateDownload := int64(0)
 	BandwidthPriority := int64(0)
-	Status := transmissionrpc.TorrentStatus(0)
-	Trackers := []*transmissionrpc.Tracker{
+	Status := backend.Status(0)
+	Trackers := []*backend.Tracker{
 		{Announce: tracker},
 	}
-	trpcTorrent := transmissionrpc.Torrent{
+	trpcTorrent := backend.Torrent{
 		SizeWhenDone:      &sizeWhenDone,
 		ID:                &ID,
 		Name:              &Name,
@@ -142,3 +142,19 @@ func TestNewFromError(t *testing.T) {
 		}
 	}
 }
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0.0 B"},
+		{15 * torrent.MiB, "15.0 MB"},
+		{3*torrent.GiB + 600*torrent.MiB, "3.6 GB"},
+	}
+	for _, tc := range tests {
+		if got := torrent.HumanSize(tc.bytes); got != tc.want {
+			t.Fatalf("HumanSize(%d): expected: %v, got: %v", tc.bytes, tc.want, got)
+		}
+	}
+}
@@ -1,14 +1,11 @@
 package util
 
 import (
-	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/fileutils"
-
-	"github.com/hekmon/transmissionrpc"
 )
 
 const (
@@ -18,8 +15,8 @@ const (
 
 // Finder keeps all the state of a Finder instance returned by NewFinder.
 type Finder struct {
-	client   *transmissionrpc.Client
-	torrents map[int64]*transmissionrpc.Torrent
+	client   backend.Backend
+	torrents map[int64]*backend.Torrent
 	// First int64 is torrent ID, second int64 is file ID (-1 if a directory)
 	cache           map[string][]int64
 	incompleteDir   *string
@@ -27,14 +24,19 @@ type Finder struct {
 }
 
 // NewFinder returns an instance of Finder.
-func NewFinder(client *transmissionrpc.Client) *Finder {
+func NewFinder(client backend.Backend) (*Finder, error) {
+	incompleteDir, err := getIncompleteDir(client)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Finder{
 		client:          client,
-		torrents:        make(map[int64]*transmissionrpc.Torrent),
+		torrents:        make(map[int64]*backend.Torrent),
 		cache:           make(map[string][]int64),
-		incompleteDir:   getIncompleteDir(client),
+		incompleteDir:   incompleteDir,
 		HasDownloadDirs: false,
-	}
+	}, nil
 }
 
 func (t *Finder) insertCache(path string, torrentID int64, fileID int64) {
@@ -43,17 +45,15 @@ func (t *Finder) insertCache(path string, torrentID int64, fileID int64) {
 	t.cache[path][1] = fileID
 }
 
-func (t *Finder) getDownloadDirs() {
+func (t *Finder) getDownloadDirs() error {
 	// We only need to run this once.
 	if t.HasDownloadDirs {
-		return
+		return nil
 	}
 
 	torrents, err := t.client.TorrentGet([]string{"id", "downloadDir", "name"}, nil)
-
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return err
 	}
 
 	var realDownloadDir string
@@ -81,34 +81,38 @@ func (t *Finder) getDownloadDirs() {
 	}
 
 	t.HasDownloadDirs = true
+
+	return nil
 }
 
-// Find returns the torrent and file ID of a given file.
-func (t *Finder) Find(filename string) (*transmissionrpc.Torrent, int64) {
+// Find returns the torrent and file ID of a given file. The torrent is nil if
+// the file doesn't belong to any torrent.
+func (t *Finder) Find(filename string) (*backend.Torrent, int64, error) {
 	absFilename := fileutils.RealPath(filename)
 
 	if val, ok := t.cache[absFilename]; ok {
 		if val[1] != fileIDunknown {
-			return t.torrents[val[0]], val[1]
+			return t.torrents[val[0]], val[1], nil
 		}
 	}
 
-	t.getDownloadDirs()
+	if err := t.getDownloadDirs(); err != nil {
+		return nil, 0, err
+	}
 
 	for fullPath, pair := range t.cache {
 		if fullPath == absFilename && pair[1] != fileIDunknown {
-			return t.torrents[pair[0]], pair[1]
+			return t.torrents[pair[0]], pair[1], nil
 		}
 
 		if strings.HasPrefix(absFilename, fullPath) {
 			if fileutils.IsDirectory(absFilename) {
-				return t.torrents[t.cache[fullPath][0]], fileIDdirectory
+				return t.torrents[t.cache[fullPath][0]], fileIDdirectory, nil
 			}
 
 			torrents, err := t.client.TorrentGet([]string{"id", "downloadDir", "name", "files"}, []int64{pair[0]})
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				return nil, 0
+				return nil, 0, err
 			}
 
 			torrent := torrents[0]
@@ -119,9 +123,13 @@ func (t *Finder) Find(filename string) (*transmissionrpc.Torrent, int64) {
 				t.insertCache(fullPath, *torrent.ID, int64(i))
 			}
 
-			return t.torrents[t.cache[absFilename][0]], t.cache[absFilename][1]
+			if pair, ok := t.cache[absFilename]; ok {
+				return t.torrents[pair[0]], pair[1], nil
+			}
+
+			return nil, 0, nil
 		}
 	}
 
-	return nil, 0
+	return nil, 0, nil
 }
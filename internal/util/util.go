@@ -1,23 +1,34 @@
 package util
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/shric/trpc/internal/fileutils"
 
-	"github.com/shric/trpc/internal/torrent"
-
 	"github.com/shric/trpc/internal/config"
 
-	"github.com/hekmon/transmissionrpc"
+	"github.com/shric/trpc/internal/backend"
 	"github.com/shric/trpc/internal/filter"
 )
 
+// ErrNoTorrents is returned by ProcessTorrents when torrents were specified
+// but none of them could be found.
+var ErrNoTorrents = errors.New("no torrents found for the given arguments")
+
+// NotFoundError is returned by ProcessTorrents when some of the filenames given
+// aren't those of any torrent, once it processed the torrents that were found.
+type NotFoundError struct {
+	Names []string
+}
+
+func (e *NotFoundError) Error() string {
+	return "did not find any torrent for " + strings.Join(e.Names, ", ")
+}
+
 func getAbsoluteFnames(fnames []string) (absoluteFnames map[string]int64) {
 	absoluteFnames = make(map[string]int64)
 
@@ -29,31 +40,35 @@ func getAbsoluteFnames(fnames []string) (absoluteFnames map[string]int64) {
 	return
 }
 
-func getIncompleteDir(client *transmissionrpc.Client) *string {
-	session, err := client.SessionArgumentsGet()
+func getIncompleteDir(client backend.Backend) (*string, error) {
+	session, err := client.SessionGet()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	if !*session.IncompleteDirEnabled {
-		return nil
+	if session.IncompleteDirEnabled == nil || !*session.IncompleteDirEnabled {
+		return nil, nil
 	}
 
-	return session.IncompleteDir
+	return session.IncompleteDir, nil
 }
 
 // getids attempts to convert a list of torrent filenames to their corresponding ID
-// numbers in transmission.
-func getids(client *transmissionrpc.Client, fnames []string) []int64 {
+// numbers in transmission, returning the filenames that aren't those of any
+// torrent.
+func getids(client backend.Backend, fnames []string) ([]int64, []string, error) {
 	// Let's do no work if given an empty list as this function is expensive
 	if len(fnames) == 0 {
-		return nil
+		return nil, nil, nil
 	}
 
 	canonicalFnames := getAbsoluteFnames(fnames)
 	paths := make([]string, 1, 2)
-	incompleteDir := getIncompleteDir(client)
+
+	incompleteDir, err := getIncompleteDir(client)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if incompleteDir != nil {
 		paths = append(paths, *incompleteDir)
@@ -61,8 +76,7 @@ func getids(client *transmissionrpc.Client, fnames []string) []int64 {
 
 	torrents, err := client.TorrentGet([]string{"id", "downloadDir", "name"}, nil)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return nil
+		return nil, nil, err
 	}
 
 	var ids []int64
@@ -72,7 +86,7 @@ func getids(client *transmissionrpc.Client, fnames []string) []int64 {
 		for _, path := range paths {
 			fullpath, err := filepath.Abs(filepath.Join(path, *torrent.Name))
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
+				return nil, nil, err
 			}
 
 			if canonicalFnames[fullpath] != 0 {
@@ -82,55 +96,80 @@ func getids(client *transmissionrpc.Client, fnames []string) []int64 {
 		}
 	}
 
-	for k, v := range canonicalFnames {
-		if v == -1 {
-			fmt.Fprintln(os.Stderr, "Did not find any torrent ID for", k)
+	var missing []string
+
+	for _, fn := range fnames {
+		if canonicalFnames[fileutils.RealPath(fn)] == -1 {
+			missing = append(missing, fn)
 		}
 	}
 
-	return ids
+	return ids, missing, nil
 }
 
-func sortTorrents(torrents []*transmissionrpc.Torrent, sortField string, reverse bool) {
-	sort.SliceStable(torrents, func(i, j int) bool {
-		x := torrents[i]
-		y := torrents[j]
-		if reverse {
-			x, y = y, x
+// missingIDs returns the torrent IDs of args that aren't those of any of
+// torrents.
+func missingIDs(args []string, torrents []*backend.Torrent) []string {
+	found := make(map[int64]bool, len(torrents))
+	for _, torrent := range torrents {
+		found[*torrent.ID] = true
+	}
+
+	var missing []string
+
+	for _, arg := range args {
+		if id, err := strconv.ParseInt(arg, 10, 64); err == nil && !found[id] {
+			missing = append(missing, arg)
 		}
-		switch sortField {
-		case "age":
-			return torrent.Age(x) < torrent.Age(y)
-		case "have":
-			return torrent.Have(x) < torrent.Have(y)
-		case "id":
-			return *x.ID < *y.ID
-		case "name":
-			return strings.ToLower(*x.Name) < strings.ToLower(*y.Name)
-		case "progress":
-			return torrent.Progress(x) < torrent.Progress(y)
-		case "ratio":
-			return torrent.Ratio(x) < torrent.Ratio(y)
-		case "size":
-			return x.SizeWhenDone.Byte() < y.SizeWhenDone.Byte()
-		case "uploaded":
-			return *x.UploadedEver < *y.UploadedEver
-		default:
-			return *x.ID < *y.ID
+	}
+
+	return missing
+}
+
+// mergeFields returns the torrent-get fields of a command along with those
+// extra ones that it doesn't already ask for.
+func mergeFields(fields, extra []string) []string {
+	merged := make([]string, 0, len(fields)+len(extra))
+	seen := make(map[string]bool, len(fields)+len(extra))
+
+	for _, list := range [][]string{fields, extra} {
+		for _, field := range list {
+			if !seen[field] {
+				seen[field] = true
+				merged = append(merged, field)
+			}
 		}
-	})
+	}
+
+	return merged
 }
 
 // ProcessTorrents runs the supplied function over all torrents matching the args and filters.
-func ProcessTorrents(client *transmissionrpc.Client, filterOptions filter.Options, args []string,
-	fields []string, do func(torrent *transmissionrpc.Torrent), sortField *string, reverse bool,
-) {
+// Torrents are sorted by sortField, if given, comma separated filter expressions such as
+// "tracker,-ratio,name".
+func ProcessTorrents(client backend.Backend, filterOptions filter.Options, args []string,
+	fields []string, do func(torrent *backend.Torrent), sortField *string, reverse bool,
+) error {
 	ids := make([]int64, 0, len(args))
 
 	conf := config.ReadConfig()
-	f := filter.New(filterOptions, conf)
+	f, err := filter.New(filterOptions, conf)
+	if err != nil {
+		return err
+	}
+
+	fields = mergeFields(fields, f.Args)
+
+	var order *filter.Order
+
+	if sortField != nil {
+		order, err = filter.NewOrder(*sortField, conf)
+		if err != nil {
+			return err
+		}
 
-	fields = append(fields, f.Args...)
+		fields = mergeFields(fields, order.Args)
+	}
 
 	fnames := make([]string, 0, len(args))
 
@@ -142,28 +181,50 @@ func ProcessTorrents(client *transmissionrpc.Client, filterOptions filter.Option
 		}
 	}
 
-	ids = append(ids, getids(client, fnames)...)
+	fnameIDs, missing, err := getids(client, fnames)
+	if err != nil {
+		return err
+	}
+
+	ids = append(ids, fnameIDs...)
 	// Something was specified as args but nothing could be converted to an ID.
 	if len(ids) == 0 && len(args) > 0 {
-		os.Exit(1)
+		if len(missing) > 0 {
+			return fmt.Errorf("%w: %s", ErrNoTorrents, strings.Join(missing, ", "))
+		}
+
+		return ErrNoTorrents
 	}
 
 	torrents, err := client.TorrentGet(fields, ids)
-
-	if sortField != nil {
-		sortTorrents(torrents, *sortField, reverse)
+	if err != nil {
+		return err
 	}
 
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	missing = append(missing, missingIDs(args, torrents)...)
+
+	if order != nil {
+		if err := order.Sort(torrents, reverse); err != nil {
+			return err
+		}
 	}
 
-	for _, transmissionrpcTorrent := range torrents {
-		if !f.CheckFilter(transmissionrpcTorrent) {
+	for _, backendTorrent := range torrents {
+		match, err := f.CheckFilter(backendTorrent)
+		if err != nil {
+			return err
+		}
+
+		if !match {
 			continue
 		}
 
-		do(transmissionrpcTorrent)
+		do(backendTorrent)
 	}
+
+	if len(missing) > 0 {
+		return &NotFoundError{Names: missing}
+	}
+
+	return nil
 }
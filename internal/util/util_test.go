@@ -0,0 +1,193 @@
+package util_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shric/trpc/internal/backend"
+	"github.com/shric/trpc/internal/backend/backendtest"
+	"github.com/shric/trpc/internal/filter"
+	"github.com/shric/trpc/internal/util"
+
+	"github.com/hekmon/cunits/v2"
+)
+
+func makeTorrent(id int64, name string, size float64, left int64, status backend.Status) *backend.Torrent {
+	sizeWhenDone := cunits.ImportInByte(size)
+	zero := int64(0)
+	noRecheck := float64(0)
+	now := time.Now()
+	isFinished := false
+	downloadDir := "/data"
+	errorString := ""
+	priority := int64(0)
+
+	return &backend.Torrent{
+		ID:                 &id,
+		Name:               &name,
+		SizeWhenDone:       &sizeWhenDone,
+		LeftUntilDone:      &left,
+		RecheckProgress:    &noRecheck,
+		UploadedEver:       &zero,
+		RateUpload:         &zero,
+		RateDownload:       &zero,
+		PeersGettingFromUs: &zero,
+		PeersSendingToUs:   &zero,
+		Error:              &zero,
+		ErrorString:        &errorString,
+		BandwidthPriority:  &priority,
+		IsFinished:         &isFinished,
+		Status:             &status,
+		DownloadDir:        &downloadDir,
+		AddedDate:          &now,
+		DoneDate:           &now,
+		Trackers:           []*backend.Tracker{{Announce: "http://tracker.example/announce"}},
+	}
+}
+
+func newFake() *backendtest.Fake {
+	return &backendtest.Fake{
+		Torrents: []*backend.Torrent{
+			makeTorrent(1, "Charlie", 300, 0, backend.StatusSeed),
+			makeTorrent(2, "alpha", 100, 50, backend.StatusDownload),
+			makeTorrent(3, "Bravo", 200, 0, backend.StatusStopped),
+		},
+	}
+}
+
+func TestProcessTorrents(t *testing.T) {
+	name := "name"
+	size := "size"
+	keys := "complete,-size"
+
+	tests := []struct {
+		name      string
+		opts      filter.Options
+		args      []string
+		sortField *string
+		reverse   bool
+		want      []int64
+	}{
+		{"all", filter.Options{}, nil, nil, false, []int64{1, 2, 3}},
+		{"ids", filter.Options{}, []string{"3", "1"}, nil, false, []int64{3, 1}},
+		{"sort by name", filter.Options{}, nil, &name, false, []int64{2, 3, 1}},
+		{"sort by size reversed", filter.Options{}, nil, &size, true, []int64{1, 3, 2}},
+		{"sort by keys", filter.Options{}, nil, &keys, false, []int64{2, 1, 3}},
+		{"sort by keys reversed", filter.Options{}, nil, &keys, true, []int64{3, 1, 2}},
+		{"complete", filter.Options{Complete: true}, nil, nil, false, []int64{1, 3}},
+		{"incomplete", filter.Options{Incomplete: true}, nil, nil, false, []int64{2}},
+		{"expression", filter.Options{Filter: []string{`status == "Stopped"`}}, nil, nil, false, []int64{3}},
+		{"name regex", filter.Options{Name: "^[A-Z]"}, nil, &name, false, []int64{3, 1}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+
+			err := util.ProcessTorrents(newFake(), tt.opts, tt.args, nil, func(torrent *backend.Torrent) {
+				got = append(got, *torrent.ID)
+			}, tt.sortField, tt.reverse)
+			if err != nil {
+				t.Fatalf("ProcessTorrents() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProcessTorrents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessTorrentsFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   filter.Options
+		fields []string
+		sort   string
+		want   []string
+	}{
+		{"no filter", filter.Options{}, []string{"id", "name", "id"}, "", []string{"id", "name"}},
+		{"expression", filter.Options{Filter: []string{`downloadDir == "/data" && len(trackers) > 0`}},
+			[]string{"id"}, "", []string{"id", "downloadDir", "trackers"}},
+		{"already asked for", filter.Options{Tracker: "example", Complete: true},
+			[]string{"id", "trackers"}, "", []string{"id", "trackers", "leftUntilDone"}},
+		{"sorted", filter.Options{Complete: true}, []string{"id"}, "ratio,complete",
+			[]string{"id", "leftUntilDone", "uploadedEver", "sizeWhenDone"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		fake := newFake()
+
+		var sort *string
+		if tt.sort != "" {
+			sort = &tt.sort
+		}
+
+		err := util.ProcessTorrents(fake, tt.opts, nil, tt.fields, func(*backend.Torrent) {}, sort, false)
+		if err != nil {
+			t.Fatalf("%s: ProcessTorrents() error = %v", tt.name, err)
+		}
+
+		if !reflect.DeepEqual(fake.Fields, tt.want) {
+			t.Errorf("%s: torrent-get fields = %v, want %v", tt.name, fake.Fields, tt.want)
+		}
+	}
+}
+
+func TestProcessTorrentsErrors(t *testing.T) {
+	do := func(torrent *backend.Torrent) {}
+
+	err := util.ProcessTorrents(newFake(), filter.Options{}, []string{"/does/not/exist"}, nil, do, nil, false)
+	if !errors.Is(err, util.ErrNoTorrents) {
+		t.Errorf("unknown file: error = %v, want %v", err, util.ErrNoTorrents)
+	}
+
+	// The torrents that were found are processed, those that weren't are
+	// reported.
+	var processed []int64
+
+	err = util.ProcessTorrents(newFake(), filter.Options{}, []string{"/does/not/exist", "2", "99"}, nil,
+		func(torrent *backend.Torrent) { processed = append(processed, *torrent.ID) }, nil, false)
+
+	var notFound *util.NotFoundError
+	if !errors.As(err, &notFound) || !reflect.DeepEqual(notFound.Names, []string{"/does/not/exist", "99"}) {
+		t.Errorf("some not found: error = %v, want /does/not/exist and 99 not found", err)
+	}
+
+	if !reflect.DeepEqual(processed, []int64{2}) {
+		t.Errorf("some not found: processed %v, want [2]", processed)
+	}
+
+	fake := newFake()
+	fake.Err = errors.New("connection refused")
+
+	err = util.ProcessTorrents(fake, filter.Options{}, nil, nil, do, nil, false)
+	if err == nil || err.Error() != "connection refused" {
+		t.Errorf("backend error: error = %v, want connection refused", err)
+	}
+
+	// Expressions are checked before the daemon is asked anything.
+	var syntaxErr *filter.SyntaxError
+
+	err = util.ProcessTorrents(fake, filter.Options{Filter: []string{"size >"}}, nil, nil, do, nil, false)
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("invalid filter: error = %v, want a filter.SyntaxError", err)
+	}
+
+	err = util.ProcessTorrents(newFake(), filter.Options{Filter: []string{`size > "big"`}}, nil, nil, do, nil, false)
+	if err == nil || !strings.Contains(err.Error(), "type mismatch") {
+		t.Errorf("evaluation error: error = %v, want a type mismatch", err)
+	}
+
+	sortField := "name,nmae"
+
+	err = util.ProcessTorrents(fake, filter.Options{}, nil, nil, do, &sortField, false)
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("invalid sort key: error = %v, want a filter.SyntaxError", err)
+	}
+}